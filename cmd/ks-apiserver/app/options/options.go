@@ -109,7 +109,7 @@ func (s *APIServerOptions) NewAPIServer(ctx context.Context) (*apiserver.APIServ
 		return nil, fmt.Errorf("unable to create resource manager: %v", err)
 	}
 
-	if err := identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(ctx, apiServer.RuntimeCache); err != nil {
+	if err := identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(ctx, apiServer.RuntimeCache, apiServer.CacheClient); err != nil {
 		return nil, fmt.Errorf("unable to setup identity provider: %v", err)
 	}
 
@@ -188,4 +188,7 @@ func (s *APIServerOptions) Merge(conf *config.Config) {
 	if conf.ExperimentalOptions != nil {
 		s.ExperimentalOptions = conf.ExperimentalOptions
 	}
+	if conf.ExtensionOptions != nil {
+		s.ExtensionOptions = conf.ExtensionOptions
+	}
 }
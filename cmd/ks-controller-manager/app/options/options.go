@@ -104,6 +104,9 @@ func (s *ControllerManagerOptions) Validate() []error {
 	errs = append(errs, s.KubernetesOptions.Validate()...)
 	errs = append(errs, s.MultiClusterOptions.Validate()...)
 	errs = append(errs, s.ComposedAppOptions.Validate()...)
+	if s.ExtensionOptions != nil {
+		errs = append(errs, s.ExtensionOptions.Validate()...)
+	}
 
 	// genetic option: controllers, check all selectors are valid
 	allControllersNameSet := sets.KeySet(controller.Controllers)
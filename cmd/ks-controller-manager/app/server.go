@@ -71,6 +71,7 @@ func init() {
 	runtime.Must(controller.Register(&extension.JSBundleWebhook{}))
 	runtime.Must(controller.Register(&extension.APIServiceWebhook{}))
 	runtime.Must(controller.Register(&extension.ReverseProxyWebhook{}))
+	runtime.Must(controller.Register(&extension.ReverseProxyReconciler{}))
 	runtime.Must(controller.Register(&extension.ExtensionEntryWebhook{}))
 	// rbac
 	runtime.Must(controller.Register(&globalrole.Reconciler{}))
@@ -19,6 +19,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	urlruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	k8sversion "k8s.io/apimachinery/pkg/version"
 	unionauth "k8s.io/apiserver/pkg/authentication/request/union"
 	"k8s.io/klog/v2"
@@ -49,8 +50,10 @@ import (
 	"kubesphere.io/kubesphere/pkg/apiserver/options"
 	"kubesphere.io/kubesphere/pkg/apiserver/request"
 	"kubesphere.io/kubesphere/pkg/apiserver/rest"
+	"kubesphere.io/kubesphere/pkg/controller/core"
 	openapicontroller "kubesphere.io/kubesphere/pkg/controller/openapi"
 	appv2 "kubesphere.io/kubesphere/pkg/kapis/application/v2"
+	auditingv1alpha1 "kubesphere.io/kubesphere/pkg/kapis/auditing/v1alpha1"
 	clusterkapisv1alpha1 "kubesphere.io/kubesphere/pkg/kapis/cluster/v1alpha1"
 	configv1alpha2 "kubesphere.io/kubesphere/pkg/kapis/config/v1alpha2"
 	gatewayv1alpha2 "kubesphere.io/kubesphere/pkg/kapis/gateway/v1alpha2"
@@ -168,26 +171,35 @@ func (s *APIServer) installKubeSphereAPIs() {
 	imOperator := im.NewOperator(s.RuntimeClient, s.ResourceManager, s.AuthenticationOptions)
 	amOperator := am.NewOperator(s.ResourceManager)
 	rbacAuthorizer := rbac.NewRBACAuthorizer(amOperator)
+	totpAuthenticator := auth.NewTOTPAuthenticator(s.RuntimeClient, s.AuthenticationOptions)
+	loginRecorder := auth.NewLoginRecorder(s.RuntimeClient)
 	counter := overviewclient.New(s.RuntimeClient)
 	counter.RegisterResource(overviewclient.NewDefaultRegisterOptions(s.K8sVersion)...)
+	var portalURL string
+	if s.AuthenticationOptions != nil && s.AuthenticationOptions.Issuer != nil {
+		portalURL = s.AuthenticationOptions.Issuer.URL
+	}
+	dryRunner, err := core.NewDryRunner(s.RuntimeClient, s.ClusterClient, s.K8sClient.Config(), portalURL, s.ExtensionOptions)
+	urlruntime.Must(err)
 
 	handlers := []rest.Handler{
 		configv1alpha2.NewHandler(&s.Options, s.RuntimeClient),
-		resourcev1alpha3.NewHandler(s.RuntimeCache, counter, s.K8sVersion),
+		resourcev1alpha3.NewHandler(s.RuntimeCache, counter, s.K8sVersion, s.ClusterClient, rbacAuthorizer),
 		operationsv1alpha2.NewHandler(s.RuntimeClient),
 		resourcesv1alpha2.NewHandler(s.RuntimeClient, s.K8sVersion, s.K8sClient.Master(), s.TerminalOptions),
 		tenantapiv1alpha3.NewHandler(s.RuntimeClient, s.K8sVersion, s.ClusterClient, amOperator, imOperator, rbacAuthorizer),
 		tenantapiv1beta1.NewHandler(s.RuntimeClient, s.K8sVersion, s.ClusterClient, amOperator, imOperator, rbacAuthorizer, counter),
 		terminalv1alpha2.NewHandler(s.K8sClient, rbacAuthorizer, s.K8sClient.Config(), s.TerminalOptions),
 		clusterkapisv1alpha1.NewHandler(s.RuntimeClient),
-		iamapiv1beta1.NewHandler(imOperator, amOperator),
+		iamapiv1beta1.NewHandler(imOperator, amOperator, totpAuthenticator, s.TokenOperator, loginRecorder),
 		oauth.NewHandler(imOperator, s.TokenOperator, auth.NewPasswordAuthenticator(s.RuntimeClient, s.AuthenticationOptions),
 			auth.NewOAuthAuthenticator(s.RuntimeClient),
-			auth.NewLoginRecorder(s.RuntimeClient), s.AuthenticationOptions,
+			loginRecorder, totpAuthenticator, auth.NewDeviceAuthorizer(s.CacheClient), s.AuthenticationOptions,
 			oauth2.NewOAuthClientGetter(s.RuntimeClient)),
 		version.NewHandler(s.K8sVersionInfo),
-		packagev1alpha1.NewHandler(s.RuntimeCache),
+		packagev1alpha1.NewHandler(s.RuntimeCache, s.RuntimeClient, dryRunner),
 		gatewayv1alpha2.NewHandler(s.RuntimeCache),
+		auditingv1alpha1.NewHandler(s.AuditingOptions, s.TokenOperator.Keys()),
 		appv2.NewHandler(s.RuntimeClient, s.ClusterClient, s.S3Options),
 		workloadtemplatev1alpha1.NewHandler(s.RuntimeClient, s.K8sVersion, rbacAuthorizer),
 		static.NewHandler(s.CacheClient),
@@ -248,16 +260,25 @@ func (s *APIServer) buildHandlerChain(handler http.Handler, stopCh <-chan struct
 			clusterv1alpha1.Resource(clusterv1alpha1.ResourcesPluralLabel),
 			resourcev1alpha3.Resource(clusterv1alpha1.ResourcesPluralCluster),
 			resourcev1alpha3.Resource(clusterv1alpha1.ResourcesPluralLabel),
+			resourcev1alpha3.Resource(resourcev1alpha3.ResourcesPluralMultiClusterResource),
 		},
 	}
 
 	handler = filters.WithKubeAPIServer(handler, s.K8sClient.Config(), s.ExperimentalOptions)
-	handler = filters.WithAPIService(handler, s.RuntimeCache)
-	handler = filters.WithReverseProxy(handler, s.RuntimeCache)
+	routingTable, err := filters.NewRoutingTable(wait.ContextForChannel(stopCh), s.RuntimeCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create routing table: %w", err)
+	}
+	handler = filters.WithAPIService(handler, routingTable)
+	handler = filters.WithReverseProxy(handler, routingTable)
 	handler = filters.WithJSBundle(handler, s.RuntimeCache)
 
 	if s.AuditingOptions.Enable {
-		handler = filters.WithAuditing(handler, auditing.NewAuditing(s.K8sClient, s.AuditingOptions, stopCh))
+		auditor, err := auditing.NewAuditing(s.K8sClient, s.RuntimeCache, s.TokenOperator.Keys(), s.AuditingOptions, stopCh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create auditing: %w", err)
+		}
+		handler = filters.WithAuditing(handler, auditor)
 	}
 
 	var authorizers authorizer.Authorizer
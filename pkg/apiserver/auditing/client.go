@@ -16,24 +16,30 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/modern-go/reflect2"
 	v1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/apis/audit"
 	"k8s.io/apiserver/pkg/endpoints/responsewriter"
 	"k8s.io/klog/v2"
 	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
 	"kubesphere.io/api/iam/v1beta1"
+	runtimecache "sigs.k8s.io/controller-runtime/pkg/cache"
 
 	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
 	"kubesphere.io/kubesphere/pkg/apiserver/auditing/log"
 	"kubesphere.io/kubesphere/pkg/apiserver/auditing/webhook"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
 	"kubesphere.io/kubesphere/pkg/apiserver/request"
 	"kubesphere.io/kubesphere/pkg/constants"
 	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
@@ -56,11 +62,23 @@ type Auditing interface {
 
 type auditing struct {
 	k8sClient  k8s.Client
+	cache      runtimecache.Cache
 	stopCh     <-chan struct{}
 	auditLevel audit.Level
 	events     chan *Event
 	backend    []internal.Backend
 
+	// overflow holds the events which can not be cached in time when the batching falls behind,
+	// it is bounded by DefaultCacheCapacity and drained in batches by Start.
+	overflowLock sync.Mutex
+	overflow     []*Event
+
+	// staticPolicy is the policy from the startup options, used when no policy can be loaded on the fly.
+	staticPolicy    *Policy
+	policyConfigMap string
+	// evaluator holds the PolicyRuleEvaluator of the current policy.
+	evaluator atomic.Value
+
 	hostname string
 	hostIP   string
 	cluster  string
@@ -69,12 +87,15 @@ type auditing struct {
 	eventBatchInterval time.Duration
 }
 
-func NewAuditing(kubernetesClient k8s.Client, opts *Options, stopCh <-chan struct{}) Auditing {
+func NewAuditing(kubernetesClient k8s.Client, cache runtimecache.Cache, keys *token.Keys, opts *Options, stopCh <-chan struct{}) (Auditing, error) {
 
 	a := &auditing{
 		k8sClient:          kubernetesClient,
+		cache:              cache,
 		stopCh:             stopCh,
 		auditLevel:         opts.AuditLevel,
+		staticPolicy:       opts.Policy,
+		policyConfigMap:    opts.PolicyConfigMap,
 		events:             make(chan *Event, DefaultCacheCapacity),
 		hostname:           os.Getenv("HOSTNAME"),
 		hostIP:             getHostIP(),
@@ -92,21 +113,71 @@ func NewAuditing(kubernetesClient k8s.Client, opts *Options, stopCh <-chan struc
 
 	a.cluster = a.getClusterName()
 
+	a.setPolicy(a.staticPolicy)
+	if cache != nil {
+		if err := a.WatchPolicyChanges(wait.ContextForChannel(stopCh), cache); err != nil {
+			klog.Errorf("failed to watch audit policy changes: %s", err)
+		}
+	}
+
+	internal.RegisterMetrics()
+
 	if opts.WebhookOptions.WebhookUrl != "" {
-		a.backend = append(a.backend, webhook.NewBackend(opts.WebhookOptions.WebhookUrl,
-			opts.WebhookOptions.EventSendersNum))
+		b, err := webhook.NewBackend(&webhook.Config{
+			URL: opts.WebhookOptions.WebhookUrl,
+			TLSConfig: internal.TLSConfig{
+				CAFile:             opts.WebhookOptions.CAFile,
+				CertFile:           opts.WebhookOptions.CertFile,
+				KeyFile:            opts.WebhookOptions.KeyFile,
+				InsecureSkipVerify: opts.WebhookOptions.InsecureSkipVerify,
+			},
+			DeliveryConfig: internal.DeliveryConfig{
+				SpoolDir:     opts.WebhookOptions.SpoolDir,
+				SpoolMaxSize: opts.WebhookOptions.SpoolMaxSize,
+				MaxBackoff:   opts.WebhookOptions.MaxBackoff,
+				BatchSize:    a.eventBatchSize,
+			},
+		}, stopCh)
+		if err != nil {
+			klog.Errorf("create auditing webhook backend error, %s", err)
+		} else {
+			a.backend = append(a.backend, b)
+		}
+	}
+
+	for _, backendOptions := range opts.Backends {
+		b, err := internal.NewBackend(backendOptions.Type, backendOptions.Options, stopCh)
+		if err != nil {
+			klog.Errorf("create auditing %s backend error, %s", backendOptions.Type, err)
+			continue
+		}
+		a.backend = append(a.backend, b)
 	}
 
 	if opts.LogOptions.Path != "" {
-		a.backend = append(a.backend, log.NewBackend(opts.LogOptions.Path,
+		var chainConfig *log.ChainConfig
+		if opts.LogOptions.HashChain {
+			chainConfig = &log.ChainConfig{Keys: keys}
+		}
+		b, err := log.NewBackend(opts.LogOptions.Path,
 			opts.LogOptions.MaxAge,
 			opts.LogOptions.MaxBackups,
-			opts.LogOptions.MaxSize))
+			opts.LogOptions.MaxSize,
+			chainConfig)
+		switch {
+		case err == nil:
+			a.backend = append(a.backend, b)
+		case chainConfig != nil:
+			// The tamper-evident audit log must not be turned off silently.
+			return nil, err
+		default:
+			klog.Errorf("create auditing log backend error, %s", err)
+		}
 	}
 
 	go a.Start()
 
-	return a
+	return a, nil
 }
 
 func getHostIP() string {
@@ -140,18 +211,16 @@ func (a *auditing) getClusterName() string {
 	return ""
 }
 
-func (a *auditing) getAuditLevel() audit.Level {
-	if a.auditLevel != "" {
-		return a.auditLevel
-	}
+func (a *auditing) setPolicy(policy *Policy) {
+	a.evaluator.Store(NewPolicyRuleEvaluator(policy, a.auditLevel))
+}
 
-	return audit.LevelMetadata
+func (a *auditing) getPolicyRuleEvaluator() PolicyRuleEvaluator {
+	return a.evaluator.Load().(PolicyRuleEvaluator)
 }
 
 func (a *auditing) Enabled() bool {
-
-	level := a.getAuditLevel()
-	return !level.Less(audit.LevelMetadata)
+	return a.getPolicyRuleEvaluator().Enabled()
 }
 
 // If the request is not a standard request, or a resource request,
@@ -184,7 +253,6 @@ func (a *auditing) LogRequestObject(req *http.Request, info *request.RequestInfo
 		Event: audit.Event{
 			RequestURI:               info.Path,
 			Verb:                     info.Verb,
-			Level:                    a.getAuditLevel(),
 			AuditID:                  types.UID(uuid.New().String()),
 			Stage:                    audit.StageResponseComplete,
 			ImpersonatedUser:         nil,
@@ -220,6 +288,27 @@ func (a *auditing) LogRequestObject(req *http.Request, info *request.RequestInfo
 		}
 	}
 
+	attrs := &Attributes{
+		RequestInfo: info,
+		User:        user,
+		Workspace:   e.Workspace,
+		Cluster:     info.Cluster,
+		ResolveWorkspace: func() string {
+			a.getWorkspace(e)
+			return e.Workspace
+		},
+	}
+	if attrs.Cluster == "" {
+		attrs.Cluster = a.cluster
+	}
+	auditConfig := a.getPolicyRuleEvaluator().EvaluatePolicyRule(attrs)
+	if auditConfig.Omitted(audit.StageResponseComplete) {
+		return nil
+	}
+	e.Level = auditConfig.Level
+	// The workspace is only resolved for the events to be emitted.
+	a.getWorkspace(e)
+
 	if a.needAnalyzeRequestBody(e, req) {
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
@@ -239,6 +328,8 @@ func (a *auditing) LogRequestObject(req *http.Request, info *request.RequestInfo
 			if err := json.Unmarshal(body, obj); err == nil {
 				e.ObjectRef.Name = obj.Name
 			}
+			// The name of the created namespace is only known from the request body.
+			a.getWorkspace(e)
 		}
 
 		// for recording disable and enable user
@@ -254,8 +345,6 @@ func (a *auditing) LogRequestObject(req *http.Request, info *request.RequestInfo
 		}
 	}
 
-	a.getWorkspace(e)
-
 	return e
 }
 
@@ -268,19 +357,19 @@ func (a *auditing) getWorkspace(e *Event) {
 	if e.ObjectRef.Resource == "namespaces" {
 		ns = e.ObjectRef.Name
 	}
-	if ns == "" {
+	if ns == "" || a.cache == nil {
 		return
 	}
 
-	namespace, err := a.k8sClient.CoreV1().Namespaces().Get(context.Background(), ns, metav1.GetOptions{})
-	if err != nil && !apierrors.IsNotFound(err) {
-		klog.Errorf("get %s error: %s", ns, err)
+	// The namespaces are read from the informer cache, so that the requests do not wait for the API server.
+	namespace := &corev1.Namespace{}
+	if err := a.cache.Get(context.Background(), types.NamespacedName{Name: ns}, namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Errorf("get %s error: %s", ns, err)
+		}
 		return
 	}
-
-	if namespace.Labels != nil {
-		e.Workspace = namespace.Labels[constants.WorkspaceLabelKey]
-	}
+	e.Workspace = namespace.Labels[constants.WorkspaceLabelKey]
 }
 
 func (a *auditing) needAnalyzeRequestBody(e *Event, req *http.Request) bool {
@@ -322,33 +411,59 @@ func (a *auditing) cacheEvent(e Event) {
 		return
 	case <-time.After(CacheTimeout):
 		klog.V(8).Infof("cache audit event %s timeout", e.AuditID)
-		break
+		a.overflowLock.Lock()
+		defer a.overflowLock.Unlock()
+		if len(a.overflow) >= DefaultCacheCapacity {
+			internal.EventsDropped.WithLabelValues("", internal.DropReasonCacheFull).Inc()
+			return
+		}
+		a.overflow = append(a.overflow, &e)
 	}
 }
 
 func (a *auditing) Start() {
 	for {
 		events, exit := a.getEvents()
+		// The batch being collected is handed over to the backends on shutdown.
+		a.processEvents(events)
+		a.processOverflow()
 		if exit {
 			break
 		}
+	}
+}
 
-		if len(events) == 0 {
-			continue
-		}
+// processOverflow hands over the overflowed events to the backends in batches,
+// so that the spooling backends do not sync the spool for every single event.
+func (a *auditing) processOverflow() {
+	a.overflowLock.Lock()
+	events := a.overflow
+	a.overflow = nil
+	a.overflowLock.Unlock()
+
+	for len(events) > 0 {
+		n := min(len(events), a.eventBatchSize)
+		a.processEvents(events[:n])
+		events = events[n:]
+	}
+}
 
-		byteEvents := a.eventToBytes(events)
-		if len(byteEvents) == 0 {
-			continue
-		}
+func (a *auditing) processEvents(events []*Event) {
+	if len(events) == 0 {
+		return
+	}
 
-		for _, b := range a.backend {
-			if reflect2.IsNil(b) {
-				continue
-			}
+	byteEvents := a.eventToBytes(events)
+	if len(byteEvents) == 0 {
+		return
+	}
 
-			b.ProcessEvents(byteEvents...)
+	for _, b := range a.backend {
+		if reflect2.IsNil(b) {
+			continue
 		}
+
+		b.ProcessEvents(byteEvents...)
 	}
 }
 
@@ -370,7 +485,15 @@ func (a *auditing) getEvents() ([]*Event, bool) {
 		case <-ctx.Done():
 			return events, false
 		case <-a.stopCh:
-			return nil, true
+			// Drain the cached events, so that they are not lost on shutdown.
+			for {
+				select {
+				case event := <-a.events:
+					events = append(events, event)
+				default:
+					return events, true
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecorder) ProcessEvents(events ...[]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, len(events))
+}
+
+func TestCacheEventOverflow(t *testing.T) {
+	stopCh := make(chan struct{})
+	recorder := &batchRecorder{}
+	a := &auditing{
+		stopCh:             stopCh,
+		events:             make(chan *Event, 1),
+		backend:            []internal.Backend{recorder},
+		eventBatchSize:     3,
+		eventBatchInterval: time.Minute,
+	}
+
+	newEvent := func(i int) Event {
+		return Event{Event: audit.Event{AuditID: types.UID(fmt.Sprintf("event-%d", i))}}
+	}
+	// the channel is full, the events are kept in the overflow buffer after the cache timeout
+	a.cacheEvent(newEvent(0))
+	var wg sync.WaitGroup
+	for i := 1; i <= 7; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a.cacheEvent(newEvent(i))
+		}(i)
+	}
+	wg.Wait()
+	if len(recorder.batches) != 0 {
+		t.Fatalf("expected the overflowed events to be delivered by Start, got batches %v", recorder.batches)
+	}
+
+	close(stopCh)
+	a.Start()
+	if expected := []int{1, 3, 3, 1}; !reflect.DeepEqual(recorder.batches, expected) {
+		t.Fatalf("expected batches %v, got %v", expected, recorder.batches)
+	}
+}
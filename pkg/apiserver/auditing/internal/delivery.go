@@ -0,0 +1,345 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultDeliveryBatchSize = 100
+	DefaultMaxBackoff        = time.Minute
+	InitialBackoff           = time.Second
+
+	// deadLetterFile is the file in the spool directory which keeps the events rejected permanently.
+	deadLetterFile = "dead-letter"
+	// MaxDeadLetterSize is the max size in bytes of the dead letter file, the rejected events are dropped
+	// once it is exceeded.
+	MaxDeadLetterSize = 64 * 1024 * 1024
+)
+
+// SendFunc delivers a batch of serialized events to the destination of a backend.
+// The error wrapped by Permanent is not retried.
+type SendFunc func(events [][]byte) error
+
+// PermanentError is a delivery error which will not be resolved by retrying, e.g. the events are rejected
+// as malformed or too large by the destination.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a PermanentError.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// PermanentStatus reports whether the events are rejected by an HTTP destination with the status code. The client
+// errors are not retried except the ones caused by the credentials, the routing or the throttling.
+func PermanentStatus(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError
+}
+
+// IsPermanent reports whether err is a PermanentError.
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// DeliveryConfig is the configuration of the reliable delivery shared by the remote backends.
+type DeliveryConfig struct {
+	// SpoolDir is the directory of the on-disk spool, undelivered events survive
+	// restarts of ks-apiserver. If empty, events are spooled in memory.
+	SpoolDir string `json:"spoolDir,omitempty" yaml:"spoolDir,omitempty" mapstructure:"spoolDir"`
+	// SpoolMaxSize is the max size in megabytes of the on-disk spool, the oldest events
+	// are dropped once it is exceeded.
+	SpoolMaxSize int `json:"spoolMaxSize,omitempty" yaml:"spoolMaxSize,omitempty" mapstructure:"spoolMaxSize"`
+	// MaxBackoff is the max interval between two retries.
+	MaxBackoff time.Duration `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty" mapstructure:"maxBackoff"`
+	// BatchSize is the max number of events delivered at once.
+	BatchSize int `json:"batchSize,omitempty" yaml:"batchSize,omitempty" mapstructure:"batchSize"`
+}
+
+var (
+	// spoolDirs are the directories of the on-disk spools in use, a spool directory can not be shared by backends.
+	spoolDirs      = make(map[string]string)
+	spoolDirsMutex sync.Mutex
+)
+
+// claimSpoolDir reserves dir for the backend, the reservation is released by releaseSpoolDir.
+func claimSpoolDir(name, dir string) (string, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	spoolDirsMutex.Lock()
+	defer spoolDirsMutex.Unlock()
+	if owner, ok := spoolDirs[path]; ok {
+		return "", fmt.Errorf("auditing spool %s is already used by backend %s", dir, owner)
+	}
+	spoolDirs[path] = name
+	return path, nil
+}
+
+func releaseSpoolDir(path string) {
+	spoolDirsMutex.Lock()
+	defer spoolDirsMutex.Unlock()
+	delete(spoolDirs, path)
+}
+
+type reliableBackend struct {
+	name      string
+	send      SendFunc
+	spool     Spool
+	batchSize int
+	backoff   wait.Backoff
+	// deadLetterPath is the file keeping the events rejected permanently, they are dropped if it is empty.
+	deadLetterPath string
+	// notifyCh wakes up the sender when events are spooled
+	notifyCh chan struct{}
+}
+
+// NewReliableBackend creates a Backend which delivers events at least once,
+// events are spooled first and then delivered in order with send, failed
+// deliveries are retried with exponential backoff until stopCh is closed.
+// The events rejected permanently are saved to the dead letter file of the
+// on-disk spool, so that they do not block the following events.
+func NewReliableBackend(name string, config *DeliveryConfig, send SendFunc, stopCh <-chan struct{}) (Backend, error) {
+	b := &reliableBackend{
+		name:      name,
+		send:      send,
+		batchSize: config.BatchSize,
+		notifyCh:  make(chan struct{}, 1),
+	}
+
+	if b.batchSize <= 0 {
+		b.batchSize = DefaultDeliveryBatchSize
+	}
+
+	maxBackoff := config.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	b.backoff = wait.Backoff{
+		Duration: InitialBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      maxBackoff,
+	}
+
+	if config.SpoolDir != "" {
+		spoolDir, err := claimSpoolDir(name, config.SpoolDir)
+		if err != nil {
+			return nil, err
+		}
+		if b.spool, err = NewDiskSpool(config.SpoolDir, config.SpoolMaxSize); err != nil {
+			releaseSpoolDir(spoolDir)
+			return nil, fmt.Errorf("failed to open auditing spool %s: %s", config.SpoolDir, err)
+		}
+		b.deadLetterPath = filepath.Join(spoolDir, deadLetterFile)
+		go func() {
+			<-stopCh
+			releaseSpoolDir(spoolDir)
+		}()
+	} else {
+		b.spool = NewMemorySpool(DefaultMemorySpoolCapacity)
+	}
+
+	go b.run(stopCh)
+
+	return b, nil
+}
+
+func (b *reliableBackend) ProcessEvents(events ...[]byte) {
+	dropped, err := b.spool.Append(events...)
+	if err != nil {
+		klog.Errorf("spool auditing events of backend %s error, %s", b.name, err)
+		EventsDropped.WithLabelValues(b.name, DropReasonSpoolError).Add(float64(len(events)))
+		return
+	}
+	if dropped > 0 {
+		klog.Warningf("auditing spool of backend %s is full, dropped %d events", b.name, dropped)
+		EventsDropped.WithLabelValues(b.name, DropReasonSpoolFull).Add(float64(dropped))
+	}
+
+	select {
+	case b.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the spooled events until stopCh is closed.
+func (b *reliableBackend) run(stopCh <-chan struct{}) {
+	backoff := b.backoff
+	for {
+		events, err := b.spool.Peek(b.batchSize)
+		if err != nil {
+			klog.Errorf("read auditing spool of backend %s error, %s", b.name, err)
+		}
+
+		if len(events) == 0 {
+			select {
+			case <-stopCh:
+				return
+			case <-b.notifyCh:
+			}
+			continue
+		}
+
+		err = b.send(events)
+		// Find out the events rejected permanently, the others in the batch are still delivered.
+		if IsPermanent(err) && len(events) > 1 {
+			err = b.sendEach(events)
+		} else {
+			b.done(events, err)
+		}
+		if err != nil && !IsPermanent(err) {
+			klog.Errorf("send audit events to backend %s error, %s", b.name, err)
+			EventsRetried.WithLabelValues(b.name).Add(float64(len(events)))
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(backoff.Step()):
+			}
+			continue
+		}
+		backoff = b.backoff
+	}
+}
+
+// sendEach delivers the events one by one, it returns the first error to be retried.
+func (b *reliableBackend) sendEach(events [][]byte) error {
+	for _, event := range events {
+		err := b.send([][]byte{event})
+		if err != nil && !IsPermanent(err) {
+			return err
+		}
+		b.done([][]byte{event}, err)
+	}
+	return nil
+}
+
+// done removes the events from the spool once they are delivered or rejected permanently.
+func (b *reliableBackend) done(events [][]byte, err error) {
+	switch {
+	case err == nil:
+		EventsDelivered.WithLabelValues(b.name).Add(float64(len(events)))
+	case IsPermanent(err):
+		klog.Errorf("audit events are rejected by backend %s, %s", b.name, err)
+		b.deadLetter(events)
+	default:
+		return
+	}
+	if err := b.spool.Commit(len(events)); err != nil {
+		klog.Errorf("commit auditing spool of backend %s error, %s", b.name, err)
+	}
+}
+
+// deadLetter saves the events rejected permanently, they are dropped if the spool is not on disk
+// or the dead letter file is full.
+func (b *reliableBackend) deadLetter(events [][]byte) {
+	if b.deadLetterPath == "" {
+		EventsDropped.WithLabelValues(b.name, DropReasonRejected).Add(float64(len(events)))
+		return
+	}
+	if err := appendDeadLetter(b.deadLetterPath, events); err != nil {
+		klog.Errorf("save the rejected audit events of backend %s error, %s", b.name, err)
+		EventsDropped.WithLabelValues(b.name, DropReasonRejected).Add(float64(len(events)))
+		return
+	}
+	EventsDeadLettered.WithLabelValues(b.name).Add(float64(len(events)))
+}
+
+func appendDeadLetter(path string, events [][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(event)
+		buf.WriteByte('\n')
+	}
+	if info.Size()+int64(buf.Len()) > MaxDeadLetterSize {
+		return fmt.Errorf("dead letter file %s is full", path)
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// TLSConfig is the TLS configuration of a remote backend.
+type TLSConfig struct {
+	// CAFile is the CA bundle used to verify the certificate of the server,
+	// the system roots are used if it is empty.
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty" mapstructure:"caFile"`
+	// CertFile and KeyFile are the client certificate for mTLS.
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty" mapstructure:"certFile"`
+	KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty" mapstructure:"keyFile"`
+	// InsecureSkipVerify skips the verification of the server certificate.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty" mapstructure:"insecureSkipVerify"`
+}
+
+// NewTLSConfig creates a tls.Config from the TLSConfig.
+func NewTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CAFile != "" {
+		ca, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificate found in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReliableBackendPermanentError(t *testing.T) {
+	var mutex sync.Mutex
+	var delivered []string
+	failures := 1
+	send := func(events [][]byte) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("connection refused")
+		}
+		for _, event := range events {
+			if string(event) == `{"AuditID":"too-large"}` {
+				return Permanent(errors.New("request entity too large"))
+			}
+		}
+		for _, event := range events {
+			delivered = append(delivered, string(event))
+		}
+		return nil
+	}
+
+	dir := t.TempDir()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	b, err := NewReliableBackend("test", &DeliveryConfig{SpoolDir: dir}, send, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ProcessEvents([]byte(`{"AuditID":"1"}`), []byte(`{"AuditID":"too-large"}`), []byte(`{"AuditID":"2"}`))
+
+	// The rejected event is dead-lettered, the others in the batch are still delivered in order.
+	expected := []string{`{"AuditID":"1"}`, `{"AuditID":"2"}`}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mutex.Lock()
+		done := slices.Equal(delivered, expected)
+		mutex.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected delivered events %q, got %q", expected, delivered)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, deadLetterFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{\"AuditID\":\"too-large\"}\n" {
+		t.Fatalf("unexpected dead letters %q", data)
+	}
+}
+
+func TestPermanentStatus(t *testing.T) {
+	for code, expected := range map[int]bool{400: true, 413: true, 401: false, 429: false, 503: false} {
+		if PermanentStatus(code) != expected {
+			t.Errorf("expected status %d permanent %t", code, expected)
+		}
+	}
+}
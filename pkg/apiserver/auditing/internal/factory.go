@@ -0,0 +1,54 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+
+	"kubesphere.io/kubesphere/pkg/server/options"
+)
+
+var (
+	backendFactories = make(map[string]BackendFactory)
+)
+
+type BackendFactory interface {
+	// Type unique type of the backend
+	Type() string
+	// Create relevant backend by type
+	Create(options options.DynamicOptions, stopCh <-chan struct{}) (Backend, error)
+}
+
+// RegisterBackendFactory registers BackendFactory with the specified type
+func RegisterBackendFactory(factory BackendFactory) {
+	backendFactories[factory.Type()] = factory
+}
+
+// NewBackend creates a backend with the factory registered for the type.
+func NewBackend(backendType string, options options.DynamicOptions, stopCh <-chan struct{}) (Backend, error) {
+	factory, ok := backendFactories[backendType]
+	if !ok {
+		return nil, fmt.Errorf("auditing backend with type %s is not supported", backendType)
+	}
+	return factory.Create(options, stopCh)
+}
+
+// DecodeOptions decodes the dynamic options of a backend into out,
+// durations can be given as strings like "30s".
+func DecodeOptions(options options.DynamicOptions, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(map[string]interface{}(options))
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"sync"
+
+	componentbasemetrics "k8s.io/component-base/metrics"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/metrics"
+)
+
+const (
+	DropReasonCacheFull  = "cache_full"
+	DropReasonSpoolFull  = "spool_full"
+	DropReasonSpoolError = "spool_error"
+	DropReasonRejected   = "rejected"
+)
+
+var (
+	registerOnce sync.Once
+
+	EventsDelivered = componentbasemetrics.NewCounterVec(
+		&componentbasemetrics.CounterOpts{
+			Name:           "ks_auditing_events_delivered_total",
+			Help:           "Counter of auditing events delivered by each backend.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"backend"},
+	)
+
+	EventsRetried = componentbasemetrics.NewCounterVec(
+		&componentbasemetrics.CounterOpts{
+			Name:           "ks_auditing_events_retried_total",
+			Help:           "Counter of auditing events which failed to be delivered and will be retried, broken out for each backend.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"backend"},
+	)
+
+	EventsDeadLettered = componentbasemetrics.NewCounterVec(
+		&componentbasemetrics.CounterOpts{
+			Name:           "ks_auditing_events_dead_lettered_total",
+			Help:           "Counter of auditing events rejected permanently and saved to the dead letter file, broken out for each backend.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"backend"},
+	)
+
+	EventsDropped = componentbasemetrics.NewCounterVec(
+		&componentbasemetrics.CounterOpts{
+			Name:           "ks_auditing_events_dropped_total",
+			Help:           "Counter of auditing events dropped, broken out for each backend and reason.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"backend", "reason"},
+	)
+)
+
+// RegisterMetrics registers the auditing metrics to the ks-apiserver metrics registry.
+func RegisterMetrics() {
+	registerOnce.Do(func() {
+		metrics.Registry.MustRegister(EventsDelivered, EventsRetried, EventsDeadLettered, EventsDropped)
+	})
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+
+	// DefaultSegmentSize is the size in bytes after which a new spool segment is started.
+	DefaultSegmentSize = 8 * 1024 * 1024
+	// DefaultSpoolMaxSize is the default max size in megabytes of the spool.
+	DefaultSpoolMaxSize = 512
+	// DefaultMemorySpoolCapacity is the max number of events held in the memory spool.
+	DefaultMemorySpoolCapacity = 10000
+)
+
+// Spool is a FIFO queue of auditing events waiting to be delivered.
+type Spool interface {
+	// Append adds events to the tail of the spool, it returns the number of
+	// events dropped to keep the spool within its bounds.
+	Append(events ...[]byte) (dropped int, err error)
+	// Peek returns up to max events from the head of the spool without removing them.
+	Peek(max int) ([][]byte, error)
+	// Commit removes the first n events returned by the last Peek.
+	Commit(n int) error
+}
+
+// memorySpool is a bounded spool which does not survive restarts.
+type memorySpool struct {
+	mutex    sync.Mutex
+	capacity int
+	events   [][]byte
+	// the number of events at the head returned by the last Peek
+	peeked int
+}
+
+// NewMemorySpool creates a bounded Spool which holds at most capacity events in memory.
+func NewMemorySpool(capacity int) Spool {
+	if capacity <= 0 {
+		capacity = DefaultMemorySpoolCapacity
+	}
+	return &memorySpool{capacity: capacity}
+}
+
+func (s *memorySpool) Append(events ...[]byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, events...)
+	dropped := 0
+	if len(s.events) > s.capacity {
+		dropped = len(s.events) - s.capacity
+		s.events = s.events[dropped:]
+		// the dropped events being delivered must not be committed again
+		s.peeked -= dropped
+		if s.peeked < 0 {
+			s.peeked = 0
+		}
+	}
+	return dropped, nil
+}
+
+func (s *memorySpool) Peek(max int) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if max > len(s.events) {
+		max = len(s.events)
+	}
+	s.peeked = max
+	return append([][]byte(nil), s.events[:max]...), nil
+}
+
+func (s *memorySpool) Commit(n int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if n > s.peeked {
+		n = s.peeked
+	}
+	s.events = s.events[n:]
+	s.peeked -= n
+	return nil
+}
+
+// diskSpool is a write-ahead spool persisted in a directory as a sequence of
+// segment files, each line of a segment is an event. The read position is
+// persisted in a cursor file, so undelivered events survive restarts.
+type diskSpool struct {
+	mutex       sync.Mutex
+	dir         string
+	maxSize     int64
+	segmentSize int64
+
+	// sequence numbers of the segments, in order
+	segments []uint64
+	// writer of the last segment
+	writer     *os.File
+	writerSize int64
+
+	// the read position in the first segment
+	headOffset int64
+	// the length in bytes of every event returned by the last Peek
+	peeked []int64
+}
+
+// NewDiskSpool creates or restores a Spool persisted in dir, with the max size in megabytes.
+func NewDiskSpool(dir string, maxSizeMB int) (Spool, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = DefaultSpoolMaxSize
+	}
+	s := &diskSpool{
+		dir:         dir,
+		maxSize:     int64(maxSizeMB) * 1024 * 1024,
+		segmentSize: DefaultSegmentSize,
+	}
+	if s.segmentSize > s.maxSize {
+		s.segmentSize = s.maxSize
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *diskSpool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// load restores the segments and the read position from the spool directory.
+func (s *diskSpool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, seq)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	data, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		var seq uint64
+		var offset int64
+		if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &offset); err != nil {
+			return fmt.Errorf("invalid spool cursor: %s", err)
+		}
+		// drop the segments which have been delivered completely
+		for len(s.segments) > 0 && s.segments[0] < seq {
+			_ = os.Remove(s.segmentPath(s.segments[0]))
+			s.segments = s.segments[1:]
+		}
+		if len(s.segments) > 0 && s.segments[0] == seq {
+			s.headOffset = offset
+		}
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, 0)
+		return s.openWriter(0)
+	}
+	// Always start a new segment after restart, a torn write at the tail
+	// of the last segment must not be merged with the following events.
+	return s.rotate()
+}
+
+func (s *diskSpool) openWriter(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if s.writer != nil {
+		_ = s.writer.Close()
+	}
+	s.writer = f
+	s.writerSize = info.Size()
+	return nil
+}
+
+func (s *diskSpool) Append(events ...[]byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, event := range events {
+		if s.writerSize >= s.segmentSize {
+			if err := s.rotate(); err != nil {
+				return 0, err
+			}
+		}
+		line := make([]byte, 0, len(event)+1)
+		line = append(append(line, event...), '\n')
+		n, err := s.writer.Write(line)
+		s.writerSize += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := s.writer.Sync(); err != nil {
+		return 0, err
+	}
+	return s.enforceMaxSize()
+}
+
+func (s *diskSpool) rotate() error {
+	seq := s.segments[len(s.segments)-1] + 1
+	if err := s.openWriter(seq); err != nil {
+		return err
+	}
+	s.segments = append(s.segments, seq)
+	return nil
+}
+
+// enforceMaxSize removes the oldest segments until the spool fits in maxSize,
+// the segment being written is never removed.
+func (s *diskSpool) enforceMaxSize() (int, error) {
+	dropped := 0
+	for len(s.segments) > 1 && s.size() > s.maxSize {
+		path := s.segmentPath(s.segments[0])
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return dropped, err
+		}
+		if s.headOffset < int64(len(data)) {
+			dropped += bytes.Count(data[s.headOffset:], []byte{'\n'})
+		}
+		if err := os.Remove(path); err != nil {
+			return dropped, err
+		}
+		s.segments = s.segments[1:]
+		s.headOffset = 0
+		s.peeked = nil
+		if err := s.saveCursor(); err != nil {
+			return dropped, err
+		}
+	}
+	return dropped, nil
+}
+
+func (s *diskSpool) size() int64 {
+	var size int64
+	for _, seq := range s.segments {
+		if info, err := os.Stat(s.segmentPath(seq)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func (s *diskSpool) Peek(max int) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.peeked = nil
+	for {
+		events, err := s.readHead(max)
+		if err != nil || len(events) > 0 || len(s.segments) == 1 {
+			return events, err
+		}
+		// the head segment is drained and sealed, move to the next one
+		if err := os.Remove(s.segmentPath(s.segments[0])); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		s.segments = s.segments[1:]
+		s.headOffset = 0
+		if err := s.saveCursor(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *diskSpool) readHead(max int) ([][]byte, error) {
+	f, err := os.Open(s.segmentPath(s.segments[0]))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(s.headOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var events [][]byte
+	reader := bufio.NewReader(f)
+	for len(events) < max {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// an incomplete line is an event being written or a torn write, skip it for now
+			break
+		}
+		s.peeked = append(s.peeked, int64(len(line)))
+		events = append(events, bytes.TrimSuffix(line, []byte{'\n'}))
+	}
+	return events, nil
+}
+
+func (s *diskSpool) Commit(n int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if n > len(s.peeked) {
+		n = len(s.peeked)
+	}
+	for _, size := range s.peeked[:n] {
+		s.headOffset += size
+	}
+	s.peeked = s.peeked[n:]
+	return s.saveCursor()
+}
+
+func (s *diskSpool) saveCursor() error {
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	data := fmt.Sprintf("%d %d", s.segments[0], s.headOffset)
+	if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, cursorFile))
+}
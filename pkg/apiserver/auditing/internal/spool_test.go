@@ -0,0 +1,138 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiskSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewDiskSpool(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append([]byte(`{"AuditID":"1"}`), []byte(`{"AuditID":"2"}`), []byte(`{"AuditID":"3"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || string(events[0]) != `{"AuditID":"1"}` {
+		t.Fatalf("unexpected events %q", events)
+	}
+	if err := s.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen the spool, the uncommitted events must survive
+	s, err = NewDiskSpool(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append([]byte(`{"AuditID":"4"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		events, err := s.Peek(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, e := range events {
+			got = append(got, string(e))
+		}
+		if err := s.Commit(len(events)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{`{"AuditID":"2"}`, `{"AuditID":"3"}`, `{"AuditID":"4"}`}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDiskSpoolMaxSize(t *testing.T) {
+	s, err := NewDiskSpool(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := s.(*diskSpool)
+	ds.segmentSize = 64 * 1024
+
+	event := make([]byte, 64*1024-1)
+	for i := range event {
+		event[i] = 'x'
+	}
+	dropped := 0
+	for i := 0; i < 32; i++ {
+		n, err := s.Append(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+	if dropped == 0 {
+		t.Fatalf("expected events to be dropped")
+	}
+	if size := ds.size(); size > ds.maxSize {
+		t.Fatalf("spool size %d exceeds the max size %d", size, ds.maxSize)
+	}
+}
+
+func TestMemorySpool(t *testing.T) {
+	s := NewMemorySpool(2)
+	dropped, _ := s.Append([]byte("1"), []byte("2"), []byte("3"))
+	if dropped != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", dropped)
+	}
+	events, _ := s.Peek(10)
+	if len(events) != 2 || string(events[0]) != "2" {
+		t.Fatalf("unexpected events %q", events)
+	}
+}
+
+func TestMemorySpoolOverflowWhilePeeked(t *testing.T) {
+	s := NewMemorySpool(3)
+	if _, err := s.Append([]byte("1"), []byte("2"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := s.Peek(2)
+	if len(events) != 2 {
+		t.Fatalf("unexpected events %q", events)
+	}
+
+	// overflow while the peeked events are being delivered
+	dropped, _ := s.Append([]byte("4"), []byte("5"))
+	if dropped != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", dropped)
+	}
+	if err := s.Commit(len(events)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _ = s.Peek(10)
+	if fmt.Sprint(toStrings(events)) != fmt.Sprint([]string{"3", "4", "5"}) {
+		t.Fatalf("undelivered events were committed, got %q", events)
+	}
+}
+
+func toStrings(events [][]byte) []string {
+	var s []string
+	for _, e := range events {
+		s = append(s, string(e))
+	}
+	return s
+}
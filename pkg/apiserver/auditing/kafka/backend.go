@@ -0,0 +1,206 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"k8s.io/klog/v2"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+	"kubesphere.io/kubesphere/pkg/server/options"
+)
+
+const (
+	BackendType = "kafka"
+
+	DefaultTopic        = "kubesphere-auditing-events"
+	DefaultWriteTimeout = time.Second * 10
+
+	saslPlain       = "PLAIN"
+	saslSCRAMSHA256 = "SCRAM-SHA-256"
+	saslSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// kafkaOptions used to create a backend which produces events to a Kafka-protocol broker.
+type kafkaOptions struct {
+	// Brokers is the list of bootstrap brokers, like kafka-0.kafka:9092.
+	Brokers []string `json:"brokers" yaml:"brokers" mapstructure:"brokers"`
+	// Topic the events are produced to.
+	Topic string `json:"topic" yaml:"topic" mapstructure:"topic"`
+	// WriteTimeout is the timeout of producing a batch of events.
+	WriteTimeout time.Duration `json:"writeTimeout,omitempty" yaml:"writeTimeout,omitempty" mapstructure:"writeTimeout"`
+	// TLS enables TLS to the brokers if set.
+	TLS *internal.TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty" mapstructure:"tls"`
+	// SASL enables SASL authentication if set.
+	SASL *saslOptions `json:"sasl,omitempty" yaml:"sasl,omitempty" mapstructure:"sasl"`
+
+	internal.DeliveryConfig `mapstructure:",squash"`
+}
+
+type saslOptions struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 and SCRAM-SHA-512.
+	Mechanism string `json:"mechanism" yaml:"mechanism" mapstructure:"mechanism"`
+	Username  string `json:"username" yaml:"username" mapstructure:"username"`
+	Password  string `json:"password" yaml:"password" mapstructure:"password"`
+}
+
+// messageWriter produces messages to the brokers, it is implemented by kafka.Writer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+type backend struct {
+	writer  messageWriter
+	timeout time.Duration
+}
+
+func NewBackend(option *kafkaOptions, stopCh <-chan struct{}) (internal.Backend, error) {
+	transport := &kafka.Transport{}
+
+	if option.TLS != nil {
+		tlsConfig, err := internal.NewTLSConfig(option.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = tlsConfig
+	}
+
+	if option.SASL != nil {
+		mechanism, err := newSASLMechanism(option.SASL)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	return newBackend(option, &kafka.Writer{
+		Addr:         kafka.TCP(option.Brokers...),
+		Topic:        option.Topic,
+		Balancer:     &kafka.RoundRobin{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    option.BatchSize,
+		BatchTimeout: time.Millisecond * 10,
+		WriteTimeout: option.WriteTimeout,
+		Transport:    transport,
+	}, stopCh)
+}
+
+func newBackend(option *kafkaOptions, writer messageWriter, stopCh <-chan struct{}) (internal.Backend, error) {
+	b := &backend{
+		writer:  writer,
+		timeout: option.WriteTimeout,
+	}
+
+	reliableBackend, err := internal.NewReliableBackend(BackendType, &option.DeliveryConfig, b.sendEvents, stopCh)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-stopCh
+		if err := b.writer.Close(); err != nil {
+			klog.Errorf("close kafka writer error, %s", err)
+		}
+	}()
+
+	return reliableBackend, nil
+}
+
+func newSASLMechanism(option *saslOptions) (sasl.Mechanism, error) {
+	switch strings.ToUpper(option.Mechanism) {
+	case "", saslPlain:
+		return plain.Mechanism{Username: option.Username, Password: option.Password}, nil
+	case saslSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, option.Username, option.Password)
+	case saslSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, option.Username, option.Password)
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %s", option.Mechanism)
+	}
+}
+
+func (b *backend) sendEvents(events [][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, kafka.Message{Value: event})
+	}
+	if err := b.writer.WriteMessages(ctx, messages...); err != nil {
+		if permanent(err) {
+			return internal.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// permanent reports whether the messages can never be produced, e.g. they are too large for the brokers.
+func permanent(err error) bool {
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		for _, writeErr := range writeErrors {
+			if writeErr != nil && !permanent(writeErr) {
+				return false
+			}
+		}
+		return writeErrors.Count() > 0
+	}
+	var tooLarge kafka.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return true
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr {
+		case kafka.MessageSizeTooLarge, kafka.RecordListTooLarge, kafka.InvalidRecord:
+			return true
+		}
+	}
+	return false
+}
+
+type kafkaFactory struct{}
+
+func (kf *kafkaFactory) Type() string {
+	return BackendType
+}
+
+func (kf *kafkaFactory) Create(options options.DynamicOptions, stopCh <-chan struct{}) (internal.Backend, error) {
+	var kOptions kafkaOptions
+	if err := internal.DecodeOptions(options, &kOptions); err != nil {
+		return nil, err
+	}
+	if len(kOptions.Brokers) == 0 {
+		return nil, errors.New("no kafka brokers specified")
+	}
+	if kOptions.Topic == "" {
+		kOptions.Topic = DefaultTopic
+	}
+	if kOptions.WriteTimeout == 0 {
+		kOptions.WriteTimeout = DefaultWriteTimeout
+	}
+	if kOptions.BatchSize == 0 {
+		kOptions.BatchSize = internal.DefaultDeliveryBatchSize
+	}
+	return NewBackend(&kOptions, stopCh)
+}
+
+func init() {
+	internal.RegisterBackendFactory(&kafkaFactory{})
+}
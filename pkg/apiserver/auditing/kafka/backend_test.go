@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+	"kubesphere.io/kubesphere/pkg/server/options"
+)
+
+type fakeWriter struct {
+	mutex    sync.Mutex
+	failures int
+	messages []string
+	closed   bool
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("leader not available")
+	}
+	for _, message := range messages {
+		w.messages = append(w.messages, string(message.Value))
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWriter) state() ([]string, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]string(nil), w.messages...), w.closed
+}
+
+func TestKafkaBackend(t *testing.T) {
+	writer := &fakeWriter{failures: 1}
+	stopCh := make(chan struct{})
+	option := &kafkaOptions{
+		WriteTimeout:   time.Second,
+		DeliveryConfig: internal.DeliveryConfig{SpoolDir: t.TempDir()},
+	}
+	b, err := newBackend(option, writer, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the spool directory can not be shared by backends
+	if _, err = newBackend(option, &fakeWriter{}, stopCh); err == nil {
+		t.Fatal("expected error when sharing the spool directory")
+	}
+
+	b.ProcessEvents([]byte(`{"AuditID":"1"}`), []byte(`{"AuditID":"2"}`))
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		messages, _ := writer.state()
+		if len(messages) == 2 {
+			if messages[0] != `{"AuditID":"1"}` || messages[1] != `{"AuditID":"2"}` {
+				t.Fatalf("unexpected messages %q", messages)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the retried messages, got %q", messages)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	close(stopCh)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if _, closed := writer.state(); closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the writer is not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the spool directory is released once the backend is stopped
+	for {
+		stopCh := make(chan struct{})
+		_, err = newBackend(option, &fakeWriter{}, stopCh)
+		close(stopCh)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the spool directory is not released: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKafkaFactory(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory := &kafkaFactory{}
+	tests := []struct {
+		name    string
+		options options.DynamicOptions
+		wantErr bool
+	}{
+		{
+			name:    "no brokers",
+			options: options.DynamicOptions{"topic": "events"},
+			wantErr: true,
+		},
+		{
+			name: "unsupported sasl mechanism",
+			options: options.DynamicOptions{
+				"brokers": []interface{}{"kafka-0.kafka:9092"},
+				"sasl":    map[string]interface{}{"mechanism": "GSSAPI"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "scram",
+			options: options.DynamicOptions{
+				"brokers":      []interface{}{"kafka-0.kafka:9092"},
+				"writeTimeout": "5s",
+				"sasl":         map[string]interface{}{"mechanism": "scram-sha-512", "username": "admin", "password": "P@88w0rd"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := factory.Create(test.options, stopCh)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %t, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -7,10 +7,12 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -34,9 +36,15 @@ type backend struct {
 	timeout    time.Duration
 
 	writer io.Writer
+
+	mutex sync.Mutex
+	// chain is nil if the hash chaining is disabled
+	chain *hashChain
 }
 
-func NewBackend(path string, maxAge, maxBackups, maxSize int) internal.Backend {
+// NewBackend creates a backend which writes events to the log file at path,
+// the events are hash chained if chainConfig is not nil.
+func NewBackend(path string, maxAge, maxBackups, maxSize int, chainConfig *ChainConfig) (internal.Backend, error) {
 	b := backend{
 		path:       path,
 		maxAge:     maxAge,
@@ -58,8 +66,15 @@ func NewBackend(path string, maxAge, maxBackups, maxSize int) internal.Backend {
 	}
 
 	if err := b.ensureLogFile(); err != nil {
-		klog.Errorf("ensure audit log file error, %s", err)
-		return nil
+		return nil, fmt.Errorf("ensure audit log file error, %s", err)
+	}
+
+	if chainConfig != nil {
+		chain, err := newHashChain(b.path, chainConfig)
+		if err != nil {
+			return nil, fmt.Errorf("recover audit log hash chain error, %s", err)
+		}
+		b.chain = chain
 	}
 
 	b.writer = &lumberjack.Logger{
@@ -70,7 +85,7 @@ func NewBackend(path string, maxAge, maxBackups, maxSize int) internal.Backend {
 		Compress:   false,
 	}
 
-	return &b
+	return &b, nil
 }
 
 func (b *backend) ensureLogFile() error {
@@ -86,6 +101,13 @@ func (b *backend) ensureLogFile() error {
 }
 
 func (b *backend) ProcessEvents(events ...[]byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.chain != nil {
+		b.writeChained(events)
+		return
+	}
 	for _, event := range events {
 		if _, err := fmt.Fprint(b.writer, string(event)+"\n"); err != nil {
 			klog.Errorf("Log audit event error, %s. affecting audit event: %v\nImpacted event:\n", err, event)
@@ -93,3 +115,34 @@ func (b *backend) ProcessEvents(events ...[]byte) {
 		}
 	}
 }
+
+// writeChained writes the chained events followed by a checkpoint at once, so that a batch is never split
+// by the rotation and every file ends with a checkpoint signing its last record.
+func (b *backend) writeChained(events [][]byte) {
+	saved := *b.chain
+	var buf bytes.Buffer
+	for _, event := range events {
+		record, err := b.chain.link(event)
+		if err != nil {
+			klog.Errorf("Chain audit event error, %s. affecting audit event: %s", err, string(event))
+			continue
+		}
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	checkpoint, err := b.chain.checkpoint(time.Now())
+	if err != nil {
+		klog.Errorf("Sign audit log checkpoint error, %s", err)
+	} else if checkpoint != nil {
+		buf.Write(checkpoint)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := b.writer.Write(buf.Bytes()); err != nil {
+		// The chain is continued from the last record written.
+		*b.chain = saved
+		klog.Errorf("Log audit events error, %s. %d events are lost", err, len(events))
+	}
+}
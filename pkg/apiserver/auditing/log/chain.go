@@ -0,0 +1,233 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+)
+
+const (
+	// chainField is appended as the last field of every chained audit event.
+	chainField = `,"auditChain":`
+	// maxRecordSize is the max size of a record in the audit log.
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// ChainConfig enables the hash chaining of the audit log records.
+type ChainConfig struct {
+	// Keys holds the RSA key used to sign the checkpoints, checkpoints are not written if it is nil.
+	// A checkpoint is written after each batch of events, so that no record is left unsigned.
+	Keys *token.Keys
+}
+
+// Link is appended to an audit event, it chains the event with the hash of the previous one.
+// Hash is the hex encoded SHA-256 of Prev and the event without the link.
+type Link struct {
+	Seq  uint64 `json:"seq"`
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// Checkpoint is a record signing the hash of the last chained event.
+type Checkpoint struct {
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	KeyID     string    `json:"keyID,omitempty"`
+	// Signature is the base64 encoded RSASSA-PKCS1-v1_5 SHA-256 signature of the payload.
+	Signature string `json:"signature"`
+}
+
+type checkpointRecord struct {
+	Checkpoint *Checkpoint `json:"auditCheckpoint"`
+}
+
+func (c *Checkpoint) payload() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s", c.Seq, c.Hash, c.Timestamp.UTC().Format(time.RFC3339Nano)))
+}
+
+func (c *Checkpoint) sign(key *rsa.PrivateKey) error {
+	digest := sha256.Sum256(c.payload())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return err
+	}
+	c.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+func (c *Checkpoint) verify(key *rsa.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(c.payload())
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+}
+
+func hashEvent(prev string, event []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashChain chains the audit events written to the log, it is not safe for concurrent use.
+type hashChain struct {
+	seq   uint64
+	last  string
+	key   *rsa.PrivateKey
+	keyID string
+
+	// the seq of the last checkpoint
+	checkpointSeq uint64
+}
+
+func newHashChain(path string, config *ChainConfig) (*hashChain, error) {
+	c := &hashChain{}
+	if config.Keys != nil && config.Keys.SigningKey != nil {
+		key, ok := config.Keys.SigningKey.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the signing key is not a RSA private key")
+		}
+		c.key = key
+		c.keyID = config.Keys.SigningKey.KeyID
+	}
+
+	// continue the chain of the previous process
+	link, err := lastLink(path)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		c.seq = link.Seq
+		c.last = link.Hash
+	}
+	return c, nil
+}
+
+// link returns the event with the link to the previous event appended.
+func (c *hashChain) link(event []byte) ([]byte, error) {
+	event = bytes.TrimRight(event, " \r\n")
+	if len(event) < 2 || event[len(event)-1] != '}' {
+		return nil, errors.New("audit event is not a JSON object")
+	}
+
+	link := Link{Seq: c.seq + 1, Prev: c.last, Hash: hashEvent(c.last, event)}
+	data, err := json.Marshal(&link)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 0, len(event)+len(chainField)+len(data)+1)
+	record = append(record, event[:len(event)-1]...)
+	if len(event) > 2 {
+		record = append(record, chainField...)
+	} else {
+		// an empty object has no field to separate
+		record = append(record, chainField[1:]...)
+	}
+	record = append(record, data...)
+	record = append(record, '}')
+
+	c.seq = link.Seq
+	c.last = link.Hash
+	return record, nil
+}
+
+// checkpoint returns a checkpoint record signing the last chained event, nil if there is nothing to sign.
+func (c *hashChain) checkpoint(now time.Time) ([]byte, error) {
+	if c.key == nil || c.seq == c.checkpointSeq {
+		return nil, nil
+	}
+
+	checkpoint := &Checkpoint{Seq: c.seq, Hash: c.last, Timestamp: now, KeyID: c.keyID}
+	if err := checkpoint.sign(c.key); err != nil {
+		return nil, err
+	}
+	c.checkpointSeq = c.seq
+	return json.Marshal(&checkpointRecord{Checkpoint: checkpoint})
+}
+
+// splitLink splits a chained record into the original event and the link.
+func splitLink(record []byte) ([]byte, *Link, error) {
+	record = bytes.TrimRight(record, " \r\n")
+	i := bytes.LastIndex(record, []byte(chainField[1:]))
+	if i < 0 || record[len(record)-1] != '}' {
+		return nil, nil, errors.New("record is not chained")
+	}
+
+	link := &Link{}
+	if err := json.Unmarshal(record[i+len(chainField)-1:len(record)-1], link); err != nil {
+		return nil, nil, fmt.Errorf("invalid chain link: %s", err)
+	}
+
+	event := make([]byte, 0, i+1)
+	if record[i-1] == ',' {
+		event = append(event, record[:i-1]...)
+	} else {
+		event = append(event, record[:i]...)
+	}
+	event = append(event, '}')
+	return event, link, nil
+}
+
+// lastLink returns the link of the last chained record in the audit log file,
+// or in the latest backup if nothing has been written to the file since it was rotated.
+func lastLink(path string) (*Link, error) {
+	link, err := lastLinkInFile(path)
+	if err != nil || link != nil {
+		return link, err
+	}
+
+	ext := filepath.Ext(path)
+	backups, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext)
+	if err != nil || len(backups) == 0 {
+		return nil, err
+	}
+	// the backups are named after the rotation time, the latest one is the last in lexical order
+	sort.Strings(backups)
+	return lastLinkInFile(backups[len(backups)-1])
+}
+
+func lastLinkInFile(path string) (*Link, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var last *Link
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		if _, link, err := splitLink(scanner.Bytes()); err == nil {
+			last = link
+		}
+	}
+	return last, scanner.Err()
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package log
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+)
+
+func TestHashChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &token.Keys{
+		SigningKey:    &jose.JSONWebKey{Key: key, KeyID: "test", Algorithm: "RS256"},
+		SigningKeyPub: &jose.JSONWebKey{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256"},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	config := &ChainConfig{Keys: keys}
+
+	b := newBackend(t, path, config)
+	b.ProcessEvents([]byte(`{"auditID":"1","verb":"create"}`), []byte(`{"auditID":"2","verb":"delete"}`))
+
+	// the chain is continued after restart
+	b = newBackend(t, path, config)
+	b.ProcessEvents([]byte(`{"auditID":"3","verb":"update"}`))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := map[string]*rsa.PublicKey{"test": &key.PublicKey}
+
+	result, err := Verify([]string{path}, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BrokenLink != nil {
+		t.Fatalf("unexpected broken link %+v", result.BrokenLink)
+	}
+	if result.Files != 1 || result.Records != 3 || result.Checkpoints != 2 || result.FirstSeq != 1 || result.LastSeq != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// the lines are: record 1, record 2, checkpoint 2, record 3, checkpoint 3
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	tests := []struct {
+		name   string
+		files  [][]byte
+		keys   map[string]*rsa.PublicKey
+		file   int
+		line   int
+		reason string
+	}{
+		{
+			name:   "modified record",
+			files:  [][]byte{bytes.Replace(data, []byte(`"verb":"delete"`), []byte(`"verb":"get"`), 1)},
+			line:   2,
+			reason: "hash mismatch",
+		},
+		{
+			name:   "removed record",
+			files:  [][]byte{bytes.Join(append(lines[:1:1], lines[2:]...), nil)},
+			line:   2,
+			reason: "checkpoint does not match",
+		},
+		{
+			name:   "removed end of the file",
+			files:  [][]byte{bytes.Join(lines[:4], nil)},
+			line:   4,
+			reason: "not signed",
+		},
+		{
+			name:  "signed with another key",
+			files: [][]byte{data},
+			keys: func() map[string]*rsa.PublicKey {
+				other, _ := rsa.GenerateKey(rand.Reader, 2048)
+				return map[string]*rsa.PublicKey{"test": &other.PublicKey}
+			}(),
+			line:   3,
+			reason: "invalid checkpoint signature",
+		},
+		{
+			name:   "signed with unknown key",
+			files:  [][]byte{data},
+			keys:   map[string]*rsa.PublicKey{"other": &key.PublicKey},
+			line:   3,
+			reason: "unknown key",
+		},
+		{
+			name:   "removed or reordered rotated file",
+			files:  [][]byte{bytes.Join(lines[:3], nil), bytes.Join(lines[3:], nil), bytes.Join(lines[:3], nil)},
+			file:   2,
+			line:   1,
+			reason: "expected seq 4",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var files []string
+			for i, data := range test.files {
+				file := filepath.Join(t.TempDir(), fmt.Sprintf("audit-%d.log", i))
+				if err := os.WriteFile(file, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, file)
+			}
+			keys := trusted
+			if test.keys != nil {
+				keys = test.keys
+			}
+			result, err := Verify(files, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			link := result.BrokenLink
+			if link == nil || link.File != filepath.Base(files[test.file]) || link.Line != test.line ||
+				!strings.Contains(link.Reason, test.reason) {
+				t.Fatalf("expected broken link at %s line %d, got %+v", filepath.Base(files[test.file]), test.line, link)
+			}
+		})
+	}
+
+	// the chain is carried across the rotated files
+	files := []string{filepath.Join(dir, "audit-1.log"), filepath.Join(dir, "audit-2.log")}
+	if err := os.WriteFile(files[0], bytes.Join(lines[:3], nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files[1], bytes.Join(lines[3:], nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Verify(files, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BrokenLink != nil || result.Files != 2 || result.Records != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	// the head of the chain can be removed by the rotation only
+	result, err = Verify(files[1:], trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BrokenLink != nil || result.FirstSeq != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestHashChainKeyRotation(t *testing.T) {
+	newKeys := func(keyID string) *token.Keys {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &token.Keys{
+			SigningKey:    &jose.JSONWebKey{Key: key, KeyID: keyID, Algorithm: "RS256"},
+			SigningKeyPub: &jose.JSONWebKey{Key: &key.PublicKey, KeyID: keyID, Algorithm: "RS256"},
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	previous, current := newKeys("previous"), newKeys("current")
+	b := newBackend(t, path, &ChainConfig{Keys: previous})
+	b.ProcessEvents([]byte(`{"auditID":"1"}`), []byte(`{"auditID":"2"}`))
+	// the signing key is generated again after restart
+	b = newBackend(t, path, &ChainConfig{Keys: current})
+	b.ProcessEvents([]byte(`{"auditID":"3"}`), []byte(`{"auditID":"4"}`))
+
+	// the checkpoints signed with a key which is not configured are not trusted
+	keys, err := VerificationKeys(current, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Verify([]string{path}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BrokenLink == nil || result.BrokenLink.Line != 3 || !strings.Contains(result.BrokenLink.Reason, "unknown key") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// the previous key is configured out of band
+	keySet, err := json.Marshal(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*previous.SigningKeyPub}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keysFile := filepath.Join(dir, "jwks.json")
+	if err = os.WriteFile(keysFile, keySet, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = VerificationKeys(current, keysFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = Verify([]string{path}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BrokenLink != nil || result.Checkpoints != 2 || result.Records != 4 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if _, err = Verify([]string{path}, nil); err == nil {
+		t.Fatal("expected error without any key")
+	}
+}
+
+func TestUnrecoverableChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// a record exceeding the max record size can not be read back
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'x'}, maxRecordSize+1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBackend(path, 0, 0, 0, &ChainConfig{}); err == nil {
+		t.Fatal("expected the unrecoverable chain to be reported")
+	}
+}
+
+func newBackend(t *testing.T, path string, config *ChainConfig) internal.Backend {
+	b, err := NewBackend(path, 0, 0, 0, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
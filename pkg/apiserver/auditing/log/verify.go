@@ -0,0 +1,201 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+)
+
+// VerifyResult is the result of walking the hash chain of the audit log files.
+type VerifyResult struct {
+	// Files is the number of the files verified.
+	Files int `json:"files"`
+	// Records is the number of chained records verified before the first broken link.
+	Records int `json:"records"`
+	// Checkpoints is the number of signed checkpoints verified before the first broken link.
+	Checkpoints int `json:"checkpoints"`
+	// FirstSeq and LastSeq are the sequence numbers of the first and last verified records.
+	FirstSeq uint64 `json:"firstSeq,omitempty"`
+	LastSeq  uint64 `json:"lastSeq,omitempty"`
+	// BrokenLink is the first broken link, nil if all the files are verified.
+	BrokenLink *BrokenLink `json:"brokenLink,omitempty"`
+}
+
+type BrokenLink struct {
+	// File is the name of the file containing the broken link.
+	File string `json:"file"`
+	// Line is the line number of the record, starting from 1.
+	Line   int    `json:"line"`
+	Seq    uint64 `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// VerificationKeys returns the public keys trusted to sign the checkpoints, indexed by the key IDs. They are the
+// signing key of the token issuer and the keys in the JSON Web Key Set file, which keeps the previous signing keys
+// out of band. The keys recorded along with the audit log are never trusted, since they can be rewritten as well.
+func VerificationKeys(keys *token.Keys, file string) (map[string]*rsa.PublicKey, error) {
+	result := make(map[string]*rsa.PublicKey)
+	if keys != nil && keys.SigningKeyPub != nil {
+		if key, ok := keys.SigningKeyPub.Key.(*rsa.PublicKey); ok {
+			result[keys.SigningKeyPub.KeyID] = key
+		}
+	}
+	if file == "" {
+		return result, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the verification keys: %s", err)
+	}
+	keySet := &jose.JSONWebKeySet{}
+	if err = json.Unmarshal(data, keySet); err != nil {
+		return nil, fmt.Errorf("invalid verification keys: %s", err)
+	}
+	for _, jwk := range keySet.Keys {
+		key, ok := jwk.Key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("verification key %s is not a RSA public key", jwk.KeyID)
+		}
+		result[jwk.KeyID] = key
+	}
+	return result, nil
+}
+
+// verifier walks the hash chain across the files, the last link is carried to the next file.
+type verifier struct {
+	keys   map[string]*rsa.PublicKey
+	result *VerifyResult
+	last   *Link
+	// signed reports whether the last record is signed by a checkpoint.
+	signed bool
+}
+
+// Verify walks the records of the audit log files in the order they were written and reports the first broken
+// link. The chain is anchored at the first record or checkpoint of the first file, since the older files may have
+// been removed by the rotation. Every checkpoint must be signed with one of the keys, and every file must end with
+// a checkpoint signing its last record, so that removing records at the end of a file is detected as well.
+func Verify(files []string, keys map[string]*rsa.PublicKey) (*VerifyResult, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no key is configured to verify the checkpoints")
+	}
+	v := &verifier{keys: keys, result: &VerifyResult{}, signed: true}
+	for _, file := range files {
+		if err := v.verifyFile(file); err != nil {
+			return nil, err
+		}
+		if v.result.BrokenLink != nil {
+			break
+		}
+	}
+	return v.result, nil
+}
+
+func (v *verifier) verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	v.result.Files++
+
+	file := filepath.Base(path)
+	broken := func(line int, seq uint64, reason string) {
+		v.result.BrokenLink = &BrokenLink{File: file, Line: line, Seq: seq, Reason: reason}
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	line, unsignedLine := 0, 0
+	for scanner.Scan() {
+		line++
+		record := bytes.TrimSpace(scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+
+		if bytes.HasPrefix(record, []byte(`{"auditCheckpoint":`)) {
+			checkpoint, reason := v.verifyCheckpoint(record)
+			if reason != "" {
+				broken(line, 0, reason)
+				return nil
+			}
+			// a checkpoint at the beginning of the chain anchors the following records
+			if v.last == nil {
+				v.last = &Link{Seq: checkpoint.Seq, Hash: checkpoint.Hash}
+			}
+			v.result.Checkpoints++
+			v.signed = true
+			continue
+		}
+
+		event, link, err := splitLink(record)
+		if err != nil {
+			broken(line, 0, err.Error())
+			return nil
+		}
+		if v.last != nil && link.Seq != v.last.Seq+1 {
+			broken(line, link.Seq, fmt.Sprintf("expected seq %d, records or files are missing or reordered", v.last.Seq+1))
+			return nil
+		}
+		if v.last != nil && link.Prev != v.last.Hash {
+			broken(line, link.Seq, "previous hash mismatch")
+			return nil
+		}
+		if hashEvent(link.Prev, event) != link.Hash {
+			broken(line, link.Seq, "hash mismatch, the record is modified")
+			return nil
+		}
+
+		if v.result.Records == 0 {
+			v.result.FirstSeq = link.Seq
+		}
+		if v.signed {
+			unsignedLine = line
+		}
+		v.result.Records++
+		v.result.LastSeq = link.Seq
+		v.last = link
+		v.signed = false
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if !v.signed {
+		broken(unsignedLine, 0, "the records are not signed by a checkpoint, the end of the file is removed")
+	}
+	return nil
+}
+
+// verifyCheckpoint returns the checkpoint, or the reason if it does not match the last record or is not signed
+// with a trusted key.
+func (v *verifier) verifyCheckpoint(record []byte) (*Checkpoint, string) {
+	c := &checkpointRecord{}
+	if err := json.Unmarshal(record, c); err != nil || c.Checkpoint == nil {
+		return nil, "invalid checkpoint"
+	}
+	if v.last != nil && (c.Checkpoint.Seq != v.last.Seq || c.Checkpoint.Hash != v.last.Hash) {
+		return nil, "checkpoint does not match the previous record"
+	}
+	key, ok := v.keys[c.Checkpoint.KeyID]
+	if !ok {
+		return nil, fmt.Sprintf("checkpoint is signed with unknown key %q", c.Checkpoint.KeyID)
+	}
+	if err := c.Checkpoint.verify(key); err != nil {
+		return nil, fmt.Sprintf("invalid checkpoint signature: %s", err)
+	}
+	return c.Checkpoint, ""
+}
@@ -7,17 +7,38 @@
 package auditing
 
 import (
+	"fmt"
 	"time"
 
 	"k8s.io/apiserver/pkg/apis/audit"
 
 	"github.com/spf13/pflag"
+
+	_ "kubesphere.io/kubesphere/pkg/apiserver/auditing/kafka"
+	_ "kubesphere.io/kubesphere/pkg/apiserver/auditing/otlp"
+	"kubesphere.io/kubesphere/pkg/server/options"
 )
 
 type WebhookOptions struct {
 	WebhookUrl string `json:"webhookUrl" yaml:"webhookUrl"`
 	// The maximum concurrent senders which send auditing events to the auditing webhook.
+	// Deprecated: events are delivered in order by a single sender, this option has no effect.
 	EventSendersNum int `json:"eventSendersNum" yaml:"eventSendersNum"`
+	// The CA bundle used to verify the certificate of the auditing webhook, the system roots are used
+	// if it is empty. The certificate of the default in-cluster webhook is not verified without it.
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// The client certificate and key used for mTLS to the auditing webhook.
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// Skip the verification of the auditing webhook certificate.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+	// The directory of the on-disk spool, undelivered auditing events survive restarts.
+	// If it is empty, auditing events are spooled in memory.
+	SpoolDir string `json:"spoolDir,omitempty" yaml:"spoolDir,omitempty"`
+	// The maximum size in megabytes of the on-disk spool.
+	SpoolMaxSize int `json:"spoolMaxSize,omitempty" yaml:"spoolMaxSize,omitempty"`
+	// The maximum interval between retries of failed deliveries.
+	MaxBackoff time.Duration `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
 }
 
 type LogOptions struct {
@@ -25,11 +46,30 @@ type LogOptions struct {
 	MaxAge     int    `json:"maxAge" yaml:"maxAge"`
 	MaxBackups int    `json:"maxBackups" yaml:"maxBackups"`
 	MaxSize    int    `json:"maxSize" yaml:"maxSize"`
+	// HashChain chains every event with the hash of the previous one to make the audit log tamper-evident.
+	HashChain bool `json:"hashChain,omitempty" yaml:"hashChain,omitempty"`
+	// VerificationKeysFile is a JSON Web Key Set file of the previous signing keys, which verifies the checkpoints
+	// signed before the signing key of the token issuer changed. It should be mounted from a trusted source,
+	// e.g. a Secret, not stored along with the audit log.
+	VerificationKeysFile string `json:"verificationKeysFile,omitempty" yaml:"verificationKeysFile,omitempty"`
+}
+
+// BackendOptions configures an additional auditing backend created by the factory registered for Type.
+type BackendOptions struct {
+	// Type of the backend, kafka or otlp.
+	Type    string                 `json:"type" yaml:"type"`
+	Options options.DynamicOptions `json:"options,omitempty" yaml:"options,omitempty"`
 }
 
 type Options struct {
-	Enable     bool        `json:"enable" yaml:"enable"`
+	Enable bool `json:"enable" yaml:"enable"`
+	// AuditLevel is the default audit level for requests which match no rule of the Policy.
 	AuditLevel audit.Level `json:"auditLevel" yaml:"auditLevel"`
+	// Policy defines the rules to choose the audit level and omitted stages per request.
+	Policy *Policy `json:"policy,omitempty" yaml:"policy,omitempty"`
+	// PolicyConfigMap is the name of the ConfigMap in the kubesphere-system namespace which holds the
+	// audit policy under the key policy.yaml. If empty, the policy is reloaded from the KubeSphere config.
+	PolicyConfigMap string `json:"policyConfigMap,omitempty" yaml:"policyConfigMap,omitempty"`
 	// The batch size of auditing events.
 	EventBatchSize int `json:"eventBatchSize" yaml:"eventBatchSize"`
 	// The batch interval of auditing events.
@@ -37,6 +77,8 @@ type Options struct {
 
 	WebhookOptions WebhookOptions `json:"webhookOptions" yaml:"webhookOptions"`
 	LogOptions     LogOptions     `json:"logOptions" yaml:"logOptions"`
+	// Backends are the additional backends created through the registered backend factories.
+	Backends []BackendOptions `json:"backends,omitempty" yaml:"backends,omitempty"`
 }
 
 func NewAuditingOptions() *Options {
@@ -45,6 +87,12 @@ func NewAuditingOptions() *Options {
 
 func (s *Options) Validate() []error {
 	errs := make([]error, 0)
+	errs = append(errs, ValidatePolicy(s.Policy)...)
+	for i, backend := range s.Backends {
+		if backend.Type == "" {
+			errs = append(errs, fmt.Errorf("backends[%d]: invalid auditing backend type", i))
+		}
+	}
 	return errs
 }
 
@@ -55,9 +103,29 @@ func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
 	fs.DurationVar(&s.EventBatchInterval, "auditing-event-batch-interval", c.EventBatchInterval,
 		"The batch interval of auditing events.")
 
+	fs.StringVar(&s.PolicyConfigMap, "auditing-policy-configmap", c.PolicyConfigMap,
+		"The name of the ConfigMap in kubesphere-system which holds the audit policy, "+
+			"if empty the policy is loaded from the KubeSphere config.")
+
 	fs.StringVar(&s.WebhookOptions.WebhookUrl, "auditing-webhook-url", c.WebhookOptions.WebhookUrl, "Auditing wehook url")
 	fs.IntVar(&s.WebhookOptions.EventSendersNum, "auditing-event-senders-num", c.WebhookOptions.EventSendersNum,
 		"The maximum concurrent senders which send auditing events to the auditing webhook.")
+	_ = fs.MarkDeprecated("auditing-event-senders-num", "events are delivered in order by a single sender")
+	fs.StringVar(&s.WebhookOptions.CAFile, "auditing-webhook-ca-file", c.WebhookOptions.CAFile,
+		"The CA bundle used to verify the certificate of the auditing webhook, the system roots are used if it is empty. "+
+			"The certificate of the default in-cluster webhook is not verified without it.")
+	fs.StringVar(&s.WebhookOptions.CertFile, "auditing-webhook-cert-file", c.WebhookOptions.CertFile,
+		"The client certificate used for mTLS to the auditing webhook.")
+	fs.StringVar(&s.WebhookOptions.KeyFile, "auditing-webhook-key-file", c.WebhookOptions.KeyFile,
+		"The client key used for mTLS to the auditing webhook.")
+	fs.BoolVar(&s.WebhookOptions.InsecureSkipVerify, "auditing-webhook-insecure-skip-verify", c.WebhookOptions.InsecureSkipVerify,
+		"Skip the verification of the auditing webhook certificate.")
+	fs.StringVar(&s.WebhookOptions.SpoolDir, "auditing-webhook-spool-dir", c.WebhookOptions.SpoolDir,
+		"The directory of the on-disk spool of auditing events waiting to be delivered to the auditing webhook.")
+	fs.IntVar(&s.WebhookOptions.SpoolMaxSize, "auditing-webhook-spool-maxsize", c.WebhookOptions.SpoolMaxSize,
+		"The maximum size in megabytes of the on-disk spool, the oldest events are dropped once it is exceeded.")
+	fs.DurationVar(&s.WebhookOptions.MaxBackoff, "auditing-webhook-max-backoff", c.WebhookOptions.MaxBackoff,
+		"The maximum interval between retries of failed deliveries to the auditing webhook.")
 
 	fs.StringVar(&s.LogOptions.Path, "audit-log-path", s.LogOptions.Path,
 		"If set, all requests coming to the apiserver will be logged to this file.  '-' means standard out.")
@@ -67,4 +135,8 @@ func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
 		"The maximum number of old audit log files to retain. Setting a value of 0 will mean there's no restriction on the number of files.")
 	fs.IntVar(&s.LogOptions.MaxSize, "audit-log-maxsize", s.LogOptions.MaxSize,
 		"The maximum size in megabytes of the audit log file before it gets rotated.")
+	fs.BoolVar(&s.LogOptions.HashChain, "audit-log-hash-chain", s.LogOptions.HashChain,
+		"Chain every audit event with the hash of the previous one to make the audit log tamper-evident.")
+	fs.StringVar(&s.LogOptions.VerificationKeysFile, "audit-log-verification-keys-file", s.LogOptions.VerificationKeysFile,
+		"The JSON Web Key Set file of the previous keys which signed the checkpoints of the hash chained audit log.")
 }
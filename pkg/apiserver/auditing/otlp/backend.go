@@ -0,0 +1,272 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+	"kubesphere.io/kubesphere/pkg/server/options"
+)
+
+const (
+	BackendType = "otlp"
+
+	DefaultEndpoint    = "http://localhost:4318/v1/logs"
+	DefaultTimeout     = time.Second * 10
+	DefaultServiceName = "ks-apiserver"
+
+	scopeName = "kubesphere.io/auditing"
+	// severity number of INFO, https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+	severityNumberInfo = 9
+)
+
+// otlpOptions used to create a backend which exports events as OpenTelemetry
+// logs with OTLP/HTTP in the JSON encoding.
+type otlpOptions struct {
+	// Endpoint is the full URL of the logs endpoint of an OTLP collector.
+	Endpoint string `json:"endpoint" yaml:"endpoint" mapstructure:"endpoint"`
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" mapstructure:"headers"`
+	// ResourceAttributes are added to the resource of the exported logs.
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty" yaml:"resourceAttributes,omitempty" mapstructure:"resourceAttributes"`
+	// Timeout is the timeout of an export request.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" mapstructure:"timeout"`
+	// TLS is the TLS configuration for a https endpoint.
+	TLS *internal.TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty" mapstructure:"tls"`
+
+	internal.DeliveryConfig `mapstructure:",squash"`
+}
+
+type backend struct {
+	endpoint string
+	headers  map[string]string
+	resource resource
+	client   http.Client
+}
+
+func NewBackend(option *otlpOptions, stopCh <-chan struct{}) (internal.Backend, error) {
+	b := &backend{
+		endpoint: option.Endpoint,
+		headers:  option.Headers,
+		resource: resource{Attributes: []keyValue{stringAttribute("service.name", DefaultServiceName)}},
+	}
+	for k, v := range option.ResourceAttributes {
+		b.resource.Attributes = append(b.resource.Attributes, stringAttribute(k, v))
+	}
+
+	transport := &http.Transport{}
+	if option.TLS != nil {
+		tlsConfig, err := internal.NewTLSConfig(option.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	b.client = http.Client{Transport: transport, Timeout: option.Timeout}
+
+	return internal.NewReliableBackend(BackendType, &option.DeliveryConfig, b.sendEvents, stopCh)
+}
+
+func (b *backend) sendEvents(events [][]byte) error {
+	records := make([]logRecord, 0, len(events))
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, event := range events {
+		records = append(records, newLogRecord(event, observed))
+	}
+
+	body, err := json.Marshal(&exportLogsServiceRequest{
+		ResourceLogs: []resourceLogs{{
+			Resource: b.resource,
+			ScopeLogs: []scopeLogs{{
+				Scope:      instrumentationScope{Name: scopeName},
+				LogRecords: records,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range b.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("unexpected response code %d: %s", resp.StatusCode, string(data))
+		if internal.PermanentStatus(resp.StatusCode) {
+			return internal.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// auditEvent is the subset of the auditing event fields mapped to log attributes.
+type auditEvent struct {
+	AuditID    string `json:"auditID"`
+	Verb       string `json:"verb"`
+	RequestURI string `json:"requestURI"`
+	Workspace  string `json:"Workspace"`
+	Cluster    string `json:"Cluster"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	SourceIPs []string `json:"sourceIPs"`
+	ObjectRef *struct {
+		Resource  string `json:"resource"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		APIGroup  string `json:"apiGroup"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int64 `json:"code"`
+	} `json:"responseStatus"`
+	StageTimestamp time.Time `json:"stageTimestamp"`
+}
+
+func newLogRecord(event []byte, observed string) logRecord {
+	record := logRecord{
+		ObservedTimeUnixNano: observed,
+		SeverityNumber:       severityNumberInfo,
+		SeverityText:         "INFO",
+		Body:                 anyValue{StringValue: string(event)},
+	}
+
+	e := &auditEvent{}
+	if err := json.Unmarshal(event, e); err != nil {
+		klog.V(4).Infof("unmarshal auditing event error, %s", err)
+		return record
+	}
+
+	if !e.StageTimestamp.IsZero() {
+		record.TimeUnixNano = strconv.FormatInt(e.StageTimestamp.UnixNano(), 10)
+	}
+	record.Attributes = append(record.Attributes,
+		stringAttribute("audit.id", e.AuditID),
+		stringAttribute("audit.verb", e.Verb),
+		stringAttribute("url.path", e.RequestURI),
+		stringAttribute("user.name", e.User.Username),
+	)
+	if e.Workspace != "" {
+		record.Attributes = append(record.Attributes, stringAttribute("kubesphere.workspace", e.Workspace))
+	}
+	if e.Cluster != "" {
+		record.Attributes = append(record.Attributes, stringAttribute("k8s.cluster.name", e.Cluster))
+	}
+	if len(e.SourceIPs) > 0 {
+		record.Attributes = append(record.Attributes, stringAttribute("client.address", e.SourceIPs[0]))
+	}
+	if e.ObjectRef != nil {
+		record.Attributes = append(record.Attributes,
+			stringAttribute("k8s.namespace.name", e.ObjectRef.Namespace),
+			stringAttribute("audit.resource", e.ObjectRef.Resource),
+			stringAttribute("audit.resource.name", e.ObjectRef.Name),
+			stringAttribute("audit.api_group", e.ObjectRef.APIGroup),
+		)
+	}
+	if e.ResponseStatus != nil {
+		record.Attributes = append(record.Attributes, keyValue{
+			Key:   "http.response.status_code",
+			Value: anyValue{IntValue: strconv.FormatInt(e.ResponseStatus.Code, 10)},
+		})
+	}
+	return record
+}
+
+// The types below are the JSON encoding of the OTLP logs protocol,
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+
+type exportLogsServiceRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      instrumentationScope `json:"scope"`
+	LogRecords []logRecord          `json:"logRecords"`
+}
+
+type instrumentationScope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	// 64-bit integers are encoded as decimal strings in the OTLP JSON encoding
+	TimeUnixNano         string     `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano,omitempty"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+}
+
+func stringAttribute(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: value}}
+}
+
+type otlpFactory struct{}
+
+func (of *otlpFactory) Type() string {
+	return BackendType
+}
+
+func (of *otlpFactory) Create(options options.DynamicOptions, stopCh <-chan struct{}) (internal.Backend, error) {
+	var oOptions otlpOptions
+	if err := internal.DecodeOptions(options, &oOptions); err != nil {
+		return nil, err
+	}
+	if oOptions.Endpoint == "" {
+		oOptions.Endpoint = DefaultEndpoint
+	}
+	if oOptions.Timeout == 0 {
+		oOptions.Timeout = DefaultTimeout
+	}
+	return NewBackend(&oOptions, stopCh)
+}
+
+func init() {
+	internal.RegisterBackendFactory(&otlpFactory{})
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package otlp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kubesphere.io/kubesphere/pkg/server/options"
+)
+
+func TestOTLPBackend(t *testing.T) {
+	received := make(chan *exportLogsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		req := &exportLogsServiceRequest{}
+		if err := json.Unmarshal(data, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- req
+	}))
+	defer server.Close()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory := &otlpFactory{}
+	backend, err := factory.Create(options.DynamicOptions{
+		"endpoint": server.URL,
+		"headers":  map[string]interface{}{"Authorization": "Bearer token"},
+		"timeout":  "5s",
+	}, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.ProcessEvents([]byte(`{"Workspace":"system-workspace","Cluster":"host","auditID":"1","verb":"delete",` +
+		`"user":{"username":"admin"},"objectRef":{"resource":"workspaces","name":"demo"},` +
+		`"responseStatus":{"code":200},"stageTimestamp":"2024-01-01T00:00:00.000000Z"}`))
+
+	select {
+	case req := <-received:
+		records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+		if len(records) != 1 {
+			t.Fatalf("expected 1 log record, got %d", len(records))
+		}
+		if records[0].TimeUnixNano != "1704067200000000000" {
+			t.Errorf("unexpected timestamp %s", records[0].TimeUnixNano)
+		}
+		attributes := make(map[string]anyValue)
+		for _, kv := range records[0].Attributes {
+			attributes[kv.Key] = kv.Value
+		}
+		if attributes["user.name"].StringValue != "admin" || attributes["kubesphere.workspace"].StringValue != "system-workspace" {
+			t.Errorf("unexpected attributes %v", attributes)
+		}
+		if attributes["http.response.status_code"].IntValue != "200" {
+			t.Errorf("unexpected status code %v", attributes["http.response.status_code"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the exported logs")
+	}
+}
@@ -0,0 +1,355 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/request"
+)
+
+// Policy defines the configuration of audit logging, and the rules for how different request
+// categories are logged. It mirrors the upstream audit.Policy, extended with the KubeSphere
+// specific request attributes such as workspace and cluster.
+type Policy struct {
+	// Rules specify the audit Level a request should be recorded at.
+	// A request may match multiple rules, in which case the FIRST matching rule is used.
+	// If no rule matches, the default AuditLevel of the Options is used.
+	Rules []PolicyRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+	// OmitStages is a list of stages for which no events are created. Note that this can also
+	// be specified per rule in which case the union of both are omitted.
+	OmitStages []audit.Stage `json:"omitStages,omitempty" yaml:"omitStages,omitempty"`
+}
+
+// PolicyRule maps requests based off metadata to an audit Level.
+// Requests must match the rules of every field (an intersection of rules).
+// An empty list of a field matches everything.
+type PolicyRule struct {
+	// The Level that requests matching this rule are recorded at.
+	Level audit.Level `json:"level" yaml:"level"`
+	// The users (by authenticated user name) this rule applies to.
+	Users []string `json:"users,omitempty" yaml:"users,omitempty"`
+	// The user groups this rule applies to. A user is considered matching
+	// if it is a member of any of the UserGroups.
+	UserGroups []string `json:"userGroups,omitempty" yaml:"userGroups,omitempty"`
+	// The verbs that match this rule.
+	Verbs []string `json:"verbs,omitempty" yaml:"verbs,omitempty"`
+	// Resources that this rule matches.
+	Resources []GroupResources `json:"resources,omitempty" yaml:"resources,omitempty"`
+	// Workspaces that this rule matches.
+	// The empty string "" matches requests which do not belong to any workspace.
+	Workspaces []string `json:"workspaces,omitempty" yaml:"workspaces,omitempty"`
+	// Namespaces that this rule matches.
+	// The empty string "" matches non-namespaced resources.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Clusters that this rule matches.
+	Clusters []string `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+	// NonResourceURLs is a set of URL paths that should be audited.
+	// "*"s are allowed, but only as the full, final step in the path.
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty" yaml:"nonResourceURLs,omitempty"`
+	// OmitStages is a list of stages for which no events are created.
+	OmitStages []audit.Stage `json:"omitStages,omitempty" yaml:"omitStages,omitempty"`
+}
+
+// GroupResources represents resource kinds in an API group.
+type GroupResources struct {
+	// Group is the name of the API group that contains the resources.
+	// The empty string represents the core API group.
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Resources is a list of resources this rule applies to.
+	//
+	// For example:
+	// 'pods' matches pods.
+	// 'pods/log' matches the log subresource of pods.
+	// '*' matches all resources and their subresources.
+	// 'pods/*' matches all subresources of pods.
+	// '*/scale' matches all scale subresources.
+	Resources []string `json:"resources,omitempty" yaml:"resources,omitempty"`
+	// ResourceNames is a list of resource instance names that the policy matches.
+	ResourceNames []string `json:"resourceNames,omitempty" yaml:"resourceNames,omitempty"`
+}
+
+// RequestAuditConfig is the audit configuration that applies to a given request.
+type RequestAuditConfig struct {
+	Level      audit.Level
+	OmitStages []audit.Stage
+}
+
+// Omitted reports whether events of the given stage should not be recorded.
+func (c RequestAuditConfig) Omitted(stage audit.Stage) bool {
+	if c.Level.Less(audit.LevelMetadata) {
+		return true
+	}
+	for _, s := range c.OmitStages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes are the request attributes a PolicyRule is evaluated against.
+type Attributes struct {
+	*request.RequestInfo
+	User user.Info
+	// Workspace overrides RequestInfo.Workspace when the workspace was resolved from the namespace.
+	Workspace string
+	// ResolveWorkspace resolves the workspace from the namespace, it is only called if a rule matches
+	// the workspaces and the workspace is not set.
+	ResolveWorkspace func() string
+	// Cluster overrides RequestInfo.Cluster when the request was not proxied to a member cluster.
+	Cluster string
+}
+
+func (a *Attributes) workspace() string {
+	if a.Workspace == "" && a.ResolveWorkspace != nil {
+		a.Workspace = a.ResolveWorkspace()
+		a.ResolveWorkspace = nil
+	}
+	return a.Workspace
+}
+
+// PolicyRuleEvaluator exposes a method for evaluating the policy rules.
+type PolicyRuleEvaluator interface {
+	// EvaluatePolicyRule evaluates the audit policy against the provided
+	// request attributes and returns the audit configuration that applies.
+	EvaluatePolicyRule(attrs *Attributes) RequestAuditConfig
+	// Enabled reports whether any request could be recorded at all.
+	Enabled() bool
+}
+
+// NewPolicyRuleEvaluator creates a PolicyRuleEvaluator for the given policy,
+// defaultLevel is used for requests which do not match any rule.
+func NewPolicyRuleEvaluator(policy *Policy, defaultLevel audit.Level) PolicyRuleEvaluator {
+	if defaultLevel == "" {
+		defaultLevel = audit.LevelMetadata
+	}
+	if policy == nil {
+		policy = &Policy{}
+	}
+	return &policyRuleEvaluator{Policy: *policy, defaultLevel: defaultLevel}
+}
+
+type policyRuleEvaluator struct {
+	Policy
+	defaultLevel audit.Level
+}
+
+func (p *policyRuleEvaluator) EvaluatePolicyRule(attrs *Attributes) RequestAuditConfig {
+	for _, rule := range p.Rules {
+		if ruleMatches(&rule, attrs) {
+			return RequestAuditConfig{
+				Level:      rule.Level,
+				OmitStages: unionStages(p.OmitStages, rule.OmitStages),
+			}
+		}
+	}
+	return RequestAuditConfig{Level: p.defaultLevel, OmitStages: p.OmitStages}
+}
+
+func (p *policyRuleEvaluator) Enabled() bool {
+	if !p.defaultLevel.Less(audit.LevelMetadata) {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if !rule.Level.Less(audit.LevelMetadata) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePolicy checks the policy for unknown levels and stages.
+func ValidatePolicy(policy *Policy) []error {
+	var errs []error
+	if policy == nil {
+		return errs
+	}
+	errs = append(errs, validateStages(policy.OmitStages, "omitStages")...)
+	for i, rule := range policy.Rules {
+		switch rule.Level {
+		case audit.LevelNone, audit.LevelMetadata, audit.LevelRequest, audit.LevelRequestResponse:
+		default:
+			errs = append(errs, fmt.Errorf("rules[%d].level: unsupported audit level %q", i, rule.Level))
+		}
+		errs = append(errs, validateStages(rule.OmitStages, fmt.Sprintf("rules[%d].omitStages", i))...)
+		for _, url := range rule.NonResourceURLs {
+			if idx := strings.Index(url, "*"); idx >= 0 && idx != len(url)-1 {
+				errs = append(errs, fmt.Errorf("rules[%d].nonResourceURLs: %q wildcard is only allowed as the final step", i, url))
+			}
+		}
+		if len(rule.NonResourceURLs) > 0 && (len(rule.Resources) > 0 || len(rule.Namespaces) > 0) {
+			errs = append(errs, fmt.Errorf("rules[%d]: rules cannot apply to both regular resources and non-resource URLs", i))
+		}
+	}
+	return errs
+}
+
+func validateStages(stages []audit.Stage, field string) []error {
+	var errs []error
+	for _, stage := range stages {
+		switch stage {
+		case audit.StageRequestReceived, audit.StageResponseStarted, audit.StageResponseComplete, audit.StagePanic:
+		default:
+			errs = append(errs, fmt.Errorf("%s: unsupported audit stage %q", field, stage))
+		}
+	}
+	return errs
+}
+
+func unionStages(stageLists ...[]audit.Stage) []audit.Stage {
+	m := make(map[audit.Stage]bool)
+	var result []audit.Stage
+	for _, stages := range stageLists {
+		for _, stage := range stages {
+			if !m[stage] {
+				m[stage] = true
+				result = append(result, stage)
+			}
+		}
+	}
+	return result
+}
+
+// ruleMatches checks whether the rule matches the request attrs.
+func ruleMatches(r *PolicyRule, attrs *Attributes) bool {
+	if len(r.Users) > 0 && (attrs.User == nil || !hasString(r.Users, attrs.User.GetName())) {
+		return false
+	}
+	if len(r.UserGroups) > 0 {
+		if attrs.User == nil {
+			return false
+		}
+		matched := false
+		for _, group := range attrs.User.GetGroups() {
+			if hasString(r.UserGroups, group) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Verbs) > 0 && !hasString(r.Verbs, attrs.Verb) {
+		return false
+	}
+	if len(r.Workspaces) > 0 && !hasString(r.Workspaces, attrs.workspace()) {
+		return false
+	}
+	if len(r.Clusters) > 0 && !hasString(r.Clusters, attrs.Cluster) {
+		return false
+	}
+
+	if len(r.Namespaces) > 0 || len(r.Resources) > 0 {
+		return ruleMatchesResource(r, attrs)
+	}
+
+	if len(r.NonResourceURLs) > 0 {
+		return ruleMatchesNonResource(r, attrs)
+	}
+
+	return true
+}
+
+// ruleMatchesNonResource checks whether the rule matches the non-resource request attrs.
+func ruleMatchesNonResource(r *PolicyRule, attrs *Attributes) bool {
+	if attrs.IsResourceRequest {
+		return false
+	}
+
+	path := attrs.Path
+	for _, spec := range r.NonResourceURLs {
+		if pathMatches(path, spec) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathMatches checks whether the path matches the path spec.
+func pathMatches(path, spec string) bool {
+	// Allow wildcard match
+	if spec == "*" {
+		return true
+	}
+	// Allow exact match
+	if spec == path {
+		return true
+	}
+	// Allow a trailing * subpath match
+	if strings.HasSuffix(spec, "*") && strings.HasPrefix(path, strings.TrimRight(spec, "*")) {
+		return true
+	}
+	return false
+}
+
+// ruleMatchesResource checks whether the rule matches the resource request attrs.
+func ruleMatchesResource(r *PolicyRule, attrs *Attributes) bool {
+	if !attrs.IsResourceRequest {
+		return false
+	}
+
+	if len(r.Namespaces) > 0 && !hasString(r.Namespaces, attrs.Namespace) {
+		return false
+	}
+	if len(r.Resources) == 0 {
+		return true
+	}
+
+	apiGroup := attrs.APIGroup
+	resource := attrs.Resource
+	subresource := attrs.Subresource
+	combinedResource := resource
+	// If subresource, the resource in the policy must match "(resource)/(subresource)"
+	if subresource != "" {
+		combinedResource = resource + "/" + subresource
+	}
+
+	name := attrs.Name
+
+	for _, gr := range r.Resources {
+		if gr.Group != apiGroup {
+			continue
+		}
+		if len(gr.Resources) == 0 {
+			return true
+		}
+		for _, res := range gr.Resources {
+			if len(gr.ResourceNames) == 0 || hasString(gr.ResourceNames, name) {
+				// match "*"
+				if res == combinedResource || res == "*" {
+					return true
+				}
+				// match "*/subresource"
+				if len(subresource) > 0 && strings.HasPrefix(res, "*/") && subresource == strings.TrimPrefix(res, "*/") {
+					return true
+				}
+				// match "resource/*"
+				if strings.HasSuffix(res, "/*") && resource == strings.TrimSuffix(res, "/*") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasString checks whether the list contains the given string.
+func hasString(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"testing"
+
+	"k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	k8srequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/request"
+)
+
+func TestEvaluatePolicyRule(t *testing.T) {
+	policy := &Policy{
+		OmitStages: []audit.Stage{audit.StageRequestReceived},
+		Rules: []PolicyRule{
+			{
+				Level: audit.LevelNone,
+				Verbs: []string{"list", "watch", "get"},
+			},
+			{
+				Level:     audit.LevelRequestResponse,
+				Resources: []GroupResources{{Group: "iam.kubesphere.io", Resources: []string{"users", "globalrolebindings"}}},
+			},
+			{
+				Level:      audit.LevelRequest,
+				Workspaces: []string{"system-workspace"},
+			},
+			{
+				Level:      audit.LevelMetadata,
+				UserGroups: []string{"system:serviceaccounts"},
+				OmitStages: []audit.Stage{audit.StageResponseComplete},
+			},
+			{
+				Level:           audit.LevelMetadata,
+				NonResourceURLs: []string{"/oauth/*"},
+			},
+		},
+	}
+	evaluator := NewPolicyRuleEvaluator(policy, audit.LevelNone)
+	if !evaluator.Enabled() {
+		t.Fatalf("expected evaluator to be enabled")
+	}
+
+	newAttrs := func(verb, group, resource, workspace string, u user.Info) *Attributes {
+		return &Attributes{
+			RequestInfo: &request.RequestInfo{RequestInfo: &k8srequest.RequestInfo{
+				IsResourceRequest: true,
+				Verb:              verb,
+				APIGroup:          group,
+				Resource:          resource,
+			}},
+			User:      u,
+			Workspace: workspace,
+		}
+	}
+	admin := &user.DefaultInfo{Name: "admin", Groups: []string{"system:authenticated"}}
+	sa := &user.DefaultInfo{Name: "system:serviceaccount:default:default", Groups: []string{"system:serviceaccounts"}}
+
+	tests := []struct {
+		name      string
+		attrs     *Attributes
+		wantLevel audit.Level
+		omitted   bool
+	}{
+		{"list is not recorded", newAttrs("list", "iam.kubesphere.io", "users", "", admin), audit.LevelNone, true},
+		{"iam write", newAttrs("update", "iam.kubesphere.io", "users", "", admin), audit.LevelRequestResponse, false},
+		{"workspace write", newAttrs("create", "apps", "deployments", "system-workspace", admin), audit.LevelRequest, false},
+		{"service account omitted", newAttrs("create", "apps", "deployments", "demo", sa), audit.LevelMetadata, true},
+		{"fallback to default level", newAttrs("create", "apps", "deployments", "demo", admin), audit.LevelNone, true},
+		{
+			"non resource url",
+			&Attributes{RequestInfo: &request.RequestInfo{RequestInfo: &k8srequest.RequestInfo{Verb: "post", Path: "/oauth/token"}}, User: admin},
+			audit.LevelMetadata,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := evaluator.EvaluatePolicyRule(tt.attrs)
+			if config.Level != tt.wantLevel {
+				t.Errorf("expected level %s, got %s", tt.wantLevel, config.Level)
+			}
+			if omitted := config.Omitted(audit.StageResponseComplete); omitted != tt.omitted {
+				t.Errorf("expected omitted %v, got %v", tt.omitted, omitted)
+			}
+		})
+	}
+
+	// The workspace is resolved only when a rule before the matched one matches the workspaces.
+	resolved := 0
+	attrs := newAttrs("list", "apps", "deployments", "", admin)
+	attrs.ResolveWorkspace = func() string {
+		resolved++
+		return "system-workspace"
+	}
+	if config := evaluator.EvaluatePolicyRule(attrs); config.Level != audit.LevelNone || resolved != 0 {
+		t.Errorf("expected level %s without resolving the workspace, got %s and %d resolutions", audit.LevelNone, config.Level, resolved)
+	}
+	attrs.Verb = "create"
+	if config := evaluator.EvaluatePolicyRule(attrs); config.Level != audit.LevelRequest || resolved != 1 {
+		t.Errorf("expected level %s with the resolved workspace, got %s and %d resolutions", audit.LevelRequest, config.Level, resolved)
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	policy := &Policy{
+		Rules: []PolicyRule{
+			{Level: "Everything"},
+			{Level: audit.LevelMetadata, OmitStages: []audit.Stage{"Unknown"}},
+			{Level: audit.LevelMetadata, NonResourceURLs: []string{"/foo*/bar"}},
+			{Level: audit.LevelMetadata, Namespaces: []string{"default"}, NonResourceURLs: []string{"/foo"}},
+		},
+	}
+	if errs := ValidatePolicy(policy); len(errs) != 4 {
+		t.Errorf("expected 4 errors, got %v", errs)
+	}
+}
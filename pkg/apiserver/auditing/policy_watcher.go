@@ -0,0 +1,112 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	runtimecache "sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+// PolicyConfigMapDataKey is the data key of the audit policy in a dedicated policy ConfigMap.
+const PolicyConfigMapDataKey = "policy.yaml"
+
+// WatchPolicyChanges watches the ConfigMap which holds the audit policy and
+// reloads the policy rules on change, without restarting ks-apiserver.
+// The policy is read from the ConfigMap named by Options.PolicyConfigMap if set,
+// otherwise from the `auditing.policy` section of the KubeSphere config.
+func (a *auditing) WatchPolicyChanges(ctx context.Context, cache runtimecache.Cache) error {
+	informer, err := cache.GetInformer(ctx, &corev1.ConfigMap{})
+	if err != nil {
+		return fmt.Errorf("get informer failed: %w", err)
+	}
+
+	_, err = informer.AddEventHandler(toolscache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			cm, ok := obj.(*corev1.ConfigMap)
+			return ok && a.isPolicyConfigMap(cm)
+		},
+		Handler: &toolscache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				a.onPolicyChange(obj.(*corev1.ConfigMap))
+			},
+			UpdateFunc: func(old, new interface{}) {
+				a.onPolicyChange(new.(*corev1.ConfigMap))
+			},
+			DeleteFunc: func(obj interface{}) {
+				klog.Infof("audit policy configmap deleted, fallback to the static audit policy")
+				a.setPolicy(a.staticPolicy)
+			},
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("add event handler failed: %w", err)
+	}
+
+	return nil
+}
+
+func (a *auditing) isPolicyConfigMap(cm *corev1.ConfigMap) bool {
+	if cm.Namespace != constants.KubeSphereNamespace {
+		return false
+	}
+	if a.policyConfigMap != "" {
+		return cm.Name == a.policyConfigMap
+	}
+	return cm.Name == constants.KubeSphereConfigName
+}
+
+func (a *auditing) onPolicyChange(cm *corev1.ConfigMap) {
+	policy, err := a.policyFromConfigMap(cm)
+	if err != nil {
+		klog.Errorf("failed to load audit policy from configmap %s/%s: %s", cm.Namespace, cm.Name, err)
+		return
+	}
+	if policy == nil {
+		policy = a.staticPolicy
+	}
+	a.setPolicy(policy)
+	klog.V(4).Infof("audit policy reloaded from configmap %s/%s", cm.Namespace, cm.Name)
+}
+
+func (a *auditing) policyFromConfigMap(cm *corev1.ConfigMap) (*Policy, error) {
+	if a.policyConfigMap != "" {
+		value, ok := cm.Data[PolicyConfigMapDataKey]
+		if !ok {
+			return nil, nil
+		}
+		policy := &Policy{}
+		if err := yaml.Unmarshal([]byte(value), policy); err != nil {
+			return nil, err
+		}
+		return policy, utilerrors.NewAggregate(ValidatePolicy(policy))
+	}
+
+	value, ok := cm.Data[constants.KubeSphereConfigMapDataKey]
+	if !ok {
+		return nil, nil
+	}
+	conf := &struct {
+		AuditingOptions *Options `yaml:"auditing,omitempty"`
+	}{}
+	if err := yaml.Unmarshal([]byte(value), conf); err != nil {
+		return nil, err
+	}
+	if conf.AuditingOptions == nil || conf.AuditingOptions.Policy == nil {
+		return nil, nil
+	}
+	return conf.AuditingOptions.Policy, utilerrors.NewAggregate(ValidatePolicy(conf.AuditingOptions.Policy))
+}
@@ -8,8 +8,7 @@ package webhook
 
 import (
 	"bytes"
-	"context"
-	"crypto/tls"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -19,112 +18,91 @@ import (
 )
 
 const (
-	GetSenderTimeout  = time.Second
-	SendTimeout       = time.Second * 3
-	DefaultSendersNum = 100
+	BackendName = "webhook"
+
+	SendTimeout = time.Second * 3
 
 	WebhookURL = "https://kube-auditing-webhook-svc.kubesphere-logging-system.svc:6443/audit/webhook/event"
 )
 
+// Config is the configuration of the webhook backend.
+type Config struct {
+	URL string
+	// TLSConfig of the webhook client, the certificate of the webhook is verified
+	// with the system roots if no CA file is specified, except for the default
+	// in-cluster webhook which serves a self-signed certificate.
+	internal.TLSConfig
+	internal.DeliveryConfig
+}
+
 type backend struct {
-	url              string
-	senderCh         chan interface{}
-	client           http.Client
-	sendTimeout      time.Duration
-	getSenderTimeout time.Duration
+	url    string
+	client http.Client
 }
 
-func NewBackend(url string, sendersNum int) internal.Backend {
+// NewBackend creates a webhook backend which delivers events at least once,
+// events are spooled first and then sent in order, failed requests are retried
+// with exponential backoff until stopCh is closed.
+func NewBackend(config *Config, stopCh <-chan struct{}) (internal.Backend, error) {
+	b, err := newBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewReliableBackend(BackendName, &config.DeliveryConfig, b.sendEvents, stopCh)
+}
 
-	b := backend{
-		url:              url,
-		getSenderTimeout: GetSenderTimeout,
-		sendTimeout:      SendTimeout,
+func newBackend(config *Config) (*backend, error) {
+	b := &backend{
+		url: config.URL,
 	}
 
 	if len(b.url) == 0 {
 		b.url = WebhookURL
 	}
 
-	num := sendersNum
-	if num == 0 {
-		num = DefaultSendersNum
+	tlsConfig := config.TLSConfig
+	// Keep compatible with the self-signed certificate of the default webhook, no CA of it is shipped.
+	if b.url == WebhookURL && tlsConfig.CAFile == "" && !tlsConfig.InsecureSkipVerify {
+		klog.Warningf("the certificate of the default auditing webhook %s is NOT verified, "+
+			"specify the CA of the webhook with the caFile of the webhookOptions to verify it", WebhookURL)
+		tlsConfig.InsecureSkipVerify = true
+	}
+	clientTLSConfig, err := internal.NewTLSConfig(&tlsConfig)
+	if err != nil {
+		return nil, err
 	}
-	b.senderCh = make(chan interface{}, num)
-
 	b.client = http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
+			TLSClientConfig: clientTLSConfig,
 		},
-		Timeout: b.sendTimeout,
+		Timeout: SendTimeout,
 	}
-
-	return &b
-}
-
-func (b *backend) ProcessEvents(events ...[]byte) {
-	go b.sendEvents(events...)
+	return b, nil
 }
 
-func (b *backend) sendEvents(events ...[]byte) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.sendTimeout)
-	defer cancel()
-
-	stopCh := make(chan struct{})
-	skipReturnSender := false
-
-	send := func() {
-		ctx, cancel := context.WithTimeout(context.Background(), b.getSenderTimeout)
-		defer cancel()
-
-		select {
-		case <-ctx.Done():
-			klog.Error("Get auditing event sender timeout")
-			skipReturnSender = true
-			return
-		case b.senderCh <- struct{}{}:
-		}
-
-		start := time.Now()
-		defer func() {
-			stopCh <- struct{}{}
-			klog.V(8).Infof("send %d auditing events used %d", len(events), time.Since(start).Milliseconds())
-		}()
-
-		var body bytes.Buffer
-		for _, event := range events {
-			if _, err := body.Write(event); err != nil {
-				klog.Errorf("send auditing event error %s", err)
-				return
-			}
-		}
-
-		response, err := b.client.Post(b.url, "application/json", &body)
-		if err != nil {
-			klog.Errorf("send audit events error, %s", err)
-			return
-		}
-		defer response.Body.Close()
+func (b *backend) sendEvents(events [][]byte) error {
+	start := time.Now()
+	defer func() {
+		klog.V(8).Infof("send %d auditing events used %d", len(events), time.Since(start).Milliseconds())
+	}()
 
-		if response.StatusCode != http.StatusOK {
-			klog.Errorf("send audit events error[%d]", response.StatusCode)
-			return
-		}
+	var body bytes.Buffer
+	for _, event := range events {
+		body.Write(event)
 	}
 
-	go send()
+	response, err := b.client.Post(b.url, "application/json", &body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
 
-	defer func() {
-		if !skipReturnSender {
-			<-b.senderCh
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("unexpected response code %d", response.StatusCode)
+		if internal.PermanentStatus(response.StatusCode) {
+			return internal.Permanent(err)
 		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		klog.Error("send audit events timeout")
-	case <-stopCh:
+		return err
 	}
+	return nil
 }
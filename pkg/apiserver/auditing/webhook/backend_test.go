@@ -0,0 +1,230 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/internal"
+)
+
+type certificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCertificate(t *testing.T, name string, usage x509.ExtKeyUsage, parent *certificate) *certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &certificate{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *certificate) write(t *testing.T, dir string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, c.cert.Subject.CommonName+".crt")
+	keyFile := filepath.Join(dir, c.cert.Subject.CommonName+".key")
+	if err := os.WriteFile(certFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	failures atomic.Int32
+	bodies   []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.failures.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(body))
+}
+
+func (r *receiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func waitForEvents(t *testing.T, r *receiver, expected int) []string {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if bodies := r.received(); len(bodies) >= expected {
+			return bodies
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("expected %d deliveries, got %q", expected, r.received())
+	return nil
+}
+
+func TestBackendRetry(t *testing.T) {
+	r := &receiver{}
+	r.failures.Store(1)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	b, err := NewBackend(&Config{URL: server.URL}, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ProcessEvents([]byte(`{"AuditID":"1"}`), []byte(`{"AuditID":"2"}`))
+
+	// the failed batch is retried after the backoff
+	bodies := waitForEvents(t, r, 1)
+	if bodies[0] != `{"AuditID":"1"}{"AuditID":"2"}` {
+		t.Fatalf("unexpected body %q", bodies[0])
+	}
+}
+
+func TestBackendTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCertificate(t, "ca", x509.ExtKeyUsageAny, nil)
+	serverCert := newCertificate(t, "server", x509.ExtKeyUsageServerAuth, ca)
+	clientCert := newCertificate(t, "client", x509.ExtKeyUsageClientAuth, ca)
+	caFile, _ := ca.write(t, dir)
+	certFile, keyFile := clientCert.write(t, dir)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	r := &receiver{}
+	server := httptest.NewUnstartedServer(r)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		tlsConfig internal.TLSConfig
+		delivered bool
+	}{
+		{
+			name:      "certificate of the server is verified with the system roots by default",
+			tlsConfig: internal.TLSConfig{CertFile: certFile, KeyFile: keyFile},
+		},
+		{
+			name:      "client certificate is required",
+			tlsConfig: internal.TLSConfig{CAFile: caFile},
+		},
+		{
+			name:      "verification is only skipped when explicitly asked",
+			tlsConfig: internal.TLSConfig{CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true},
+			delivered: true,
+		},
+		{
+			name:      "mTLS",
+			tlsConfig: internal.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+			delivered: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := newBackend(&Config{URL: server.URL, TLSConfig: test.tlsConfig})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.sendEvents([][]byte{[]byte(`{"AuditID":"1"}`)})
+			if test.delivered != (err == nil) {
+				t.Fatalf("expected delivered %t, got error %v", test.delivered, err)
+			}
+		})
+	}
+}
+
+func TestDefaultWebhookTLS(t *testing.T) {
+	caFile, _ := newCertificate(t, "ca", x509.ExtKeyUsageAny, nil).write(t, t.TempDir())
+	tests := []struct {
+		name               string
+		config             *Config
+		insecureSkipVerify bool
+	}{
+		{
+			name:               "default webhook without ca",
+			config:             &Config{},
+			insecureSkipVerify: true,
+		},
+		{
+			name:   "default webhook with ca",
+			config: &Config{TLSConfig: internal.TLSConfig{CAFile: caFile}},
+		},
+		{
+			name:   "custom webhook without ca",
+			config: &Config{URL: "https://auditing.example.com/event"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := newBackend(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify != test.insecureSkipVerify {
+				t.Fatalf("expected insecureSkipVerify %t", test.insecureSkipVerify)
+			}
+		})
+	}
+}
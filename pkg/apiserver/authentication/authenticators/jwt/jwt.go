@@ -8,6 +8,7 @@ package jwt
 
 import (
 	"context"
+	"errors"
 
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
@@ -23,6 +24,8 @@ import (
 	"kubesphere.io/kubesphere/pkg/utils/serviceaccount"
 )
 
+var errMFATokenNotAllowed = errors.New("mfa token is not allowed to access the api")
+
 // TokenAuthenticator implements kubernetes token authenticate interface with our custom logic.
 // TokenAuthenticator will retrieve user info from cache by given token. If empty or invalid token
 // was given, authenticator will still give passed response at the condition user will be user.Anonymous
@@ -42,13 +45,18 @@ func NewTokenAuthenticator(cache runtimecache.Cache, tokenOperator auth.TokenMan
 	}
 }
 
-func (t *tokenAuthenticator) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
-	verified, err := t.tokenOperator.Verify(token)
+func (t *tokenAuthenticator) AuthenticateToken(ctx context.Context, tokenString string) (*authenticator.Response, bool, error) {
+	verified, err := t.tokenOperator.Verify(tokenString)
 	if err != nil {
 		klog.Warning(err)
 		return nil, false, err
 	}
 
+	// the mfa token is only accepted by the otp grant
+	if verified.TokenType == token.MFAToken {
+		return nil, false, errMFATokenNotAllowed
+	}
+
 	if serviceaccount.IsServiceAccountToken(verified.Subject) {
 		if t.clusterRole == string(clusterv1alpha1.ClusterRoleHost) {
 			_, err = t.validateServiceAccount(ctx, verified)
@@ -67,6 +75,7 @@ func (t *tokenAuthenticator) AuthenticateToken(ctx context.Context, token string
 		}, true, nil
 	}
 
+	groups := []string{user.AllAuthenticated}
 	if t.clusterRole == string(clusterv1alpha1.ClusterRoleHost) {
 		userInfo := &iamv1beta1.User{}
 		if err := t.cache.Get(ctx, types.NamespacedName{Name: verified.User.GetName()}, userInfo); err != nil {
@@ -77,13 +86,14 @@ func (t *tokenAuthenticator) AuthenticateToken(ctx context.Context, token string
 		if userInfo.Status.State == iamv1beta1.UserDisabled {
 			return nil, false, auth.AccountIsNotActiveError
 		}
+		// the groups are maintained by the groupbinding controller
+		groups = append(groups, userInfo.Spec.Groups...)
 	}
 
 	return &authenticator.Response{
 		User: &user.DefaultInfo{
-			Name: verified.User.GetName(),
-			// TODO(wenhaozhou) Add user`s groups(can be searched by GroupBinding)
-			Groups: []string{user.AllAuthenticated},
+			Name:   verified.User.GetName(),
+			Groups: groups,
 		},
 	}, true, nil
 }
@@ -67,6 +67,26 @@ type Configuration struct {
 
 	// The options of identify provider
 	ProviderOptions options.DynamicOptions `json:"provider" yaml:"provider"`
+
+	// Synchronize the groups of identities into the groups of a workspace,
+	// the group memberships are not synchronized if it's nil.
+	GroupSync *GroupSyncOptions `json:"groupSync,omitempty" yaml:"groupSync,omitempty"`
+}
+
+// GroupSyncEnabled returns true if the groups of identities are synchronized into a workspace.
+func (c *Configuration) GroupSyncEnabled() bool {
+	return c.GroupSync != nil && c.GroupSync.Workspace != ""
+}
+
+type GroupSyncOptions struct {
+	// The workspace that the groups are synchronized into.
+	Workspace string `json:"workspace" yaml:"workspace"`
+
+	// The prefix of the synchronized group names, defaults to the provider name.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// Only the groups in the list are synchronized, all groups are synchronized if it's empty.
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
 }
 
 type ConfigurationGetter interface {
@@ -15,6 +15,12 @@ type GenericProvider interface {
 	Authenticate(username string, password string) (Identity, error)
 }
 
+// GroupsProvider is implemented by the generic providers which look up the groups of the End-User
+// with additional requests, the lookup is only enabled if the groups are synchronized.
+type GroupsProvider interface {
+	SetGroupLookup(enabled bool)
+}
+
 type GenericProviderFactory interface {
 	// Type unique type of the provider
 	Type() string
@@ -10,8 +10,10 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -25,6 +27,8 @@ const (
 	userInfoURL = "https://api.github.com/user"
 	authURL     = "https://github.com/login/oauth/authorize"
 	tokenURL    = "https://github.com/login/oauth/access_token"
+	// maxTeamPages is the max number of pages of the teams of a user, 100 teams per page.
+	maxTeamPages = 100
 )
 
 func init() {
@@ -54,6 +58,10 @@ type github struct {
 	// Scope specifies optional requested permissions.
 	Scopes []string `json:"scopes" yaml:"scopes"`
 
+	// ListTeams lists the teams of the user as the groups in the form of "org/team-slug",
+	// the read:org scope is required.
+	ListTeams bool `json:"listTeams" yaml:"listTeams"`
+
 	Config *oauth2.Config `json:"-" yaml:"-"`
 }
 
@@ -102,6 +110,15 @@ type githubIdentity struct {
 	OwnedPrivateRepos int       `json:"owned_private_repos"`
 	DiskUsage         int       `json:"disk_usage"`
 	Collaborators     int       `json:"collaborators"`
+	// Teams is not a field of the user, it is listed with the teams API.
+	Teams []string `json:"-"`
+}
+
+type githubTeam struct {
+	Slug         string `json:"slug"`
+	Organization struct {
+		Login string `json:"login"`
+	} `json:"organization"`
 }
 
 type ldapProviderFactory struct {
@@ -157,6 +174,10 @@ func (g githubIdentity) GetEmail() string {
 	return g.Email
 }
 
+func (g githubIdentity) GetGroups() []string {
+	return g.Teams
+}
+
 func (g *github) IdentityExchangeCallback(req *http.Request) (identityprovider.Identity, error) {
 	// OAuth2 callback, see also https://tools.ietf.org/html/rfc6749#section-4.1.2
 	code := req.URL.Query().Get("code")
@@ -175,22 +196,64 @@ func (g *github) IdentityExchangeCallback(req *http.Request) (identityprovider.I
 	if err != nil {
 		return nil, err
 	}
-	resp, err := oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)).Get(g.Endpoint.UserInfoURL)
-	if err != nil {
+	client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(token))
+
+	var githubIdentity githubIdentity
+	if _, err = getJSON(client, g.Endpoint.UserInfoURL, &githubIdentity); err != nil {
 		return nil, err
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	if g.ListTeams {
+		// https://docs.github.com/en/rest/teams/teams#list-teams-for-the-authenticated-user
+		url := g.Endpoint.UserInfoURL + "/teams?per_page=100"
+		for page := 0; url != ""; page++ {
+			if page == maxTeamPages {
+				return nil, fmt.Errorf("the teams of user %s exceed %d pages", githubIdentity.Login, maxTeamPages)
+			}
+			var teams []githubTeam
+			if url, err = getJSON(client, url, &teams); err != nil {
+				return nil, err
+			}
+			for _, team := range teams {
+				githubIdentity.Teams = append(githubIdentity.Teams, team.Organization.Login+"/"+team.Slug)
+			}
+		}
+	}
+
+	return githubIdentity, nil
+}
+
+// getJSON decodes the response of url into v, the URL of the next page is returned if the response is paginated.
+func getJSON(client *http.Client, url string, v interface{}) (string, error) {
+	resp, err := client.Get(url)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	var githubIdentity githubIdentity
-	err = json.Unmarshal(data, &githubIdentity)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s: %s", resp.StatusCode, url, data)
+	}
+	return nextPage(resp.Header), json.Unmarshal(data, v)
+}
 
-	return githubIdentity, nil
+// nextPage returns the URL of the next page in the Link header, e.g.
+// Link: <https://api.github.com/user/teams?page=2>; rel="next", <https://api.github.com/user/teams?page=5>; rel="last"
+func nextPage(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
 }
@@ -48,6 +48,20 @@ var _ = BeforeSuite(func() {
 				"login": "test",
 				"email": "test@kubesphere.io",
 			}
+		case "/user/teams?per_page=100":
+			w.Header().Add("Content-Type", "application/json")
+			w.Header().Add("Link", fmt.Sprintf(`<%s/user/teams?per_page=100&page=2>; rel="next", <%s/user/teams?per_page=100&page=2>; rel="last"`, githubServer.URL, githubServer.URL))
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"slug": "dev", "organization": map[string]interface{}{"login": "kubesphere"}},
+			})
+			return
+		case "/user/teams?per_page=100&page=2":
+			w.Header().Add("Content-Type", "application/json")
+			w.Header().Add("Link", fmt.Sprintf(`<%s/user/teams?per_page=100&page=1>; rel="prev", <%s/user/teams?per_page=100&page=1>; rel="first"`, githubServer.URL, githubServer.URL))
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"slug": "ops", "organization": map[string]interface{}{"login": "kubesphere"}},
+			})
+			return
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte("not implemented"))
@@ -112,6 +126,7 @@ scopes:
 				"clientSecret":       "2b70536f79ec8d2939863509d05e2a71c268b9af",
 				"redirectURL":        "https://ks-console.kubesphere-system.svc/oauth/redirect/github",
 				"insecureSkipVerify": true,
+				"listTeams":          true,
 				"endpoint": options.DynamicOptions{
 					"authURL":     fmt.Sprintf("%s/login/oauth/authorize", githubServer.URL),
 					"tokenURL":    fmt.Sprintf("%s/login/oauth/access_token", githubServer.URL),
@@ -126,6 +141,7 @@ scopes:
 				"clientSecret":       "2b70536f79ec8d2939863509d05e2a71c268b9af",
 				"redirectURL":        "https://ks-console.kubesphere-system.svc/oauth/redirect/github",
 				"insecureSkipVerify": true,
+				"listTeams":          true,
 				"endpoint": options.DynamicOptions{
 					"authURL":     fmt.Sprintf("%s/login/oauth/authorize", githubServer.URL),
 					"tokenURL":    fmt.Sprintf("%s/login/oauth/access_token", githubServer.URL),
@@ -142,6 +158,7 @@ scopes:
 			Expect(identity.GetUserID()).Should(Equal("test"))
 			Expect(identity.GetUsername()).Should(Equal("test"))
 			Expect(identity.GetEmail()).Should(Equal("test@kubesphere.io"))
+			Expect(identity.(identityprovider.GroupsIdentity).GetGroups()).Should(Equal([]string{"kubesphere/dev", "kubesphere/ops"}))
 		})
 	})
 })
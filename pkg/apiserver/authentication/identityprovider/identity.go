@@ -17,3 +17,10 @@ type Identity interface {
 	// GetEmail optional
 	GetEmail() string
 }
+
+// GroupsIdentity is implemented by the identities which carry the groups of the End-User,
+// the groups of the other identities are unknown and not synchronized.
+type GroupsIdentity interface {
+	// GetGroups returns the groups the End-User is a member of at the Issuer.
+	GetGroups() []string
+}
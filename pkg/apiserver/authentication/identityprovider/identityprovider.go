@@ -15,6 +15,8 @@ import (
 	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	runtimecache "sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
 )
 
 var SharedIdentityProviderController = NewController()
@@ -22,14 +24,17 @@ var SharedIdentityProviderController = NewController()
 type Controller struct {
 	identityProviders       *sync.Map
 	identityProviderConfigs *sync.Map
+	// cache is shared by the stateful providers
+	cache cache.Interface
 }
 
 func NewController() *Controller {
 	return &Controller{identityProviders: &sync.Map{}, identityProviderConfigs: &sync.Map{}}
 }
 
-func (c *Controller) WatchConfigurationChanges(ctx context.Context, cache runtimecache.Cache) error {
-	informer, err := cache.GetInformer(ctx, &v1.Secret{})
+func (c *Controller) WatchConfigurationChanges(ctx context.Context, runtimeCache runtimecache.Cache, cacheClient cache.Interface) error {
+	c.cache = cacheClient
+	informer, err := runtimeCache.GetInformer(ctx, &v1.Secret{})
 	if err != nil {
 		return fmt.Errorf("get informer failed: %w", err)
 	}
@@ -85,6 +90,9 @@ func (c *Controller) OnConfigurationChange(secret *v1.Secret) {
 			// don’t return errors, decoupling external dependencies
 			klog.Error(fmt.Sprintf("failed to create identity provider %s: %s", configuration.Name, err))
 		} else {
+			if stateful, ok := provider.(StatefulProvider); ok {
+				stateful.SetCache(c.cache)
+			}
 			c.identityProviders.Store(configuration.Name, provider)
 			c.identityProviderConfigs.Store(configuration.Name, configuration)
 			klog.Infof("create identity provider %s successfully", configuration.Name)
@@ -94,6 +102,9 @@ func (c *Controller) OnConfigurationChange(secret *v1.Secret) {
 		if provider, err := factory.Create(configuration.ProviderOptions); err != nil {
 			klog.Error(fmt.Sprintf("failed to create identity provider %s: %s", configuration.Name, err))
 		} else {
+			if groupsProvider, ok := provider.(GroupsProvider); ok {
+				groupsProvider.SetGroupLookup(configuration.GroupSyncEnabled())
+			}
 			c.identityProviders.Store(configuration.Name, provider)
 			c.identityProviderConfigs.Store(configuration.Name, configuration)
 			klog.V(4).Infof("create identity provider %s successfully", configuration.Name)
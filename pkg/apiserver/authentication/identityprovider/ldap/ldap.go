@@ -27,8 +27,10 @@ import (
 )
 
 const (
-	ldapIdentityProvider = "LDAPIdentityProvider"
-	defaultReadTimeout   = 15000
+	ldapIdentityProvider        = "LDAPIdentityProvider"
+	defaultReadTimeout          = 15000
+	defaultGroupMemberAttribute = "member"
+	defaultGroupNameAttribute   = "cn"
 )
 
 func init() {
@@ -63,12 +65,18 @@ type ldapProvider struct {
 	GroupSearchFilter string `json:"groupSearchFilter,omitempty" yaml:"groupSearchFilter"`
 	// Attribute on a user object storing the groups the user is a member of.
 	UserMemberAttribute string `json:"userMemberAttribute,omitempty" yaml:"userMemberAttribute"`
-	// Attribute on a group object storing the information for primary group membership.
+	// Attribute on a group object storing the information for primary group membership, default to member.
+	// The values of the attribute are the DNs of the members, or the login attribute values if it is memberUid.
 	GroupMemberAttribute string `json:"groupMemberAttribute,omitempty" yaml:"groupMemberAttribute"`
+	// Attribute on a group object storing the group name, default to cn.
+	GroupNameAttribute string `json:"groupNameAttribute,omitempty" yaml:"groupNameAttribute"`
 	// The following three fields are direct mappings of attributes on the user entry.
 	// login attribute used for comparing user entries.
 	LoginAttribute string `json:"loginAttribute" yaml:"loginAttribute"`
 	MailAttribute  string `json:"mailAttribute" yaml:"mailAttribute"`
+
+	// the groups are only looked up if they are synchronized
+	lookupGroups bool
 }
 
 type ldapProviderFactory struct {
@@ -94,6 +102,12 @@ type ldapIdentity struct {
 	Email    string
 }
 
+// ldapGroupsIdentity is the identity with the groups looked up.
+type ldapGroupsIdentity struct {
+	ldapIdentity
+	Groups []string
+}
+
 func (l *ldapIdentity) GetUserID() string {
 	return l.Username
 }
@@ -106,6 +120,14 @@ func (l *ldapIdentity) GetEmail() string {
 	return l.Email
 }
 
+func (l *ldapGroupsIdentity) GetGroups() []string {
+	return l.Groups
+}
+
+func (l *ldapProvider) SetGroupLookup(enabled bool) {
+	l.lookupGroups = enabled
+}
+
 func (l ldapProvider) Authenticate(username string, password string) (identityprovider.Identity, error) {
 	conn, err := l.newConn()
 	if err != nil {
@@ -125,6 +147,10 @@ func (l ldapProvider) Authenticate(username string, password string) (identitypr
 	if l.UserSearchFilter != "" {
 		filter = fmt.Sprintf("(&%s%s)", filter, l.UserSearchFilter)
 	}
+	attributes := []string{l.LoginAttribute, l.MailAttribute}
+	if l.lookupGroups && l.UserMemberAttribute != "" {
+		attributes = append(attributes, l.UserMemberAttribute)
+	}
 	result, err := conn.Search(&ldap.SearchRequest{
 		BaseDN:       l.UserSearchBase,
 		Scope:        ldap.ScopeWholeSubtree,
@@ -133,7 +159,7 @@ func (l ldapProvider) Authenticate(username string, password string) (identitypr
 		TimeLimit:    0,
 		TypesOnly:    false,
 		Filter:       filter,
-		Attributes:   []string{l.LoginAttribute, l.MailAttribute},
+		Attributes:   attributes,
 	})
 	if err != nil {
 		klog.Error(err)
@@ -160,10 +186,83 @@ func (l ldapProvider) Authenticate(username string, password string) (identitypr
 	}
 	email := entry.GetAttributeValue(l.MailAttribute)
 	uid := entry.GetAttributeValue(l.LoginAttribute)
-	return &ldapIdentity{
+	identity := ldapIdentity{
 		Username: uid,
 		Email:    email,
-	}, nil
+	}
+	if !l.lookupGroups {
+		return &identity, nil
+	}
+	groups, err := l.searchGroups(conn, entry)
+	if err != nil {
+		// the groups are unknown and not synchronized, the user is still authenticated
+		klog.Errorf("ldap: failed to look up the groups of %s: %v", uid, err)
+		return &identity, nil
+	}
+	return &ldapGroupsIdentity{ldapIdentity: identity, Groups: groups}, nil
+}
+
+// searchGroups returns the names of the groups the user is a member of. The groups are read from
+// the UserMemberAttribute of the user entry if it is configured, otherwise they are searched
+// under the GroupSearchBase.
+func (l ldapProvider) searchGroups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	if l.UserMemberAttribute != "" {
+		groups := make([]string, 0)
+		for _, value := range entry.GetAttributeValues(l.UserMemberAttribute) {
+			// the values are usually the DNs of the groups, e.g. memberOf
+			if dn, err := ldap.ParseDN(value); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+				groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+			} else {
+				groups = append(groups, value)
+			}
+		}
+		return groups, nil
+	}
+
+	if l.GroupSearchBase == "" {
+		return nil, fmt.Errorf("neither userMemberAttribute nor groupSearchBase is configured")
+	}
+
+	// the connection is bound to the user after verifying the password
+	if err := conn.Bind(l.ManagerDN, l.ManagerPassword); err != nil {
+		return nil, err
+	}
+
+	memberAttribute := l.GroupMemberAttribute
+	if memberAttribute == "" {
+		memberAttribute = defaultGroupMemberAttribute
+	}
+	member := entry.DN
+	if strings.EqualFold(memberAttribute, "memberUid") {
+		member = entry.GetAttributeValue(l.LoginAttribute)
+	}
+	nameAttribute := l.GroupNameAttribute
+	if nameAttribute == "" {
+		nameAttribute = defaultGroupNameAttribute
+	}
+
+	filter := fmt.Sprintf("(%s=%s)", memberAttribute, ldap.EscapeFilter(member))
+	if l.GroupSearchFilter != "" {
+		filter = fmt.Sprintf("(&%s%s)", filter, l.GroupSearchFilter)
+	}
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:       l.GroupSearchBase,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		Filter:       filter,
+		Attributes:   []string{nameAttribute},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to search groups: %v", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		if name := group.GetAttributeValue(nameAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
 }
 
 func (l *ldapProvider) newConn() (*ldap.Conn, error) {
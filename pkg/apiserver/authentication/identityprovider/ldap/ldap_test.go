@@ -53,7 +53,7 @@ mailAttribute: mail
 		LoginAttribute:       "uid",
 		MailAttribute:        "mail",
 	}
-	if diff := cmp.Diff(got, expected); diff != "" {
+	if diff := cmp.Diff(got, expected, cmp.AllowUnexported(ldapProvider{})); diff != "" {
 		t.Errorf("%T differ (-got, +want): %s", expected, diff)
 	}
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"kubesphere.io/kubesphere/pkg/server/options"
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
 )
 
 type OAuthProvider interface {
@@ -23,3 +24,25 @@ type OAuthProviderFactory interface {
 	// Create Apply the dynamic options
 	Create(options options.DynamicOptions) (OAuthProvider, error)
 }
+
+// LoginInitiator is implemented by the OAuth providers which require the login request
+// to be built by KubeSphere, such as the SAML AuthnRequest.
+type LoginInitiator interface {
+	// LoginURL returns the URL that the user agent is redirected to, the state will be sent back to the callback.
+	// The cookie binds the login request to the user agent, it must be set in the redirect response if not nil.
+	LoginURL(state string) (string, *http.Cookie, error)
+}
+
+// MetadataProvider is implemented by the OAuth providers which publish the metadata of KubeSphere
+// as a relying party, such as the SAML service provider metadata.
+type MetadataProvider interface {
+	// Metadata returns the content type and the content of the metadata.
+	Metadata() (string, []byte, error)
+}
+
+// StatefulProvider is implemented by the OAuth providers which keep the state of the login requests, such as the
+// IDs of the SAML AuthnRequests. The state is kept in the cache shared by all replicas of ks-apiserver, because
+// the callback may be handled by a replica other than the one that built the login request.
+type StatefulProvider interface {
+	SetCache(cache cache.Interface)
+}
@@ -72,6 +72,9 @@ type oidcProvider struct {
 	// Configurable key which contains the preferred username claims
 	PreferredUsernameKey string `json:"preferredUsernameKey" yaml:"preferredUsernameKey"`
 
+	// Configurable key which contains the groups claims, default to groups
+	GroupsKey string `json:"groupsKey" yaml:"groupsKey"`
+
 	Provider     *oidc.Provider        `json:"-" yaml:"-"`
 	OAuth2Config *oauth2.Config        `json:"-" yaml:"-"`
 	Verifier     *oidc.IDTokenVerifier `json:"-" yaml:"-"`
@@ -107,6 +110,8 @@ type oidcIdentity struct {
 	// Its value MUST conform to the RFC 5322 [RFC5322] addr-spec syntax.
 	// The RP MUST NOT rely upon this value being unique.
 	Email string `json:"email"`
+	// The groups the End-User is a member of.
+	Groups []string `json:"groups"`
 }
 
 func (o oidcIdentity) GetUserID() string {
@@ -121,6 +126,10 @@ func (o oidcIdentity) GetEmail() string {
 	return o.Email
 }
 
+func (o oidcIdentity) GetGroups() []string {
+	return o.Groups
+}
+
 type oidcProviderFactory struct {
 }
 
@@ -290,9 +299,27 @@ func (o *oidcProvider) IdentityExchangeCallback(req *http.Request) (identityprov
 		preferredUsername, _ = claims["name"].(string)
 	}
 
+	groupsKey := "groups"
+	if o.GroupsKey != "" {
+		groupsKey = o.GroupsKey
+	}
+	// the groups claim is either an array of strings or a single string
+	var groups []string
+	switch value := claims[groupsKey].(type) {
+	case string:
+		groups = []string{value}
+	case []interface{}:
+		for _, group := range value {
+			if group, ok := group.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	}
+
 	return &oidcIdentity{
 		Sub:               subject,
 		PreferredUsername: preferredUsername,
 		Email:             email,
+		Groups:            groups,
 	}, nil
 }
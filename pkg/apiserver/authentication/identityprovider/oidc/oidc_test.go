@@ -120,6 +120,7 @@ var _ = BeforeSuite(func() {
 				"email":          "test@kubesphere.io",
 				"email_verified": "true",
 				"name":           "test",
+				"groups":         []string{"developers", "operators"},
 				"iat":            time.Now().Unix(),
 				"exp":            time.Now().Add(10 * time.Hour).Unix(),
 			}
@@ -189,6 +190,7 @@ var _ = Describe("OIDC", func() {
 			Expect(identity.GetUserID()).Should(Equal("110169484474386276334"))
 			Expect(identity.GetUsername()).Should(Equal("test"))
 			Expect(identity.GetEmail()).Should(Equal("test@kubesphere.io"))
+			Expect(identity.(identityprovider.GroupsIdentity).GetGroups()).Should(Equal([]string{"developers", "operators"}))
 		})
 	})
 })
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	namespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	namespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	nameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// entitiesDescriptor is the SAML metadata, see also https://docs.oasis-open.org/security/saml/v2.0/saml-metadata-2.0-os.pdf
+type entitiesDescriptor struct {
+	XMLName            xml.Name             `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntitiesDescriptor"`
+	EntityDescriptors  []entityDescriptor   `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntitiesDescriptor []entitiesDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntitiesDescriptor"`
+}
+
+type entityDescriptor struct {
+	XMLName           xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID          string             `xml:"entityID,attr"`
+	IDPSSODescriptors []idpSSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors      []keyDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleSignOnService []endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+type keyDescriptor struct {
+	Use              string   `xml:"use,attr"`
+	X509Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+}
+
+type endpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+// idpMetadata is the information of the identity provider used by the service provider.
+type idpMetadata struct {
+	EntityID     string
+	SSOURL       string
+	Certificates []*x509.Certificate
+}
+
+func parseIDPMetadata(data []byte) (*idpMetadata, error) {
+	var descriptors []entityDescriptor
+	var entity entityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil {
+		descriptors = append(descriptors, entity)
+	} else {
+		var entities entitiesDescriptor
+		if err = xml.Unmarshal(data, &entities); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata: %s", err)
+		}
+		descriptors = entities.flatten()
+	}
+
+	for _, descriptor := range descriptors {
+		for _, idp := range descriptor.IDPSSODescriptors {
+			metadata := &idpMetadata{EntityID: descriptor.EntityID}
+			for _, service := range idp.SingleSignOnService {
+				if service.Binding == bindingHTTPRedirect {
+					metadata.SSOURL = service.Location
+				}
+			}
+			if metadata.SSOURL == "" {
+				return nil, errors.New("the HTTP-Redirect binding of single sign-on service is not found")
+			}
+			for _, key := range idp.KeyDescriptors {
+				if key.Use != "" && key.Use != "signing" {
+					continue
+				}
+				for _, data := range key.X509Certificates {
+					der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+					if err != nil {
+						return nil, fmt.Errorf("failed to decode certificate: %s", err)
+					}
+					certificate, err := x509.ParseCertificate(der)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse certificate: %s", err)
+					}
+					metadata.Certificates = append(metadata.Certificates, certificate)
+				}
+			}
+			if len(metadata.Certificates) == 0 {
+				return nil, errors.New("the signing certificate is not found")
+			}
+			return metadata, nil
+		}
+	}
+	return nil, errors.New("the IDPSSODescriptor is not found")
+}
+
+func (e entitiesDescriptor) flatten() []entityDescriptor {
+	descriptors := e.EntityDescriptors
+	for _, nested := range e.EntitiesDescriptor {
+		descriptors = append(descriptors, nested.flatten()...)
+	}
+	return descriptors
+}
+
+type spEntityDescriptor struct {
+	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                     `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                   `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormat               string                   `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	AssertionConsumerService   assertionConsumerService `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// authnRequest is the authentication request sent to the identity provider,
+// see also https://docs.oasis-open.org/security/saml/v2.0/saml-core-2.0-os.pdf
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      issuer       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
@@ -0,0 +1,528 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider"
+	"kubesphere.io/kubesphere/pkg/server/options"
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+const (
+	statusSuccess               = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	subjectConfirmationBearer   = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	metadataContentType         = "application/samlmetadata+xml"
+	maxResponseSize             = 1 << 20
+	maxClockSkew                = 3 * time.Minute
+	defaultMetadataFetchTimeout = 10 * time.Second
+	// authnRequestMaxAge is how long the response to an AuthnRequest is accepted, the user must log in to
+	// the identity provider in time.
+	authnRequestMaxAge = 15 * time.Minute
+	// authnRequestCookie keeps the ID of the AuthnRequest in the user agent which initiated the login,
+	// only the response to it is accepted from the same user agent.
+	authnRequestCookie = "kubesphere-saml-request"
+)
+
+func init() {
+	identityprovider.RegisterOAuthProviderFactory(&samlProviderFactory{})
+}
+
+type samlProvider struct {
+	// EntityID is the entity ID of KubeSphere as a service provider, defaults to the AssertionConsumerServiceURL.
+	EntityID string `json:"entityID" yaml:"entityID"`
+
+	// AssertionConsumerServiceURL is the URL that the identity provider posts the SAML responses to,
+	// which is the callback URL of this identity provider, e.g. https://ks-console.example.com/oauth/redirect/saml
+	AssertionConsumerServiceURL string `json:"assertionConsumerServiceURL" yaml:"assertionConsumerServiceURL"`
+
+	// IDPMetadataURL is the URL of the identity provider metadata.
+	IDPMetadataURL string `json:"idpMetadataURL" yaml:"idpMetadataURL"`
+
+	// IDPMetadata is the inline XML of the identity provider metadata, it takes precedence over the IDPMetadataURL.
+	IDPMetadata string `json:"idpMetadata" yaml:"idpMetadata"`
+
+	// NameIDFormat is the requested format of the name identifier, defaults to unspecified.
+	NameIDFormat string `json:"nameIDFormat" yaml:"nameIDFormat"`
+
+	// Configurable attribute which contains the user ID, defaults to the name identifier.
+	UserIDAttribute string `json:"userIDAttribute" yaml:"userIDAttribute"`
+
+	// Configurable attribute which contains the username, defaults to the name identifier.
+	UsernameAttribute string `json:"usernameAttribute" yaml:"usernameAttribute"`
+
+	// Configurable attribute which contains the email.
+	EmailAttribute string `json:"emailAttribute" yaml:"emailAttribute"`
+
+	// Configurable attribute which contains the groups.
+	GroupsAttribute string `json:"groupsAttribute" yaml:"groupsAttribute"`
+
+	// Used to turn off TLS certificate checks when fetching the metadata.
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+
+	idp *idpMetadata
+	// cache records the issued AuthnRequests until they are answered, and the consumed assertions until they
+	// expire to prevent the replay attacks. It is shared by all replicas of ks-apiserver.
+	cache cache.Interface
+	now   func() time.Time
+}
+
+// authnRequestState is recorded in the cache for each issued AuthnRequest.
+type authnRequestState struct {
+	AssertionConsumerServiceURL string `json:"acs"`
+	RelayState                  string `json:"relayState,omitempty"`
+}
+
+type samlIdentity struct {
+	UserID   string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+func (s samlIdentity) GetUserID() string {
+	return s.UserID
+}
+
+func (s samlIdentity) GetUsername() string {
+	return s.Username
+}
+
+func (s samlIdentity) GetEmail() string {
+	return s.Email
+}
+
+func (s samlIdentity) GetGroups() []string {
+	return s.Groups
+}
+
+type samlProviderFactory struct {
+}
+
+func (f *samlProviderFactory) Type() string {
+	return "SAMLIdentityProvider"
+}
+
+func (f *samlProviderFactory) Create(opts options.DynamicOptions) (identityprovider.OAuthProvider, error) {
+	var provider samlProvider
+	if err := mapstructure.Decode(opts, &provider); err != nil {
+		return nil, err
+	}
+	if provider.AssertionConsumerServiceURL == "" {
+		return nil, errors.New("saml: assertionConsumerServiceURL is required")
+	}
+	if provider.EntityID == "" {
+		provider.EntityID = provider.AssertionConsumerServiceURL
+	}
+	if provider.NameIDFormat == "" {
+		provider.NameIDFormat = nameIDFormatUnspecified
+	}
+
+	metadata := []byte(provider.IDPMetadata)
+	if len(metadata) == 0 {
+		if provider.IDPMetadataURL == "" {
+			return nil, errors.New("saml: either idpMetadata or idpMetadataURL is required")
+		}
+		var err error
+		if metadata, err = provider.fetchMetadata(); err != nil {
+			return nil, fmt.Errorf("saml: failed to fetch identity provider metadata: %v", err)
+		}
+	}
+	idp, err := parseIDPMetadata(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid identity provider metadata: %v", err)
+	}
+	provider.idp = idp
+	provider.now = time.Now
+	return &provider, nil
+}
+
+func (s *samlProvider) SetCache(cache cache.Interface) {
+	s.cache = cache
+}
+
+func (s *samlProvider) fetchMetadata() ([]byte, error) {
+	client := &http.Client{
+		Timeout: defaultMetadataFetchTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify},
+		},
+	}
+	resp, err := client.Get(s.IDPMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// LoginURL builds the SP-initiated AuthnRequest with the HTTP-Redirect binding, the returned cookie binds
+// the AuthnRequest to the user agent.
+func (s *samlProvider) LoginURL(state string) (string, *http.Cookie, error) {
+	if s.cache == nil {
+		return "", nil, errors.New("saml: the cache is not configured")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	request := authnRequest{
+		// the ID must start with a letter or underscore
+		ID:                          "_" + hex.EncodeToString(id),
+		Version:                     "2.0",
+		IssueInstant:                s.now().UTC().Format(time.RFC3339),
+		Destination:                 s.idp.SSOURL,
+		AssertionConsumerServiceURL: s.AssertionConsumerServiceURL,
+		ProtocolBinding:             bindingHTTPPost,
+		Issuer:                      issuer{Value: s.EntityID},
+		NameIDPolicy:                nameIDPolicy{Format: s.NameIDFormat, AllowCreate: true},
+	}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	writer, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	if _, err = writer.Write(data); err != nil {
+		return "", nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return "", nil, err
+	}
+
+	loginURL, err := url.Parse(s.idp.SSOURL)
+	if err != nil {
+		return "", nil, err
+	}
+	// only the responses to the issued requests are accepted, with the RelayState sent along with them
+	requestState, err := json.Marshal(&authnRequestState{AssertionConsumerServiceURL: s.AssertionConsumerServiceURL, RelayState: state})
+	if err != nil {
+		return "", nil, err
+	}
+	if err = s.cache.Set(authnRequestKey(request.ID), string(requestState), authnRequestMaxAge); err != nil {
+		return "", nil, fmt.Errorf("saml: failed to save the AuthnRequest: %v", err)
+	}
+	query := loginURL.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if state != "" {
+		query.Set("RelayState", state)
+	}
+	loginURL.RawQuery = query.Encode()
+	return loginURL.String(), s.authnRequestCookie(request.ID), nil
+}
+
+// authnRequestCookie returns the HttpOnly cookie of the AuthnRequest ID. The response is posted to the assertion
+// consumer service by the identity provider across sites, so SameSite=None is required if it is served over HTTPS.
+func (s *samlProvider) authnRequestCookie(id string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     authnRequestCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(authnRequestMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if acs, err := url.Parse(s.AssertionConsumerServiceURL); err == nil && acs.Scheme == "https" {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// Metadata returns the service provider metadata which is imported by the identity provider.
+func (s *samlProvider) Metadata() (string, []byte, error) {
+	descriptor := spEntityDescriptor{
+		EntityID: s.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: namespaceProtocol,
+			NameIDFormat:               s.NameIDFormat,
+			AssertionConsumerService: assertionConsumerService{
+				Binding:   bindingHTTPPost,
+				Location:  s.AssertionConsumerServiceURL,
+				IsDefault: true,
+			},
+		},
+	}
+	data, err := xml.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	return metadataContentType, append([]byte(xml.Header), data...), nil
+}
+
+// IdentityExchangeCallback handles the SAML response posted to the assertion consumer service,
+// see also https://docs.oasis-open.org/security/saml/v2.0/saml-profiles-2.0-os.pdf
+func (s *samlProvider) IdentityExchangeCallback(req *http.Request) (identityprovider.Identity, error) {
+	if s.cache == nil {
+		return nil, errors.New("saml: the cache is not configured")
+	}
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(nil, req.Body, maxResponseSize)
+	}
+	encoded := req.PostFormValue("SAMLResponse")
+	if encoded == "" {
+		return nil, errors.New("saml: SAMLResponse is required")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("saml: failed to decode SAMLResponse: %v", err)
+	}
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("saml: failed to parse SAMLResponse: %v", err)
+	}
+	// the response is only accepted from the user agent which initiated the login
+	cookie, err := req.Cookie(authnRequestCookie)
+	if err != nil {
+		return nil, errors.New("saml: the AuthnRequest of the user agent is not found")
+	}
+	assertion, err := s.validateResponse(response, cookie.Value, req.PostFormValue("RelayState"))
+	if err != nil {
+		return nil, fmt.Errorf("saml: %v", err)
+	}
+	return s.identityFrom(assertion)
+}
+
+// validateResponse validates the response to the AuthnRequest with the requestID and relayState,
+// and returns the verified assertion.
+func (s *samlProvider) validateResponse(response *element, requestID, relayState string) (*element, error) {
+	if !response.is(namespaceProtocol, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+	responseSigned := false
+	if verified, err := verifySignature(response, s.idp.Certificates); err == nil {
+		response, responseSigned = verified, true
+	} else if !errors.Is(err, errSignatureNotFound) {
+		return nil, fmt.Errorf("invalid response signature: %v", err)
+	}
+
+	if destination, ok := response.attr("Destination"); ok && destination != s.AssertionConsumerServiceURL {
+		return nil, fmt.Errorf("unexpected destination %s", destination)
+	}
+	if issuer := response.child(namespaceAssertion, "Issuer"); issuer != nil && issuer.text() != s.idp.EntityID {
+		return nil, fmt.Errorf("unexpected issuer %s", issuer.text())
+	}
+	var statusCode string
+	if status := response.child(namespaceProtocol, "Status"); status != nil {
+		if code := status.child(namespaceProtocol, "StatusCode"); code != nil {
+			statusCode, _ = code.attr("Value")
+		}
+	}
+	if statusCode != statusSuccess {
+		return nil, fmt.Errorf("authentication failed with status %s", statusCode)
+	}
+	// the unsolicited responses of the IdP-initiated logins are not accepted
+	inResponseTo, _ := response.attr("InResponseTo")
+	if inResponseTo == "" {
+		return nil, errors.New("the response is not in response to an AuthnRequest")
+	}
+	if inResponseTo != requestID {
+		return nil, fmt.Errorf("the AuthnRequest %s is not initiated by the user agent", inResponseTo)
+	}
+	requestState := &authnRequestState{}
+	if data, err := s.cache.Get(authnRequestKey(inResponseTo)); err != nil ||
+		json.Unmarshal([]byte(data), requestState) != nil || requestState.AssertionConsumerServiceURL != s.AssertionConsumerServiceURL {
+		return nil, fmt.Errorf("the AuthnRequest %s is unknown or expired", inResponseTo)
+	}
+	if requestState.RelayState != relayState {
+		return nil, errors.New("the RelayState does not match the AuthnRequest")
+	}
+
+	if response.child(namespaceAssertion, "EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := childElements(response, namespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("exactly one assertion is expected")
+	}
+	assertion := assertions[0]
+	if verified, err := verifySignature(assertion, s.idp.Certificates); err == nil {
+		assertion = verified
+	} else {
+		if !errors.Is(err, errSignatureNotFound) {
+			return nil, fmt.Errorf("invalid assertion signature: %v", err)
+		}
+		if !responseSigned {
+			return nil, errors.New("neither the response nor the assertion is signed")
+		}
+	}
+
+	if err := s.validateAssertion(assertion, inResponseTo); err != nil {
+		return nil, err
+	}
+	// each AuthnRequest is answered only once
+	if err := s.cache.Del(authnRequestKey(inResponseTo)); err != nil {
+		return nil, fmt.Errorf("failed to delete the AuthnRequest %s: %v", inResponseTo, err)
+	}
+	return assertion, nil
+}
+
+func (s *samlProvider) validateAssertion(assertion *element, inResponseTo string) error {
+	now := s.now()
+	issuer := assertion.child(namespaceAssertion, "Issuer")
+	if issuer == nil || issuer.text() != s.idp.EntityID {
+		return errors.New("unexpected assertion issuer")
+	}
+
+	subject := assertion.child(namespaceAssertion, "Subject")
+	if subject == nil || subject.child(namespaceAssertion, "NameID") == nil {
+		return errors.New("subject not found")
+	}
+	var expiresAt time.Time
+	confirmed := false
+	for _, confirmation := range childElements(subject, namespaceAssertion, "SubjectConfirmation") {
+		if method, _ := confirmation.attr("Method"); method != subjectConfirmationBearer {
+			continue
+		}
+		data := confirmation.child(namespaceAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if recipient, _ := data.attr("Recipient"); recipient != s.AssertionConsumerServiceURL {
+			continue
+		}
+		if id, ok := data.attr("InResponseTo"); ok && id != inResponseTo {
+			continue
+		}
+		notOnOrAfter, err := timeAttr(data, "NotOnOrAfter")
+		if err != nil || notOnOrAfter.IsZero() || !now.Before(notOnOrAfter.Add(maxClockSkew)) {
+			continue
+		}
+		confirmed, expiresAt = true, notOnOrAfter
+		break
+	}
+	if !confirmed {
+		return errors.New("the bearer subject confirmation is invalid or expired")
+	}
+
+	conditions := assertion.child(namespaceAssertion, "Conditions")
+	if conditions == nil {
+		return errors.New("conditions not found")
+	}
+	notBefore, err := timeAttr(conditions, "NotBefore")
+	if err != nil {
+		return err
+	}
+	if !notBefore.IsZero() && now.Add(maxClockSkew).Before(notBefore) {
+		return errors.New("the assertion is not yet valid")
+	}
+	notOnOrAfter, err := timeAttr(conditions, "NotOnOrAfter")
+	if err != nil {
+		return err
+	}
+	if !notOnOrAfter.IsZero() && !now.Before(notOnOrAfter.Add(maxClockSkew)) {
+		return errors.New("the assertion is expired")
+	}
+	for _, restriction := range childElements(conditions, namespaceAssertion, "AudienceRestriction") {
+		matched := false
+		for _, audience := range childElements(restriction, namespaceAssertion, "Audience") {
+			if audience.text() == s.EntityID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.New("the audience does not match")
+		}
+	}
+
+	id, _ := assertion.attr("ID")
+	if id == "" {
+		return errors.New("the assertion ID is required")
+	}
+	key := assertionKey(s.idp.EntityID, id)
+	consumed, err := s.cache.Exists(key)
+	if err != nil {
+		return fmt.Errorf("failed to check the assertion %s: %v", id, err)
+	}
+	if consumed {
+		return errors.New("the assertion has been consumed")
+	}
+	if err = s.cache.Set(key, "", expiresAt.Add(maxClockSkew).Sub(now)); err != nil {
+		return fmt.Errorf("failed to save the assertion %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *samlProvider) identityFrom(assertion *element) (identityprovider.Identity, error) {
+	nameID := assertion.child(namespaceAssertion, "Subject").child(namespaceAssertion, "NameID").text()
+	attributes := make(map[string][]string)
+	for _, statement := range childElements(assertion, namespaceAssertion, "AttributeStatement") {
+		for _, attribute := range childElements(statement, namespaceAssertion, "Attribute") {
+			var values []string
+			for _, value := range childElements(attribute, namespaceAssertion, "AttributeValue") {
+				values = append(values, value.text())
+			}
+			if name, ok := attribute.attr("Name"); ok {
+				attributes[name] = append(attributes[name], values...)
+			}
+			if friendlyName, ok := attribute.attr("FriendlyName"); ok {
+				attributes[friendlyName] = append(attributes[friendlyName], values...)
+			}
+		}
+	}
+
+	first := func(name, defaultValue string) string {
+		if values := attributes[name]; name != "" && len(values) > 0 {
+			return values[0]
+		}
+		return defaultValue
+	}
+	identity := &samlIdentity{
+		UserID:   first(s.UserIDAttribute, nameID),
+		Username: first(s.UsernameAttribute, nameID),
+		Email:    first(s.EmailAttribute, ""),
+	}
+	if s.GroupsAttribute != "" {
+		identity.Groups = attributes[s.GroupsAttribute]
+	}
+	if identity.UserID == "" {
+		return nil, errors.New("saml: the user ID is empty")
+	}
+	return identity, nil
+}
+
+func authnRequestKey(id string) string {
+	return fmt.Sprintf("kubesphere:saml:authnrequest:%s", id)
+}
+
+func assertionKey(issuer, id string) string {
+	return fmt.Sprintf("kubesphere:saml:assertion:%s:%s", issuer, id)
+}
+
+func timeAttr(e *element, name string) (time.Time, error) {
+	value, ok := e.attr(name)
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return t, nil
+}
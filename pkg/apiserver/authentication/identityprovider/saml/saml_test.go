@@ -0,0 +1,377 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider"
+	"kubesphere.io/kubesphere/pkg/server/options"
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+const (
+	testACS      = "https://ks-console.kubesphere.io/oauth/redirect/saml"
+	testEntityID = "https://ks-console.kubesphere.io"
+	testIDP      = "https://idp.example.com/metadata"
+)
+
+// The fixtures in testdata are signed by libxmlsec1 1.2.37 with the key of testdata/idp.crt, the same as
+//
+//	xmlsec1 --sign --privkey-pem idp.key,idp.crt \
+//		--id-attr:ID urn:oasis:names:tc:SAML:2.0:assertion:Assertion \
+//		--id-attr:ID urn:oasis:names:tc:SAML:2.0:protocol:Response template.xml
+//
+// The private key is not kept, sign the changed fixtures with a new key and replace testdata/idp.crt.
+// assertion-signed.xml: the assertion is signed with the exclusive canonicalization and rsa-sha256.
+// response-signed.xml: the response is signed with the inclusive canonicalization and rsa-sha256.
+// assertion-signed-sha1.xml: the assertion is signed with rsa-sha1.
+func TestIdentityExchangeCallback(t *testing.T) {
+	certificate := loadCertificate(t)
+	issueInstant := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		fixture  string
+		modify   func(response string) string
+		now      time.Time
+		entityID string
+		// the AuthnRequest _req1 is not issued before the response is received
+		notIssued bool
+		// the response is received again after it is accepted, the AuthnRequest is issued again if reissue is true
+		replay  bool
+		reissue bool
+		// the cookie of the AuthnRequest sent by the user agent, defaults to _req1
+		cookie     string
+		relayState string
+		wantErr    string
+	}{
+		{
+			name:    "signed assertion",
+			fixture: "assertion-signed.xml",
+		},
+		{
+			name:    "signed response",
+			fixture: "response-signed.xml",
+		},
+		{
+			name:    "replayed response",
+			fixture: "response-signed.xml",
+			replay:  true,
+			wantErr: "the AuthnRequest _req1 is unknown or expired",
+		},
+		{
+			name:    "replayed assertion",
+			fixture: "assertion-signed.xml",
+			replay:  true,
+			reissue: true,
+			wantErr: "the assertion has been consumed",
+		},
+		{
+			name:      "unknown request",
+			fixture:   "assertion-signed.xml",
+			notIssued: true,
+			wantErr:   "the AuthnRequest _req1 is unknown or expired",
+		},
+		{
+			name:    "unsolicited response",
+			fixture: "assertion-signed.xml",
+			modify: func(response string) string {
+				return strings.Replace(response, ` InResponseTo="_req1"`, "", 1)
+			},
+			wantErr: "the response is not in response to an AuthnRequest",
+		},
+		{
+			name:    "sha1 signature",
+			fixture: "assertion-signed-sha1.xml",
+			wantErr: "unsupported digest algorithm http://www.w3.org/2000/09/xmldsig#sha1",
+		},
+		{
+			name:    "request of another user agent",
+			fixture: "assertion-signed.xml",
+			cookie:  "_req2",
+			wantErr: "the AuthnRequest _req1 is not initiated by the user agent",
+		},
+		{
+			name:       "unexpected relay state",
+			fixture:    "assertion-signed.xml",
+			relayState: "state2",
+			wantErr:    "the RelayState does not match the AuthnRequest",
+		},
+		{
+			name:    "modified assertion",
+			fixture: "assertion-signed.xml",
+			modify: func(response string) string {
+				return strings.Replace(response, "developers", "admins", 1)
+			},
+			wantErr: "invalid assertion signature: Signature could not be verified",
+		},
+		{
+			name:    "modified response",
+			fixture: "response-signed.xml",
+			modify: func(response string) string {
+				return strings.Replace(response, ">alice</saml:NameID>", ">admin</saml:NameID>", 1)
+			},
+			wantErr: "invalid response signature: Signature could not be verified",
+		},
+		{
+			name:    "wrapped assertion",
+			fixture: "assertion-signed.xml",
+			modify: func(response string) string {
+				// the signed assertion is moved into an extension, and the forged one references its ID
+				start := strings.Index(response, "<saml:Assertion ")
+				end := strings.Index(response, "</saml:Assertion>") + len("</saml:Assertion>")
+				signed := response[start:end]
+				forged := strings.ReplaceAll(signed, ">alice<", ">admin<")
+				return response[:start] + forged + `<samlp:Extensions>` + signed + `</samlp:Extensions>` + response[end:]
+			},
+			wantErr: "invalid assertion signature: Signature could not be verified",
+		},
+		{
+			name:     "unexpected audience",
+			fixture:  "assertion-signed.xml",
+			entityID: "https://other.example.com",
+			wantErr:  "the audience does not match",
+		},
+		{
+			name:    "expired assertion",
+			fixture: "assertion-signed.xml",
+			now:     issueInstant.Add(time.Hour),
+			wantErr: "the bearer subject confirmation is invalid or expired",
+		},
+		{
+			name:    "undeclared namespace prefix",
+			fixture: "assertion-signed.xml",
+			modify: func(response string) string {
+				return strings.Replace(response, `<samlp:Status>`, `<samlp:Status><ext:Debug/>`, 1)
+			},
+			wantErr: "undeclared namespace prefix ext",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := newTestProvider(t, certificate)
+			provider.now = func() time.Time { return issueInstant.Add(time.Minute) }
+			if !test.now.IsZero() {
+				provider.now = func() time.Time { return test.now }
+			}
+			if test.entityID != "" {
+				provider.EntityID = test.entityID
+			}
+			issue := func() {
+				if err := provider.cache.Set(authnRequestKey("_req1"), `{"acs":"`+testACS+`","relayState":"state1"}`, authnRequestMaxAge); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cookie, relayState := "_req1", "state1"
+			if test.cookie != "" {
+				cookie = test.cookie
+			}
+			if test.relayState != "" {
+				relayState = test.relayState
+			}
+			if !test.notIssued {
+				issue()
+			}
+
+			response, err := os.ReadFile(filepath.Join("testdata", test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.modify != nil {
+				response = []byte(test.modify(string(response)))
+			}
+			callback := func() (identityprovider.Identity, error) {
+				form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(response)}, "RelayState": {relayState}}
+				req, _ := http.NewRequest(http.MethodPost, testACS, strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.AddCookie(&http.Cookie{Name: authnRequestCookie, Value: cookie})
+				return provider.IdentityExchangeCallback(req)
+			}
+
+			identity, err := callback()
+			if test.replay {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.reissue {
+					issue()
+				}
+				identity, err = callback()
+			}
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &samlIdentity{UserID: "alice", Username: "alice", Email: "alice@example.com", Groups: []string{"developers", "ops"}}
+			if fmt.Sprint(identity) != fmt.Sprint(expected) {
+				t.Errorf("expected identity %+v, got %+v", expected, identity)
+			}
+		})
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "well-formed",
+			data: `<?xml version="1.0"?><a:root xmlns:a="urn:a" xmlns:b="urn:b" b:attr="1"><!-- comment --><a:child>text</a:child></a:root>`,
+		},
+		{
+			name:    "mismatched end element",
+			data:    `<root><a><b></a></b></root>`,
+			wantErr: true,
+		},
+		{
+			name:    "unclosed element",
+			data:    `<root><a></a>`,
+			wantErr: true,
+		},
+		{
+			name:    "undeclared element prefix",
+			data:    `<a:root/>`,
+			wantErr: true,
+		},
+		{
+			name:    "undeclared attribute prefix",
+			data:    `<root b:attr="1"/>`,
+			wantErr: true,
+		},
+		{
+			name:    "doctype",
+			data:    `<!DOCTYPE root [<!ENTITY e "e">]><root>&e;</root>`,
+			wantErr: true,
+		},
+		{
+			name:    "multiple root elements",
+			data:    `<root/><root/>`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseXML([]byte(test.data)); (err != nil) != test.wantErr {
+				t.Fatalf("parseXML() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginURL(t *testing.T) {
+	provider := newTestProvider(t, loadCertificate(t))
+
+	loginURL, cookie, err := provider.LoginURL("state1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(loginURL)
+	if u.Host != "idp.example.com" || u.Query().Get("RelayState") != "state1" {
+		t.Fatalf("unexpected login url %s", loginURL)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(request, []byte(`AssertionConsumerServiceURL="`+testACS+`"`)) {
+		t.Fatalf("unexpected authn request %s", request)
+	}
+	// the request is recorded to accept the response
+	parsed, err := parseXML(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := parsed.attr("ID")
+	if state, err := provider.cache.Get(authnRequestKey(id)); err != nil || state != `{"acs":"`+testACS+`","relayState":"state1"}` {
+		t.Fatalf("the AuthnRequest %s is not recorded: %v", id, err)
+	}
+	// the request is bound to the user agent
+	if cookie.Name != authnRequestCookie || cookie.Value != id || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteNoneMode {
+		t.Fatalf("unexpected cookie %+v", cookie)
+	}
+
+	_, metadata, err := provider.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(metadata, []byte(`entityID="`+testEntityID+`"`)) {
+		t.Fatalf("unexpected metadata %s", metadata)
+	}
+}
+
+func newTestProvider(t *testing.T, certificate []byte) *samlProvider {
+	metadata := fmt.Sprintf(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, testIDP, base64.StdEncoding.EncodeToString(certificate))
+
+	provider, err := (&samlProviderFactory{}).Create(options.DynamicOptions{
+		"entityID":                    testEntityID,
+		"assertionConsumerServiceURL": testACS,
+		"idpMetadata":                 metadata,
+		"emailAttribute":              "mail",
+		"groupsAttribute":             "memberOf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cache is injected by the identity provider controller
+	stateful, ok := provider.(identityprovider.StatefulProvider)
+	if !ok {
+		t.Fatal("the saml provider is not stateful")
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateful.SetCache(c)
+	return provider.(*samlProvider)
+}
+
+func loadCertificate(t *testing.T) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", "idp.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("invalid certificate")
+	}
+	return block.Bytes
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package saml
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/beevik/etree"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+const namespaceDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+// SHA-1 is not accepted for either digests or signatures.
+var digestAlgorithms = map[string]bool{
+	"http://www.w3.org/2001/04/xmlenc#sha256":       true,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": true,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       true,
+}
+
+var signatureAlgorithms = map[string]bool{
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256":   true,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha384":   true,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512":   true,
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256": true,
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384": true,
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512": true,
+}
+
+var errSignatureNotFound = errors.New("signature not found")
+
+// element wraps the etree element with the namespace aware lookups used to read the SAML messages.
+type element struct {
+	*etree.Element
+}
+
+// parseXML parses the document, the documents which are changed by the round trip of encoding/xml,
+// the directives such as the DTDs and the undeclared namespace prefixes are rejected.
+func parseXML(data []byte) (*element, error) {
+	// etree reads the raw tokens, the end elements are checked by the decoder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := xrv.Validate(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	var root *etree.Element
+	for _, token := range doc.Child {
+		switch t := token.(type) {
+		case *etree.Directive:
+			return nil, errors.New("xml directives are not allowed")
+		case *etree.Element:
+			if root != nil {
+				return nil, errors.New("multiple root elements")
+			}
+			root = t
+		}
+	}
+	if root == nil {
+		return nil, errors.New("malformed xml document")
+	}
+	err := etreeutils.NSTraverse(etreeutils.NewDefaultNSContext(), root, func(ctx etreeutils.NSContext, e *etree.Element) error {
+		if _, err := ctx.LookupPrefix(e.Space); err != nil {
+			return fmt.Errorf("undeclared namespace prefix %s", e.Space)
+		}
+		for _, attr := range e.Attr {
+			if attr.Space == "" || attr.Space == "xmlns" {
+				continue
+			}
+			if _, err := ctx.LookupPrefix(attr.Space); err != nil {
+				return fmt.Errorf("undeclared namespace prefix %s", attr.Space)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &element{root}, nil
+}
+
+func (e *element) is(namespace, local string) bool {
+	return e.Tag == local && e.NamespaceURI() == namespace
+}
+
+func (e *element) attr(local string) (string, bool) {
+	for _, attr := range e.Attr {
+		if attr.Space == "" && attr.Key == local {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func (e *element) child(namespace, local string) *element {
+	for _, child := range e.ChildElements() {
+		if child := (&element{child}); child.is(namespace, local) {
+			return child
+		}
+	}
+	return nil
+}
+
+func (e *element) text() string {
+	var buf strings.Builder
+	for _, child := range e.Child {
+		switch child := child.(type) {
+		case *etree.CharData:
+			buf.WriteString(child.Data)
+		case *etree.Element:
+			buf.WriteString((&element{child}).text())
+		}
+	}
+	return buf.String()
+}
+
+// verifySignature verifies the enveloped XML signature of the element with goxmldsig, and returns the verified
+// copy of the element, which must be read instead of the element itself to prevent the signature wrapping attacks.
+// The signature must reference the element by its ID attribute with the algorithms other than SHA-1.
+func verifySignature(e *element, certificates []*x509.Certificate) (*element, error) {
+	signature := e.child(namespaceDSig, "Signature")
+	if signature == nil {
+		return nil, errSignatureNotFound
+	}
+	signedInfo := signature.child(namespaceDSig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("signed info not found")
+	}
+	references := childElements(signedInfo, namespaceDSig, "Reference")
+	if len(references) != 1 {
+		return nil, errors.New("exactly one reference is expected")
+	}
+	id, _ := e.attr("ID")
+	if uri, _ := references[0].attr("URI"); id == "" || uri != "#"+id {
+		return nil, fmt.Errorf("the signature does not reference the element %s", e.Tag)
+	}
+	if digestMethod := references[0].child(namespaceDSig, "DigestMethod"); digestMethod != nil {
+		if algorithm, _ := digestMethod.attr("Algorithm"); !digestAlgorithms[algorithm] {
+			return nil, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+		}
+	}
+	if signatureMethod := signedInfo.child(namespaceDSig, "SignatureMethod"); signatureMethod != nil {
+		if algorithm, _ := signatureMethod.attr("Algorithm"); !signatureAlgorithms[algorithm] {
+			return nil, fmt.Errorf("unsupported signature algorithm %s", algorithm)
+		}
+	}
+
+	// the namespaces declared by the ancestors are declared on the detached copy, so that it is canonicalized
+	// as the signer did
+	ctx, err := etreeutils.NSBuildParentContext(e.Element)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(ctx, e.Element)
+	if err != nil {
+		return nil, err
+	}
+	validationContext := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certificates})
+	validationContext.IdAttribute = "ID"
+	verified, err := validationContext.Validate(detached)
+	if err != nil {
+		if errors.Is(err, dsig.ErrMissingSignature) {
+			return nil, errSignatureNotFound
+		}
+		return nil, err
+	}
+	return &element{verified}, nil
+}
+
+func childElements(e *element, namespace, local string) []*element {
+	var elements []*element
+	for _, child := range e.ChildElements() {
+		if child := (&element{child}); child.is(namespace, local) {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
@@ -73,6 +73,34 @@ const (
 	// Error HTTP status code cannot be returned to the client
 	// via an HTTP redirect.)
 	ServerError ErrorType = "server_error"
+
+	// MFARequired
+	// The resource owner is authenticated, but the multi-factor authentication must be
+	// completed with the otp grant before the tokens are issued.
+	MFARequired ErrorType = "mfa_required"
+)
+
+// The following error type is defined in https://datatracker.ietf.org/doc/html/rfc8628#section-3.5
+const (
+	// AuthorizationPending
+	// The authorization request is still pending as the end user hasn't
+	// yet completed the user-interaction steps.
+	AuthorizationPending ErrorType = "authorization_pending"
+
+	// SlowDown
+	// A variant of "authorization_pending", the authorization request is
+	// still pending and polling should continue, but the interval MUST
+	// be increased by 5 seconds for this and all subsequent requests.
+	SlowDown ErrorType = "slow_down"
+
+	// AccessDenied
+	// The authorization request was denied.
+	AccessDenied ErrorType = "access_denied"
+
+	// ExpiredToken
+	// The "device_code" has expired, and the device authorization
+	// session has concluded.
+	ExpiredToken ErrorType = "expired_token"
 )
 
 func NewError(errorType ErrorType, description string) *Error {
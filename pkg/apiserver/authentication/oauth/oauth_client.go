@@ -79,6 +79,21 @@ type Client struct {
 	// AccessTokenInactivityTimeout overrides the default token inactivity timeout
 	// for tokens granted to this client.
 	AccessTokenInactivityTimeoutSeconds int64 `json:"accessTokenInactivityTimeoutSeconds,omitempty" yaml:"accessTokenInactivityTimeoutSeconds,omitempty"`
+
+	// GrantTypes is a list of grant types the client is allowed to use, valid grant types are:
+	// authorization_code, refresh_token, password, client_credentials and
+	// urn:ietf:params:oauth:grant-type:device_code. If no grant types are provided, the
+	// authorization_code, refresh_token and password grants are allowed. The password grant
+	// additionally requires the client to be trusted.
+	GrantTypes []string `json:"grantTypes,omitempty" yaml:"grantTypes,omitempty"`
+
+	// RequirePKCE requires the client to use Proof Key for Code Exchange with the S256 method
+	// in the authorization code flow, it is recommended for public clients such as single-page applications.
+	RequirePKCE bool `json:"requirePKCE,omitempty" yaml:"requirePKCE,omitempty"`
+
+	// ClientCredentialsUser is the user that the access tokens issued by the client_credentials grant
+	// represent, it is required if the client_credentials grant is allowed.
+	ClientCredentialsUser string `json:"clientCredentialsUser,omitempty" yaml:"clientCredentialsUser,omitempty"`
 }
 
 type ClientGetter interface {
@@ -152,6 +167,21 @@ func ValidateClient(client Client) error {
 		validationErrors = append(validationErrors, fmt.Errorf("invalid access token max age: %d, the minimum value can only be 600", client.AccessTokenMaxAgeSeconds))
 	}
 
+	// Validate grant types.
+	for _, grantType := range client.GrantTypes {
+		if !sliceutil.HasString(ValidGrantTypes, grantType) {
+			validationErrors = append(validationErrors, fmt.Errorf("invalid grant type: %s", grantType))
+		}
+	}
+	if sliceutil.HasString(client.GrantTypes, GrantTypeClientCredentials) {
+		if client.Secret == "" {
+			validationErrors = append(validationErrors, fmt.Errorf("the client_credentials grant is not allowed for public clients"))
+		}
+		if client.ClientCredentialsUser == "" {
+			validationErrors = append(validationErrors, fmt.Errorf("clientCredentialsUser is required by the client_credentials grant"))
+		}
+	}
+
 	// Aggregate validation errors and return.
 	return errorsutil.NewAggregate(validationErrors)
 }
@@ -207,6 +237,18 @@ func (c *Client) IsValidScope(requestedScope string) bool {
 	return true
 }
 
+// IsGrantTypeAllowed checks whether the client is allowed to use the grant type.
+func (c *Client) IsGrantTypeAllowed(grantType string) bool {
+	// code is an alias of authorization_code
+	if grantType == GrantTypeCode {
+		grantType = GrantTypeAuthorizationCode
+	}
+	if len(c.GrantTypes) == 0 {
+		return sliceutil.HasString(DefaultGrantTypes, grantType)
+	}
+	return sliceutil.HasString(c.GrantTypes, grantType)
+}
+
 // filterValidRedirectURIs filters out invalid redirect URIs from the given slice.
 // It returns a new slice containing only valid URIs.
 func filterValidRedirectURIs(redirectURIs []string) []string {
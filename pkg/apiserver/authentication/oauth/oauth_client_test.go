@@ -38,3 +38,36 @@ func TestMarshalInto(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestIsGrantTypeAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *Client
+		grantType string
+		want      bool
+	}{
+		{name: "default", client: &Client{}, grantType: GrantTypeCode, want: true},
+		{name: "default client credentials", client: &Client{}, grantType: GrantTypeClientCredentials, want: false},
+		{name: "configured", client: &Client{GrantTypes: []string{GrantTypeDeviceCode}}, grantType: GrantTypeDeviceCode, want: true},
+		{name: "not configured", client: &Client{GrantTypes: []string{GrantTypeDeviceCode}}, grantType: GrantTypePassword, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.client.IsGrantTypeAllowed(test.grantType); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateClient(t *testing.T) {
+	client := Client{GrantMethod: GrantMethodAuto, GrantTypes: []string{GrantTypeClientCredentials}}
+	if err := ValidateClient(client); err == nil {
+		t.Errorf("expected the client_credentials grant to require a secret and a user")
+	}
+	client.Secret = "secret"
+	client.ClientCredentialsUser = "robot"
+	if err := ValidateClient(client); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
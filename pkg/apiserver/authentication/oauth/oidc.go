@@ -29,11 +29,22 @@ const (
 	GrantTypeCode              = "code"
 	GrantTypeAuthorizationCode = "authorization_code"
 	GrantTypeOTP               = "otp"
+	GrantTypeClientCredentials = "client_credentials"
+	// GrantTypeDeviceCode https://datatracker.ietf.org/doc/html/rfc8628#section-3.4
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
 )
 
 var ValidScopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile}
 var ValidResponseTypes = []string{ResponseTypeCode, ResponseTypeIDToken, ResponseTypeToken}
 
+// ValidGrantTypes are the grant types can be configured for a client, the otp grant is not included
+// because it continues the other grants to complete the multi-factor authentication.
+var ValidGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypePassword,
+	GrantTypeClientCredentials, GrantTypeDeviceCode}
+
+// DefaultGrantTypes are the grant types allowed for the clients without grant types configured.
+var DefaultGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypePassword}
+
 func IsValidScopes(scopes []string) bool {
 	for _, scope := range scopes {
 		if !sliceutil.HasString(ValidScopes, scope) {
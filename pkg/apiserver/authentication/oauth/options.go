@@ -62,6 +62,11 @@ type IssuerOptions struct {
 	// This should be values of a few seconds, and we don’t recommend using more than 30 seconds for this purpose,
 	// as this would rather indicate problems with the server, rather than a common clock skew.
 	MaximumClockSkew time.Duration `json:"maximumClockSkew" yaml:"maximumClockSkew"`
+
+	// DeviceVerificationURI is the end-user verification page of the device authorization grant,
+	// where the user enters the user code and approves the device through the device verification endpoint.
+	// Defaults to the /device page of the console, which is served at the issuer URL.
+	DeviceVerificationURI string `json:"deviceVerificationURI,omitempty" yaml:"deviceVerificationURI,omitempty"`
 }
 
 type IdentityProviderOptions struct {
@@ -112,6 +117,29 @@ type Token struct {
 	ExpiresIn int `json:"expires_in,omitempty"`
 }
 
+// DeviceAuthorization is the Device Authorization Response,
+// for more details: https://datatracker.ietf.org/doc/html/rfc8628#section-3.2
+type DeviceAuthorization struct {
+	// DeviceCode is the device verification code.
+	DeviceCode string `json:"device_code"`
+
+	// UserCode is the end-user verification code.
+	UserCode string `json:"user_code"`
+
+	// VerificationURI is the end-user verification URI on the authorization server.
+	VerificationURI string `json:"verification_uri"`
+
+	// VerificationURIComplete is the verification URI that includes the user code.
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+
+	// ExpiresIn is the lifetime in seconds of the device code and user code.
+	ExpiresIn int `json:"expires_in"`
+
+	// Interval is the minimum amount of time in seconds that the client
+	// SHOULD wait between polling requests to the token endpoint.
+	Interval int `json:"interval,omitempty"`
+}
+
 func NewIssuerOptions() *IssuerOptions {
 	return &IssuerOptions{
 		AccessTokenMaxAge:            time.Hour * 2,
@@ -0,0 +1,32 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// CodeChallengeMethodS256 is the only supported code challenge method of Proof Key for Code Exchange,
+// https://datatracker.ietf.org/doc/html/rfc7636. The plain method is not supported since the
+// code challenge is carried by the authorization code.
+const CodeChallengeMethodS256 = "S256"
+
+// codeVerifierPattern https://datatracker.ietf.org/doc/html/rfc7636#section-4.1
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// VerifyCodeChallenge checks whether the code verifier matches the S256 code challenge.
+func VerifyCodeChallenge(codeChallenge, codeVerifier string) bool {
+	if !codeVerifierPattern.MatchString(codeVerifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package oauth
+
+import "testing"
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// the example in https://datatracker.ietf.org/doc/html/rfc7636#appendix-B
+	codeChallenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	tests := []struct {
+		codeVerifier string
+		want         bool
+	}{
+		{codeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", want: true},
+		{codeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXK", want: false},
+		{codeVerifier: "", want: false},
+	}
+	for _, test := range tests {
+		if got := VerifyCodeChallenge(codeChallenge, test.codeVerifier); got != test.want {
+			t.Errorf("VerifyCodeChallenge(%q) = %v, want %v", test.codeVerifier, got, test.want)
+		}
+	}
+}
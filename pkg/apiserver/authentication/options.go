@@ -17,9 +17,12 @@ import (
 	_ "kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider/github"
 	_ "kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider/ldap"
 	_ "kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider/oidc"
+	_ "kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider/saml"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/oauth"
 )
 
+const DefaultMFAIssuer = "KubeSphere"
+
 type Options struct {
 	// AuthenticateRateLimiter defines under which circumstances we will block user.
 	// A user will be blocked if his/her failed login attempt reaches AuthenticateRateLimiterMaxTries in
@@ -40,6 +43,18 @@ type Options struct {
 
 	// Issuer defines options needed for integrated oauth plugins
 	Issuer *oauth.IssuerOptions `json:"issuer" yaml:"issuer"`
+
+	// MultiFactorAuth configures the TOTP multi-factor authentication.
+	MultiFactorAuth *MultiFactorAuthOptions `json:"multiFactorAuth,omitempty" yaml:"multiFactorAuth,omitempty"`
+}
+
+type MultiFactorAuthOptions struct {
+	// Required enforces the multi-factor authentication for all users,
+	// it can also be enforced for the members of a workspace with the
+	// iam.kubesphere.io/mfa-required annotation of the workspace template.
+	Required bool `json:"required" yaml:"required"`
+	// Issuer is the issuer shown in the authenticator apps.
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
 }
 
 func NewOptions() *Options {
@@ -50,6 +65,7 @@ func NewOptions() *Options {
 		LoginHistoryMaximumEntries:      100,
 		Issuer:                          oauth.NewIssuerOptions(),
 		MultipleLogin:                   false,
+		MultiFactorAuth:                 &MultiFactorAuthOptions{Issuer: DefaultMFAIssuer},
 	}
 }
 
@@ -68,6 +84,7 @@ func (options *Options) AddFlags(fs *pflag.FlagSet, s *Options) {
 	fs.IntVar(&options.AuthenticateRateLimiterMaxTries, "authenticate-rate-limiter-max-retries", s.AuthenticateRateLimiterMaxTries, "")
 	fs.DurationVar(&options.AuthenticateRateLimiterDuration, "authenticate-rate-limiter-duration", s.AuthenticateRateLimiterDuration, "")
 	fs.BoolVar(&options.MultipleLogin, "multiple-login", s.MultipleLogin, "Allow multiple login with the same account, disable means only one user can login at the same time.")
+	fs.BoolVar(&options.MultiFactorAuth.Required, "mfa-required", s.MultiFactorAuth.Required, "Enforce the multi-factor authentication for all users.")
 	fs.StringVar(&options.Issuer.JWTSecret, "jwt-secret", s.Issuer.JWTSecret, "Secret to sign jwt token, must not be empty.")
 	fs.DurationVar(&options.LoginHistoryRetentionPeriod, "login-history-retention-period", s.LoginHistoryRetentionPeriod, "login-history-retention-period defines how long login history should be kept.")
 	fs.IntVar(&options.LoginHistoryMaximumEntries, "login-history-maximum-entries", s.LoginHistoryMaximumEntries, "login-history-maximum-entries defines how many entries of login history should be kept.")
@@ -32,6 +32,7 @@ const (
 	StaticToken       Type   = "static_token"
 	AuthorizationCode Type   = "code"
 	IDToken           Type   = "id_token"
+	MFAToken          Type   = "mfa_token"
 	headerKeyID       string = "kid"
 	headerAlgorithm   string = "alg"
 )
@@ -95,6 +96,14 @@ type Claims struct {
 	Locale string `json:"locale,omitempty"`
 	// Shorthand url by which the End-User wishes to be referred to at the RP,
 	PreferredUsername string `json:"preferred_username,omitempty"`
+
+	// Used for issuing authorization code
+	// CodeChallenge is the S256 code challenge of Proof Key for Code Exchange.
+	CodeChallenge string `json:"code_challenge,omitempty"`
+
+	// SessionID identifies the login session, the access token and the refresh token
+	// issued in the same login session share the session ID.
+	SessionID string `json:"sid,omitempty"`
 }
 
 type issuer struct {
@@ -142,6 +151,12 @@ func (s *issuer) IssueTo(request *IssueRequest) (string, error) {
 	if len(request.Scopes) > 0 {
 		claims.Scopes = request.Scopes
 	}
+	if request.CodeChallenge != "" {
+		claims.CodeChallenge = request.CodeChallenge
+	}
+	if request.SessionID != "" {
+		claims.SessionID = request.SessionID
+	}
 	if request.ExpiresIn > 0 {
 		claims.ExpiresAt = jwt.NewNumericDate(issueAt.Add(request.ExpiresIn))
 	}
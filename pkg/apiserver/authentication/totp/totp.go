@@ -0,0 +1,171 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+// Package totp implements the Time-Based One-Time Password algorithm,
+// https://datatracker.ietf.org/doc/html/rfc6238
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPeriod = 30
+	DefaultDigits = 6
+	// secretSize is the size in bytes of the generated secrets, the recommended size of HMAC-SHA1 keys.
+	secretSize = 20
+	// skew is the number of periods before and after the current one in which a code is accepted.
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is a TOTP key, it can be encoded as the otpauth URI of the Key Uri Format
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+type Key struct {
+	Issuer      string
+	AccountName string
+	// Secret is the base32 encoded shared secret.
+	Secret string
+	// Period is the time step in seconds.
+	Period uint64
+	Digits int
+}
+
+// Generate generates a key with a random secret.
+func Generate(issuer, accountName string) (*Key, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &Key{
+		Issuer:      issuer,
+		AccountName: accountName,
+		Secret:      encoding.EncodeToString(secret),
+		Period:      DefaultPeriod,
+		Digits:      DefaultDigits,
+	}, nil
+}
+
+// ParseKey parses a key from the otpauth URI.
+func ParseKey(uri string) (*Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		return nil, errors.New("not a totp key uri")
+	}
+
+	key := &Key{Period: DefaultPeriod, Digits: DefaultDigits}
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		key.Issuer, key.AccountName = label[:i], label[i+1:]
+	} else {
+		key.AccountName = label
+	}
+
+	values := u.Query()
+	if issuer := values.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+	if algorithm := values.Get("algorithm"); algorithm != "" && !strings.EqualFold(algorithm, "SHA1") {
+		return nil, fmt.Errorf("unsupported algorithm %s", algorithm)
+	}
+	if period := values.Get("period"); period != "" {
+		if key.Period, err = strconv.ParseUint(period, 10, 64); err != nil || key.Period == 0 {
+			return nil, fmt.Errorf("invalid period %s", period)
+		}
+	}
+	if digits := values.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil || key.Digits < 6 || key.Digits > 8 {
+			return nil, fmt.Errorf("invalid digits %s", digits)
+		}
+	}
+	key.Secret = strings.ToUpper(values.Get("secret"))
+	if _, err := encoding.DecodeString(key.Secret); err != nil || key.Secret == "" {
+		return nil, errors.New("invalid secret")
+	}
+	return key, nil
+}
+
+// URL returns the otpauth URI of the key, which is usually rendered as a QR code for provisioning.
+func (k *Key) URL() string {
+	values := url.Values{}
+	values.Set("secret", k.Secret)
+	values.Set("issuer", k.Issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", strconv.Itoa(k.Digits))
+	values.Set("period", strconv.FormatUint(k.Period, 10))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + k.Issuer + ":" + k.AccountName,
+		RawQuery: values.Encode(),
+	}
+	return u.String()
+}
+
+// Counter returns the counter of the time step at t.
+func (k *Key) Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / k.Period
+}
+
+// Code returns the code of the counter.
+func (k *Key) Code(counter uint64) (string, error) {
+	secret, err := encoding.DecodeString(k.Secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(secret, counter, k.Digits), nil
+}
+
+// Validate validates the code at t, the counter of the matched time step is returned
+// so that the caller is able to reject a code which has been used.
+func (k *Key) Validate(code string, t time.Time) (uint64, bool) {
+	secret, err := encoding.DecodeString(k.Secret)
+	if err != nil || len(code) != k.Digits {
+		return 0, false
+	}
+	current := k.Counter(t)
+	for i := -skew; i <= skew; i++ {
+		counter := current + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, counter, k.Digits)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// hotp implements the HMAC-Based One-Time Password algorithm, https://datatracker.ietf.org/doc/html/rfc4226
+func hotp(secret []byte, counter uint64, digits int) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// the test vectors of SHA1 in https://datatracker.ietf.org/doc/html/rfc6238#appendix-B
+func TestCode(t *testing.T) {
+	key := &Key{
+		Secret: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890")),
+		Period: DefaultPeriod,
+		Digits: 8,
+	}
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "94287082"},
+		{time: 1111111109, code: "07081804"},
+		{time: 1111111111, code: "14050471"},
+		{time: 1234567890, code: "89005924"},
+		{time: 2000000000, code: "69279037"},
+		{time: 20000000000, code: "65353130"},
+	}
+	for _, test := range tests {
+		code, err := key.Code(key.Counter(time.Unix(test.time, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("expected code %s at %d, got %s", test.code, test.time, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key, err := Generate("KubeSphere", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKey(key.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *key {
+		t.Fatalf("expected key %+v, got %+v", key, parsed)
+	}
+
+	now := time.Now()
+	code, _ := key.Code(key.Counter(now.Add(-time.Second * DefaultPeriod)))
+	if counter, ok := parsed.Validate(code, now); !ok || counter != key.Counter(now)-1 {
+		t.Errorf("expected the code of the previous period to be accepted")
+	}
+	code, _ = key.Code(key.Counter(now.Add(-time.Second * DefaultPeriod * 3)))
+	if _, ok := parsed.Validate(code, now); ok {
+		t.Errorf("expected the expired code to be rejected")
+	}
+}
@@ -19,7 +19,6 @@ import (
 	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
 	"k8s.io/client-go/transport"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
 
@@ -27,12 +26,12 @@ import (
 )
 
 type apiService struct {
-	next  http.Handler
-	cache cache.Cache
+	next         http.Handler
+	routingTable *RoutingTable
 }
 
-func WithAPIService(next http.Handler, cache cache.Cache) http.Handler {
-	return &apiService{next: next, cache: cache}
+func WithAPIService(next http.Handler, routingTable *RoutingTable) http.Handler {
+	return &apiService{next: next, routingTable: routingTable}
 }
 
 func (s *apiService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -45,29 +44,20 @@ func (s *apiService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		s.next.ServeHTTP(w, req)
 		return
 	}
-	var apiServices extensionsv1alpha1.APIServiceList
-	if err := s.cache.List(req.Context(), &apiServices); err != nil {
-		reason := fmt.Errorf("failed to list api services")
-		klog.Errorf("%v: %v", reason, err)
-		responsewriters.InternalError(w, req, errors.NewInternalError(reason))
+	apiService := s.routingTable.APIServiceFor(requestInfo.APIGroup, requestInfo.APIVersion)
+	if apiService == nil {
+		s.next.ServeHTTP(w, req)
 		return
 	}
-	for _, apiService := range apiServices.Items {
-		if apiService.Spec.Group != requestInfo.APIGroup || apiService.Spec.Version != requestInfo.APIVersion {
-			continue
-		}
-		if apiService.Status.State != extensionsv1alpha1.StateAvailable {
-			reason := fmt.Sprintf("apiService %s is not available", apiService.Name)
-			responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
-			return
-		}
-		s.handleProxyRequest(apiService, w, req)
+	if apiService.Status.State != extensionsv1alpha1.StateAvailable {
+		reason := fmt.Sprintf("apiService %s is not available", apiService.Name)
+		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
 		return
 	}
-	s.next.ServeHTTP(w, req)
+	s.handleProxyRequest(apiService, w, req)
 }
 
-func (s *apiService) handleProxyRequest(apiService extensionsv1alpha1.APIService, w http.ResponseWriter, req *http.Request) {
+func (s *apiService) handleProxyRequest(apiService *extensionsv1alpha1.APIService, w http.ResponseWriter, req *http.Request) {
 	endpoint, err := url.Parse(apiService.Spec.RawURL())
 	if err != nil {
 		reason := fmt.Sprintf("apiService %s is not available", apiService.Name)
@@ -111,6 +101,15 @@ func (s *apiService) handleProxyRequest(apiService extensionsv1alpha1.APIService
 		return
 	}
 
+	if policy := s.routingTable.trafficPolicyFor(apiServiceKind, apiService.Name); policy != nil {
+		admission, ok := policy.admit(w, req)
+		if !ok {
+			return
+		}
+		defer admission.done()
+		tr = admission.RoundTripper(tr)
+	}
+
 	user, _ := request.UserFrom(req.Context())
 	proxyRoundTripper := transport.NewAuthProxyRoundTripper(user.GetName(), user.GetUID(), user.GetGroups(), user.GetExtra(), tr)
 
@@ -7,17 +7,12 @@
 package filters
 
 import (
-	"encoding/base64"
 	"fmt"
-	"net"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
-	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/httpstream"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/proxy"
@@ -25,21 +20,18 @@ import (
 	"k8s.io/client-go/transport"
 	"k8s.io/klog/v2"
 	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"kubesphere.io/kubesphere/pkg/apiserver/request"
 	"kubesphere.io/kubesphere/pkg/utils/directives"
 )
 
 type reverseProxy struct {
-	next               http.Handler
-	cache              cache.Cache
-	proxyRoundTrippers *sync.Map
+	next         http.Handler
+	routingTable *RoutingTable
 }
 
-func WithReverseProxy(next http.Handler, cache cache.Cache) http.Handler {
-	return &reverseProxy{next: next, cache: cache, proxyRoundTrippers: &sync.Map{}}
+func WithReverseProxy(next http.Handler, routingTable *RoutingTable) http.Handler {
+	return &reverseProxy{next: next, routingTable: routingTable}
 }
 
 func (s *reverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -58,54 +50,46 @@ func (s *reverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var reverseProxies extensionsv1alpha1.ReverseProxyList
-	// If the target label is not set, it is also handled by ks-apiserver (backward compatibility)
-	selector, _ := labels.Parse(fmt.Sprintf("%s!=%s", extensionsv1alpha1.ReverseProxyTargetLabel, extensionsv1alpha1.ReverseProxyTargetConsole))
-	if err := s.cache.List(req.Context(), &reverseProxies, client.MatchingLabelsSelector{Selector: selector}); err != nil {
-		reason := "failed to list reverse proxies"
-		klog.Errorf("%v: %v\n", reason, err)
-		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
+	reverseProxy := s.routingTable.ReverseProxyFor(req.Method, req.URL.Path)
+	if reverseProxy == nil {
+		s.next.ServeHTTP(w, req)
 		return
 	}
-
-	for _, reverseProxy := range reverseProxies.Items {
-		if !s.match(reverseProxy.Spec.Matcher, req) {
-			continue
-		}
-		if reverseProxy.Status.State != extensionsv1alpha1.StateAvailable {
-			responsewriters.WriteRawJSON(http.StatusServiceUnavailable, fmt.Errorf("upstream %s is not available", reverseProxy.Name), w)
-			return
-		}
-
-		s.handleProxyRequest(reverseProxy, w, req)
+	if reverseProxy.Status.State != extensionsv1alpha1.StateAvailable {
+		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, fmt.Errorf("upstream %s is not available", reverseProxy.Name), w)
 		return
-
 	}
-	s.next.ServeHTTP(w, req)
+	s.handleProxyRequest(reverseProxy, w, req)
 }
 
-func (s *reverseProxy) match(matcher extensionsv1alpha1.Matcher, req *http.Request) bool {
-	if matcher.Method != req.Method && matcher.Method != "*" {
-		return false
-	}
-	if matcher.Path == req.URL.Path {
-		return true
+func (s *reverseProxy) handleProxyRequest(reverseProxy *extensionsv1alpha1.ReverseProxy, w http.ResponseWriter, req *http.Request) {
+	pool := s.routingTable.upstreamPoolFor(reverseProxy.Name)
+	if pool == nil || pool.err != nil {
+		reason := fmt.Sprintf("upstream of %s is not available", reverseProxy.Name)
+		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
+		return
 	}
-	if strings.HasSuffix(matcher.Path, "*") &&
-		strings.HasPrefix(req.URL.Path, strings.TrimRight(matcher.Path, "*")) {
-		return true
+	var admission *trafficAdmission
+	if policy := s.routingTable.trafficPolicyFor(reverseProxyKind, reverseProxy.Name); policy != nil {
+		var ok bool
+		if admission, ok = policy.admit(w, req); !ok {
+			return
+		}
+		defer admission.done()
 	}
-	return false
-}
-
-func (s *reverseProxy) handleProxyRequest(reverseProxy extensionsv1alpha1.ReverseProxy, w http.ResponseWriter, req *http.Request) {
-	endpoint, err := url.Parse(reverseProxy.Spec.Upstream.RawURL())
-	if err != nil {
-		reason := fmt.Sprintf("endpoint %s is not available", endpoint)
-		klog.Warningf("%v: %v\n", reason, err)
+	upstream := pool.pick()
+	if upstream == nil {
+		if admission != nil {
+			admission.failed.Store(true)
+		}
+		reason := fmt.Sprintf("no healthy upstream of %s is available", reverseProxy.Name)
 		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
 		return
 	}
+	upstream.activeRequests.Add(1)
+	defer upstream.activeRequests.Add(-1)
+
+	endpoint := upstream.url
 	location := &url.URL{}
 	location.Scheme = endpoint.Scheme
 	location.Host = endpoint.Host
@@ -138,74 +122,31 @@ func (s *reverseProxy) handleProxyRequest(reverseProxy extensionsv1alpha1.Revers
 		}
 	}
 
-	if err = directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.Rewrite, directives.WithRewriteFilter); err != nil {
+	if err := directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.Rewrite, directives.WithRewriteFilter); err != nil {
 		reason := "failed to create handler directives Directives.Rewrite"
 		klog.Warningf("%v: %v\n", reason, err)
 		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
 		return
 	}
 
-	if err = directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.Replace, directives.WithReplaceFilter); err != nil {
+	if err := directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.Replace, directives.WithReplaceFilter); err != nil {
 		reason := "failed to create handler directives Directives.Replace"
 		klog.Warningf("%v: %v\n", reason, err)
 		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
 		return
 	}
 
-	if err = directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.PathRegexp, directives.WithPathRegexpFilter); err != nil {
+	if err := directives.HandlerRequest(newReq, reverseProxy.Spec.Directives.PathRegexp, directives.WithPathRegexpFilter); err != nil {
 		reason := "failed to create handler directives Directives.PathRegexp"
 		klog.Warningf("%v: %v\n", reason, err)
 		responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
 		return
 	}
 
-	var proxyRoundTripper http.RoundTripper
-	if newProxyRoundTripper, ok := s.proxyRoundTrippers.Load(reverseProxy.Name); !ok {
-		tlsConfig := transport.TLSConfig{
-			Insecure: reverseProxy.Spec.Upstream.InsecureSkipVerify,
-		}
-		if !reverseProxy.Spec.Upstream.InsecureSkipVerify && len(reverseProxy.Spec.Upstream.CABundle) > 0 {
-			caData, err := base64.StdEncoding.DecodeString(string(reverseProxy.Spec.Upstream.CABundle))
-			if err != nil {
-				reason := fmt.Sprintf("failed to decode CA bundle from upstream %s", reverseProxy.Name)
-				klog.Warningf("%v: %v\n", reason, err)
-				responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
-				return
-			}
-			tlsConfig.CAData = caData
-		}
-
-		newProxyRoundTripper, err := transport.New(&transport.Config{
-			TLS: tlsConfig,
-			WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
-				return &http.Transport{
-					DialContext: (&net.Dialer{
-						Timeout:   30 * time.Second,
-						KeepAlive: 30 * time.Second,
-					}).DialContext,
-					ForceAttemptHTTP2:     true,
-					MaxIdleConns:          0,
-					MaxConnsPerHost:       0,
-					MaxIdleConnsPerHost:   100,
-					IdleConnTimeout:       90 * time.Second,
-					TLSHandshakeTimeout:   10 * time.Second,
-					ExpectContinueTimeout: 1 * time.Second,
-					TLSClientConfig:       rt.(*http.Transport).TLSClientConfig,
-				}
-			},
-		})
-		if err != nil {
-			reason := "failed to create transport.TLSConfig"
-			klog.Warningf("%v: %v\n", reason, err)
-			responsewriters.WriteRawJSON(http.StatusServiceUnavailable, errors.NewServiceUnavailable(reason), w)
-			return
-		}
-		proxyRoundTripper = newProxyRoundTripper
-		s.proxyRoundTrippers.Store(reverseProxy.Name, newProxyRoundTripper)
-	} else {
-		proxyRoundTripper = newProxyRoundTripper.(http.RoundTripper)
+	proxyRoundTripper := upstream.roundTripper
+	if admission != nil {
+		proxyRoundTripper = admission.RoundTripper(proxyRoundTripper)
 	}
-
 	if reverseProxy.Spec.Directives.AuthProxy {
 		user, _ := request.UserFrom(req.Context())
 		proxyRoundTripper = transport.NewAuthProxyRoundTripper(user.GetName(), user.GetUID(), user.GetGroups(), user.GetExtra(), proxyRoundTripper)
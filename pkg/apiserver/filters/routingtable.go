@@ -0,0 +1,345 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+	runtimecache "sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/metrics"
+)
+
+const (
+	reverseProxyKind = "ReverseProxy"
+	apiServiceKind   = "APIService"
+
+	upstreamHealthy   = "healthy"
+	upstreamUnhealthy = "unhealthy"
+)
+
+// RoutingTable indexes the ReverseProxies and APIServices handled by ks-apiserver. It is rebuilt from
+// the informer events, so that the requests can be routed without listing the objects from the cache.
+type RoutingTable struct {
+	ctx            context.Context
+	mu             sync.Mutex
+	reverseProxies map[string]*extensionsv1alpha1.ReverseProxy
+	upstreamPools  map[string]*upstreamPool
+	apiServices    map[string]*extensionsv1alpha1.APIService
+	// trafficPolicies are indexed by the kind and the name of the objects.
+	trafficPolicies map[string]*trafficPolicy
+	globalLimiters  map[globalLimiterKey]*rate.Limiter
+	routes          atomic.Pointer[routes]
+}
+
+type routes struct {
+	// exact indexes the ReverseProxies by the path of the matcher.
+	exact map[string][]*extensionsv1alpha1.ReverseProxy
+	// prefixes indexes the ReverseProxies with wildcard matchers by the path prefix.
+	prefixes        map[string][]*extensionsv1alpha1.ReverseProxy
+	upstreamPools   map[string]*upstreamPool
+	trafficPolicies map[string]*trafficPolicy
+	apiServices     map[schema.GroupVersion]*extensionsv1alpha1.APIService
+}
+
+// NewRoutingTable creates a RoutingTable which is kept in sync with the informers of the cache.
+func NewRoutingTable(ctx context.Context, cache runtimecache.Cache) (*RoutingTable, error) {
+	t := newRoutingTable(ctx)
+
+	reverseProxyInformer, err := cache.GetInformer(ctx, &extensionsv1alpha1.ReverseProxy{})
+	if err != nil {
+		return nil, fmt.Errorf("get informer failed: %w", err)
+	}
+	if _, err = reverseProxyInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			t.setReverseProxy(obj.(*extensionsv1alpha1.ReverseProxy))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			t.setReverseProxy(obj.(*extensionsv1alpha1.ReverseProxy))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if reverseProxy, ok := deletedObject(obj).(*extensionsv1alpha1.ReverseProxy); ok {
+				t.deleteReverseProxy(reverseProxy.Name)
+			}
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("add event handler failed: %w", err)
+	}
+
+	apiServiceInformer, err := cache.GetInformer(ctx, &extensionsv1alpha1.APIService{})
+	if err != nil {
+		return nil, fmt.Errorf("get informer failed: %w", err)
+	}
+	if _, err = apiServiceInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			t.setAPIService(obj.(*extensionsv1alpha1.APIService))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			t.setAPIService(obj.(*extensionsv1alpha1.APIService))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if apiService, ok := deletedObject(obj).(*extensionsv1alpha1.APIService); ok {
+				t.deleteAPIService(apiService.Name)
+			}
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("add event handler failed: %w", err)
+	}
+	return t, nil
+}
+
+func newRoutingTable(ctx context.Context) *RoutingTable {
+	t := &RoutingTable{
+		ctx:             ctx,
+		reverseProxies:  make(map[string]*extensionsv1alpha1.ReverseProxy),
+		upstreamPools:   make(map[string]*upstreamPool),
+		trafficPolicies: make(map[string]*trafficPolicy),
+		globalLimiters:  make(map[globalLimiterKey]*rate.Limiter),
+		apiServices:     make(map[string]*extensionsv1alpha1.APIService),
+	}
+	t.rebuild()
+	return t
+}
+
+func deletedObject(obj interface{}) interface{} {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+func (t *RoutingTable) setReverseProxy(reverseProxy *extensionsv1alpha1.ReverseProxy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// If the target label is not set, it is also handled by ks-apiserver (backward compatibility)
+	if reverseProxy.Labels[extensionsv1alpha1.ReverseProxyTargetLabel] == extensionsv1alpha1.ReverseProxyTargetConsole {
+		delete(t.reverseProxies, reverseProxy.Name)
+		t.deleteUpstreamPool(reverseProxy.Name)
+		t.deleteTrafficPolicy(reverseProxyKind, reverseProxy.Name)
+	} else {
+		t.reverseProxies[reverseProxy.Name] = reverseProxy
+		t.setTrafficPolicy(reverseProxyKind, reverseProxy.Name, reverseProxy.Labels,
+			reverseProxy.Spec.Directives.RateLimit, reverseProxy.Spec.Directives.CircuitBreaker)
+		// The pool is kept across the updates of the status, so that the health of the upstreams is not reset.
+		if pool, ok := t.upstreamPools[reverseProxy.Name]; !ok || pool.specChanged(&reverseProxy.Spec) {
+			t.deleteUpstreamPool(reverseProxy.Name)
+			pool = newUpstreamPool(reverseProxy)
+			name := reverseProxy.Name
+			pool.start(t.ctx, func(total int, unhealthy []string) {
+				t.reportUpstreamHealth(name, pool, total, unhealthy)
+			})
+			t.upstreamPools[reverseProxy.Name] = pool
+		}
+	}
+	t.rebuild()
+}
+
+func (t *RoutingTable) deleteReverseProxy(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.reverseProxies, name)
+	t.deleteUpstreamPool(name)
+	t.deleteTrafficPolicy(reverseProxyKind, name)
+	t.rebuild()
+}
+
+// deleteUpstreamPool must be called with the lock held.
+func (t *RoutingTable) deleteUpstreamPool(name string) {
+	if pool, ok := t.upstreamPools[name]; ok {
+		pool.stop()
+		delete(t.upstreamPools, name)
+		metrics.ProxyUpstreams.Delete(map[string]string{"name": name, "state": upstreamHealthy})
+		metrics.ProxyUpstreams.Delete(map[string]string{"name": name, "state": upstreamUnhealthy})
+	}
+}
+
+// reportUpstreamHealth exports the number of the healthy and unhealthy upstreams of the ReverseProxy. The health
+// is observed by each replica of ks-apiserver independently, so it is not written to the status of the ReverseProxy,
+// the UpstreamsHealthy condition is set by the health checks of ks-controller-manager instead.
+func (t *RoutingTable) reportUpstreamHealth(name string, pool *upstreamPool, total int, unhealthy []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// The pool has been replaced or stopped.
+	if t.upstreamPools[name] != pool {
+		return
+	}
+	metrics.ProxyUpstreams.WithLabelValues(name, upstreamHealthy).Set(float64(total - len(unhealthy)))
+	metrics.ProxyUpstreams.WithLabelValues(name, upstreamUnhealthy).Set(float64(len(unhealthy)))
+}
+
+func (t *RoutingTable) setAPIService(apiService *extensionsv1alpha1.APIService) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.apiServices[apiService.Name] = apiService
+	t.setTrafficPolicy(apiServiceKind, apiService.Name, apiService.Labels, apiService.Spec.RateLimit, apiService.Spec.CircuitBreaker)
+	t.rebuild()
+}
+
+func (t *RoutingTable) deleteAPIService(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.apiServices, name)
+	t.deleteTrafficPolicy(apiServiceKind, name)
+	t.rebuild()
+}
+
+// setTrafficPolicy must be called with the lock held, the policy is kept unless the settings are changed.
+func (t *RoutingTable) setTrafficPolicy(kind, name string, labels map[string]string,
+	rateLimit *extensionsv1alpha1.RateLimit, circuitBreaker *extensionsv1alpha1.CircuitBreaker) {
+	key := kind + "/" + name
+	policy, ok := t.trafficPolicies[key]
+	if rateLimit == nil && circuitBreaker == nil {
+		if ok {
+			t.deleteTrafficPolicy(kind, name)
+		}
+		return
+	}
+	extension := extensionOf(kind, name, labels)
+	if ok && !policy.specChanged(rateLimit, circuitBreaker) &&
+		(policy.globalKey == nil || policy.globalKey.extension == extension) {
+		return
+	}
+	if ok {
+		t.deleteTrafficPolicy(kind, name)
+	}
+	t.trafficPolicies[key] = newTrafficPolicy(kind, name, extension, rateLimit, circuitBreaker, t.globalLimiters)
+}
+
+// deleteTrafficPolicy must be called with the lock held, the global limiters no longer used are released.
+func (t *RoutingTable) deleteTrafficPolicy(kind, name string) {
+	key := kind + "/" + name
+	policy, ok := t.trafficPolicies[key]
+	if !ok {
+		return
+	}
+	policy.stop()
+	delete(t.trafficPolicies, key)
+	if policy.globalKey == nil {
+		return
+	}
+	for _, p := range t.trafficPolicies {
+		if p.globalKey != nil && *p.globalKey == *policy.globalKey {
+			return
+		}
+	}
+	delete(t.globalLimiters, *policy.globalKey)
+}
+
+// rebuild must be called with the lock held.
+func (t *RoutingTable) rebuild() {
+	r := &routes{
+		exact:           make(map[string][]*extensionsv1alpha1.ReverseProxy),
+		prefixes:        make(map[string][]*extensionsv1alpha1.ReverseProxy),
+		upstreamPools:   make(map[string]*upstreamPool, len(t.upstreamPools)),
+		trafficPolicies: make(map[string]*trafficPolicy, len(t.trafficPolicies)),
+		apiServices:     make(map[schema.GroupVersion]*extensionsv1alpha1.APIService),
+	}
+	for name, pool := range t.upstreamPools {
+		r.upstreamPools[name] = pool
+	}
+	for key, policy := range t.trafficPolicies {
+		r.trafficPolicies[key] = policy
+	}
+	for _, reverseProxy := range t.reverseProxies {
+		if prefix, ok := strings.CutSuffix(reverseProxy.Spec.Matcher.Path, "*"); ok {
+			prefix = strings.TrimRight(prefix, "*")
+			r.prefixes[prefix] = append(r.prefixes[prefix], reverseProxy)
+		} else {
+			r.exact[reverseProxy.Spec.Matcher.Path] = append(r.exact[reverseProxy.Spec.Matcher.Path], reverseProxy)
+		}
+	}
+	for _, reverseProxies := range r.exact {
+		slices.SortFunc(reverseProxies, compareReverseProxies)
+	}
+	for _, reverseProxies := range r.prefixes {
+		slices.SortFunc(reverseProxies, compareReverseProxies)
+	}
+
+	for _, apiService := range t.apiServices {
+		gv := schema.GroupVersion{Group: apiService.Spec.Group, Version: apiService.Spec.Version}
+		if existing, ok := r.apiServices[gv]; ok {
+			if compareObjects(existing.CreationTimestamp.Time, existing.Name, apiService.CreationTimestamp.Time, apiService.Name) < 0 {
+				klog.Warningf("api service %s conflicts with %s for %s", apiService.Name, existing.Name, gv)
+				continue
+			}
+			klog.Warningf("api service %s conflicts with %s for %s", existing.Name, apiService.Name, gv)
+		}
+		r.apiServices[gv] = apiService
+	}
+	t.routes.Store(r)
+}
+
+// compareReverseProxies sorts the ReverseProxies with the same path, the specific methods take precedence over
+// the wildcard method, and the oldest one wins among the conflicting ReverseProxies.
+func compareReverseProxies(a, b *extensionsv1alpha1.ReverseProxy) int {
+	if wildcardA, wildcardB := a.Spec.Matcher.Method == "*", b.Spec.Matcher.Method == "*"; wildcardA != wildcardB {
+		if wildcardA {
+			return 1
+		}
+		return -1
+	}
+	return compareObjects(a.CreationTimestamp.Time, a.Name, b.CreationTimestamp.Time, b.Name)
+}
+
+// ReverseProxyFor returns the ReverseProxy matching the request. The path is matched by the longest prefix,
+// an exact path takes precedence over the wildcard path with the same prefix, then the method is matched.
+func (t *RoutingTable) ReverseProxyFor(method, path string) *extensionsv1alpha1.ReverseProxy {
+	r := t.routes.Load()
+	// An exact path is always longer than or equal to the prefixes that match the same path.
+	if reverseProxy := matchMethod(r.exact[path], method); reverseProxy != nil {
+		return reverseProxy
+	}
+	for i := len(path); i >= 0; i-- {
+		if reverseProxy := matchMethod(r.prefixes[path[:i]], method); reverseProxy != nil {
+			return reverseProxy
+		}
+	}
+	return nil
+}
+
+func matchMethod(reverseProxies []*extensionsv1alpha1.ReverseProxy, method string) *extensionsv1alpha1.ReverseProxy {
+	for _, reverseProxy := range reverseProxies {
+		if reverseProxy.Spec.Matcher.Method == method || reverseProxy.Spec.Matcher.Method == "*" {
+			return reverseProxy
+		}
+	}
+	return nil
+}
+
+// upstreamPoolFor returns the upstream pool of the ReverseProxy.
+func (t *RoutingTable) upstreamPoolFor(name string) *upstreamPool {
+	return t.routes.Load().upstreamPools[name]
+}
+
+// trafficPolicyFor returns the rate limit and circuit breaker of the object, nil if neither is configured.
+func (t *RoutingTable) trafficPolicyFor(kind, name string) *trafficPolicy {
+	return t.routes.Load().trafficPolicies[kind+"/"+name]
+}
+
+// APIServiceFor returns the APIService serving the group version.
+func (t *RoutingTable) APIServiceFor(group, version string) *extensionsv1alpha1.APIService {
+	return t.routes.Load().apiServices[schema.GroupVersion{Group: group, Version: version}]
+}
+
+// compareObjects orders the conflicting objects, the oldest one comes first.
+func compareObjects(createdA time.Time, nameA string, createdB time.Time, nameB string) int {
+	if c := createdA.Compare(createdB); c != 0 {
+		return c
+	}
+	return strings.Compare(nameA, nameB)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+)
+
+func newReverseProxy(name, method, path string, created time.Time) *extensionsv1alpha1.ReverseProxy {
+	return &extensionsv1alpha1.ReverseProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Spec:       extensionsv1alpha1.ReverseProxySpec{Matcher: extensionsv1alpha1.Matcher{Method: method, Path: path}},
+	}
+}
+
+func TestRoutingTableReverseProxyFor(t *testing.T) {
+	now := time.Now()
+	table := newRoutingTable(context.Background())
+	table.setReverseProxy(newReverseProxy("devops", "*", "/proxy/devops*", now))
+	table.setReverseProxy(newReverseProxy("devops-api", "*", "/proxy/devops/api/*", now))
+	table.setReverseProxy(newReverseProxy("devops-api-get", http.MethodGet, "/proxy/devops/api/*", now))
+	table.setReverseProxy(newReverseProxy("devops-version", "*", "/proxy/devops/api/version", now))
+	table.setReverseProxy(newReverseProxy("logging", "*", "/proxy/logging/*", now))
+	table.setReverseProxy(newReverseProxy("logging-conflicted", "*", "/proxy/logging/*", now.Add(-time.Minute)))
+	console := newReverseProxy("console", "*", "/proxy/console/*", now)
+	console.Labels = map[string]string{extensionsv1alpha1.ReverseProxyTargetLabel: extensionsv1alpha1.ReverseProxyTargetConsole}
+	table.setReverseProxy(console)
+
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{method: http.MethodGet, path: "/proxy/devops", expected: "devops"},
+		{method: http.MethodGet, path: "/proxy/devops/pipelines", expected: "devops"},
+		{method: http.MethodPost, path: "/proxy/devops/api/pipelines", expected: "devops-api"},
+		{method: http.MethodGet, path: "/proxy/devops/api/pipelines", expected: "devops-api-get"},
+		{method: http.MethodGet, path: "/proxy/devops/api/version", expected: "devops-version"},
+		{method: http.MethodGet, path: "/proxy/logging/logs", expected: "logging-conflicted"},
+		{method: http.MethodGet, path: "/proxy/console/logs"},
+		{method: http.MethodGet, path: "/proxy/monitoring"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			reverseProxy := table.ReverseProxyFor(tt.method, tt.path)
+			if tt.expected == "" {
+				assert.Nil(t, reverseProxy)
+				return
+			}
+			assert.NotNil(t, reverseProxy)
+			assert.Equal(t, tt.expected, reverseProxy.Name)
+		})
+	}
+
+	table.deleteReverseProxy("devops-version")
+	assert.Equal(t, "devops-api-get", table.ReverseProxyFor(http.MethodGet, "/proxy/devops/api/version").Name)
+}
+
+func TestRoutingTableAPIServiceFor(t *testing.T) {
+	now := time.Now()
+	table := newRoutingTable(context.Background())
+	for _, apiService := range []*extensionsv1alpha1.APIService{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "v1alpha1.devops.kubesphere.io", CreationTimestamp: metav1.NewTime(now)},
+			Spec:       extensionsv1alpha1.APIServiceSpec{Group: "devops.kubesphere.io", Version: "v1alpha1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "conflicted", CreationTimestamp: metav1.NewTime(now.Add(time.Minute))},
+			Spec:       extensionsv1alpha1.APIServiceSpec{Group: "devops.kubesphere.io", Version: "v1alpha1"},
+		},
+	} {
+		table.setAPIService(apiService)
+	}
+
+	assert.Equal(t, "v1alpha1.devops.kubesphere.io", table.APIServiceFor("devops.kubesphere.io", "v1alpha1").Name)
+	assert.Nil(t, table.APIServiceFor("devops.kubesphere.io", "v1alpha2"))
+
+	table.deleteAPIService("v1alpha1.devops.kubesphere.io")
+	assert.Equal(t, "conflicted", table.APIServiceFor("devops.kubesphere.io", "v1alpha1").Name)
+}
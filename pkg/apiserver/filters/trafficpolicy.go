@@ -0,0 +1,362 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	"k8s.io/klog/v2"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/metrics"
+	"kubesphere.io/kubesphere/pkg/apiserver/request"
+	"kubesphere.io/kubesphere/pkg/utils/healthcheck"
+)
+
+const (
+	defaultMinimumRequests = 20
+	defaultBreakerInterval = 10 * time.Second
+	defaultCoolDown        = 30 * time.Second
+	// maxUserLimiters is the number of the per user limiters kept for a route before the idle ones are pruned.
+	maxUserLimiters = 1024
+
+	rejectReasonUserRateLimit  = "UserRateLimit"
+	rejectReasonRouteRateLimit = "RouteRateLimit"
+	rejectReasonGlobalLimit    = "GlobalRateLimit"
+	rejectReasonConcurrency    = "MaxConcurrentRequests"
+	rejectReasonCircuitOpen    = "CircuitOpen"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// globalLimiterKey identifies the limiter shared by the routes of an extension with the same global limit.
+type globalLimiterKey struct {
+	extension string
+	bucket    extensionsv1alpha1.TokenBucket
+}
+
+// trafficPolicy applies the rate limit and the circuit breaker of a ReverseProxy or an APIService.
+type trafficPolicy struct {
+	kind string
+	name string
+
+	rateLimit      *extensionsv1alpha1.RateLimit
+	circuitBreaker *extensionsv1alpha1.CircuitBreaker
+
+	routeLimiter  *rate.Limiter
+	globalKey     *globalLimiterKey
+	globalLimiter *rate.Limiter
+	userLimiters  sync.Map
+	userCount     atomic.Int64
+
+	activeRequests atomic.Int64
+
+	mu          sync.Mutex
+	state       circuitState
+	openedUntil time.Time
+	probing     bool
+	windowStart time.Time
+	requests    int32
+	failures    int32
+}
+
+func newTrafficPolicy(kind, name, extension string, rateLimit *extensionsv1alpha1.RateLimit, circuitBreaker *extensionsv1alpha1.CircuitBreaker,
+	globalLimiters map[globalLimiterKey]*rate.Limiter) *trafficPolicy {
+	p := &trafficPolicy{
+		kind:           kind,
+		name:           name,
+		rateLimit:      rateLimit.DeepCopy(),
+		circuitBreaker: circuitBreaker.DeepCopy(),
+	}
+	if p.rateLimit != nil {
+		if p.rateLimit.PerRoute != nil {
+			p.routeLimiter = newLimiter(p.rateLimit.PerRoute)
+		}
+		if p.rateLimit.Global != nil {
+			p.globalKey = &globalLimiterKey{extension: extension, bucket: *p.rateLimit.Global}
+			if p.globalLimiter = globalLimiters[*p.globalKey]; p.globalLimiter == nil {
+				p.globalLimiter = newLimiter(p.rateLimit.Global)
+				globalLimiters[*p.globalKey] = p.globalLimiter
+			}
+		}
+	}
+	if p.circuitBreaker != nil {
+		metrics.ProxyCircuitBreakerState.WithLabelValues(kind, name).Set(float64(circuitClosed))
+	}
+	return p
+}
+
+func newLimiter(bucket *extensionsv1alpha1.TokenBucket) *rate.Limiter {
+	burst := bucket.Burst
+	if burst <= 0 {
+		burst = bucket.RequestsPerSecond
+	}
+	return rate.NewLimiter(rate.Limit(bucket.RequestsPerSecond), int(burst))
+}
+
+// specChanged reports whether the rate limit or the circuit breaker has been changed.
+func (p *trafficPolicy) specChanged(rateLimit *extensionsv1alpha1.RateLimit, circuitBreaker *extensionsv1alpha1.CircuitBreaker) bool {
+	return !equality.Semantic.DeepEqual(p.rateLimit, rateLimit) || !equality.Semantic.DeepEqual(p.circuitBreaker, circuitBreaker)
+}
+
+func (p *trafficPolicy) stop() {
+	if p.circuitBreaker != nil {
+		metrics.ProxyCircuitBreakerState.Delete(map[string]string{"kind": p.kind, "name": p.name})
+	}
+}
+
+// trafficAdmission tracks an admitted request, the result is recorded by the circuit breaker when it is done.
+type trafficAdmission struct {
+	policy *trafficPolicy
+	probe  bool
+	failed atomic.Bool
+}
+
+// admit checks the circuit breaker and the rate limits, the rejected request is responded with Retry-After.
+// done must be called on the returned admission once the request is proxied.
+func (p *trafficPolicy) admit(w http.ResponseWriter, req *http.Request) (*trafficAdmission, bool) {
+	now := time.Now()
+	// The request is counted before the check, so that the concurrent requests can not exceed the limit together.
+	if active := p.activeRequests.Add(1); p.circuitBreaker != nil &&
+		p.circuitBreaker.MaxConcurrentRequests > 0 && active > int64(p.circuitBreaker.MaxConcurrentRequests) {
+		p.activeRequests.Add(-1)
+		p.reject(w, http.StatusServiceUnavailable, rejectReasonConcurrency, time.Second)
+		return nil, false
+	}
+	probe, retryAfter := p.allow(now)
+	if retryAfter > 0 {
+		p.activeRequests.Add(-1)
+		p.reject(w, http.StatusServiceUnavailable, rejectReasonCircuitOpen, retryAfter)
+		return nil, false
+	}
+	if reason, retryAfter := p.reserve(req, now); retryAfter > 0 {
+		p.activeRequests.Add(-1)
+		if probe {
+			p.mu.Lock()
+			p.probing = false
+			p.mu.Unlock()
+		}
+		p.reject(w, http.StatusTooManyRequests, reason, retryAfter)
+		return nil, false
+	}
+	return &trafficAdmission{policy: p, probe: probe}, true
+}
+
+// allow returns whether the request is a probe of the half-open breaker, or how long to wait if the breaker is open.
+func (p *trafficPolicy) allow(now time.Time) (bool, time.Duration) {
+	if p.circuitBreaker == nil || p.circuitBreaker.ErrorRateThreshold <= 0 {
+		return false, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.state {
+	case circuitOpen:
+		if now.Before(p.openedUntil) {
+			return false, p.openedUntil.Sub(now)
+		}
+		p.setState(circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		if p.probing {
+			return false, time.Second
+		}
+		p.probing = true
+		return true, 0
+	}
+	return false, 0
+}
+
+// reserve takes a token from each bucket, the tokens are returned if any of the buckets is exhausted.
+func (p *trafficPolicy) reserve(req *http.Request, now time.Time) (string, time.Duration) {
+	if p.rateLimit == nil {
+		return "", 0
+	}
+	type bucket struct {
+		limiter *rate.Limiter
+		reason  string
+	}
+	var buckets []bucket
+	if p.rateLimit.PerUser != nil {
+		buckets = append(buckets, bucket{p.userLimiter(req, now), rejectReasonUserRateLimit})
+	}
+	if p.routeLimiter != nil {
+		buckets = append(buckets, bucket{p.routeLimiter, rejectReasonRouteRateLimit})
+	}
+	if p.globalLimiter != nil {
+		buckets = append(buckets, bucket{p.globalLimiter, rejectReasonGlobalLimit})
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(buckets))
+	for _, b := range buckets {
+		reservation := b.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+			if !reservation.OK() {
+				delay = time.Second
+			}
+			reservation.CancelAt(now)
+			for _, r := range reservations {
+				r.CancelAt(now)
+			}
+			return b.reason, delay
+		}
+		reservations = append(reservations, reservation)
+	}
+	return "", 0
+}
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64
+}
+
+func (p *trafficPolicy) userLimiter(req *http.Request, now time.Time) *rate.Limiter {
+	var username string
+	if user, ok := request.UserFrom(req.Context()); ok {
+		username = user.GetName()
+	}
+	value, loaded := p.userLimiters.LoadOrStore(username, &userLimiter{limiter: newLimiter(p.rateLimit.PerUser)})
+	limiter := value.(*userLimiter)
+	limiter.lastSeen.Store(now.UnixNano())
+	if !loaded && p.userCount.Add(1) > maxUserLimiters {
+		p.pruneUserLimiters(now)
+	}
+	return limiter.limiter
+}
+
+// pruneUserLimiters removes the limiters whose buckets have been refilled, which behave the same as the new ones.
+func (p *trafficPolicy) pruneUserLimiters(now time.Time) {
+	p.userLimiters.Range(func(key, value any) bool {
+		limiter := value.(*userLimiter)
+		if limiter.lastSeen.Load() < now.UnixNano() && limiter.limiter.TokensAt(now) >= float64(limiter.limiter.Burst()) {
+			p.userLimiters.Delete(key)
+			p.userCount.Add(-1)
+		}
+		return true
+	})
+}
+
+func (p *trafficPolicy) reject(w http.ResponseWriter, code int, reason string, retryAfter time.Duration) {
+	metrics.ProxyRejectedRequests.WithLabelValues(p.kind, p.name, reason).Inc()
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("%s %s rejected the request: %s", p.kind, p.name, reason)
+	if code == http.StatusTooManyRequests {
+		responsewriters.WriteRawJSON(code, errors.NewTooManyRequests(message, seconds), w)
+		return
+	}
+	responsewriters.WriteRawJSON(code, errors.NewServiceUnavailable(message), w)
+}
+
+// setState must be called with the lock held.
+func (p *trafficPolicy) setState(state circuitState) {
+	if p.state == state {
+		return
+	}
+	if state == circuitOpen {
+		klog.Warningf("circuit breaker of %s %s is open", p.kind, p.name)
+	}
+	p.state = state
+	metrics.ProxyCircuitBreakerState.WithLabelValues(p.kind, p.name).Set(float64(state))
+}
+
+// RoundTripper records the failure of the request, connection errors and 5xx responses are counted as failures.
+func (a *trafficAdmission) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return &admissionRoundTripper{admission: a, roundTripper: rt}
+}
+
+func (a *trafficAdmission) done() {
+	p := a.policy
+	p.activeRequests.Add(-1)
+	if p.circuitBreaker == nil || p.circuitBreaker.ErrorRateThreshold <= 0 {
+		return
+	}
+	now := time.Now()
+	failed := a.failed.Load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if a.probe {
+		p.probing = false
+		if failed {
+			p.open(now)
+		} else {
+			p.setState(circuitClosed)
+			p.windowStart, p.requests, p.failures = now, 0, 0
+		}
+		return
+	}
+	if p.state != circuitClosed {
+		return
+	}
+	interval := defaultBreakerInterval
+	if p.circuitBreaker.Interval != nil && p.circuitBreaker.Interval.Duration > 0 {
+		interval = p.circuitBreaker.Interval.Duration
+	}
+	if now.Sub(p.windowStart) >= interval {
+		p.windowStart, p.requests, p.failures = now, 0, 0
+	}
+	p.requests++
+	if failed {
+		p.failures++
+	}
+	if p.requests >= healthcheck.Threshold(p.circuitBreaker.MinimumRequests, defaultMinimumRequests) &&
+		p.failures*100 >= p.circuitBreaker.ErrorRateThreshold*p.requests {
+		p.open(now)
+	}
+}
+
+// open must be called with the lock held.
+func (p *trafficPolicy) open(now time.Time) {
+	coolDown := defaultCoolDown
+	if p.circuitBreaker.CoolDown != nil && p.circuitBreaker.CoolDown.Duration > 0 {
+		coolDown = p.circuitBreaker.CoolDown.Duration
+	}
+	p.openedUntil = now.Add(coolDown)
+	p.windowStart, p.requests, p.failures = now, 0, 0
+	p.setState(circuitOpen)
+}
+
+type admissionRoundTripper struct {
+	admission    *trafficAdmission
+	roundTripper http.RoundTripper
+}
+
+func (rt *admissionRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.roundTripper.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		rt.admission.failed.Store(true)
+	}
+	return resp, err
+}
+
+func (rt *admissionRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.roundTripper
+}
+
+// extensionOf returns the extension which the object belongs to, the object itself is used if it is not labeled.
+func extensionOf(kind, name string, labels map[string]string) string {
+	if extension := labels[corev1alpha1.ExtensionReferenceLabel]; extension != "" {
+		return extension
+	}
+	return kind + "/" + name
+}
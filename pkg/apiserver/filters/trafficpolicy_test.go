@@ -0,0 +1,159 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/request"
+)
+
+func newUserRequest(username string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/proxy/devops/api", nil)
+	return req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: username}))
+}
+
+func admitRequest(t *testing.T, policy *trafficPolicy, username string) (*trafficAdmission, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	admission, ok := policy.admit(w, newUserRequest(username))
+	assert.Equal(t, ok, admission != nil)
+	return admission, w
+}
+
+func TestTrafficPolicyRateLimit(t *testing.T) {
+	globalLimiters := make(map[globalLimiterKey]*rate.Limiter)
+	policy := newTrafficPolicy(reverseProxyKind, "devops", "devops", &extensionsv1alpha1.RateLimit{
+		PerUser:  &extensionsv1alpha1.TokenBucket{RequestsPerSecond: 1, Burst: 2},
+		PerRoute: &extensionsv1alpha1.TokenBucket{RequestsPerSecond: 1, Burst: 3},
+	}, nil, globalLimiters)
+
+	for i := 0; i < 2; i++ {
+		admission, _ := admitRequest(t, policy, "admin")
+		assert.NotNil(t, admission)
+		admission.done()
+	}
+	admission, w := admitRequest(t, policy, "admin")
+	assert.Nil(t, admission)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// The token of the per user bucket is returned when the per route bucket is exhausted.
+	admission, _ = admitRequest(t, policy, "guest")
+	assert.NotNil(t, admission)
+	admission, w = admitRequest(t, policy, "guest")
+	assert.Nil(t, admission)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	value, _ := policy.userLimiters.Load("guest")
+	assert.InDelta(t, 1, value.(*userLimiter).limiter.Tokens(), 0.1)
+
+	// The global limiter is shared by the routes of the same extension.
+	global := &extensionsv1alpha1.RateLimit{Global: &extensionsv1alpha1.TokenBucket{RequestsPerSecond: 1}}
+	a := newTrafficPolicy(reverseProxyKind, "devops-api", "devops", global, nil, globalLimiters)
+	b := newTrafficPolicy(apiServiceKind, "devops-apiservice", "devops", global, nil, globalLimiters)
+	c := newTrafficPolicy(apiServiceKind, "logging", "logging", global, nil, globalLimiters)
+	assert.Same(t, a.globalLimiter, b.globalLimiter)
+	assert.NotSame(t, a.globalLimiter, c.globalLimiter)
+	admission, _ = admitRequest(t, a, "admin")
+	assert.NotNil(t, admission)
+	admission, _ = admitRequest(t, b, "admin")
+	assert.Nil(t, admission)
+	admission, _ = admitRequest(t, c, "admin")
+	assert.NotNil(t, admission)
+}
+
+func TestTrafficPolicyCircuitBreaker(t *testing.T) {
+	policy := newTrafficPolicy(apiServiceKind, "devops", "devops", nil, &extensionsv1alpha1.CircuitBreaker{
+		MaxConcurrentRequests: 2,
+		ErrorRateThreshold:    50,
+		MinimumRequests:       4,
+		CoolDown:              &metav1.Duration{Duration: time.Hour},
+	}, nil)
+
+	first, _ := admitRequest(t, policy, "admin")
+	second, _ := admitRequest(t, policy, "admin")
+	admission, w := admitRequest(t, policy, "admin")
+	assert.Nil(t, admission)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, int64(2), policy.activeRequests.Load())
+	first.done()
+	second.failed.Store(true)
+	second.done()
+
+	for _, failed := range []bool{false, true} {
+		admission, _ = admitRequest(t, policy, "admin")
+		admission.failed.Store(failed)
+		admission.done()
+	}
+	assert.Equal(t, circuitOpen, policy.state)
+	admission, w = admitRequest(t, policy, "admin")
+	assert.Nil(t, admission)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+	assert.Equal(t, int64(0), policy.activeRequests.Load())
+
+	// Only one probe is allowed when the cool-down elapses.
+	policy.openedUntil = time.Now()
+	probe, _ := admitRequest(t, policy, "admin")
+	assert.NotNil(t, probe)
+	assert.True(t, probe.probe)
+	admission, _ = admitRequest(t, policy, "admin")
+	assert.Nil(t, admission)
+	probe.done()
+	assert.Equal(t, circuitClosed, policy.state)
+	admission, _ = admitRequest(t, policy, "admin")
+	assert.NotNil(t, admission)
+}
+
+func TestTrafficPolicyMaxConcurrentRequests(t *testing.T) {
+	policy := newTrafficPolicy(apiServiceKind, "devops", "devops", nil, &extensionsv1alpha1.CircuitBreaker{
+		MaxConcurrentRequests: 5,
+	}, nil)
+
+	var wg sync.WaitGroup
+	var admitted atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if admission, _ := admitRequest(t, policy, "admin"); admission != nil {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), admitted.Load())
+	assert.Equal(t, int64(5), policy.activeRequests.Load())
+}
+
+func TestAdmissionRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	for path, failed := range map[string]bool{"/ok": false, "/error": true} {
+		admission := &trafficAdmission{}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		resp, err := admission.RoundTripper(http.DefaultTransport).RoundTrip(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, failed, admission.failed.Load())
+	}
+}
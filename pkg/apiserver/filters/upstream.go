@@ -0,0 +1,300 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+
+	"kubesphere.io/kubesphere/pkg/utils/healthcheck"
+)
+
+const (
+	defaultConsecutiveErrors = 5
+	defaultEjectionTime      = 30 * time.Second
+)
+
+// upstream is an endpoint of a ReverseProxy.
+type upstream struct {
+	url          *url.URL
+	weight       int64
+	transport    http.RoundTripper
+	roundTripper http.RoundTripper
+
+	activeRequests atomic.Int64
+	// health is updated by the active health checks.
+	health healthcheck.Status
+	// consecutiveErrors counts the consecutive failures of the proxied requests.
+	consecutiveErrors atomic.Int32
+	ejectedUntil      atomic.Int64
+}
+
+func (u *upstream) String() string {
+	return u.url.Host
+}
+
+func (u *upstream) available(now time.Time) bool {
+	return !u.health.Unhealthy() && now.UnixNano() >= u.ejectedUntil.Load()
+}
+
+// upstreamPool balances the requests of a ReverseProxy among its upstreams.
+type upstreamPool struct {
+	spec      extensionsv1alpha1.ReverseProxySpec
+	upstreams []*upstream
+	// err is set if the upstreams are invalid, the requests are rejected.
+	err     error
+	counter atomic.Uint64
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+// reverseProxyEndpoints returns the upstreams of the ReverseProxy, the single upstream is used if no upstreams are specified.
+func reverseProxyEndpoints(spec *extensionsv1alpha1.ReverseProxySpec) []extensionsv1alpha1.WeightedEndpoint {
+	if len(spec.Upstreams) > 0 {
+		return spec.Upstreams
+	}
+	return []extensionsv1alpha1.WeightedEndpoint{{Endpoint: spec.Upstream}}
+}
+
+func newUpstreamPool(reverseProxy *extensionsv1alpha1.ReverseProxy) *upstreamPool {
+	p := &upstreamPool{spec: *reverseProxy.Spec.DeepCopy(), cancel: func() {}}
+	var outlierDetection *extensionsv1alpha1.OutlierDetection
+	if p.spec.LoadBalancer != nil {
+		outlierDetection = p.spec.LoadBalancer.OutlierDetection
+	}
+	for _, endpoint := range reverseProxyEndpoints(&p.spec) {
+		u, err := newUpstream(endpoint, outlierDetection)
+		if err != nil {
+			p.err = fmt.Errorf("upstream of %s is not available: %v", reverseProxy.Name, err)
+			klog.Warning(p.err)
+			return p
+		}
+		p.upstreams = append(p.upstreams, u)
+	}
+	return p
+}
+
+func newUpstream(endpoint extensionsv1alpha1.WeightedEndpoint, outlierDetection *extensionsv1alpha1.OutlierDetection) (*upstream, error) {
+	u := &upstream{weight: 1}
+	if endpoint.Weight != nil {
+		u.weight = int64(*endpoint.Weight)
+	}
+	var err error
+	if u.url, err = url.Parse(endpoint.RawURL()); err != nil {
+		return nil, err
+	}
+	if u.transport, err = newUpstreamTransport(&endpoint.Endpoint); err != nil {
+		return nil, err
+	}
+	u.roundTripper = u.transport
+	if outlierDetection != nil {
+		u.roundTripper = &outlierRoundTripper{upstream: u, outlierDetection: outlierDetection}
+	}
+	return u, nil
+}
+
+func newUpstreamTransport(endpoint *extensionsv1alpha1.Endpoint) (http.RoundTripper, error) {
+	tlsConfig := transport.TLSConfig{
+		Insecure: endpoint.InsecureSkipVerify,
+	}
+	if !endpoint.InsecureSkipVerify && len(endpoint.CABundle) > 0 {
+		caData, err := base64.StdEncoding.DecodeString(string(endpoint.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CA bundle: %v", err)
+		}
+		tlsConfig.CAData = caData
+	}
+
+	return transport.New(&transport.Config{
+		TLS: tlsConfig,
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          0,
+				MaxConnsPerHost:       0,
+				MaxIdleConnsPerHost:   100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				TLSClientConfig:       rt.(*http.Transport).TLSClientConfig,
+			}
+		},
+	})
+}
+
+// specChanged reports whether the upstreams of the ReverseProxy have been changed.
+func (p *upstreamPool) specChanged(spec *extensionsv1alpha1.ReverseProxySpec) bool {
+	return !equality.Semantic.DeepEqual(p.spec.Upstream, spec.Upstream) ||
+		!equality.Semantic.DeepEqual(p.spec.Upstreams, spec.Upstreams) ||
+		!equality.Semantic.DeepEqual(p.spec.LoadBalancer, spec.LoadBalancer)
+}
+
+// pick returns an available upstream according to the load balancer policy. If all the healthy upstreams are ejected,
+// the ejection is ignored. nil is returned if there is no healthy upstream.
+func (p *upstreamPool) pick() *upstream {
+	now := time.Now()
+	var healthy, available []*upstream
+	for _, u := range p.upstreams {
+		if u.weight <= 0 || u.health.Unhealthy() {
+			continue
+		}
+		healthy = append(healthy, u)
+		if u.available(now) {
+			available = append(available, u)
+		}
+	}
+	if len(available) == 0 {
+		available = healthy
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	n := p.counter.Add(1)
+	if p.spec.LoadBalancer != nil && p.spec.LoadBalancer.Policy == extensionsv1alpha1.LoadBalancerPolicyLeastRequest {
+		// Start from a rotating offset so that the ties are broken in turn.
+		var picked *upstream
+		for i := range available {
+			u := available[(int(n%uint64(len(available)))+i)%len(available)]
+			// Compare active/weight without division.
+			if picked == nil || u.activeRequests.Load()*picked.weight < picked.activeRequests.Load()*u.weight {
+				picked = u
+			}
+		}
+		return picked
+	}
+
+	var totalWeight int64
+	for _, u := range available {
+		totalWeight += u.weight
+	}
+	offset := int64(n % uint64(totalWeight))
+	for _, u := range available {
+		if offset < u.weight {
+			return u
+		}
+		offset -= u.weight
+	}
+	return available[len(available)-1]
+}
+
+// unhealthyUpstreams returns the upstreams failing the health checks or ejected by the outlier detection.
+func (p *upstreamPool) unhealthyUpstreams(now time.Time) []string {
+	var unhealthy []string
+	for _, u := range p.upstreams {
+		if !u.available(now) {
+			unhealthy = append(unhealthy, u.String())
+		}
+	}
+	return unhealthy
+}
+
+// start runs the health checks of the upstreams, report is called when the unhealthy upstreams change.
+func (p *upstreamPool) start(ctx context.Context, report func(total int, unhealthy []string)) {
+	if p.err != nil || p.spec.LoadBalancer == nil ||
+		(p.spec.LoadBalancer.HealthCheck == nil && p.spec.LoadBalancer.OutlierDetection == nil) {
+		return
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	healthCheck := p.spec.LoadBalancer.HealthCheck
+	interval := healthcheck.Interval(healthCheck)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var reported []string
+		for first := true; ; first = false {
+			if healthCheck != nil {
+				var wg sync.WaitGroup
+				for _, u := range p.upstreams {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						u.check(ctx, healthCheck)
+					}()
+				}
+				wg.Wait()
+			}
+			if unhealthy := p.unhealthyUpstreams(time.Now()); first || !slices.Equal(unhealthy, reported) {
+				report(len(p.upstreams), unhealthy)
+				reported = unhealthy
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *upstreamPool) stop() {
+	p.once.Do(p.cancel)
+}
+
+// check probes the upstream and updates its health once the threshold is reached.
+func (u *upstream) check(ctx context.Context, healthCheck *extensionsv1alpha1.HealthCheck) {
+	err := healthcheck.Probe(ctx, u.transport, u.url, healthCheck)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// The pool is stopped.
+		return
+	}
+	if u.health.Record(healthCheck, err) {
+		if u.health.Unhealthy() {
+			klog.Warningf("upstream %s becomes unhealthy: %v", u, err)
+		} else {
+			klog.V(4).Infof("upstream %s becomes healthy", u)
+		}
+	}
+}
+
+// outlierRoundTripper ejects the upstream after consecutive connection errors or 5xx responses.
+type outlierRoundTripper struct {
+	upstream         *upstream
+	outlierDetection *extensionsv1alpha1.OutlierDetection
+}
+
+func (rt *outlierRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.upstream.transport.RoundTrip(req)
+	if err == nil && resp.StatusCode < http.StatusInternalServerError {
+		rt.upstream.consecutiveErrors.Store(0)
+		return resp, err
+	}
+	if rt.upstream.consecutiveErrors.Add(1) >= healthcheck.Threshold(rt.outlierDetection.ConsecutiveErrors, defaultConsecutiveErrors) {
+		ejectionTime := defaultEjectionTime
+		if rt.outlierDetection.EjectionTime != nil && rt.outlierDetection.EjectionTime.Duration > 0 {
+			ejectionTime = rt.outlierDetection.EjectionTime.Duration
+		}
+		klog.Warningf("upstream %s is ejected for %s", rt.upstream, ejectionTime)
+		rt.upstream.ejectedUntil.Store(time.Now().Add(ejectionTime).UnixNano())
+		rt.upstream.consecutiveErrors.Store(0)
+	}
+	return resp, err
+}
+
+// WrappedRoundTripper allows the TLS config of the upstream to be used for the upgrade requests.
+func (rt *outlierRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.upstream.transport
+}
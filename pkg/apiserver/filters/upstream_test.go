@@ -0,0 +1,162 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/ptr"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+)
+
+func newUpstreamReverseProxy(loadBalancer *extensionsv1alpha1.LoadBalancer, weights ...int32) *extensionsv1alpha1.ReverseProxy {
+	reverseProxy := newReverseProxy("devops", "*", "/proxy/devops/*", time.Now())
+	for i, weight := range weights {
+		reverseProxy.Spec.Upstreams = append(reverseProxy.Spec.Upstreams, extensionsv1alpha1.WeightedEndpoint{
+			Endpoint: extensionsv1alpha1.Endpoint{URL: ptr.To("http://upstream-" + string(rune('a'+i)) + ":8080")},
+			Weight:   ptr.To(weight),
+		})
+	}
+	reverseProxy.Spec.LoadBalancer = loadBalancer
+	return reverseProxy
+}
+
+func markUnhealthy(u *upstream) {
+	u.health.Record(&extensionsv1alpha1.HealthCheck{UnhealthyThreshold: 1}, errors.New("unavailable"))
+}
+
+func pickCounts(pool *upstreamPool, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		if u := pool.pick(); u != nil {
+			counts[u.String()]++
+		}
+	}
+	return counts
+}
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	pool := newUpstreamPool(newUpstreamReverseProxy(nil, 1, 3, 0))
+	assert.NoError(t, pool.err)
+	assert.Equal(t, map[string]int{"upstream-a:8080": 25, "upstream-b:8080": 75}, pickCounts(pool, 100))
+
+	pool.upstreams[1].ejectedUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	assert.Equal(t, map[string]int{"upstream-a:8080": 10}, pickCounts(pool, 10))
+
+	// The ejection is ignored if all the healthy upstreams are ejected.
+	markUnhealthy(pool.upstreams[0])
+	assert.Equal(t, map[string]int{"upstream-b:8080": 10}, pickCounts(pool, 10))
+
+	markUnhealthy(pool.upstreams[1])
+	assert.Nil(t, pool.pick())
+	assert.Equal(t, []string{"upstream-a:8080", "upstream-b:8080"}, pool.unhealthyUpstreams(time.Now()))
+}
+
+func TestUpstreamPoolLeastRequest(t *testing.T) {
+	pool := newUpstreamPool(newUpstreamReverseProxy(&extensionsv1alpha1.LoadBalancer{
+		Policy: extensionsv1alpha1.LoadBalancerPolicyLeastRequest,
+	}, 1, 2))
+	assert.Equal(t, map[string]int{"upstream-a:8080": 5, "upstream-b:8080": 5}, pickCounts(pool, 10))
+
+	pool.upstreams[0].activeRequests.Store(1)
+	pool.upstreams[1].activeRequests.Store(1)
+	assert.Equal(t, map[string]int{"upstream-b:8080": 10}, pickCounts(pool, 10))
+
+	pool.upstreams[1].activeRequests.Store(3)
+	assert.Equal(t, map[string]int{"upstream-a:8080": 10}, pickCounts(pool, 10))
+}
+
+func TestUpstreamPoolSpecChanged(t *testing.T) {
+	reverseProxy := newUpstreamReverseProxy(nil, 1, 1)
+	pool := newUpstreamPool(reverseProxy)
+	updated := reverseProxy.DeepCopy()
+	updated.Status.State = extensionsv1alpha1.StateAvailable
+	updated.Spec.Directives.StripPathPrefix = "/proxy"
+	assert.False(t, pool.specChanged(&updated.Spec))
+	updated.Spec.Upstreams[0].Weight = ptr.To(int32(2))
+	assert.True(t, pool.specChanged(&updated.Spec))
+}
+
+func TestOutlierDetection(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	reverseProxy := newUpstreamReverseProxy(&extensionsv1alpha1.LoadBalancer{
+		OutlierDetection: &extensionsv1alpha1.OutlierDetection{ConsecutiveErrors: 2},
+	})
+	reverseProxy.Spec.Upstream = extensionsv1alpha1.Endpoint{URL: ptr.To(server.URL)}
+	pool := newUpstreamPool(reverseProxy)
+	assert.NoError(t, pool.err)
+	u := pool.upstreams[0]
+
+	roundTrip := func() {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := u.roundTripper.RoundTrip(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	failing.Store(true)
+	roundTrip()
+	assert.True(t, u.available(time.Now()))
+	roundTrip()
+	assert.False(t, u.available(time.Now()))
+	assert.True(t, u.available(time.Now().Add(defaultEjectionTime)))
+}
+
+func TestHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	healthCheck := &extensionsv1alpha1.HealthCheck{Path: "/healthz", UnhealthyThreshold: 2, HealthyThreshold: 2}
+	reverseProxy := newUpstreamReverseProxy(&extensionsv1alpha1.LoadBalancer{HealthCheck: healthCheck})
+	reverseProxy.Spec.Upstream = extensionsv1alpha1.Endpoint{URL: ptr.To(server.URL)}
+	pool := newUpstreamPool(reverseProxy)
+	u := pool.upstreams[0]
+
+	ctx := context.Background()
+	failing.Store(true)
+	u.check(ctx, healthCheck)
+	assert.False(t, u.health.Unhealthy())
+	u.check(ctx, healthCheck)
+	assert.True(t, u.health.Unhealthy())
+
+	failing.Store(false)
+	u.check(ctx, healthCheck)
+	assert.True(t, u.health.Unhealthy())
+	u.check(ctx, healthCheck)
+	assert.False(t, u.health.Unhealthy())
+
+	reports := make(chan []string, 1)
+	pool.start(ctx, func(total int, unhealthy []string) {
+		assert.Equal(t, 1, total)
+		reports <- unhealthy
+	})
+	defer pool.stop()
+	select {
+	case unhealthy := <-reports:
+		assert.Empty(t, unhealthy)
+	case <-time.After(time.Minute):
+		t.Fatal("health is not reported")
+	}
+}
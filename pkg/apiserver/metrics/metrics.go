@@ -47,9 +47,39 @@ var (
 		[]string{"verb", "group", "version", "resource"},
 	)
 
+	ProxyRejectedRequests = componentbasemetrics.NewCounterVec(
+		&componentbasemetrics.CounterOpts{
+			Name:           "ks_server_proxy_rejected_requests_total",
+			Help:           "Counter of proxied requests rejected by the rate limits and circuit breakers, broken out for each kind, name and reason.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"kind", "name", "reason"},
+	)
+
+	ProxyCircuitBreakerState = componentbasemetrics.NewGaugeVec(
+		&componentbasemetrics.GaugeOpts{
+			Name:           "ks_server_proxy_circuit_breaker_state",
+			Help:           "State of the circuit breakers of the proxies, 0 for closed, 1 for open and 2 for half-open.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"kind", "name"},
+	)
+
+	ProxyUpstreams = componentbasemetrics.NewGaugeVec(
+		&componentbasemetrics.GaugeOpts{
+			Name:           "ks_server_proxy_upstreams",
+			Help:           "Number of the upstreams of the reverse proxies observed by this ks-apiserver, broken out for each name and state.",
+			StabilityLevel: componentbasemetrics.ALPHA,
+		},
+		[]string{"name", "state"},
+	)
+
 	metricsList = []componentbasemetrics.Registerable{
 		RequestCounter,
 		RequestLatencies,
+		ProxyRejectedRequests,
+		ProxyCircuitBreakerState,
+		ProxyUpstreams,
 	}
 )
 
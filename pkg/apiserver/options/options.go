@@ -14,6 +14,7 @@ import (
 	"kubesphere.io/kubesphere/pkg/apiserver/auditing"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
 	"kubesphere.io/kubesphere/pkg/apiserver/authorization"
+	"kubesphere.io/kubesphere/pkg/controller/options"
 	"kubesphere.io/kubesphere/pkg/models/terminal"
 	"kubesphere.io/kubesphere/pkg/multicluster"
 	"kubesphere.io/kubesphere/pkg/simple/client/cache"
@@ -30,4 +31,5 @@ type Options struct {
 	TerminalOptions       *terminal.Options           `json:"-"`
 	S3Options             *s3.Options                 `json:"-"`
 	ExperimentalOptions   *config.ExperimentalOptions `json:"-"`
+	ExtensionOptions      *options.ExtensionOptions   `json:"-"`
 }
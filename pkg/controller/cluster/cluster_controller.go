@@ -56,6 +56,8 @@ import (
 // Also put all clusters back into queue every 5 * time.Minute to sync cluster status, this is needed
 // in case there aren't any cluster changes made.
 // Also check if all the clusters are ready by the spec.connection.kubeconfig every resync period
+// Also probe the kube-apiserver and ks-apiserver of all the clusters every health probe period, the latency
+// percentiles and the recent connectivity transitions are recorded in status.health and exported as metrics.
 
 const (
 	controllerName  = "cluster"
@@ -109,7 +111,9 @@ type Reconciler struct {
 	hostConfig          *rest.Config
 	hostClusterName     string
 	resyncPeriod        time.Duration
+	healthProbePeriod   time.Duration
 	installLock         *sync.Map
+	healthStates        *sync.Map
 	clusterClient       clusterclient.Interface
 	clusterUID          types.UID
 	tls                 bool
@@ -126,8 +130,10 @@ func (r *Reconciler) SetupWithManager(mgr *kscontroller.Manager) error {
 	r.clusterClient = mgr.ClusterClient
 	r.hostClusterName = mgr.MultiClusterOptions.HostClusterName
 	r.resyncPeriod = mgr.MultiClusterOptions.ClusterControllerResyncPeriod
+	r.healthProbePeriod = mgr.MultiClusterOptions.ClusterHealthProbePeriod
 	r.clusterUID = kubeSystem.UID
 	r.installLock = &sync.Map{}
+	r.healthStates = &sync.Map{}
 	r.tls = mgr.Options.KubeSphereOptions.TLS
 	r.HelmExecutorOptions = mgr.Options.HelmExecutorOptions
 	r.Client = mgr.GetClient()
@@ -193,6 +199,10 @@ func (r *Reconciler) Start(ctx context.Context) error {
 			klog.Errorf("failed to reconcile cluster ready status, err: %v", err)
 		}
 	}, r.resyncPeriod, ctx.Done())
+	// probe the endpoints of the clusters every health probe period
+	if r.healthProbePeriod > 0 {
+		go wait.UntilWithContext(ctx, r.probeClusters, r.healthProbePeriod)
+	}
 	return nil
 }
 
@@ -520,12 +530,7 @@ func (r *Reconciler) tryFetchKubeSphereVersion(ctx context.Context, cluster *clu
 		return "", fmt.Errorf("failed to get cluster client: %s", err)
 	}
 
-	scheme := "http"
-	port := "80"
-	if r.tls {
-		scheme = "https"
-		port = "443"
-	}
+	scheme, port := r.kubeSphereAPIServerSchemeAndPort()
 	response, err := clusterClient.KubernetesClient.CoreV1().Services(constants.KubeSphereNamespace).
 		ProxyGet(scheme, constants.KubeSphereAPIServerName, port, "/version", nil).
 		DoRaw(ctx)
@@ -552,6 +557,13 @@ func (r *Reconciler) tryFetchKubeSphereVersion(ctx context.Context, cluster *clu
 	return info.GitVersion, nil
 }
 
+func (r *Reconciler) kubeSphereAPIServerSchemeAndPort() (string, string) {
+	if r.tls {
+		return "https", "443"
+	}
+	return "http", "80"
+}
+
 func (r *Reconciler) updateClusterReadyCondition(ctx context.Context, cluster *clusterv1alpha1.Cluster, err error) error {
 	condition := clusterv1alpha1.ClusterCondition{
 		Type:               clusterv1alpha1.ClusterReady,
@@ -0,0 +1,301 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+const (
+	healthProbeTimeout = 10 * time.Second
+	// healthStatusSyncPeriod is the max interval of persisting the probe results into the cluster status when the
+	// connectivity of the endpoints does not change, the metrics are updated after every probe.
+	healthStatusSyncPeriod = 5 * time.Minute
+	// latencySamples is the number of the recent successful probes used to calculate the latency percentiles.
+	latencySamples = 60
+)
+
+var latencyQuantiles = []float64{0.5, 0.9, 0.99}
+
+type probeResult struct {
+	endpoint clusterv1alpha1.ClusterEndpoint
+	latency  time.Duration
+	err      error
+}
+
+// latencyWindow is a ring buffer of the latencies of the recent successful probes.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencySamples
+}
+
+// percentiles returns the nearest-rank percentiles of the samples, or nil if there is no sample.
+func (w *latencyWindow) percentiles(quantiles ...float64) []time.Duration {
+	if len(w.samples) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(w.samples)
+	slices.Sort(sorted)
+	result := make([]time.Duration, len(quantiles))
+	for i, q := range quantiles {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		result[i] = sorted[max(rank, 0)]
+	}
+	return result
+}
+
+// endpointState is the in-memory probe state of an endpoint, the cluster status is only a snapshot of it.
+type endpointState struct {
+	observed            bool
+	healthy             bool
+	message             string
+	consecutiveFailures int32
+	lastProbeTime       metav1.Time
+	latencies           latencyWindow
+}
+
+// newEndpointStates restores the probe states from the cluster status, e.g. after the controller restarted.
+func newEndpointStates(health *clusterv1alpha1.ClusterHealth) map[clusterv1alpha1.ClusterEndpoint]*endpointState {
+	states := make(map[clusterv1alpha1.ClusterEndpoint]*endpointState)
+	if health == nil {
+		return states
+	}
+	for _, endpoint := range health.Endpoints {
+		states[endpoint.Endpoint] = &endpointState{
+			observed:            true,
+			healthy:             endpoint.Healthy,
+			message:             endpoint.Message,
+			consecutiveFailures: endpoint.ConsecutiveFailures,
+			lastProbeTime:       endpoint.LastProbeTime,
+		}
+	}
+	return states
+}
+
+// record records the probe result, returns the transition if the connectivity of the endpoint changed.
+// The first probe is only regarded as a transition if it failed.
+func (s *endpointState) record(result probeResult, now metav1.Time) *clusterv1alpha1.ConnectivityTransition {
+	healthy := result.err == nil
+	if healthy {
+		s.message = ""
+		s.consecutiveFailures = 0
+		s.latencies.add(result.latency)
+	} else {
+		s.message = result.err.Error()
+		s.consecutiveFailures++
+	}
+	changed := s.healthy != healthy
+	if !s.observed {
+		changed = !healthy
+	}
+	s.observed = true
+	s.healthy = healthy
+	s.lastProbeTime = now
+	if !changed {
+		return nil
+	}
+	return &clusterv1alpha1.ConnectivityTransition{
+		Endpoint: result.endpoint,
+		Healthy:  healthy,
+		Time:     now,
+		Message:  s.message,
+	}
+}
+
+func (s *endpointState) status(endpoint clusterv1alpha1.ClusterEndpoint) clusterv1alpha1.EndpointHealth {
+	health := clusterv1alpha1.EndpointHealth{
+		Endpoint:            endpoint,
+		Healthy:             s.healthy,
+		Message:             s.message,
+		ConsecutiveFailures: s.consecutiveFailures,
+		LastProbeTime:       s.lastProbeTime,
+	}
+	if percentiles := s.latencies.percentiles(latencyQuantiles...); percentiles != nil {
+		health.LatencyP50 = &metav1.Duration{Duration: percentiles[0]}
+		health.LatencyP90 = &metav1.Duration{Duration: percentiles[1]}
+		health.LatencyP99 = &metav1.Duration{Duration: percentiles[2]}
+	}
+	return health
+}
+
+// appendTransitions appends the transitions and only keeps the last MaxConnectivityTransitions ones.
+func appendTransitions(transitions []clusterv1alpha1.ConnectivityTransition, added ...clusterv1alpha1.ConnectivityTransition) []clusterv1alpha1.ConnectivityTransition {
+	transitions = append(slices.Clone(transitions), added...)
+	if len(transitions) > clusterv1alpha1.MaxConnectivityTransitions {
+		transitions = transitions[len(transitions)-clusterv1alpha1.MaxConnectivityTransitions:]
+	}
+	return transitions
+}
+
+// healthStatusOutdated returns true if the probe results in the cluster status are older than healthStatusSyncPeriod.
+func healthStatusOutdated(health *clusterv1alpha1.ClusterHealth, now metav1.Time) bool {
+	if health == nil || len(health.Endpoints) == 0 {
+		return true
+	}
+	for _, endpoint := range health.Endpoints {
+		if now.Sub(endpoint.LastProbeTime.Time) >= healthStatusSyncPeriod {
+			return true
+		}
+	}
+	return false
+}
+
+func updateEndpointMetrics(cluster string, health clusterv1alpha1.EndpointHealth) {
+	endpoint := string(health.Endpoint)
+	healthy := 0.0
+	if health.Healthy {
+		healthy = 1
+	}
+	clusterEndpointHealthy.WithLabelValues(cluster, endpoint).Set(healthy)
+	clusterEndpointConsecutiveFailures.WithLabelValues(cluster, endpoint).Set(float64(health.ConsecutiveFailures))
+	for i, latency := range []*metav1.Duration{health.LatencyP50, health.LatencyP90, health.LatencyP99} {
+		if latency != nil {
+			quantile := strconv.FormatFloat(latencyQuantiles[i], 'f', -1, 64)
+			clusterEndpointProbeLatency.WithLabelValues(cluster, endpoint, quantile).Set(latency.Seconds())
+		}
+	}
+}
+
+// probeClusters probes the endpoints of all the clusters in parallel.
+func (r *Reconciler) probeClusters(ctx context.Context) {
+	clusters := &clusterv1alpha1.ClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		klog.Errorf("failed to list clusters: %v", err)
+		return
+	}
+
+	probed := sets.New[string]()
+	wg := sync.WaitGroup{}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if !cluster.DeletionTimestamp.IsZero() || len(cluster.Spec.Connection.KubeConfig) == 0 {
+			continue
+		}
+		probed.Insert(cluster.Name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results := r.probeEndpoints(ctx, cluster.Name)
+			if err := r.recordProbeResults(ctx, cluster, results, metav1.Now()); err != nil {
+				klog.Errorf("failed to record the health of cluster %s: %v", cluster.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.healthStates.Range(func(key, _ any) bool {
+		if name := key.(string); !probed.Has(name) {
+			r.healthStates.Delete(name)
+			deleteClusterHealthMetrics(name)
+		}
+		return true
+	})
+}
+
+// probeEndpoints probes the kube-apiserver and ks-apiserver of the cluster. The ks-apiserver is probed through
+// the service proxy of the kube-apiserver, the same way as fetching the KubeSphere version.
+func (r *Reconciler) probeEndpoints(ctx context.Context, name string) []probeResult {
+	clusterClient, err := r.clusterClient.GetClusterClient(name)
+	if err != nil {
+		err = fmt.Errorf("failed to get cluster client: %s", err)
+		return []probeResult{
+			{endpoint: clusterv1alpha1.ClusterEndpointKubernetesAPIServer, err: err},
+			{endpoint: clusterv1alpha1.ClusterEndpointKubeSphereAPIServer, err: err},
+		}
+	}
+	return []probeResult{
+		probeEndpoint(ctx, clusterv1alpha1.ClusterEndpointKubernetesAPIServer, func(ctx context.Context) error {
+			_, err := clusterClient.KubernetesClient.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+			return err
+		}),
+		probeEndpoint(ctx, clusterv1alpha1.ClusterEndpointKubeSphereAPIServer, func(ctx context.Context) error {
+			scheme, port := r.kubeSphereAPIServerSchemeAndPort()
+			_, err := clusterClient.KubernetesClient.CoreV1().Services(constants.KubeSphereNamespace).
+				ProxyGet(scheme, constants.KubeSphereAPIServerName, port, "/healthz", nil).
+				DoRaw(ctx)
+			return err
+		}),
+	}
+}
+
+func probeEndpoint(ctx context.Context, endpoint clusterv1alpha1.ClusterEndpoint, probe func(ctx context.Context) error) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	err := probe(ctx)
+	return probeResult{endpoint: endpoint, latency: time.Since(start), err: err}
+}
+
+// recordProbeResults updates the probe states and the metrics of the cluster. The results are persisted into the
+// cluster status if the connectivity of any endpoint changed, or the status is outdated.
+func (r *Reconciler) recordProbeResults(ctx context.Context, cluster *clusterv1alpha1.Cluster, results []probeResult, now metav1.Time) error {
+	value, ok := r.healthStates.Load(cluster.Name)
+	if !ok {
+		value, _ = r.healthStates.LoadOrStore(cluster.Name, newEndpointStates(cluster.Status.Health))
+	}
+	states := value.(map[clusterv1alpha1.ClusterEndpoint]*endpointState)
+
+	endpoints := make([]clusterv1alpha1.EndpointHealth, 0, len(results))
+	var transitions []clusterv1alpha1.ConnectivityTransition
+	for _, result := range results {
+		state, ok := states[result.endpoint]
+		if !ok {
+			state = &endpointState{}
+			states[result.endpoint] = state
+		}
+		if transition := state.record(result, now); transition != nil {
+			klog.V(4).Infof("%s of cluster %s became healthy: %t", result.endpoint, cluster.Name, transition.Healthy)
+			clusterEndpointTransitions.WithLabelValues(cluster.Name, string(result.endpoint)).Inc()
+			transitions = append(transitions, *transition)
+		}
+		health := state.status(result.endpoint)
+		updateEndpointMetrics(cluster.Name, health)
+		endpoints = append(endpoints, health)
+	}
+
+	if len(transitions) == 0 && !healthStatusOutdated(cluster.Status.Health, now) {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &clusterv1alpha1.Cluster{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), latest); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		health := &clusterv1alpha1.ClusterHealth{Endpoints: endpoints}
+		if latest.Status.Health != nil {
+			health.Transitions = latest.Status.Health.Transitions
+		}
+		health.Transitions = appendTransitions(health.Transitions, transitions...)
+		latest.Status.Health = health
+		return r.Update(ctx, latest)
+	})
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/scheme"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	window := &latencyWindow{}
+	assert.Nil(t, window.percentiles(latencyQuantiles...))
+
+	for i := 1; i <= 100; i++ {
+		window.add(time.Duration(i) * time.Millisecond)
+	}
+	// Only the last latencySamples samples are kept.
+	assert.Len(t, window.samples, latencySamples)
+	assert.Equal(t, []time.Duration{70 * time.Millisecond, 94 * time.Millisecond, 100 * time.Millisecond},
+		window.percentiles(latencyQuantiles...))
+}
+
+func TestEndpointStateRecord(t *testing.T) {
+	now := metav1.Now()
+	ok := probeResult{endpoint: clusterv1alpha1.ClusterEndpointKubernetesAPIServer, latency: time.Millisecond}
+	failed := probeResult{endpoint: clusterv1alpha1.ClusterEndpointKubernetesAPIServer, err: errors.New("timeout")}
+
+	state := &endpointState{}
+	assert.Nil(t, state.record(ok, now))
+	assert.Nil(t, state.record(ok, now))
+	transition := state.record(failed, now)
+	assert.Equal(t, &clusterv1alpha1.ConnectivityTransition{
+		Endpoint: clusterv1alpha1.ClusterEndpointKubernetesAPIServer,
+		Healthy:  false,
+		Time:     now,
+		Message:  "timeout",
+	}, transition)
+	assert.Nil(t, state.record(failed, now))
+	assert.Equal(t, int32(2), state.consecutiveFailures)
+	assert.True(t, state.record(ok, now).Healthy)
+	assert.Equal(t, int32(0), state.consecutiveFailures)
+
+	status := state.status(clusterv1alpha1.ClusterEndpointKubernetesAPIServer)
+	assert.True(t, status.Healthy)
+	assert.Equal(t, time.Millisecond, status.LatencyP99.Duration)
+
+	// The first probe is a transition if it failed.
+	state = &endpointState{}
+	assert.NotNil(t, state.record(failed, now))
+}
+
+func TestRecordProbeResults(t *testing.T) {
+	cluster := &clusterv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "member"}}
+	r := &Reconciler{
+		Client:       runtimefakeclient.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cluster).Build(),
+		healthStates: &sync.Map{},
+	}
+	ctx := context.Background()
+	results := func(err error) []probeResult {
+		return []probeResult{
+			{endpoint: clusterv1alpha1.ClusterEndpointKubernetesAPIServer, latency: time.Millisecond},
+			{endpoint: clusterv1alpha1.ClusterEndpointKubeSphereAPIServer, latency: time.Millisecond, err: err},
+		}
+	}
+	record := func(err error, now time.Time) *clusterv1alpha1.ClusterHealth {
+		latest := &clusterv1alpha1.Cluster{}
+		assert.NoError(t, r.Get(ctx, client.ObjectKeyFromObject(cluster), latest))
+		assert.NoError(t, r.recordProbeResults(ctx, latest, results(err), metav1.NewTime(now)))
+		assert.NoError(t, r.Get(ctx, client.ObjectKeyFromObject(cluster), latest))
+		return latest.Status.Health
+	}
+
+	start := time.Now().Truncate(time.Second)
+	health := record(nil, start)
+	assert.Len(t, health.Endpoints, 2)
+	assert.Empty(t, health.Transitions)
+
+	// The status is not updated if nothing changed.
+	health = record(nil, start.Add(time.Minute))
+	assert.Equal(t, start, health.Endpoints[0].LastProbeTime.Time)
+
+	for i := 0; i < clusterv1alpha1.MaxConnectivityTransitions; i++ {
+		health = record(errors.New("service unavailable"), start.Add(time.Duration(2*i+2)*time.Minute))
+		assert.False(t, health.Endpoints[1].Healthy)
+		health = record(nil, start.Add(time.Duration(2*i+3)*time.Minute))
+	}
+	assert.Len(t, health.Transitions, clusterv1alpha1.MaxConnectivityTransitions)
+	last := health.Transitions[len(health.Transitions)-1]
+	assert.Equal(t, clusterv1alpha1.ClusterEndpointKubeSphereAPIServer, last.Endpoint)
+	assert.True(t, last.Healthy)
+	assert.True(t, health.Endpoints[0].Healthy)
+	assert.NotNil(t, health.Endpoints[0].LatencyP50)
+
+	// The outdated status is refreshed.
+	now := start.Add(time.Duration(2*clusterv1alpha1.MaxConnectivityTransitions+1)*time.Minute + healthStatusSyncPeriod)
+	health = record(nil, now)
+	assert.Equal(t, now, health.Endpoints[0].LastProbeTime.Time)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package cluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	clusterEndpointHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ks_controller_manager_cluster_endpoint_healthy",
+			Help: "Whether the last probe of the cluster endpoint succeeded (1) or not (0), broken out for each cluster, endpoint",
+		},
+		[]string{"cluster", "endpoint"},
+	)
+	clusterEndpointConsecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ks_controller_manager_cluster_endpoint_consecutive_failures",
+			Help: "Number of the failed probes of the cluster endpoint since the last successful one, broken out for each cluster, endpoint",
+		},
+		[]string{"cluster", "endpoint"},
+	)
+	clusterEndpointProbeLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ks_controller_manager_cluster_endpoint_probe_latency_seconds",
+			Help: "Latency percentiles of the recent successful probes of the cluster endpoint, broken out for each cluster, endpoint, quantile",
+		},
+		[]string{"cluster", "endpoint", "quantile"},
+	)
+	clusterEndpointTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ks_controller_manager_cluster_endpoint_transitions_total",
+			Help: "Counter of the connectivity transitions of the cluster endpoint, broken out for each cluster, endpoint",
+		},
+		[]string{"cluster", "endpoint"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		clusterEndpointHealthy,
+		clusterEndpointConsecutiveFailures,
+		clusterEndpointProbeLatency,
+		clusterEndpointTransitions,
+	)
+}
+
+func deleteClusterHealthMetrics(cluster string) {
+	labels := prometheus.Labels{"cluster": cluster}
+	clusterEndpointHealthy.DeletePartialMatch(labels)
+	clusterEndpointConsecutiveFailures.DeletePartialMatch(labels)
+	clusterEndpointProbeLatency.DeletePartialMatch(labels)
+	clusterEndpointTransitions.DeletePartialMatch(labels)
+}
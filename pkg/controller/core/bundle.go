@@ -0,0 +1,401 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+const (
+	bundleManifestFile = "bundle.yaml"
+	bundleImagesFile   = "images.txt"
+	bundleChartsDir    = "charts"
+	bundleChartDataKey = "chart.tgz"
+	// bundleChartConfigMapFormat is the name of the ConfigMap that contains the chart data of the imported extension version.
+	bundleChartConfigMapFormat = "extension-%s-chart"
+	maxBundleFileSize          = 16 << 20
+	// maxBundleSize limits the total size of the decompressed files in the bundle.
+	maxBundleSize    = 256 << 20
+	maxBundleEntries = 1024
+	// maxChartDataSize is limited by the size of the ConfigMap.
+	maxChartDataSize = 1 << 20
+)
+
+// BundleEntry describes an extension version in the bundle.
+type BundleEntry struct {
+	ExtensionVersion corev1alpha1.ExtensionVersion `json:"extensionVersion"`
+	// Chart is the path of the chart archive in the bundle.
+	Chart string `json:"chart"`
+	// Images used by the chart, derived from the chart values.
+	Images []string `json:"images,omitempty"`
+}
+
+// BundleManifest is stored in the bundle as bundle.yaml.
+type BundleManifest struct {
+	Created metav1.Time   `json:"created"`
+	Entries []BundleEntry `json:"entries"`
+}
+
+// ExportBundle writes the extension versions to a gzipped tarball, which contains the charts, the metadata of
+// the extension versions and the list of the images, so that the extensions can be installed without repositories.
+func ExportBundle(ctx context.Context, client client.Reader, names []string, w io.Writer) error {
+	manifest := BundleManifest{Created: metav1.Now()}
+	charts := make(map[string][]byte, len(names))
+	var images []string
+	for _, name := range names {
+		extensionVersion := &corev1alpha1.ExtensionVersion{}
+		if err := client.Get(ctx, types.NamespacedName{Name: name}, extensionVersion); err != nil {
+			return err
+		}
+		data, err := fetchChartData(ctx, client, extensionVersion)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch chart data of %s", name)
+		}
+		mainChart, err := loader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrapf(err, "failed to load chart of %s", name)
+		}
+
+		entry := BundleEntry{
+			ExtensionVersion: bundleExtensionVersion(extensionVersion, sha256Hex(data)),
+			Chart:            path.Join(bundleChartsDir, fmt.Sprintf("%s.tgz", name)),
+			Images:           chartImages(mainChart),
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		charts[entry.Chart] = data
+		images = append(images, entry.Images...)
+	}
+	slices.Sort(images)
+
+	manifestData, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	writeFile := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.Created.Time}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err = writeFile(bundleManifestFile, manifestData); err != nil {
+		return err
+	}
+	var imageList string
+	if images = slices.Compact(images); len(images) > 0 {
+		imageList = strings.Join(images, "\n") + "\n"
+	}
+	if err = writeFile(bundleImagesFile, []byte(imageList)); err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		if err = writeFile(entry.Chart, charts[entry.Chart]); err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// bundleExtensionVersion removes the references to the repository from the extension version.
+func bundleExtensionVersion(extensionVersion *corev1alpha1.ExtensionVersion, digest string) corev1alpha1.ExtensionVersion {
+	exported := corev1alpha1.ExtensionVersion{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1alpha1.SchemeGroupVersion.String(),
+			Kind:       "ExtensionVersion",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        extensionVersion.Name,
+			Labels:      make(map[string]string),
+			Annotations: extensionVersion.Annotations,
+		},
+		Spec: *extensionVersion.Spec.DeepCopy(),
+	}
+	for k, v := range extensionVersion.Labels {
+		if k != corev1alpha1.RepositoryReferenceLabel {
+			exported.Labels[k] = v
+		}
+	}
+	exported.Spec.Repository = ""
+	exported.Spec.ChartURL = ""
+	exported.Spec.ChartDataRef = nil
+	exported.Spec.Digest = digest
+	return exported
+}
+
+// chartImages returns the images in the values of the chart and its dependencies, the image is either a string
+// value of the image key, or a map with the repository key and the optional registry, tag and digest keys.
+func chartImages(mainChart *chart.Chart) []string {
+	images := make([]string, 0)
+	var globalRegistry string
+	if global, ok := mainChart.Values["global"].(map[string]interface{}); ok {
+		globalRegistry, _ = global["imageRegistry"].(string)
+	}
+	var walk func(values map[string]interface{}, appVersion string)
+	walk = func(values map[string]interface{}, appVersion string) {
+		for key, value := range values {
+			switch v := value.(type) {
+			case string:
+				if key == "image" && v != "" {
+					images = append(images, v)
+				}
+			case map[string]interface{}:
+				if image := imageReference(v, globalRegistry, appVersion); image != "" {
+					images = append(images, image)
+					continue
+				}
+				walk(v, appVersion)
+			}
+		}
+	}
+	var walkChart func(c *chart.Chart)
+	walkChart = func(c *chart.Chart) {
+		walk(c.Values, c.AppVersion())
+		for _, dependency := range c.Dependencies() {
+			walkChart(dependency)
+		}
+	}
+	walkChart(mainChart)
+
+	slices.Sort(images)
+	return slices.Compact(images)
+}
+
+func imageReference(values map[string]interface{}, globalRegistry, appVersion string) string {
+	repository, _ := values["repository"].(string)
+	if repository == "" {
+		return ""
+	}
+	registry, _ := values["registry"].(string)
+	if registry == "" {
+		registry = globalRegistry
+	}
+	image := repository
+	if registry != "" {
+		image = fmt.Sprintf("%s/%s", registry, repository)
+	}
+	if digest, _ := values["digest"].(string); digest != "" {
+		return fmt.Sprintf("%s@%s", image, digest)
+	}
+	tag := fmt.Sprint(values["tag"])
+	if values["tag"] == nil || tag == "" {
+		tag = appVersion
+	}
+	if tag == "" {
+		return image
+	}
+	return fmt.Sprintf("%s:%s", image, tag)
+}
+
+// ImportBundle loads the extension versions from the bundle created by ExportBundle, the chart data is stored in
+// ConfigMaps referenced by the ChartDataRef of the extension versions. Returns the imported extension versions.
+func ImportBundle(ctx context.Context, client client.Client, r io.Reader) ([]corev1alpha1.ExtensionVersion, error) {
+	manifest, files, err := readBundle(r)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make([]corev1alpha1.ExtensionVersion, 0, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		data, ok := files[entry.Chart]
+		if !ok {
+			return nil, fmt.Errorf("chart %s not found in the bundle", entry.Chart)
+		}
+		if len(data) > maxChartDataSize {
+			return nil, fmt.Errorf("chart %s exceeds the size limit of the ConfigMap", entry.Chart)
+		}
+		if err = verifyDigest(data, entry.ExtensionVersion.Spec.Digest); err != nil {
+			return nil, errors.Wrapf(err, "failed to verify chart %s", entry.Chart)
+		}
+		extensionVersion, err := importExtensionVersion(ctx, client, entry.ExtensionVersion, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to import extension version %s", entry.ExtensionVersion.Name)
+		}
+		imported = append(imported, *extensionVersion)
+	}
+	return imported, nil
+}
+
+// readBundle returns the manifest and the charts referenced by it, the other files in the bundle are dropped.
+// The files before the manifest are kept until the manifest is read, ExportBundle writes the manifest first.
+func readBundle(r io.Reader) (*BundleManifest, map[string][]byte, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid bundle")
+	}
+	defer gr.Close()
+
+	var manifest *BundleManifest
+	charts := sets.New[string]()
+	files := make(map[string][]byte)
+	var entries int
+	var size int64
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid bundle")
+		}
+		if entries++; entries > maxBundleEntries {
+			return nil, nil, fmt.Errorf("the bundle contains more than %d entries", maxBundleEntries)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxBundleFileSize {
+			return nil, nil, fmt.Errorf("file %s in the bundle exceeds the size limit", header.Name)
+		}
+		// the skipped files are decompressed as well
+		if size += header.Size; size > maxBundleSize {
+			return nil, nil, fmt.Errorf("the bundle exceeds the size limit")
+		}
+		name := path.Clean(header.Name)
+		if name != bundleManifestFile && manifest != nil && !charts.Has(name) {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleFileSize))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read %s", header.Name)
+		}
+		if name != bundleManifestFile {
+			files[name] = data
+			continue
+		}
+		manifest = &BundleManifest{}
+		if err = yaml.Unmarshal(data, manifest); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse %s", bundleManifestFile)
+		}
+		charts.Clear()
+		for i := range manifest.Entries {
+			manifest.Entries[i].Chart = path.Clean(manifest.Entries[i].Chart)
+			charts.Insert(manifest.Entries[i].Chart)
+		}
+	}
+
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%s not found in the bundle", bundleManifestFile)
+	}
+	for name := range files {
+		if !charts.Has(name) {
+			delete(files, name)
+		}
+	}
+	return manifest, files, nil
+}
+
+// importExtensionVersion creates the extension version and the ConfigMap that contains the chart data, the extension
+// is created if it does not exist, the extensions synchronized from repositories are not changed.
+func importExtensionVersion(ctx context.Context, c client.Client, bundled corev1alpha1.ExtensionVersion, data []byte) (*corev1alpha1.ExtensionVersion, error) {
+	mainChart, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load chart archive")
+	}
+	extensionName := mainChart.Name()
+	if bundled.Name != fmt.Sprintf("%s-%s", extensionName, mainChart.Metadata.Version) {
+		return nil, fmt.Errorf("extension version %s does not match the chart %s-%s", bundled.Name, extensionName, mainChart.Metadata.Version)
+	}
+
+	extension := &corev1alpha1.Extension{ObjectMeta: metav1.ObjectMeta{Name: extensionName}}
+	if _, err = controllerutil.CreateOrUpdate(ctx, c, extension, func() error {
+		if extension.Labels[corev1alpha1.RepositoryReferenceLabel] != "" {
+			return nil
+		}
+		if extension.Labels == nil {
+			extension.Labels = make(map[string]string)
+		}
+		if bundled.Spec.Category != "" {
+			extension.Labels[corev1alpha1.CategoryLabel] = bundled.Spec.Category
+		}
+		extension.Spec.ExtensionInfo = bundled.Spec.ExtensionInfo
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to update extension")
+	}
+
+	configMapName := fmt.Sprintf(bundleChartConfigMapFormat, bundled.Name)
+	extensionVersion := &corev1alpha1.ExtensionVersion{ObjectMeta: metav1.ObjectMeta{Name: bundled.Name}}
+	if _, err = controllerutil.CreateOrUpdate(ctx, c, extensionVersion, func() error {
+		if extensionVersion.Labels[corev1alpha1.RepositoryReferenceLabel] != "" {
+			return fmt.Errorf("extension version %s is synchronized from the repository %s",
+				extensionVersion.Name, extensionVersion.Labels[corev1alpha1.RepositoryReferenceLabel])
+		}
+		if extensionVersion.Labels == nil {
+			extensionVersion.Labels = make(map[string]string)
+		}
+		for k, v := range bundled.Labels {
+			extensionVersion.Labels[k] = v
+		}
+		extensionVersion.Labels[corev1alpha1.ExtensionReferenceLabel] = extensionName
+		if bundled.Spec.Category != "" {
+			extensionVersion.Labels[corev1alpha1.CategoryLabel] = bundled.Spec.Category
+		}
+		if len(bundled.Annotations) > 0 && extensionVersion.Annotations == nil {
+			extensionVersion.Annotations = make(map[string]string)
+		}
+		for k, v := range bundled.Annotations {
+			extensionVersion.Annotations[k] = v
+		}
+		extensionVersion.Spec = bundled.Spec
+		if extensionVersion.Spec.Created.IsZero() {
+			extensionVersion.Spec.Created = metav1.NewTime(time.Now())
+		}
+		extensionVersion.Spec.ChartDataRef = &corev1alpha1.ConfigMapKeyRef{
+			Namespace: constants.KubeSphereNamespace,
+			ConfigMapKeySelector: corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMapName},
+				Key:                  bundleChartDataKey,
+			},
+		}
+		return controllerutil.SetOwnerReference(extension, extensionVersion, c.Scheme())
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to update extension version")
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: constants.KubeSphereNamespace, Name: configMapName}}
+	if _, err = controllerutil.CreateOrUpdate(ctx, c, configMap, func() error {
+		if configMap.Labels == nil {
+			configMap.Labels = make(map[string]string)
+		}
+		configMap.Labels[constants.KubeSphereManagedLabel] = "true"
+		configMap.Labels[corev1alpha1.ExtensionReferenceLabel] = extensionName
+		configMap.BinaryData = map[string][]byte{bundleChartDataKey: data}
+		return controllerutil.SetOwnerReference(extensionVersion, configMap, c.Scheme())
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to update chart data")
+	}
+	return extensionVersion, nil
+}
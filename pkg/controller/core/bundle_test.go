@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+func TestChartImages(t *testing.T) {
+	subchart := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "agent", AppVersion: "v1.0.0"},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"repository": "kubesphere/agent"},
+		},
+	}
+	mainChart := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "devops", AppVersion: "v1.1.0"},
+		Values: map[string]interface{}{
+			"global": map[string]interface{}{"imageRegistry": "docker.io"},
+			"apiserver": map[string]interface{}{
+				"image": map[string]interface{}{"registry": "quay.io", "repository": "kubesphere/apiserver", "tag": "v1.2.0"},
+			},
+			"controller": map[string]interface{}{
+				"image": map[string]interface{}{"repository": "kubesphere/controller", "digest": "sha256:0000"},
+			},
+			"jenkins": map[string]interface{}{"image": "jenkins/jenkins:2.0"},
+		},
+	}
+	mainChart.AddDependency(subchart)
+
+	assert.Equal(t, []string{
+		"docker.io/kubesphere/agent:v1.0.0",
+		"docker.io/kubesphere/controller@sha256:0000",
+		"jenkins/jenkins:2.0",
+		"quay.io/kubesphere/apiserver:v1.2.0",
+	}, chartImages(mainChart))
+}
+
+func TestExportAndImportBundle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, corev1alpha1.AddToScheme(scheme))
+	assert.NoError(t, corev1.AddToScheme(scheme))
+
+	data := newChartData(t)
+	exported := &corev1alpha1.ExtensionVersion{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "devops-1.0.0",
+			Labels: map[string]string{
+				corev1alpha1.ExtensionReferenceLabel:  "devops",
+				corev1alpha1.RepositoryReferenceLabel: "builtin",
+			},
+		},
+		Spec: corev1alpha1.ExtensionVersionSpec{
+			Version:    "1.0.0",
+			Repository: "builtin",
+			ChartDataRef: &corev1alpha1.ConfigMapKeyRef{
+				Namespace: constants.KubeSphereNamespace,
+				ConfigMapKeySelector: corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "devops"},
+					Key:                  "chart.tgz",
+				},
+			},
+		},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: constants.KubeSphereNamespace, Name: "devops"},
+		BinaryData: map[string][]byte{"chart.tgz": data},
+	}
+
+	ctx := context.Background()
+	bundle := &bytes.Buffer{}
+	source := fake.NewClientBuilder().WithScheme(scheme).WithObjects(exported, configMap).Build()
+	assert.NoError(t, ExportBundle(ctx, source, []string{"devops-1.0.0"}, bundle))
+	assert.Error(t, ExportBundle(ctx, source, []string{"devops-2.0.0"}, &bytes.Buffer{}))
+
+	manifest, files, err := readBundle(bytes.NewReader(bundle.Bytes()))
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Entries, 1)
+	assert.Equal(t, data, files["charts/devops-1.0.0.tgz"])
+	// the files not referenced by the manifest are dropped
+	assert.NotContains(t, files, bundleImagesFile)
+
+	target := fake.NewClientBuilder().WithScheme(scheme).Build()
+	imported, err := ImportBundle(ctx, target, bytes.NewReader(bundle.Bytes()))
+	assert.NoError(t, err)
+	assert.Len(t, imported, 1)
+
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	assert.NoError(t, target.Get(ctx, types.NamespacedName{Name: "devops-1.0.0"}, extensionVersion))
+	assert.Empty(t, extensionVersion.Spec.Repository)
+	assert.Empty(t, extensionVersion.Labels[corev1alpha1.RepositoryReferenceLabel])
+	assert.Equal(t, sha256Hex(data), extensionVersion.Spec.Digest)
+
+	chartData, err := fetchChartData(ctx, target, extensionVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, data, chartData)
+
+	extension := &corev1alpha1.Extension{}
+	assert.NoError(t, target.Get(ctx, types.NamespacedName{Name: "devops"}, extension))
+
+	_, err = ImportBundle(ctx, target, bytes.NewReader([]byte("invalid")))
+	assert.Error(t, err)
+}
+
+func TestReadBundleLimits(t *testing.T) {
+	newBundle := func(headers ...*tar.Header) []byte {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		for _, header := range headers {
+			assert.NoError(t, tw.WriteHeader(header))
+			_, err := tw.Write(make([]byte, header.Size))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tw.Close())
+		assert.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	headers := make([]*tar.Header, 0, maxBundleEntries+1)
+	for i := 0; i <= maxBundleEntries; i++ {
+		headers = append(headers, &tar.Header{Name: fmt.Sprintf("file-%d", i), Mode: 0644, Typeflag: tar.TypeReg})
+	}
+	_, _, err := readBundle(bytes.NewReader(newBundle(headers...)))
+	assert.ErrorContains(t, err, "entries")
+
+	headers = headers[:0]
+	for i := 0; i*maxBundleFileSize <= maxBundleSize; i++ {
+		headers = append(headers, &tar.Header{Name: fmt.Sprintf("file-%d", i), Mode: 0644, Size: maxBundleFileSize, Typeflag: tar.TypeReg})
+	}
+	_, _, err = readBundle(bytes.NewReader(newBundle(headers...)))
+	assert.ErrorContains(t, err, "the bundle exceeds the size limit")
+}
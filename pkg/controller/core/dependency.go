@@ -0,0 +1,246 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	dependenciesSatisfied     = "DependenciesSatisfied"
+	dependencyNotFound        = "DependencyNotFound"
+	circularDependency        = "CircularDependency"
+	dependencyVersionMismatch = "DependencyVersionMismatch"
+	dependencyNotReady        = "DependencyNotReady"
+	installingDependencies    = "InstallingDependencies"
+)
+
+// dependencyError indicates that the dependencies can not be satisfied without user intervention.
+type dependencyError struct {
+	reason  string
+	message string
+}
+
+func (e *dependencyError) Error() string {
+	return e.message
+}
+
+func asDependencyError(err error) (*dependencyError, bool) {
+	var dependencyErr *dependencyError
+	ok := errors.As(err, &dependencyErr)
+	return dependencyErr, ok
+}
+
+// requiredDependencies returns the required dependencies on other extensions.
+func requiredDependencies(extensionVersion *corev1alpha1.ExtensionVersion) []corev1alpha1.ExternalDependency {
+	var dependencies []corev1alpha1.ExternalDependency
+	for _, dependency := range extensionVersion.Spec.ExternalDependencies {
+		if dependency.Required && isExtensionDependency(dependency) {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	return dependencies
+}
+
+func isExtensionDependency(dependency corev1alpha1.ExternalDependency) bool {
+	return dependency.Type == "" || dependency.Type == corev1alpha1.DependencyTypeExtension
+}
+
+// dependencySatisfied checks the version against the version constraint of the dependency.
+func dependencySatisfied(dependency corev1alpha1.ExternalDependency, version string) (bool, error) {
+	if dependency.Version == "" {
+		return true, nil
+	}
+	constraint, err := semver.NewConstraint(dependency.Version)
+	if err != nil {
+		return false, &dependencyError{
+			reason:  dependencyVersionMismatch,
+			message: fmt.Sprintf("Invalid version constraint %q of the dependency %s: %s", dependency.Version, dependency.Name, err),
+		}
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, nil
+	}
+	return constraint.Check(v), nil
+}
+
+func describeDependencies(dependencies []corev1alpha1.ExternalDependency) string {
+	descriptions := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		if dependency.Version == "" {
+			descriptions = append(descriptions, dependency.Name)
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", dependency.Name, dependency.Version))
+		}
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// installPlansByExtension returns the InstallPlans that are not being deleted, indexed by the extension name.
+func installPlansByExtension(ctx context.Context, reader client.Reader) (map[string]*corev1alpha1.InstallPlan, error) {
+	installPlans := &corev1alpha1.InstallPlanList{}
+	if err := reader.List(ctx, installPlans); err != nil {
+		return nil, err
+	}
+	result := make(map[string]*corev1alpha1.InstallPlan, len(installPlans.Items))
+	for i := range installPlans.Items {
+		plan := &installPlans.Items[i]
+		if plan.DeletionTimestamp.IsZero() {
+			result[plan.Spec.Extension.Name] = plan
+		}
+	}
+	return result, nil
+}
+
+// checkDependencies returns the dependencies that are not planned to be installed,
+// a dependencyError is returned if the planned version of a dependency does not satisfy the constraint.
+func checkDependencies(dependencies []corev1alpha1.ExternalDependency, plans map[string]*corev1alpha1.InstallPlan) ([]corev1alpha1.ExternalDependency, error) {
+	var missing []corev1alpha1.ExternalDependency
+	for _, dependency := range dependencies {
+		plan, ok := plans[dependency.Name]
+		if !ok {
+			missing = append(missing, dependency)
+			continue
+		}
+		satisfied, err := dependencySatisfied(dependency, plan.Spec.Extension.Version)
+		if err != nil {
+			return nil, err
+		}
+		if !satisfied {
+			return nil, &dependencyError{
+				reason: dependencyVersionMismatch,
+				message: fmt.Sprintf("The extension %s %s is required, but the version %s is planned to be installed.",
+					dependency.Name, dependency.Version, plan.Spec.Extension.Version),
+			}
+		}
+	}
+	return missing, nil
+}
+
+// dependencyResolver resolves the missing dependencies of an extension recursively,
+// only the versions compatible with the Kubernetes and KubeSphere versions are selected.
+type dependencyResolver struct {
+	reader     client.Reader
+	plans      map[string]*corev1alpha1.InstallPlan
+	k8sVersion *semver.Version
+	ksVersion  *semver.Version
+	selected   map[string]*corev1alpha1.ExtensionVersion
+	visiting   map[string]bool
+	ordered    []corev1alpha1.ExtensionRef
+}
+
+func newDependencyResolver(reader client.Reader, plans map[string]*corev1alpha1.InstallPlan, k8sVersion, ksVersion *semver.Version) *dependencyResolver {
+	return &dependencyResolver{
+		reader:     reader,
+		plans:      plans,
+		k8sVersion: k8sVersion,
+		ksVersion:  ksVersion,
+		selected:   make(map[string]*corev1alpha1.ExtensionVersion),
+		visiting:   make(map[string]bool),
+	}
+}
+
+// resolve returns the extensions to be installed in topological order, dependencies first.
+func (d *dependencyResolver) resolve(ctx context.Context, extensionName string, extensionVersion *corev1alpha1.ExtensionVersion) ([]corev1alpha1.ExtensionRef, error) {
+	if err := d.visit(ctx, extensionName, extensionVersion); err != nil {
+		return nil, err
+	}
+	return d.ordered, nil
+}
+
+func (d *dependencyResolver) visit(ctx context.Context, extensionName string, extensionVersion *corev1alpha1.ExtensionVersion) error {
+	d.visiting[extensionName] = true
+	defer delete(d.visiting, extensionName)
+
+	dependencies := requiredDependencies(extensionVersion)
+	missing, err := checkDependencies(dependencies, d.plans)
+	if err != nil {
+		return err
+	}
+	for _, dependency := range missing {
+		if d.visiting[dependency.Name] {
+			return &dependencyError{
+				reason:  circularDependency,
+				message: fmt.Sprintf("Circular dependency detected between the extensions %s and %s.", extensionName, dependency.Name),
+			}
+		}
+		if selected, ok := d.selected[dependency.Name]; ok {
+			satisfied, err := dependencySatisfied(dependency, selected.Spec.Version)
+			if err != nil {
+				return err
+			}
+			if !satisfied {
+				return &dependencyError{
+					reason: dependencyVersionMismatch,
+					message: fmt.Sprintf("Conflicting version constraints of the extension %s, %s is required by %s but %s is selected.",
+						dependency.Name, dependency.Version, extensionName, selected.Spec.Version),
+				}
+			}
+			continue
+		}
+		selected, err := d.selectExtensionVersion(ctx, dependency)
+		if err != nil {
+			return err
+		}
+		d.selected[dependency.Name] = selected
+		if err = d.visit(ctx, dependency.Name, selected); err != nil {
+			return err
+		}
+		d.ordered = append(d.ordered, corev1alpha1.ExtensionRef{Name: dependency.Name, Version: selected.Spec.Version})
+	}
+	return nil
+}
+
+// selectExtensionVersion selects the latest compatible version of the extension that satisfies the constraint,
+// prereleases are only selected if the constraint asks for them.
+func (d *dependencyResolver) selectExtensionVersion(ctx context.Context, dependency corev1alpha1.ExternalDependency) (*corev1alpha1.ExtensionVersion, error) {
+	extensionVersions := &corev1alpha1.ExtensionVersionList{}
+	if err := d.reader.List(ctx, extensionVersions, client.MatchingLabels{corev1alpha1.ExtensionReferenceLabel: dependency.Name}); err != nil {
+		return nil, err
+	}
+	var selected *corev1alpha1.ExtensionVersion
+	var selectedVersion *semver.Version
+	for i := range extensionVersions.Items {
+		extensionVersion := &extensionVersions.Items[i]
+		satisfied, err := dependencySatisfied(dependency, extensionVersion.Spec.Version)
+		if err != nil {
+			return nil, err
+		}
+		if !satisfied {
+			continue
+		}
+		version, err := semver.NewVersion(extensionVersion.Spec.Version)
+		if err != nil {
+			continue
+		}
+		// the constraints exclude the prereleases unless they contain a prerelease
+		if dependency.Version == "" && version.Prerelease() != "" {
+			continue
+		}
+		if kubeVersionMatched, ksVersionMatched := matchVersionConstraints(*extensionVersion, d.k8sVersion, d.ksVersion); !kubeVersionMatched || !ksVersionMatched {
+			continue
+		}
+		if selectedVersion == nil || version.GreaterThan(selectedVersion) {
+			selected, selectedVersion = extensionVersion, version
+		}
+	}
+	if selected == nil {
+		return nil, &dependencyError{
+			reason:  dependencyNotFound,
+			message: fmt.Sprintf("No available version of the extension %s satisfies %s and is compatible with the cluster.", dependency.Name, dependency.Version),
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newExtensionVersion(name, version string, dependencies ...corev1alpha1.ExternalDependency) *corev1alpha1.ExtensionVersion {
+	return &corev1alpha1.ExtensionVersion{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("%s-%s", name, version),
+			Labels: map[string]string{corev1alpha1.ExtensionReferenceLabel: name},
+		},
+		Spec: corev1alpha1.ExtensionVersionSpec{
+			Version:              version,
+			ExternalDependencies: dependencies,
+		},
+	}
+}
+
+func withVersionConstraints(extensionVersion *corev1alpha1.ExtensionVersion, kubeVersion, ksVersion string) *corev1alpha1.ExtensionVersion {
+	extensionVersion.Spec.KubeVersion = kubeVersion
+	extensionVersion.Spec.KSVersion = ksVersion
+	return extensionVersion
+}
+
+func newInstallPlan(name, version string) *corev1alpha1.InstallPlan {
+	return &corev1alpha1.InstallPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1alpha1.InstallPlanSpec{
+			Extension: corev1alpha1.ExtensionRef{Name: name, Version: version},
+		},
+	}
+}
+
+func requires(name, version string) corev1alpha1.ExternalDependency {
+	return corev1alpha1.ExternalDependency{Name: name, Version: version, Required: true}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	plans := map[string]*corev1alpha1.InstallPlan{
+		"gateway": newInstallPlan("gateway", "1.2.0"),
+	}
+	tests := []struct {
+		name         string
+		dependencies []corev1alpha1.ExternalDependency
+		missing      []string
+		reason       string
+	}{
+		{
+			name:         "satisfied",
+			dependencies: []corev1alpha1.ExternalDependency{requires("gateway", ">=1.0.0")},
+		},
+		{
+			name:         "missing",
+			dependencies: []corev1alpha1.ExternalDependency{requires("gateway", "^1.0.0"), requires("storage", ">=1.0.0")},
+			missing:      []string{"storage"},
+		},
+		{
+			name:         "version mismatch",
+			dependencies: []corev1alpha1.ExternalDependency{requires("gateway", ">=2.0.0")},
+			reason:       dependencyVersionMismatch,
+		},
+		{
+			name:         "invalid constraint",
+			dependencies: []corev1alpha1.ExternalDependency{requires("gateway", "latest")},
+			reason:       dependencyVersionMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := checkDependencies(tt.dependencies, plans)
+			if tt.reason != "" {
+				dependencyErr, ok := asDependencyError(err)
+				assert.True(t, ok)
+				assert.Equal(t, tt.reason, dependencyErr.reason)
+				return
+			}
+			assert.NoError(t, err)
+			var names []string
+			for _, dependency := range missing {
+				names = append(names, dependency.Name)
+			}
+			assert.Equal(t, tt.missing, names)
+		})
+	}
+}
+
+func TestRequiredDependencies(t *testing.T) {
+	extensionVersion := newExtensionVersion("devops", "1.0.0",
+		requires("gateway", ">=1.0.0"),
+		corev1alpha1.ExternalDependency{Name: "logging", Version: ">=1.0.0"},
+		corev1alpha1.ExternalDependency{Name: "kubernetes", Type: "platform", Version: ">=1.26.0", Required: true},
+		corev1alpha1.ExternalDependency{Name: "storage", Type: corev1alpha1.DependencyTypeExtension, Required: true},
+	)
+	dependencies := requiredDependencies(extensionVersion)
+	assert.Equal(t, "gateway (>=1.0.0), storage", describeDependencies(dependencies))
+}
+
+func TestDependencyResolver(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, corev1alpha1.AddToScheme(scheme))
+
+	tests := []struct {
+		name     string
+		objects  []client.Object
+		root     *corev1alpha1.ExtensionVersion
+		expected []corev1alpha1.ExtensionRef
+		reason   string
+	}{
+		{
+			name: "topological order",
+			objects: []client.Object{
+				newExtensionVersion("gateway", "1.0.0"),
+				newExtensionVersion("gateway", "1.1.0", requires("storage", "^1.0.0")),
+				newExtensionVersion("gateway", "2.0.0", requires("storage", "^2.0.0")),
+				newExtensionVersion("storage", "1.0.0"),
+				newExtensionVersion("storage", "1.3.0"),
+				newExtensionVersion("storage", "2.0.0"),
+			},
+			root: newExtensionVersion("devops", "1.0.0", requires("gateway", "^1.0.0"), requires("storage", ">=1.0.0")),
+			expected: []corev1alpha1.ExtensionRef{
+				{Name: "storage", Version: "1.3.0"},
+				{Name: "gateway", Version: "1.1.0"},
+			},
+		},
+		{
+			name: "skip installed dependencies",
+			objects: []client.Object{
+				newInstallPlan("storage", "1.0.0"),
+				newExtensionVersion("gateway", "1.1.0", requires("storage", "^1.0.0")),
+			},
+			root:     newExtensionVersion("devops", "1.0.0", requires("gateway", "^1.0.0")),
+			expected: []corev1alpha1.ExtensionRef{{Name: "gateway", Version: "1.1.0"}},
+		},
+		{
+			name: "conflicting constraints",
+			objects: []client.Object{
+				newExtensionVersion("gateway", "1.0.0", requires("storage", "^2.0.0")),
+				newExtensionVersion("storage", "1.0.0"),
+				newExtensionVersion("storage", "2.0.0"),
+			},
+			root:   newExtensionVersion("devops", "1.0.0", requires("storage", "^1.0.0"), requires("gateway", "^1.0.0")),
+			reason: dependencyVersionMismatch,
+		},
+		{
+			name: "circular dependency",
+			objects: []client.Object{
+				newExtensionVersion("gateway", "1.0.0", requires("devops", "^1.0.0")),
+				newExtensionVersion("devops", "1.0.0", requires("gateway", "^1.0.0")),
+			},
+			root:   newExtensionVersion("devops", "1.0.0", requires("gateway", "^1.0.0")),
+			reason: circularDependency,
+		},
+		{
+			name: "skip incompatible versions and prereleases",
+			objects: []client.Object{
+				newExtensionVersion("gateway", "1.0.0"),
+				withVersionConstraints(newExtensionVersion("gateway", "1.1.0"), ">=1.30.0", ""),
+				withVersionConstraints(newExtensionVersion("gateway", "1.2.0"), "", ">=4.2.0"),
+				newExtensionVersion("gateway", "1.3.0-rc.1"),
+				newExtensionVersion("storage", "2.0.0-beta.1"),
+			},
+			root: newExtensionVersion("devops", "1.0.0", requires("gateway", ""), requires("storage", ">=2.0.0-0")),
+			expected: []corev1alpha1.ExtensionRef{
+				{Name: "gateway", Version: "1.0.0"},
+				{Name: "storage", Version: "2.0.0-beta.1"},
+			},
+		},
+		{
+			name:   "no available version",
+			root:   newExtensionVersion("devops", "1.0.0", requires("gateway", "^1.0.0")),
+			reason: dependencyNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build()
+			ctx := context.Background()
+			plans, err := installPlansByExtension(ctx, c)
+			assert.NoError(t, err)
+			refs, err := newDependencyResolver(c, plans, semver.MustParse("1.28.0"), semver.MustParse("4.1.0")).resolve(ctx, "devops", tt.root)
+			if tt.reason != "" {
+				dependencyErr, ok := asDependencyError(err)
+				assert.True(t, ok, "unexpected error: %v", err)
+				assert.Equal(t, tt.reason, dependencyErr.reason)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, refs)
+		})
+	}
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"kubesphere.io/utils/helm"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	clusterutils "kubesphere.io/kubesphere/pkg/controller/cluster/utils"
+	"kubesphere.io/kubesphere/pkg/controller/options"
+	"kubesphere.io/kubesphere/pkg/utils/clusterclient"
+)
+
+const (
+	redactedValue        = "(redacted)"
+	redactedChangedValue = "(redacted, changed)"
+)
+
+const (
+	ObjectActionCreate = "Create"
+	ObjectActionUpdate = "Update"
+	ObjectActionDelete = "Delete"
+)
+
+// ObjectDiff describes the change of an object in the release.
+type ObjectDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Action is one of Create, Update and Delete.
+	Action string `json:"action"`
+	// Diff is the unified diff between the manifest of the live object and the rendered object.
+	Diff string `json:"diff,omitempty"`
+}
+
+// ReleaseDiff describes the changes of the release in a cluster.
+type ReleaseDiff struct {
+	// Cluster is empty for the extension release in the host cluster.
+	Cluster     string       `json:"cluster,omitempty"`
+	ReleaseName string       `json:"releaseName"`
+	Namespace   string       `json:"namespace"`
+	Objects     []ObjectDiff `json:"objects"`
+	// Error is the reason why the release cannot be compared.
+	Error string `json:"error,omitempty"`
+}
+
+// DryRunner renders the charts of an InstallPlan the same way as the InstallPlanReconciler, and compares
+// the objects with the manifests of the deployed releases without installing anything.
+type DryRunner struct {
+	reconciler     *InstallPlanReconciler
+	hostKubeConfig []byte
+}
+
+func NewDryRunner(client client.Client, clusterClient clusterclient.Interface, hostConfig *rest.Config,
+	portalURL string, extensionOptions *options.ExtensionOptions) (*DryRunner, error) {
+	hostKubeConfig, err := clusterutils.BuildKubeconfigFromRestConfig(hostConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build host cluster kubeconfig: %v", err)
+	}
+	return &DryRunner{
+		reconciler: &InstallPlanReconciler{
+			Client:           client,
+			PortalURL:        portalURL,
+			ExtensionOptions: extensionOptions,
+			clusterClientSet: clusterClient,
+		},
+		hostKubeConfig: hostKubeConfig,
+	}, nil
+}
+
+// DryRun returns the changes of the extension release in the host cluster and the agent releases in the
+// scheduled clusters, the agents in the clusters recorded in the status but no longer scheduled are deleted.
+func (d *DryRunner) DryRun(ctx context.Context, plan *corev1alpha1.InstallPlan) ([]ReleaseDiff, error) {
+	r := d.reconciler
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	extensionVersionName := fmt.Sprintf("%s-%s", plan.Spec.Extension.Name, plan.Spec.Extension.Version)
+	if err := r.Get(ctx, types.NamespacedName{Name: extensionVersionName}, extensionVersion); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, contextKeyExtensionVersion{}, extensionVersion)
+
+	chartData, _, err := r.loadChartDataAndCABundle(ctx, &corev1alpha1.InstallationStatus{})
+	if err != nil {
+		return nil, err
+	}
+	mainChart, err := loader.LoadArchive(bytes.NewReader(chartData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart data: %v", err)
+	}
+
+	namespace := extensionTargetNamespace(extensionVersion, plan.Spec.Extension.Name)
+	labels := map[string]string{corev1alpha1.ExtensionReferenceLabel: plan.Spec.Extension.Name}
+	releases := []ReleaseDiff{
+		diffRelease(d.hostKubeConfig, ReleaseDiff{ReleaseName: plan.Spec.Extension.Name, Namespace: namespace},
+			func(caps *chartutil.Capabilities) (map[string]*unstructured.Unstructured, error) {
+				return renderManifests(chartData, plan.Spec.Extension.Name, namespace, clusterConfig(plan, ""),
+					r.getOverrides(mainChart, tagExtension, nil), labels, caps)
+			}),
+	}
+
+	if plan.Spec.ClusterScheduling == nil {
+		return releases, nil
+	}
+	targetClusters, err := r.targetClusters(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+	releaseName := fmt.Sprintf(agentReleaseFormat, plan.Spec.Extension.Name)
+	for _, cluster := range targetClusters {
+		if !clusterutils.IsClusterSchedulable(&cluster) {
+			releases = append(releases, ReleaseDiff{Cluster: cluster.Name, ReleaseName: releaseName, Namespace: namespace,
+				Error: fmt.Sprintf("cluster %s is not schedulable", cluster.Name)})
+			continue
+		}
+		releases = append(releases, diffRelease(cluster.Spec.Connection.KubeConfig,
+			ReleaseDiff{Cluster: cluster.Name, ReleaseName: releaseName, Namespace: namespace},
+			func(caps *chartutil.Capabilities) (map[string]*unstructured.Unstructured, error) {
+				return renderManifests(chartData, releaseName, namespace, clusterConfig(plan, cluster.Name),
+					r.getOverrides(mainChart, tagAgent, &cluster), labels, caps)
+			}))
+	}
+
+	for _, clusterName := range slices.Sorted(maps.Keys(plan.Status.ClusterSchedulingStatuses)) {
+		if hasCluster(targetClusters, clusterName) {
+			continue
+		}
+		release := ReleaseDiff{Cluster: clusterName, ReleaseName: releaseName, Namespace: namespace}
+		cluster := &clusterv1alpha1.Cluster{}
+		if err := r.Get(ctx, types.NamespacedName{Name: clusterName}, cluster); err != nil {
+			release.Error = err.Error()
+			releases = append(releases, release)
+			continue
+		}
+		releases = append(releases, diffRelease(cluster.Spec.Connection.KubeConfig, release,
+			func(*chartutil.Capabilities) (map[string]*unstructured.Unstructured, error) {
+				return nil, nil
+			}))
+	}
+	return releases, nil
+}
+
+// diffRelease compares the objects rendered with the capabilities of the cluster with the manifest of the
+// release deployed in the cluster.
+func diffRelease(kubeConfig []byte, release ReleaseDiff, render func(caps *chartutil.Capabilities) (map[string]*unstructured.Unstructured, error)) ReleaseDiff {
+	helmConf, err := helm.InitHelmConf(kubeConfig, release.Namespace)
+	if err != nil {
+		release.Error = fmt.Sprintf("failed to connect to cluster: %v", err)
+		return release
+	}
+	caps, err := clusterCapabilities(helmConf)
+	if err != nil {
+		release.Error = fmt.Sprintf("failed to get cluster capabilities: %v", err)
+		return release
+	}
+	rendered, err := render(caps)
+	if err != nil {
+		release.Error = fmt.Sprintf("failed to render chart: %v", err)
+		return release
+	}
+	live, err := liveManifests(helmConf, release.ReleaseName)
+	if err != nil {
+		release.Error = fmt.Sprintf("failed to get release: %v", err)
+		return release
+	}
+	release.Objects, err = diffObjects(live, rendered)
+	if err != nil {
+		release.Error = fmt.Sprintf("failed to compare objects: %v", err)
+	}
+	return release
+}
+
+// clusterCapabilities returns the Kubernetes version and the API versions of the cluster like helm does on upgrade.
+func clusterCapabilities(helmConf *action.Configuration) (*chartutil.Capabilities, error) {
+	dc, err := helmConf.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not get Kubernetes discovery client: %v", err)
+	}
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("could not get server version from Kubernetes: %v", err)
+	}
+	// the API versions are still populated if some of the API services are unavailable
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("could not get apiVersions from Kubernetes: %v", err)
+	}
+	return &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		KubeVersion: chartutil.KubeVersion{
+			Version: kubeVersion.GitVersion,
+			Major:   kubeVersion.Major,
+			Minor:   kubeVersion.Minor,
+		},
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}, nil
+}
+
+// liveManifests returns the objects of the release deployed in the cluster, nil is returned if the release is not found.
+func liveManifests(helmConf *action.Configuration, releaseName string) (map[string]*unstructured.Unstructured, error) {
+	release, err := action.NewGet(helmConf).Run(releaseName)
+	if err != nil {
+		if isReleaseNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseManifests(releaseutil.SplitManifests(release.Manifest), nil)
+}
+
+// renderManifests renders the chart with the values built by processValues. The labels are added to the objects as the post renderer of the helm executor does.
+func renderManifests(chartData []byte, releaseName, namespace string, config []byte,
+	overrides []string, labels map[string]string, caps *chartutil.Capabilities) (map[string]*unstructured.Unstructured, error) {
+	// the chart is loaded every time since the dependencies are processed in place
+	mainChart, err := loader.LoadArchive(bytes.NewReader(chartData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart data: %v", err)
+	}
+	values, err := processValues(mainChart, config, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	renderValues, err := chartutil.ToRenderValues(mainChart, values,
+		chartutil.ReleaseOptions{Name: releaseName, Namespace: namespace, IsUpgrade: true}, caps)
+	if err != nil {
+		return nil, err
+	}
+	files, err := engine.Render(mainChart, renderValues)
+	if err != nil {
+		return nil, err
+	}
+	// hooks are not stored in the manifest of the release
+	_, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]string, len(manifests))
+	for _, manifest := range manifests {
+		docs[manifest.Name] = manifest.Content
+	}
+	return parseManifests(docs, labels)
+}
+
+// parseManifests parses the manifests to objects indexed by objectKey.
+func parseManifests(manifests map[string]string, labels map[string]string) (map[string]*unstructured.Unstructured, error) {
+	objects := make(map[string]*unstructured.Unstructured)
+	for name, manifest := range manifests {
+		for _, doc := range releaseutil.SplitManifests(manifest) {
+			object := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(doc), &object.Object); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest %s: %v", name, err)
+			}
+			if len(object.Object) == 0 {
+				continue
+			}
+			if len(labels) > 0 {
+				objectLabels := object.GetLabels()
+				if objectLabels == nil {
+					objectLabels = make(map[string]string, len(labels))
+				}
+				for k, v := range labels {
+					objectLabels[k] = v
+				}
+				object.SetLabels(objectLabels)
+			}
+			objects[objectKey(object)] = object
+		}
+	}
+	return objects, nil
+}
+
+func objectKey(object *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s/%s", object.GetAPIVersion(), object.GetKind(), object.GetNamespace(), object.GetName())
+}
+
+// diffObjects returns the changed objects sorted by objectKey.
+func diffObjects(live, rendered map[string]*unstructured.Unstructured) ([]ObjectDiff, error) {
+	keys := make([]string, 0, len(live)+len(rendered))
+	for key := range live {
+		keys = append(keys, key)
+	}
+	for key := range rendered {
+		if _, ok := live[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	objects := make([]ObjectDiff, 0)
+	for _, key := range keys {
+		from, to := live[key], rendered[key]
+		object, action := to, ObjectActionUpdate
+		switch {
+		case from == nil:
+			action = ObjectActionCreate
+		case to == nil:
+			object, action = from, ObjectActionDelete
+		}
+		diff, err := unifiedDiff(key, redactSecret(from, nil), redactSecret(to, from))
+		if err != nil {
+			return nil, err
+		}
+		if diff == "" {
+			continue
+		}
+		objects = append(objects, ObjectDiff{
+			APIVersion: object.GetAPIVersion(),
+			Kind:       object.GetKind(),
+			Namespace:  object.GetNamespace(),
+			Name:       object.GetName(),
+			Action:     action,
+			Diff:       diff,
+		})
+	}
+	return objects, nil
+}
+
+// redactSecret returns a copy of the Secret with the values of data and stringData replaced, the placeholders only
+// tell whether the values are changed from the previous Secret if it is given. Other objects are returned as is.
+func redactSecret(object, previous *unstructured.Unstructured) *unstructured.Unstructured {
+	if object == nil || object.GetAPIVersion() != "v1" || object.GetKind() != "Secret" {
+		return object
+	}
+	object = object.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := object.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var previousValues map[string]interface{}
+		if previous != nil {
+			previousValues, _ = previous.Object[field].(map[string]interface{})
+		}
+		for key, value := range values {
+			if previousValue, found := previousValues[key]; previous != nil && (!found || previousValue != value) {
+				values[key] = redactedChangedValue
+			} else {
+				values[key] = redactedValue
+			}
+		}
+	}
+	return object
+}
+
+// unifiedDiff compares the objects in YAML format with sorted keys, the nil object is treated as empty.
+func unifiedDiff(name string, from, to *unstructured.Unstructured) (string, error) {
+	toYAML := func(object *unstructured.Unstructured) (string, error) {
+		if object == nil {
+			return "", nil
+		}
+		data, err := yaml.Marshal(object.Object)
+		return string(data), err
+	}
+	a, err := toYAML(from)
+	if err != nil {
+		return "", err
+	}
+	b, err := toYAML(to)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: "live/" + name,
+		ToFile:   "rendered/" + name,
+		Context:  3,
+	})
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+)
+
+func newChartData(t *testing.T) []byte {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "devops", Version: "1.0.0"},
+		Values:   map[string]interface{}{"replicas": 1, "global": map[string]interface{}{"imageRegistry": "docker.io"}},
+		Templates: []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  replicas: "{{ .Values.replicas }}"
+  registry: {{ .Values.global.imageRegistry }}
+`)},
+			{Name: "templates/hook.yaml", Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hook
+  annotations:
+    helm.sh/hook: pre-install
+`)},
+		},
+	}
+	path, err := chartutil.Save(c, t.TempDir())
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestRenderManifests(t *testing.T) {
+	labels := map[string]string{corev1alpha1.ExtensionReferenceLabel: "devops"}
+	objects, err := renderManifests(newChartData(t), "devops", "extension-devops", []byte("replicas: 2"),
+		[]string{"global.imageRegistry=registry.kubesphere.io"}, labels, chartutil.DefaultCapabilities)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+
+	object := objects["v1/ConfigMap//devops"]
+	assert.NotNil(t, object)
+	assert.Equal(t, labels, object.GetLabels())
+	assert.Equal(t, map[string]interface{}{"replicas": "2", "registry": "registry.kubesphere.io"}, object.Object["data"])
+
+	_, err = renderManifests(newChartData(t), "devops", "extension-devops", []byte("invalid"), nil, nil, chartutil.DefaultCapabilities)
+	assert.Error(t, err)
+}
+
+func TestDiffObjects(t *testing.T) {
+	live, err := parseManifests(map[string]string{"manifest": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: old
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: removed
+`}, nil)
+	assert.NoError(t, err)
+	rendered, err := parseManifests(map[string]string{"manifest": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: new
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: added
+`}, nil)
+	assert.NoError(t, err)
+
+	objects, err := diffObjects(live, rendered)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 3)
+
+	actions := make(map[string]string)
+	for _, object := range objects {
+		actions[object.Name] = object.Action
+	}
+	assert.Equal(t, map[string]string{
+		"changed": ObjectActionUpdate,
+		"added":   ObjectActionCreate,
+		"removed": ObjectActionDelete,
+	}, actions)
+	assert.Contains(t, objects[0].Diff, "-  key: old\n+  key: new\n")
+}
+
+func TestDiffSecrets(t *testing.T) {
+	newSecret := func(data map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "credentials"},
+			"data":       data,
+		}}
+	}
+	key := "v1/Secret//credentials"
+	live := map[string]*unstructured.Unstructured{key: newSecret(map[string]interface{}{"username": "YWRtaW4=", "password": "b2xk"})}
+	rendered := map[string]*unstructured.Unstructured{key: newSecret(map[string]interface{}{"username": "YWRtaW4=", "password": "bmV3"})}
+
+	objects, err := diffObjects(live, rendered)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Contains(t, objects[0].Diff, "-  password: (redacted)\n+  password: (redacted, changed)\n")
+	assert.NotContains(t, objects[0].Diff, "b2xk")
+	assert.NotContains(t, objects[0].Diff, "bmV3")
+	assert.NotContains(t, objects[0].Diff, "YWRtaW4=")
+
+	// the secrets are not changed in place
+	assert.Equal(t, "bmV3", rendered[key].Object["data"].(map[string]interface{})["password"])
+	objects, err = diffObjects(live, live)
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
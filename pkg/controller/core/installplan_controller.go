@@ -16,6 +16,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/go-logr/logr"
 	"golang.org/x/exp/slices"
 	"helm.sh/helm/v3/pkg/chart"
@@ -57,6 +58,7 @@ import (
 	"kubesphere.io/kubesphere/pkg/utils/clusterclient"
 	"kubesphere.io/kubesphere/pkg/utils/hashutil"
 	"kubesphere.io/kubesphere/pkg/utils/sliceutil"
+	"kubesphere.io/kubesphere/pkg/version"
 )
 
 const (
@@ -76,6 +78,7 @@ const (
 	installSuccessful                  = "InstallSuccessful"
 	installFailed                      = "InstallFailed"
 	initialized                        = "Initialized"
+	automaticUpgrade                   = "AutomaticUpgrade"
 	uninstallFailed                    = "UninstallFailed"
 	typeHelmRelease                    = "helm.sh/release.v1"
 	globalExtensionIngressClassName    = "global.extension.ingress.ingressClassName"
@@ -110,6 +113,7 @@ type InstallPlanReconciler struct {
 	ExtensionOptions    *options.ExtensionOptions
 	hostResetConfig     *rest.Config
 	clusterClientSet    clusterclient.Interface
+	k8sVersion          *semver.Version
 }
 
 func (r *InstallPlanReconciler) SetupWithManager(mgr *kscontroller.Manager) error {
@@ -123,6 +127,7 @@ func (r *InstallPlanReconciler) SetupWithManager(mgr *kscontroller.Manager) erro
 	r.logger = mgr.GetLogger().WithName(installPlanController)
 	r.recorder = mgr.GetEventRecorderFor(installPlanController)
 	r.clusterClientSet = mgr.ClusterClient
+	r.k8sVersion = mgr.K8sVersion
 
 	if r.HelmExecutorOptions == nil || r.HelmExecutorOptions.Image == "" {
 		return fmt.Errorf("helm executor image is not specified")
@@ -214,6 +219,40 @@ func (r *InstallPlanReconciler) SetupWithManager(mgr *kscontroller.Manager) erro
 				},
 			}),
 		).
+		Watches(
+			&corev1alpha1.Extension{},
+			handler.EnqueueRequestsFromMapFunc(
+				func(ctx context.Context, h client.Object) []reconcile.Request {
+					return []reconcile.Request{{
+						NamespacedName: types.NamespacedName{
+							Name: h.GetName(),
+						}}}
+				}),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldExtension := e.ObjectOld.(*corev1alpha1.Extension)
+					newExtension := e.ObjectNew.(*corev1alpha1.Extension)
+					return oldExtension.Status.RecommendedVersion != newExtension.Status.RecommendedVersion
+				},
+				CreateFunc: func(e event.CreateEvent) bool {
+					return false
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return false
+				},
+			}),
+		).
+		Watches(
+			&corev1alpha1.InstallPlan{},
+			handler.EnqueueRequestsFromMapFunc(r.dependentsMapper),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldPlan := e.ObjectOld.(*corev1alpha1.InstallPlan)
+					newPlan := e.ObjectNew.(*corev1alpha1.InstallPlan)
+					return oldPlan.Status.State != newPlan.Status.State || oldPlan.Status.Version != newPlan.Status.Version
+				},
+			}),
+		).
 		Watches(
 			&clusterv1alpha1.Cluster{},
 			handler.EnqueueRequestsFromMapFunc(r.mapper),
@@ -268,31 +307,119 @@ func (r *InstallPlanReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, r.Patch(ctx, expected, client.MergeFrom(plan))
 	}
 
-	targetNamespace := extensionVersion.Spec.Namespace
-	if targetNamespace == "" {
-		targetNamespace = fmt.Sprintf("extension-%s", plan.Spec.Extension.Name)
-	}
-
+	targetNamespace := extensionTargetNamespace(extensionVersion, plan.Spec.Extension.Name)
 	if plan.Status.TargetNamespace != targetNamespace {
 		plan.Status.TargetNamespace = targetNamespace
 		return ctrl.Result{}, r.updateInstallPlan(ctx, plan)
 	}
 
-	if err := r.syncInstallPlanStatus(ctx, plan); err != nil {
+	statusRequeueAfter, err := r.syncInstallPlanStatus(ctx, plan)
+	if err != nil {
 		logger.Error(err, "failed to sync installplan status")
 		return ctrl.Result{}, fmt.Errorf("failed to sync installplan status: %v", err)
 	}
 
 	// Multi-cluster installation
+	var rolloutRequeueAfter time.Duration
 	if plan.Spec.ClusterScheduling != nil {
-		if err := r.syncClusterSchedulingStatus(ctx, plan); err != nil {
+		if rolloutRequeueAfter, err = r.syncClusterSchedulingStatus(ctx, plan); err != nil {
 			logger.Error(err, "failed to sync scheduling status")
 			return ctrl.Result{}, fmt.Errorf("failed to sync scheduling status: %v", err)
 		}
 	}
 
+	requeueAfter, err := r.syncAutomaticUpgrade(ctx, plan)
+	if err != nil {
+		logger.Error(err, "failed to sync automatic upgrade")
+		return ctrl.Result{}, fmt.Errorf("failed to sync automatic upgrade: %v", err)
+	}
+	requeueAfter = minRequeueAfter(minRequeueAfter(requeueAfter, rolloutRequeueAfter), statusRequeueAfter)
+
 	logger.V(4).Info("Successfully synced")
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// syncAutomaticUpgrade upgrades the extension to the recommended version if the upgrade strategy is Automatic,
+// returns the duration to wait if the maintenance window is not open.
+func (r *InstallPlanReconciler) syncAutomaticUpgrade(ctx context.Context, plan *corev1alpha1.InstallPlan) (time.Duration, error) {
+	if plan.Spec.UpgradeStrategy != corev1alpha1.Automatic ||
+		plan.Status.State != corev1alpha1.StateDeployed ||
+		plan.Spec.Extension.Version != plan.Status.Version {
+		return 0, nil
+	}
+	logger := klog.FromContext(ctx)
+
+	extension := &corev1alpha1.Extension{}
+	if err := r.Get(ctx, types.NamespacedName{Name: plan.Spec.Extension.Name}, extension); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	recommendedVersion := extension.Status.RecommendedVersion
+	if recommendedVersion == "" {
+		return 0, nil
+	}
+	recommended, err := semver.NewVersion(recommendedVersion)
+	if err != nil {
+		logger.V(4).Info("invalid recommended version", "version", recommendedVersion, "error", err)
+		return 0, nil
+	}
+	current, err := semver.NewVersion(plan.Status.Version)
+	if err != nil || !recommended.GreaterThan(current) {
+		return 0, nil
+	}
+	if plan.Annotations[corev1alpha1.AutomaticUpgradeAnnotation] == recommendedVersion {
+		// the automatic upgrade to the recommended version has been rolled back
+		return 0, nil
+	}
+
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	extensionVersionName := fmt.Sprintf("%s-%s", plan.Spec.Extension.Name, recommendedVersion)
+	if err := r.Get(ctx, types.NamespacedName{Name: extensionVersionName}, extensionVersion); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	ksVersion, err := semver.NewVersion(version.Get().GitVersion)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse KS version %s: %v", version.Get().GitVersion, err)
+	}
+	if kubeVersionMatched, ksVersionMatched := matchVersionConstraints(*extensionVersion, r.k8sVersion, ksVersion); !kubeVersionMatched || !ksVersionMatched {
+		logger.V(4).Info("the recommended version is not compatible", "version", recommendedVersion)
+		return 0, nil
+	}
+
+	var window *options.MaintenanceWindow
+	if r.ExtensionOptions != nil {
+		window = r.ExtensionOptions.MaintenanceWindow
+	}
+	wait, err := untilMaintenanceWindow(window, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		logger.V(4).Info("waiting for the maintenance window to upgrade automatically", "version", recommendedVersion, "after", wait)
+		return wait, nil
+	}
+
+	currentVersion := plan.Spec.Extension.Version
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.Get(ctx, types.NamespacedName{Name: plan.Name}, plan); err != nil {
+			return err
+		}
+		if plan.Spec.Extension.Version != currentVersion {
+			return nil
+		}
+		plan.Spec.Extension.Version = recommendedVersion
+		if plan.Annotations == nil {
+			plan.Annotations = make(map[string]string)
+		}
+		plan.Annotations[corev1alpha1.AutomaticUpgradeAnnotation] = recommendedVersion
+		return r.Update(ctx, plan)
+	}); err != nil {
+		return 0, fmt.Errorf("failed to update install plan: %v", err)
+	}
+
+	logger.Info("upgrading extension automatically", "from", currentVersion, "to", recommendedVersion)
+	r.recorder.Eventf(plan, corev1.EventTypeNormal, automaticUpgrade, "Upgrading extension %s from %s to %s automatically",
+		plan.Spec.Extension.Name, currentVersion, recommendedVersion)
+	return 0, nil
 }
 
 // reconcileDelete delete the helm release involved and remove finalizer from installplan.
@@ -410,7 +537,8 @@ func latestJobCondition(job *batchv1.Job) batchv1.JobCondition {
 	return condition
 }
 
-func (r *InstallPlanReconciler) loadChartDataAndCABundle(ctx context.Context) ([]byte, string, error) {
+// loadChartDataAndCABundle loads and verifies the chart data, the result of the verification is recorded in the status.
+func (r *InstallPlanReconciler) loadChartDataAndCABundle(ctx context.Context, status *corev1alpha1.InstallationStatus) ([]byte, string, error) {
 	extensionVersion, ok := ctx.Value(contextKeyExtensionVersion{}).(*corev1alpha1.ExtensionVersion)
 	if !ok {
 		return nil, "", fmt.Errorf("failed to get extension version from context")
@@ -424,14 +552,21 @@ func (r *InstallPlanReconciler) loadChartDataAndCABundle(ctx context.Context) ([
 	}
 
 	data, err := fetchChartData(ctx, r.Client, extensionVersion)
+	if err == nil {
+		err = verifyChartSignature(ctx, repo, extensionVersion.Spec.ChartURL, data)
+	}
 	if err != nil {
+		updateVerifiedCondition(status, err)
 		return nil, "", fmt.Errorf("failed to load chart data: %v", err)
 	}
 
+	if repo.Spec.Verification != nil || (extensionVersion.Spec.ChartDataRef == nil && extensionVersion.Spec.Digest != "") {
+		updateVerifiedCondition(status, nil)
+	}
 	return data, repo.Spec.CABundle, nil
 }
 
-func updateState(status *corev1alpha1.InstallationStatus, state string, time time.Time) bool {
+func updateState(status *corev1alpha1.InstallationStatus, state, message string, time time.Time) bool {
 	var lastState corev1alpha1.InstallPlanState
 	if len(status.StateHistory) > 0 {
 		lastState = status.StateHistory[len(status.StateHistory)-1]
@@ -450,6 +585,7 @@ func updateState(status *corev1alpha1.InstallationStatus, state string, time tim
 	newState := corev1alpha1.InstallPlanState{
 		LastTransitionTime: metav1.NewTime(time),
 		State:              state,
+		Message:            message,
 	}
 
 	if status.StateHistory == nil {
@@ -895,13 +1031,49 @@ func (r *InstallPlanReconciler) syncExtensionStatus(ctx context.Context, plan *c
 	return nil
 }
 
-func (r *InstallPlanReconciler) syncClusterSchedulingStatus(ctx context.Context, plan *corev1alpha1.InstallPlan) error {
-	logger := klog.FromContext(ctx)
+// syncClusterSchedulingStatus installs or upgrades the agents in the target clusters, returns the duration to wait
+// before upgrading the next batch of the rollout or checking the resources of the agents again.
+func (r *InstallPlanReconciler) syncClusterSchedulingStatus(ctx context.Context, plan *corev1alpha1.InstallPlan) (time.Duration, error) {
 	if plan.Status.State != corev1alpha1.StateDeployed {
-		return nil
+		return 0, nil
 	}
 	// extension is already installed
+	targetClusters, err := r.targetClusters(ctx, plan)
+	if err != nil {
+		return 0, err
+	}
+
+	held, requeueAfter, err := r.syncRollout(ctx, plan, targetClusters)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sync rollout status: %v", err)
+	}
+
+	for _, cluster := range targetClusters {
+		agentRequeueAfter, err := r.syncClusterAgentStatus(ctx, plan, &cluster, held.Has(cluster.Name))
+		if err != nil {
+			return 0, err
+		}
+		requeueAfter = minRequeueAfter(requeueAfter, agentRequeueAfter)
+	}
+
+	for clusterName := range plan.Status.ClusterSchedulingStatuses {
+		if !hasCluster(targetClusters, clusterName) {
+			if err := r.uninstallClusterAgent(ctx, plan, clusterName); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return requeueAfter, nil
+}
+
+// targetClusters returns the clusters selected by the placement of the InstallPlan.
+func (r *InstallPlanReconciler) targetClusters(ctx context.Context, plan *corev1alpha1.InstallPlan) ([]clusterv1alpha1.Cluster, error) {
+	logger := klog.FromContext(ctx)
 	var targetClusters []clusterv1alpha1.Cluster
+	if plan.Spec.ClusterScheduling == nil || plan.Spec.ClusterScheduling.Placement == nil {
+		return targetClusters, nil
+	}
 	if len(plan.Spec.ClusterScheduling.Placement.Clusters) > 0 {
 		for _, target := range plan.Spec.ClusterScheduling.Placement.Clusters {
 			var cluster clusterv1alpha1.Cluster
@@ -910,7 +1082,7 @@ func (r *InstallPlanReconciler) syncClusterSchedulingStatus(ctx context.Context,
 					logger.V(4).Info("cluster not found")
 					continue
 				}
-				return err
+				return nil, err
 			}
 			targetClusters = append(targetClusters, cluster)
 		}
@@ -918,29 +1090,14 @@ func (r *InstallPlanReconciler) syncClusterSchedulingStatus(ctx context.Context,
 		clusterList := &clusterv1alpha1.ClusterList{}
 		selector, err := metav1.LabelSelectorAsSelector(plan.Spec.ClusterScheduling.Placement.ClusterSelector)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if err := r.List(ctx, clusterList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
-			return err
+			return nil, err
 		}
 		targetClusters = clusterList.Items
 	}
-
-	for _, cluster := range targetClusters {
-		if err := r.syncClusterAgentStatus(ctx, plan, &cluster); err != nil {
-			return err
-		}
-	}
-
-	for clusterName := range plan.Status.ClusterSchedulingStatuses {
-		if !hasCluster(targetClusters, clusterName) {
-			if err := r.uninstallClusterAgent(ctx, plan, clusterName); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return targetClusters, nil
 }
 
 func (r *InstallPlanReconciler) cleanupOutdatedJobsAndConfigMaps(ctx context.Context, plan *corev1alpha1.InstallPlan) error {
@@ -979,8 +1136,9 @@ func (r *InstallPlanReconciler) cleanupOutdatedJobsAndConfigMaps(ctx context.Con
 	return nil
 }
 
-// syncInstallPlanStatus syncs the installation status of an extension.
-func (r *InstallPlanReconciler) syncInstallPlanStatus(ctx context.Context, plan *corev1alpha1.InstallPlan) error {
+// syncInstallPlanStatus syncs the installation status of an extension, returns the duration to wait before
+// checking the resources again after the upgrade.
+func (r *InstallPlanReconciler) syncInstallPlanStatus(ctx context.Context, plan *corev1alpha1.InstallPlan) (time.Duration, error) {
 	releaseName := plan.Spec.Extension.Name
 	targetNamespace := plan.Status.TargetNamespace
 
@@ -988,55 +1146,212 @@ func (r *InstallPlanReconciler) syncInstallPlanStatus(ctx context.Context, plan
 	installationStatus := plan.Status.InstallationStatus
 
 	if err := r.syncInstallationStatus(ctx, hostKubeConfig, targetNamespace, releaseName, &installationStatus); err != nil {
-		return fmt.Errorf("failed to sync release status: %v", err)
+		return 0, fmt.Errorf("failed to sync release status: %v", err)
 	}
 
 	if !reflect.DeepEqual(plan.Status.InstallationStatus, installationStatus) {
 		plan.Status.InstallationStatus = installationStatus
 		if err := r.updateInstallPlan(ctx, plan); err != nil {
-			return fmt.Errorf("failed to sync extension status: %v", err)
+			return 0, fmt.Errorf("failed to sync extension status: %v", err)
+		}
+	}
+
+	started, requeueAfter, err := r.syncRollback(ctx, plan, "", hostKubeConfig)
+	if err != nil || started {
+		return 0, err
+	}
+
+	if plan.Status.State == "" || versionChanged(plan, "") {
+		satisfied, err := r.syncDependencies(ctx, plan)
+		if err != nil {
+			return 0, fmt.Errorf("failed to sync dependencies: %v", err)
+		}
+		if !satisfied {
+			// waiting for the dependencies to be installed
+			return 0, nil
 		}
 	}
 
 	switch plan.Status.State {
 	case "":
-		return r.installOrUpgradeExtension(ctx, plan, false)
+		return 0, r.installOrUpgradeExtension(ctx, plan, false)
 	case corev1alpha1.StateInstallFailed:
 		// upgrade after configuration changes
 		if configChanged(plan, "") || versionChanged(plan, "") {
-			return r.installOrUpgradeExtension(ctx, plan, false)
+			return 0, r.installOrUpgradeExtension(ctx, plan, false)
 		}
-	case corev1alpha1.StatePreparing, corev1alpha1.StateInstalling, corev1alpha1.StateUpgrading:
+	case corev1alpha1.StatePreparing, corev1alpha1.StateInstalling, corev1alpha1.StateUpgrading, corev1alpha1.StateRollingBack:
 		// waiting for the installation to complete
-		return nil
-	case corev1alpha1.StateDeployed, corev1alpha1.StateUpgradeFailed:
+		return 0, nil
+	case corev1alpha1.StateDeployed, corev1alpha1.StateUpgradeFailed, corev1alpha1.StateRollbackFailed:
 		// upgrade after configuration changes
 		if configChanged(plan, "") || versionChanged(plan, "") {
-			return r.installOrUpgradeExtension(ctx, plan, true)
+			return 0, r.installOrUpgradeExtension(ctx, plan, true)
 		}
 	}
 
 	if plan.Status.State == corev1alpha1.StateDeployed {
 		if err := r.syncExtendedAPIStatus(ctx, r.Client, plan); err != nil {
-			return fmt.Errorf("failed to sync extended api status: %v", err)
+			return 0, fmt.Errorf("failed to sync extended api status: %v", err)
 		}
 
 		if plan.Status.Enabled != plan.Spec.Enabled {
 			plan.Status.Enabled = plan.Spec.Enabled
 			if err := r.updateInstallPlan(ctx, plan); err != nil {
-				return fmt.Errorf("failed to sync extension status: %v", err)
+				return 0, fmt.Errorf("failed to sync extension status: %v", err)
 			}
 		}
 	}
 
+	return requeueAfter, nil
+}
+
+// syncDependencies checks the required dependencies of the extension before it is installed or upgraded,
+// returns true if all of them have been installed.
+func (r *InstallPlanReconciler) syncDependencies(ctx context.Context, plan *corev1alpha1.InstallPlan) (bool, error) {
+	extensionVersion, ok := ctx.Value(contextKeyExtensionVersion{}).(*corev1alpha1.ExtensionVersion)
+	if !ok {
+		return false, fmt.Errorf("failed to get extension version from context")
+	}
+	dependencies := requiredDependencies(extensionVersion)
+	if len(dependencies) == 0 {
+		return true, nil
+	}
+
+	plans, err := installPlansByExtension(ctx, r.Client)
+	if err != nil {
+		return false, fmt.Errorf("failed to list install plans: %v", err)
+	}
+
+	var onUnsatisfied = func(err error) (bool, error) {
+		if dependencyErr, ok := asDependencyError(err); ok {
+			return false, r.updateDependencyCondition(ctx, plan, metav1.ConditionFalse, dependencyErr.reason, dependencyErr.message)
+		}
+		return false, err
+	}
+
+	missing, err := checkDependencies(dependencies, plans)
+	if err != nil {
+		return onUnsatisfied(err)
+	}
+
+	if len(missing) > 0 {
+		if plan.Annotations[corev1alpha1.InstallDependenciesAnnotation] != "true" {
+			message := fmt.Sprintf("The required extensions are not installed: %s.", describeDependencies(missing))
+			return false, r.updateDependencyCondition(ctx, plan, metav1.ConditionFalse, dependencyNotFound, message)
+		}
+		if err = r.installDependencies(ctx, plan, extensionVersion, plans); err != nil {
+			return onUnsatisfied(err)
+		}
+		message := fmt.Sprintf("Installing the required extensions: %s.", describeDependencies(missing))
+		return false, r.updateDependencyCondition(ctx, plan, metav1.ConditionFalse, installingDependencies, message)
+	}
+
+	var notReady []corev1alpha1.ExternalDependency
+	for _, dependency := range dependencies {
+		dependencyPlan := plans[dependency.Name]
+		satisfied, _ := dependencySatisfied(dependency, dependencyPlan.Status.Version)
+		if dependencyPlan.Status.State != corev1alpha1.StateDeployed || !satisfied {
+			notReady = append(notReady, dependency)
+		}
+	}
+	if len(notReady) > 0 {
+		message := fmt.Sprintf("Waiting for the required extensions to be installed: %s.", describeDependencies(notReady))
+		return false, r.updateDependencyCondition(ctx, plan, metav1.ConditionFalse, dependencyNotReady, message)
+	}
+
+	message := "All required extensions are installed."
+	return true, r.updateDependencyCondition(ctx, plan, metav1.ConditionTrue, dependenciesSatisfied, message)
+}
+
+// installDependencies creates InstallPlans for the missing dependencies in topological order.
+func (r *InstallPlanReconciler) installDependencies(ctx context.Context, plan *corev1alpha1.InstallPlan,
+	extensionVersion *corev1alpha1.ExtensionVersion, plans map[string]*corev1alpha1.InstallPlan) error {
+	ksVersion, err := semver.NewVersion(version.Get().GitVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse KS version %s: %v", version.Get().GitVersion, err)
+	}
+	refs, err := newDependencyResolver(r.Client, plans, r.k8sVersion, ksVersion).resolve(ctx, plan.Spec.Extension.Name, extensionVersion)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		dependencyPlan := &corev1alpha1.InstallPlan{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ref.Name,
+				Annotations: map[string]string{
+					corev1alpha1.InstallDependenciesAnnotation: "true",
+					corev1alpha1.RequiredByAnnotation:          plan.Name,
+				},
+			},
+			Spec: corev1alpha1.InstallPlanSpec{
+				Extension:       ref,
+				Enabled:         true,
+				UpgradeStrategy: corev1alpha1.Manual,
+			},
+		}
+		if err := r.Create(ctx, dependencyPlan); err != nil {
+			if errors.IsAlreadyExists(err) {
+				continue
+			}
+			return fmt.Errorf("failed to create install plan %s: %v", ref.Name, err)
+		}
+		klog.FromContext(ctx).Info("install plan of the dependency created", "dependency", ref.Name, "version", ref.Version)
+		r.recorder.Eventf(plan, corev1.EventTypeNormal, installingDependencies, "Created install plan %s for the dependency %s %s", dependencyPlan.Name, ref.Name, ref.Version)
+	}
 	return nil
 }
 
+func (r *InstallPlanReconciler) updateDependencyCondition(ctx context.Context, plan *corev1alpha1.InstallPlan, status metav1.ConditionStatus, reason, message string) error {
+	for _, condition := range plan.Status.Conditions {
+		if condition.Type == corev1alpha1.ConditionTypeDependenciesSatisfied &&
+			condition.Status == status && condition.Reason == reason && condition.Message == message {
+			return nil
+		}
+	}
+	updateCondition(&plan.Status.InstallationStatus, corev1alpha1.ConditionTypeDependenciesSatisfied, reason, message, status, time.Now())
+	return r.updateInstallPlan(ctx, plan)
+}
+
+// dependentsMapper enqueues the InstallPlans that depend on the extension of the given InstallPlan.
+func (r *InstallPlanReconciler) dependentsMapper(ctx context.Context, object client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	dependencyPlan, ok := object.(*corev1alpha1.InstallPlan)
+	if !ok {
+		return requests
+	}
+	installPlans := &corev1alpha1.InstallPlanList{}
+	if err := r.List(ctx, installPlans); err != nil {
+		klog.Warningf("failed to list install plans: %v", err)
+		return requests
+	}
+	for _, plan := range installPlans.Items {
+		if plan.Name == dependencyPlan.Name {
+			continue
+		}
+		extensionVersion := &corev1alpha1.ExtensionVersion{}
+		extensionVersionName := fmt.Sprintf("%s-%s", plan.Spec.Extension.Name, plan.Spec.Extension.Version)
+		if err := r.Get(ctx, types.NamespacedName{Name: extensionVersionName}, extensionVersion); err != nil {
+			continue
+		}
+		for _, dependency := range requiredDependencies(extensionVersion) {
+			if dependency.Name == dependencyPlan.Spec.Extension.Name {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: plan.Name}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// syncClusterAgentStatus installs or upgrades the agent in the cluster, the upgrade is held if the cluster
+// is waiting for its batch of the rollout. It returns the duration to wait before checking the resources again
+// after the upgrade.
 func (r *InstallPlanReconciler) syncClusterAgentStatus(ctx context.Context,
-	plan *corev1alpha1.InstallPlan, cluster *clusterv1alpha1.Cluster) error {
+	plan *corev1alpha1.InstallPlan, cluster *clusterv1alpha1.Cluster, held bool) (time.Duration, error) {
 	if !clusterutils.IsClusterSchedulable(cluster) {
 		klog.V(4).Infof("cluster %s is not schedulable", cluster.Name)
-		return nil
+		return 0, nil
 	}
 	if plan.Status.ClusterSchedulingStatuses == nil {
 		plan.Status.ClusterSchedulingStatuses = make(map[string]corev1alpha1.InstallationStatus)
@@ -1048,44 +1363,49 @@ func (r *InstallPlanReconciler) syncClusterAgentStatus(ctx context.Context,
 	installationStatus := plan.Status.ClusterSchedulingStatuses[cluster.Name]
 
 	if err := r.syncInstallationStatus(ctx, kubeConfig, targetNamespace, releaseName, &installationStatus); err != nil {
-		return fmt.Errorf("failed to sync cluster agent release status: %v", err)
+		return 0, fmt.Errorf("failed to sync cluster agent release status: %v", err)
 	}
 
 	plan.Status.ClusterSchedulingStatuses[cluster.Name] = installationStatus
 	if err := r.updateInstallPlan(ctx, plan); err != nil {
-		return fmt.Errorf("failed to sync cluster agent status: %v", err)
+		return 0, fmt.Errorf("failed to sync cluster agent status: %v", err)
+	}
+
+	started, requeueAfter, err := r.syncRollback(ctx, plan, cluster.Name, kubeConfig)
+	if err != nil || started {
+		return 0, err
 	}
 
 	switch plan.Status.ClusterSchedulingStatuses[cluster.Name].State {
 	case "":
-		return r.installOrUpgradeClusterAgent(ctx, plan, cluster, false)
+		return 0, r.installOrUpgradeClusterAgent(ctx, plan, cluster, false)
 	case corev1alpha1.StateInstallFailed:
 		// upgrade after configuration changes
-		if configChanged(plan, cluster.Name) || versionChanged(plan, cluster.Name) {
-			return r.installOrUpgradeClusterAgent(ctx, plan, cluster, false)
+		if !held && (configChanged(plan, cluster.Name) || versionChanged(plan, cluster.Name)) {
+			return 0, r.installOrUpgradeClusterAgent(ctx, plan, cluster, false)
 		}
-	case corev1alpha1.StatePreparing, corev1alpha1.StateInstalling, corev1alpha1.StateUpgrading:
+	case corev1alpha1.StatePreparing, corev1alpha1.StateInstalling, corev1alpha1.StateUpgrading, corev1alpha1.StateRollingBack:
 		// waiting for the installation to complete
-		return nil
-	case corev1alpha1.StateDeployed, corev1alpha1.StateUpgradeFailed:
+		return 0, nil
+	case corev1alpha1.StateDeployed, corev1alpha1.StateUpgradeFailed, corev1alpha1.StateRollbackFailed:
 		// upgrade after configuration changes
-		if configChanged(plan, cluster.Name) || versionChanged(plan, cluster.Name) {
-			return r.installOrUpgradeClusterAgent(ctx, plan, cluster, true)
+		if !held && (configChanged(plan, cluster.Name) || versionChanged(plan, cluster.Name)) {
+			return 0, r.installOrUpgradeClusterAgent(ctx, plan, cluster, true)
 		}
 	}
 
 	if plan.Status.ClusterSchedulingStatuses[cluster.Name].State == corev1alpha1.StateDeployed {
 		clusterClient, err := r.clusterClientSet.GetRuntimeClient(cluster.Name)
 		if err != nil {
-			return fmt.Errorf("failed to get cluster client: %v", err)
+			return 0, fmt.Errorf("failed to get cluster client: %v", err)
 		}
 
 		if err := r.syncExtendedAPIStatus(ctx, clusterClient, plan); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return nil
+	return requeueAfter, nil
 }
 
 func (r *InstallPlanReconciler) installOrUpgradeExtension(ctx context.Context, plan *corev1alpha1.InstallPlan, upgrade bool) error {
@@ -1106,7 +1426,7 @@ func (r *InstallPlanReconciler) installOrUpgradeExtension(ctx context.Context, p
 		return r.updateInstallPlan(ctx, plan)
 	}
 
-	chartData, caBundle, err := r.loadChartDataAndCABundle(ctx)
+	chartData, caBundle, err := r.loadChartDataAndCABundle(ctx, &plan.Status.InstallationStatus)
 	if err != nil {
 		return onFailed(err)
 	}
@@ -1162,12 +1482,16 @@ func (r *InstallPlanReconciler) installOrUpgradeExtension(ctx context.Context, p
 		return onFailed(fmt.Errorf("failed to create executor job: %v", err))
 	}
 
+	var message string
+	if upgrade && plan.Annotations[corev1alpha1.AutomaticUpgradeAnnotation] == extensionVersion.Spec.Version {
+		message = fmt.Sprintf("Upgrading automatically from %s to %s.", plan.Status.Version, extensionVersion.Spec.Version)
+	}
 	plan.Status.ConfigHash = hashutil.FNVString(values)
 	plan.Status.Version = extensionVersion.Spec.Version
 	plan.Status.ReleaseName = releaseName
 	plan.Status.JobName = jobName
 	if upgrade {
-		updateStateAndConditions(&plan.Status.InstallationStatus, corev1alpha1.StateUpgrading, "", time.Now())
+		updateStateAndConditions(&plan.Status.InstallationStatus, corev1alpha1.StateUpgrading, message, time.Now())
 	} else {
 		updateStateAndConditions(&plan.Status.InstallationStatus, corev1alpha1.StateInstalling, "", time.Now())
 	}
@@ -1298,7 +1622,7 @@ func (r *InstallPlanReconciler) installOrUpgradeClusterAgent(ctx context.Context
 		return r.updateInstallPlan(ctx, plan)
 	}
 
-	chartData, caBundle, err := r.loadChartDataAndCABundle(ctx)
+	chartData, caBundle, err := r.loadChartDataAndCABundle(ctx, &installationStatus)
 	if err != nil {
 		return onFailed(fmt.Errorf("failed to load chart data: %v", err))
 	}
@@ -1361,6 +1685,7 @@ func (r *InstallPlanReconciler) installOrUpgradeClusterAgent(ctx context.Context
 	installationStatus.ConfigHash = hashutil.FNVString(values)
 	installationStatus.ReleaseName = releaseName
 	installationStatus.Version = extensionVersion.Spec.Version
+	installationStatus.RolledBackVersion = ""
 	installationStatus.TargetNamespace = targetNamespace
 	installationStatus.JobName = jobName
 	if upgrade {
@@ -1524,7 +1849,7 @@ func updateStateAndConditions(installationStatus *corev1alpha1.InstallationStatu
 		fixedState = corev1alpha1.StateDeployed
 	}
 
-	if updateState(installationStatus, fixedState, lastTransitionTime) {
+	if updateState(installationStatus, fixedState, message, lastTransitionTime) {
 		switch state {
 		case corev1alpha1.StateInstalled:
 			updateCondition(installationStatus, corev1alpha1.ConditionTypeInstalled, installSuccessful, message, metav1.ConditionTrue, lastTransitionTime)
@@ -1581,6 +1906,8 @@ func (r *InstallPlanReconciler) syncInstallationStatus(ctx context.Context, kube
 				updateStateAndConditions(installationStatus, corev1alpha1.StateUpgradeFailed, condition.Message, lastTransitionTime)
 			case helm.ActionUninstall:
 				updateStateAndConditions(installationStatus, corev1alpha1.StateUninstallFailed, condition.Message, lastTransitionTime)
+			case helm.ActionRollback:
+				updateStateAndConditions(installationStatus, corev1alpha1.StateRollbackFailed, condition.Message, lastTransitionTime)
 			}
 		}
 
@@ -1597,6 +1924,8 @@ func (r *InstallPlanReconciler) syncInstallationStatus(ctx context.Context, kube
 				updateStateAndConditions(installationStatus, corev1alpha1.StateUpgrading, "", lastTransitionTime)
 			case helm.ActionUninstall:
 				updateStateAndConditions(installationStatus, corev1alpha1.StateUninstalling, "", lastTransitionTime)
+			case helm.ActionRollback:
+				updateStateAndConditions(installationStatus, corev1alpha1.StateRollingBack, "", lastTransitionTime)
 			}
 		}
 	}
@@ -1619,8 +1948,10 @@ func (r *InstallPlanReconciler) syncInstallationStatus(ctx context.Context, kube
 			}
 		case helmrelease.StatusPendingInstall:
 			updateStateAndConditions(installationStatus, corev1alpha1.StateInstalling, release.Info.Description, release.Info.LastDeployed.Time)
-		case helmrelease.StatusPendingRollback, helmrelease.StatusPendingUpgrade:
+		case helmrelease.StatusPendingUpgrade:
 			updateStateAndConditions(installationStatus, corev1alpha1.StateUpgrading, release.Info.Description, release.Info.LastDeployed.Time)
+		case helmrelease.StatusPendingRollback:
+			updateStateAndConditions(installationStatus, corev1alpha1.StateRollingBack, release.Info.Description, release.Info.LastDeployed.Time)
 		case helmrelease.StatusUninstalling:
 			updateStateAndConditions(installationStatus, corev1alpha1.StateUninstalling, release.Info.Description, release.Info.LastDeployed.Time)
 		case helmrelease.StatusUninstalled:
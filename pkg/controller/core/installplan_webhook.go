@@ -10,13 +10,27 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
 	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
 
 	kscontroller "kubesphere.io/kubesphere/pkg/controller"
+	"kubesphere.io/kubesphere/pkg/controller/options"
+	"kubesphere.io/kubesphere/pkg/version"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -24,6 +38,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// chartFetchTimeout bounds the time to fetch the chart from the repository in the admission.
+const chartFetchTimeout = 5 * time.Second
+
 var _ admission.CustomValidator = &InstallPlanWebhook{}
 var _ kscontroller.Controller = &InstallPlanWebhook{}
 
@@ -33,6 +50,9 @@ func (r *InstallPlanWebhook) Name() string {
 
 type InstallPlanWebhook struct {
 	client.Client
+	PortalURL        string
+	ExtensionOptions *options.ExtensionOptions
+	k8sVersion       *semver.Version
 }
 
 func trimSpace(data string) string {
@@ -60,11 +80,40 @@ func (r *InstallPlanWebhook) Default(ctx context.Context, obj runtime.Object) er
 }
 
 func (r *InstallPlanWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	return r.validateInstallPlan(ctx, obj.(*corev1alpha1.InstallPlan))
+	installPlan := obj.(*corev1alpha1.InstallPlan)
+	if warnings, err := r.validateInstallPlan(ctx, installPlan); err != nil {
+		return warnings, err
+	}
+	warnings, err := r.validateConfig(ctx, installPlan)
+	if err != nil {
+		return warnings, err
+	}
+	dependencyWarnings, err := r.validateDependencies(ctx, installPlan)
+	return append(warnings, dependencyWarnings...), err
 }
 
-func (r *InstallPlanWebhook) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
-	return r.validateInstallPlan(ctx, newObj.(*corev1alpha1.InstallPlan))
+func (r *InstallPlanWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldInstallPlan := oldObj.(*corev1alpha1.InstallPlan)
+	installPlan := newObj.(*corev1alpha1.InstallPlan)
+	if warnings, err := r.validateInstallPlan(ctx, installPlan); err != nil {
+		return warnings, err
+	}
+	var warnings admission.Warnings
+	// The config only needs to be validated when it or the version changes.
+	if oldInstallPlan.Spec.Extension.Version != installPlan.Spec.Extension.Version ||
+		oldInstallPlan.Spec.Config != installPlan.Spec.Config ||
+		!reflect.DeepEqual(clusterOverrides(oldInstallPlan), clusterOverrides(installPlan)) {
+		var err error
+		if warnings, err = r.validateConfig(ctx, installPlan); err != nil {
+			return warnings, err
+		}
+	}
+	// The dependencies only need to be validated when the version changes.
+	if oldInstallPlan.Spec.Extension.Version == installPlan.Spec.Extension.Version {
+		return warnings, nil
+	}
+	dependencyWarnings, err := r.validateDependencies(ctx, installPlan)
+	return append(warnings, dependencyWarnings...), err
 }
 
 func (r *InstallPlanWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
@@ -89,7 +138,161 @@ func (r *InstallPlanWebhook) validateInstallPlan(_ context.Context, installPlan
 	return nil, nil
 }
 
+func clusterOverrides(installPlan *corev1alpha1.InstallPlan) map[string]string {
+	if installPlan.Spec.ClusterScheduling == nil {
+		return nil
+	}
+	return installPlan.Spec.ClusterScheduling.Overrides
+}
+
+// validateConfig validates the values of the extension release and the agent releases against the values.schema.json
+// of the chart, the values are built with the same overrides as the InstallPlanReconciler.
+func (r *InstallPlanWebhook) validateConfig(ctx context.Context, installPlan *corev1alpha1.InstallPlan) (admission.Warnings, error) {
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	extensionVersionName := fmt.Sprintf("%s-%s", installPlan.Spec.Extension.Name, installPlan.Spec.Extension.Version)
+	if err := r.Get(ctx, types.NamespacedName{Name: extensionVersionName}, extensionVersion); err != nil {
+		// The extension version will be checked by the InstallPlanReconciler.
+		return nil, client.IgnoreNotFound(err)
+	}
+	// The chart may be fetched from the repository, which must not block the admission for long.
+	fetchCtx, cancel := context.WithTimeout(ctx, chartFetchTimeout)
+	defer cancel()
+	data, err := fetchChartData(fetchCtx, r.Client, extensionVersion)
+	if err != nil {
+		// The chart may be temporarily unavailable, the InstallPlanReconciler will retry it.
+		return admission.Warnings{fmt.Sprintf("the config is not validated, failed to fetch the chart: %v", err)}, nil
+	}
+	// The dependencies of the chart are processed in place, so the chart is loaded for each validation.
+	loadChart := func() (*chart.Chart, error) {
+		mainChart, err := loader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chart data: %v", err)
+		}
+		return mainChart, nil
+	}
+	mainChart, err := loadChart()
+	if err != nil {
+		return nil, err
+	}
+	overrider := &InstallPlanReconciler{PortalURL: r.PortalURL, ExtensionOptions: r.ExtensionOptions}
+
+	configPath := field.NewPath("spec", "config")
+	overrides := overrider.getOverrides(mainChart, tagExtension, nil)
+	allErrs := validateConfig(mainChart, []byte(installPlan.Spec.Config), overrides, configPath)
+	if installPlan.Spec.ClusterScheduling != nil {
+		reported := sets.New[string]()
+		for _, err := range allErrs {
+			reported.Insert(strings.TrimPrefix(err.Error(), configPath.String()))
+		}
+		// The agents in the clusters without overrides share the same values except the cluster name and role.
+		agentConfigs := map[string][]byte{"": []byte(installPlan.Spec.Config)}
+		for cluster := range clusterOverrides(installPlan) {
+			agentConfigs[cluster] = clusterConfig(installPlan, cluster)
+		}
+		for _, clusterName := range slices.Sorted(maps.Keys(agentConfigs)) {
+			var cluster *clusterv1alpha1.Cluster
+			fldPath := configPath
+			if clusterName != "" {
+				if cluster, err = r.getCluster(ctx, clusterName); err != nil {
+					return nil, err
+				}
+				fldPath = field.NewPath("spec", "clusterScheduling", "overrides").Key(clusterName)
+			}
+			agentChart, err := loadChart()
+			if err != nil {
+				return nil, err
+			}
+			overrides = overrider.getOverrides(agentChart, tagAgent, cluster)
+			for _, err := range validateConfig(agentChart, agentConfigs[clusterName], overrides, configPath) {
+				// The errors inherited from the config have been reported.
+				if reported.Has(strings.TrimPrefix(err.Error(), configPath.String())) {
+					continue
+				}
+				if clusterName == "" {
+					reported.Insert(strings.TrimPrefix(err.Error(), configPath.String()))
+				}
+				err.Field = fldPath.String() + strings.TrimPrefix(err.Field, configPath.String())
+				allErrs = append(allErrs, err)
+			}
+		}
+	}
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(corev1alpha1.SchemeGroupVersion.WithKind(corev1alpha1.ResourceKindInstallPlan).GroupKind(),
+			installPlan.Name, allErrs)
+	}
+	return nil, nil
+}
+
+// getCluster returns the cluster, the cluster that does not exist is treated as a member cluster.
+func (r *InstallPlanWebhook) getCluster(ctx context.Context, name string) (*clusterv1alpha1.Cluster, error) {
+	cluster := &clusterv1alpha1.Cluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, cluster); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get cluster %s: %v", name, err)
+		}
+		cluster.Name = name
+	}
+	return cluster, nil
+}
+
+// validateDependencies rejects the InstallPlan if its required dependencies can not be satisfied.
+func (r *InstallPlanWebhook) validateDependencies(ctx context.Context, installPlan *corev1alpha1.InstallPlan) (admission.Warnings, error) {
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	extensionVersionName := fmt.Sprintf("%s-%s", installPlan.Spec.Extension.Name, installPlan.Spec.Extension.Version)
+	if err := r.Get(ctx, types.NamespacedName{Name: extensionVersionName}, extensionVersion); err != nil {
+		// The extension version will be checked by the InstallPlanReconciler.
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	plans, err := installPlansByExtension(ctx, r.Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list install plans: %v", err)
+	}
+
+	var warnings admission.Warnings
+	for _, dependency := range extensionVersion.Spec.ExternalDependencies {
+		if dependency.Required || !isExtensionDependency(dependency) {
+			continue
+		}
+		if plan, ok := plans[dependency.Name]; ok {
+			if satisfied, _ := dependencySatisfied(dependency, plan.Spec.Extension.Version); !satisfied {
+				warnings = append(warnings, fmt.Sprintf("the optional dependency %s %s is not satisfied by the version %s",
+					dependency.Name, dependency.Version, plan.Spec.Extension.Version))
+			}
+		}
+	}
+
+	missing, err := checkDependencies(requiredDependencies(extensionVersion), plans)
+	if err != nil {
+		return warnings, err
+	}
+	if len(missing) == 0 {
+		return warnings, nil
+	}
+	if installPlan.Annotations[corev1alpha1.InstallDependenciesAnnotation] != "true" {
+		return warnings, fmt.Errorf("the required extensions are not installed: %s, set the annotation %s=true to install them automatically",
+			describeDependencies(missing), corev1alpha1.InstallDependenciesAnnotation)
+	}
+	ksVersion, err := semver.NewVersion(version.Get().GitVersion)
+	if err != nil {
+		return warnings, fmt.Errorf("failed to parse KS version %s: %v", version.Get().GitVersion, err)
+	}
+	refs, err := newDependencyResolver(r.Client, plans, r.k8sVersion, ksVersion).resolve(ctx, installPlan.Spec.Extension.Name, extensionVersion)
+	if err != nil {
+		return warnings, err
+	}
+	for _, ref := range refs {
+		warnings = append(warnings, fmt.Sprintf("the dependency %s %s will be installed automatically", ref.Name, ref.Version))
+	}
+	return warnings, nil
+}
+
 func (r *InstallPlanWebhook) SetupWithManager(mgr *kscontroller.Manager) error {
+	if mgr.AuthenticationOptions != nil && mgr.Options.AuthenticationOptions.Issuer != nil {
+		r.PortalURL = mgr.Options.AuthenticationOptions.Issuer.URL
+	}
+	r.ExtensionOptions = mgr.ExtensionOptions
+	r.k8sVersion = mgr.K8sVersion
 	r.Client = mgr.GetClient()
 	return ctrl.NewWebhookManagedBy(mgr).
 		WithValidator(r).
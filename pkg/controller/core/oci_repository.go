@@ -0,0 +1,240 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"kubesphere.io/utils/helm"
+	orasregistry "oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/oci"
+)
+
+// ociChart is the chart pulled from an OCI registry, cached by the manifest digest since the tags are mutable.
+type ociChart struct {
+	meta    *chart.Metadata
+	created time.Time
+	digest  string
+	data    []byte
+}
+
+// loadOCIRepoIndex builds the repo index from an OCI registry, each repository under the path of the
+// repo URL is an extension and the semver tags are its versions. Only the latest versions limited by
+// the depth of the Repository are pulled, the chart data is returned by the chart URL to avoid pulling again.
+// The tags are resolved to the manifest digests, the charts in the cache are not pulled again, the cache is
+// optional. The tags failed to pull are skipped and recorded in the result.
+func loadOCIRepoIndex(ctx context.Context, repo *corev1alpha1.Repository, cache *lru.Cache, result *repositorySyncResult) (*helmrepo.IndexFile, map[string][]byte, error) {
+	logger := klog.FromContext(ctx)
+	repoURL, err := url.Parse(repo.Spec.URL)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to parse repo URL")
+	}
+
+	tlsConf, err := helm.NewTLSConfig(repo.Spec.CABundle, repo.Spec.Insecure)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to create tls config")
+	}
+	tlsConf.ServerName = repoURL.Hostname()
+
+	timeout := defaultRegistryPollTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	var username, password string
+	if repo.Spec.BasicAuth != nil {
+		username, password = repo.Spec.BasicAuth.Username, repo.Spec.BasicAuth.Password
+	}
+
+	reg, err := oci.NewRegistry(repoURL.Host,
+		oci.WithTimeout(timeout),
+		oci.WithBasicAuth(username, password),
+		oci.WithTLSConfig(tlsConf))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to connect to registry %s", repoURL.Host)
+	}
+
+	repoPath := strings.Trim(repoURL.Path, "/")
+	repositories, err := listOCIRepositories(ctx, reg, repoPath, repo.Spec.Repositories)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConf, Proxy: http.ProxyFromEnvironment},
+	}
+	authorizer := auth.Client{Client: httpClient}
+	if username != "" || password != "" {
+		authorizer.Credential = auth.StaticCredential(repoURL.Host, auth.Credential{Username: username, Password: password})
+	}
+	opts := []registry.ClientOption{registry.ClientOptHTTPClient(httpClient), registry.ClientOptAuthorizer(authorizer)}
+	if reg.PlainHTTP {
+		opts = append(opts, registry.ClientOptPlainHTTP())
+	}
+	client, err := registry.NewClient(opts...)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to create registry client")
+	}
+
+	index := helmrepo.NewIndexFile()
+	chartData := make(map[string][]byte)
+	for _, repository := range repositories {
+		ref := fmt.Sprintf("%s/%s", repoURL.Host, repository)
+		// The tags are valid semantic versions in descending order.
+		versions, err := client.Tags(ref)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to list tags of %s", ref)
+		}
+		versions = versions[:repositoryDepth(repo.Spec.Depth, len(versions))]
+		remoteRepo := &remote.Repository{
+			Client:    &authorizer,
+			Reference: orasregistry.Reference{Registry: repoURL.Host, Repository: repository},
+			PlainHTTP: reg.PlainHTTP,
+		}
+		for _, version := range versions {
+			// Helm replaces the plus sign of the version with underscore in OCI tags.
+			tag := strings.ReplaceAll(version, "+", "_")
+			pullRef := fmt.Sprintf("%s:%s", ref, tag)
+			pulled, err := pullOCIChart(ctx, client, remoteRepo, tag, cache)
+			if err != nil {
+				logger.Error(err, "failed to pull chart", "ref", pullRef)
+				// Each repository is an extension, the chart name is not known without the chart.
+				result.addError(path.Base(repository), version, "failed to pull chart %s: %v", pullRef, err)
+				continue
+			}
+			chartURL := fmt.Sprintf("%s://%s", registry.OCIScheme, pullRef)
+			index.Entries[pulled.meta.Name] = append(index.Entries[pulled.meta.Name], &helmrepo.ChartVersion{
+				Metadata: pulled.meta,
+				URLs:     []string{chartURL},
+				Created:  pulled.created,
+				Digest:   pulled.digest,
+			})
+			chartData[chartURL] = pulled.data
+		}
+	}
+	index.SortEntries()
+	return index, chartData, nil
+}
+
+// listOCIRepositories returns the repositories under the path of the registry. The repositories specified
+// take precedence, otherwise they are listed by the Harbor project API, which falls back to the catalog API
+// if the registry is not Harbor. Docker Hub and GHCR serve neither of them.
+func listOCIRepositories(ctx context.Context, reg *oci.Registry, repoPath string, specified []string) ([]string, error) {
+	if len(specified) > 0 {
+		repositories := make([]string, 0, len(specified))
+		for _, name := range specified {
+			repositories = append(repositories, path.Join(repoPath, strings.Trim(name, "/")))
+		}
+		return repositories, nil
+	}
+
+	var repositories []string
+	collect := func(repos []string) error {
+		repositories = append(repositories, ociSubRepositories(repoPath, repos)...)
+		return nil
+	}
+	if project, _, _ := strings.Cut(repoPath, "/"); project != "" {
+		err := reg.HarborRepositories(ctx, project, collect)
+		if err == nil {
+			return repositories, nil
+		}
+		klog.FromContext(ctx).V(4).Info("failed to list repositories by the Harbor API, fall back to the catalog API", "project", project, "error", err)
+		repositories = nil
+	}
+	if err := reg.Repositories(ctx, "", collect); err != nil {
+		return nil, errors.Wrapf(err, "failed to list repositories, specify them in spec.repositories if the catalog API is not served by the registry")
+	}
+	return repositories, nil
+}
+
+// pullOCIChart resolves the tag to the manifest digest and pulls the chart by the digest if it is not cached.
+func pullOCIChart(ctx context.Context, client *registry.Client, repo *remote.Repository, tag string, cache *lru.Cache) (*ociChart, error) {
+	desc, err := repo.Resolve(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	digestRef := fmt.Sprintf("%s@%s", repo.Reference, desc.Digest)
+	if cache != nil {
+		if cached, ok := cache.Get(digestRef); ok {
+			return cached.(*ociChart), nil
+		}
+	}
+	result, err := client.Pull(digestRef)
+	if err != nil {
+		return nil, err
+	}
+	pulled := &ociChart{
+		meta:    result.Chart.Meta,
+		created: ociManifestCreated(result.Manifest.Data),
+		digest:  strings.TrimPrefix(result.Chart.Digest, "sha256:"),
+		data:    result.Chart.Data,
+	}
+	if cache != nil {
+		cache.Add(digestRef, pulled)
+	}
+	return pulled, nil
+}
+
+// ociSubRepositories returns the repositories directly under the path.
+func ociSubRepositories(repoPath string, repos []string) []string {
+	prefix := repoPath
+	if prefix != "" {
+		prefix = prefix + "/"
+	}
+	var repositories []string
+	for _, repo := range repos {
+		if name, found := strings.CutPrefix(repo, prefix); found && name != "" && !strings.Contains(name, "/") {
+			repositories = append(repositories, repo)
+		}
+	}
+	return repositories
+}
+
+// repositoryDepth returns the number of versions to be synchronized, see also filterExtensionVersions.
+func repositoryDepth(depth *int, length int) int {
+	end := length
+	if depth == nil {
+		end = corev1alpha1.DefaultRepositoryDepth
+	} else if *depth > 0 {
+		end = *depth
+	}
+	if end > length {
+		end = length
+	}
+	return end
+}
+
+func ociManifestCreated(data []byte) time.Time {
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return time.Time{}
+	}
+	created, err := time.Parse(time.RFC3339, manifest.Annotations[ocispec.AnnotationCreated])
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
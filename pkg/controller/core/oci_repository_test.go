@@ -0,0 +1,192 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/utils/lru"
+	"k8s.io/utils/ptr"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+)
+
+// fakeOCIRegistry serves the chart devops:1.0.0 under the project kubesphere, the catalog API and the Harbor
+// API are served optionally.
+type fakeOCIRegistry struct {
+	harbor  bool
+	catalog bool
+	// broken serves the tag 1.1.0 whose manifest is missing.
+	broken bool
+	// blobs is the number of the blobs fetched.
+	blobs     atomic.Int32
+	manifest  []byte
+	chartData []byte
+	content   map[digest.Digest][]byte
+}
+
+func newFakeOCIRegistry(t *testing.T, harbor, catalog bool) (*fakeOCIRegistry, string) {
+	chartData := newChartData(t)
+	config, err := json.Marshal(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "devops", Version: "1.0.0"})
+	assert.NoError(t, err)
+	descriptor := func(mediaType string, data []byte) ocispec.Descriptor {
+		return ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	}
+	manifest, err := json.Marshal(&ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Config:      descriptor(registry.ConfigMediaType, config),
+		Layers:      []ocispec.Descriptor{descriptor(registry.ChartLayerMediaType, chartData)},
+		Annotations: map[string]string{ocispec.AnnotationCreated: "2024-05-01T08:00:00Z"},
+	})
+	assert.NoError(t, err)
+	r := &fakeOCIRegistry{harbor: harbor, catalog: catalog, manifest: manifest, chartData: chartData, content: map[digest.Digest][]byte{
+		digest.FromBytes(config):    config,
+		digest.FromBytes(chartData): chartData,
+	}}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (r *fakeOCIRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	switch {
+	case path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case path == "/v2/_catalog":
+		if !r.catalog {
+			// Harbor restricts the catalog API to the system administrators.
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"repositories": {"kubesphere/devops", "library/nginx"}})
+	case path == "/api/v2.0/projects/kubesphere/repositories":
+		if !r.harbor {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"kubesphere/devops"}]`))
+	case path == "/v2/kubesphere/devops/tags/list":
+		if r.broken {
+			_, _ = w.Write([]byte(`{"name":"kubesphere/devops","tags":["1.0.0","1.1.0"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"kubesphere/devops","tags":["1.0.0"]}`))
+	case path == "/v2/kubesphere/devops/manifests/1.0.0" || path == "/v2/kubesphere/devops/manifests/"+digest.FromBytes(r.manifest).String():
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(r.manifest).String())
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.manifest)))
+		if req.Method != http.MethodHead {
+			_, _ = w.Write(r.manifest)
+		}
+	case strings.HasPrefix(path, "/v2/kubesphere/devops/blobs/"):
+		data, ok := r.content[digest.Digest(strings.TrimPrefix(path, "/v2/kubesphere/devops/blobs/"))]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.blobs.Add(1)
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestLoadOCIRepoIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		harbor       bool
+		catalog      bool
+		repositories []string
+		broken       bool
+		wantErr      bool
+	}{
+		{name: "harbor project API", harbor: true},
+		{name: "catalog API", catalog: true},
+		{name: "repositories specified", repositories: []string{"devops"}},
+		{name: "repositories not listed", wantErr: true},
+		{name: "tag failed to pull", harbor: true, broken: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, host := newFakeOCIRegistry(t, tt.harbor, tt.catalog)
+			fake.broken = tt.broken
+			repo := &corev1alpha1.Repository{Spec: corev1alpha1.RepositorySpec{
+				URL:          fmt.Sprintf("oci://%s/kubesphere", host),
+				Repositories: tt.repositories,
+			}}
+			cache := lru.New(ociChartCacheSize)
+			result := &repositorySyncResult{}
+			index, chartData, err := loadOCIRepoIndex(context.Background(), repo, cache, result)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "spec.repositories")
+				return
+			}
+			assert.NoError(t, err)
+			if tt.broken {
+				if assert.Len(t, result.errors, 1) {
+					assert.Equal(t, "devops", result.errors[0].Extension)
+					assert.Equal(t, "1.1.0", result.errors[0].Version)
+					assert.Contains(t, result.errors[0].Message, "failed to pull chart")
+				}
+			} else {
+				assert.Empty(t, result.errors)
+			}
+			chartURL := fmt.Sprintf("oci://%s/kubesphere/devops:1.0.0", host)
+			if assert.Len(t, index.Entries["devops"], 1) {
+				version := index.Entries["devops"][0]
+				assert.Equal(t, "1.0.0", version.Version)
+				assert.Equal(t, []string{chartURL}, version.URLs)
+				assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), version.Created)
+			}
+			assert.Equal(t, fake.chartData, chartData[chartURL])
+			assert.Equal(t, int32(2), fake.blobs.Load())
+
+			// The chart of the same digest is not pulled again.
+			_, chartData, err = loadOCIRepoIndex(context.Background(), repo, cache, &repositorySyncResult{})
+			assert.NoError(t, err)
+			assert.Equal(t, fake.chartData, chartData[chartURL])
+			assert.Equal(t, int32(2), fake.blobs.Load())
+		})
+	}
+}
+
+func TestOCISubRepositories(t *testing.T) {
+	repos := []string{"kubesphere/devops", "kubesphere/gateway", "kubesphere/charts/storage", "library/nginx"}
+	assert.Equal(t, []string{"kubesphere/devops", "kubesphere/gateway"}, ociSubRepositories("kubesphere", repos))
+	assert.Equal(t, []string{"kubesphere/charts/storage"}, ociSubRepositories("kubesphere/charts", repos))
+	assert.Nil(t, ociSubRepositories("", repos))
+}
+
+func TestRepositoryDepth(t *testing.T) {
+	assert.Equal(t, corev1alpha1.DefaultRepositoryDepth, repositoryDepth(nil, 10))
+	assert.Equal(t, 2, repositoryDepth(nil, 2))
+	assert.Equal(t, 10, repositoryDepth(ptr.To(0), 10))
+	assert.Equal(t, 1, repositoryDepth(ptr.To(1), 10))
+	assert.Equal(t, 3, repositoryDepth(ptr.To(5), 3))
+}
+
+func TestOCIManifestCreated(t *testing.T) {
+	created := ociManifestCreated([]byte(`{"annotations":{"org.opencontainers.image.created":"2024-05-01T08:00:00Z"}}`))
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), created)
+	assert.True(t, ociManifestCreated([]byte(`{}`)).IsZero())
+}
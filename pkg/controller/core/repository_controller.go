@@ -7,21 +7,27 @@
 package core
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/registry"
 	helmrepo "helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
 	"k8s.io/utils/ptr"
 	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
 	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
@@ -40,6 +46,9 @@ const (
 	minimumRegistryPollInterval = 15 * time.Minute
 	defaultRegistryPollTimeout  = 2 * time.Minute
 	extensionFileName           = "extension.yaml"
+	// maxRepositorySyncErrors limits the size of the repository status.
+	maxRepositorySyncErrors = 100
+	ociChartCacheSize       = 256
 )
 
 var extensionRepoConflict = errors.New("extension repo mismatch")
@@ -59,12 +68,15 @@ type RepositoryReconciler struct {
 	client.Client
 	recorder record.EventRecorder
 	logger   logr.Logger
+	// ociCharts caches the charts pulled from the OCI registries by the manifest digests.
+	ociCharts *lru.Cache
 }
 
 func (r *RepositoryReconciler) SetupWithManager(mgr *kscontroller.Manager) error {
 	r.Client = mgr.GetClient()
 	r.logger = ctrl.Log.WithName("controllers").WithName(repositoryController)
 	r.recorder = mgr.GetEventRecorderFor(repositoryController)
+	r.ociCharts = lru.New(ociChartCacheSize)
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(repositoryController).
 		For(&corev1alpha1.Repository{}).
@@ -113,7 +125,7 @@ func (r *RepositoryReconciler) createOrUpdateExtension(ctx context.Context, repo
 		originRepoName := extension.Labels[corev1alpha1.RepositoryReferenceLabel]
 		if originRepoName != "" && originRepoName != repo.Name {
 			logger.Error(extensionRepoConflict, "extension repo mismatch", "name", extension.Name, "origin", originRepoName, "current", repo.Name)
-			return extensionRepoConflict
+			return errors.Wrapf(extensionRepoConflict, "the extension is synchronized from the repository %s", originRepoName)
 		}
 		if extension.Labels == nil {
 			extension.Labels = make(map[string]string)
@@ -168,7 +180,51 @@ func (r *RepositoryReconciler) createOrUpdateExtensionVersion(ctx context.Contex
 	return nil
 }
 
-func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *corev1alpha1.Repository, timeout time.Duration) error {
+// repositorySyncResult records the extensions discovered, skipped and suspended in a synchronization,
+// and the errors of the skipped index entries.
+type repositorySyncResult struct {
+	discovered int
+	skipped    int
+	suspended  int
+	errors     []corev1alpha1.RepositorySyncError
+}
+
+func (s *repositorySyncResult) addError(extension, version, format string, args ...interface{}) {
+	s.errors = append(s.errors, corev1alpha1.RepositorySyncError{
+		Extension: extension,
+		Version:   version,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// applyTo records the result in the status of the repository, the Degraded condition is true if any error is recorded.
+func (s *repositorySyncResult) applyTo(status *corev1alpha1.RepositoryStatus) {
+	slices.SortFunc(s.errors, func(a, b corev1alpha1.RepositorySyncError) int {
+		return cmp.Or(cmp.Compare(a.Extension, b.Extension), cmp.Compare(a.Version, b.Version))
+	})
+	status.DiscoveredExtensions = s.discovered
+	status.SkippedExtensions = s.skipped
+	status.SuspendedExtensions = s.suspended
+	status.SyncErrors = s.errors
+	if len(status.SyncErrors) > maxRepositorySyncErrors {
+		status.SyncErrors = status.SyncErrors[:maxRepositorySyncErrors]
+	}
+
+	condition := metav1.Condition{
+		Type:    corev1alpha1.ConditionTypeDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "AllEntriesSynced",
+		Message: fmt.Sprintf("%d extensions synchronized", s.discovered-s.skipped),
+	}
+	if len(s.errors) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "EntriesSkipped"
+		condition.Message = fmt.Sprintf("%d extensions skipped, %d index entries are invalid", s.skipped, len(s.errors))
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *corev1alpha1.Repository, timeout time.Duration, result *repositorySyncResult) error {
 	logger := klog.FromContext(ctx)
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -183,15 +239,25 @@ func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *
 		return errors.Wrapf(err, "failed to parse repo URL")
 	}
 
-	index, err := helm.LoadRepoIndex(ctx, repo.Spec.URL, cred)
+	var index *helmrepo.IndexFile
+	// chartData is the chart data pulled while loading the index of OCI registries.
+	var chartData map[string][]byte
+	if registry.IsOCI(repo.Spec.URL) {
+		index, chartData, err = loadOCIRepoIndex(ctx, repo, r.ociCharts, result)
+	} else {
+		index, err = helm.LoadRepoIndex(ctx, repo.Spec.URL, cred)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "failed to load repo index")
 	}
 
+	result.discovered = len(index.Entries)
 	for extensionName, versions := range index.Entries {
 		// check extensionName
 		if errs := isValidExtensionName(extensionName); len(errs) > 0 {
 			logger.Info("invalid extension name", "extension", extensionName, "error", errs)
+			result.addError(extensionName, "", "invalid extension name: %s", strings.Join(errs, ", "))
+			result.skipped++
 			continue
 		}
 
@@ -199,12 +265,14 @@ func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *
 		for _, version := range versions {
 			if version.Name != extensionName {
 				logger.V(4).Info("extension name mismatch", "extension", extensionName, "version", version.Version)
+				result.addError(extensionName, version.Version, "chart name %s does not match the extension name", version.Name)
 				continue
 			}
 
 			chartURL := resolveChartURL(version, repoURL)
 			if chartURL == nil {
 				logger.V(4).Info("failed to resolve chart URL", "extension", extensionName, "version", version.Version)
+				result.addError(extensionName, version.Version, "failed to resolve chart URL %v", version.URLs)
 				continue
 			}
 
@@ -223,13 +291,23 @@ func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *
 				},
 			}
 
-			extensionVersionSpec, err := r.fetchExtensionVersionSpec(ctx, &extensionVersion)
+			var extensionVersionSpec corev1alpha1.ExtensionVersionSpec
+			if data, ok := chartData[chartURL.String()]; ok {
+				extensionVersionSpec, err = loadExtensionVersionSpec(ctx, &extensionVersion, data)
+			} else {
+				extensionVersionSpec, err = r.fetchExtensionVersionSpec(ctx, &extensionVersion)
+			}
 			if err != nil {
 				return errors.Wrapf(err, "failed to load extension version spec")
 			}
 
 			if extensionVersionSpec.Name != extensionName {
 				logger.V(4).Info("extension version name mismatch", "extension", extensionName, "version", version.Version)
+				result.addError(extensionName, version.Version, "extension name %s in %s does not match", extensionVersionSpec.Name, extensionFileName)
+				continue
+			}
+			if _, err = semver.NewVersion(extensionVersionSpec.Version); err != nil {
+				result.addError(extensionName, version.Version, "invalid version %s: %v", extensionVersionSpec.Version, err)
 				continue
 			}
 
@@ -247,12 +325,15 @@ func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *
 
 		filteredVersions := filterExtensionVersions(extensionVersions, repo.Spec.Depth)
 		if len(filteredVersions) == 0 {
+			result.skipped++
 			continue
 		}
 		// update extension of latest extensionVersion
 		extension, err := r.createOrUpdateExtension(ctx, repo, extensionName, ptr.To(filteredVersions[0]))
 		if err != nil {
 			if errors.Is(err, extensionRepoConflict) {
+				result.addError(extensionName, "", "%v", err)
+				result.skipped++
 				continue
 			}
 			return errors.Wrapf(err, "failed to create or update extension")
@@ -276,6 +357,7 @@ func (r *RepositoryReconciler) syncExtensionsFromURL(ctx context.Context, repo *
 
 	for _, extension := range extensions.Items {
 		if _, ok := index.Entries[extension.Name]; !ok {
+			result.suspended++
 			// remove all the extensionVersions if the extension is not in the index
 			if err := r.removeSuspendedExtensionVersion(ctx, repo.Name, extension.Name, []corev1alpha1.ExtensionVersion{}); err != nil {
 				return errors.Wrapf(err, "failed to remove suspended extension version")
@@ -323,13 +405,32 @@ func (r *RepositoryReconciler) reconcileRepository(ctx context.Context, repo *co
 
 	outOfSync := repo.Status.LastSyncTime == nil || time.Now().After(repo.Status.LastSyncTime.Add(registryPollInterval))
 	if outOfSync {
-		if err := r.syncExtensionsFromURL(ctx, repo, registryPollTimeout); err != nil {
+		result := &repositorySyncResult{}
+		if err := r.syncExtensionsFromURL(ctx, repo, registryPollTimeout, result); err != nil {
 			r.recorder.Eventf(repo, corev1.EventTypeWarning, kscontroller.SyncFailed, "failed to sync extensions from %s: %s", repoURL, err)
+			expected := repo.DeepCopy()
+			if meta.SetStatusCondition(&expected.Status.Conditions, metav1.Condition{
+				Type:    corev1alpha1.ConditionTypeSynced,
+				Status:  metav1.ConditionFalse,
+				Reason:  kscontroller.SyncFailed,
+				Message: err.Error(),
+			}) {
+				if updateErr := r.Update(ctx, expected); updateErr != nil {
+					logger.Error(updateErr, "failed to update repository status", "name", repo.Name)
+				}
+			}
 			return ctrl.Result{}, errors.Wrapf(err, "failed to sync extensions from %s", repoURL)
 		}
 		r.recorder.Eventf(repo, corev1.EventTypeNormal, kscontroller.Synced, "sync extensions from %s successfully", repoURL)
 		repo = repo.DeepCopy()
 		repo.Status.LastSyncTime = &metav1.Time{Time: time.Now()}
+		meta.SetStatusCondition(&repo.Status.Conditions, metav1.Condition{
+			Type:    corev1alpha1.ConditionTypeSynced,
+			Status:  metav1.ConditionTrue,
+			Reason:  kscontroller.Synced,
+			Message: fmt.Sprintf("sync extensions from %s successfully", repoURL),
+		})
+		result.applyTo(&repo.Status)
 		if err := r.Update(ctx, repo); err != nil {
 			return ctrl.Result{}, errors.Wrapf(err, "failed to update repository status")
 		}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+)
+
+func TestRepositorySyncResult(t *testing.T) {
+	status := &corev1alpha1.RepositoryStatus{}
+	result := &repositorySyncResult{discovered: 3}
+	result.applyTo(status)
+	assert.Equal(t, 3, status.DiscoveredExtensions)
+	assert.Empty(t, status.SyncErrors)
+	assert.True(t, meta.IsStatusConditionFalse(status.Conditions, corev1alpha1.ConditionTypeDegraded))
+
+	result = &repositorySyncResult{discovered: 3, skipped: 1, suspended: 2}
+	result.addError("devops", "1.0.0", "invalid version %s", "1.0.0")
+	result.addError("Invalid", "", "invalid extension name")
+	result.addError("devops", "0.9.0", "failed to resolve chart URL")
+	result.applyTo(status)
+	assert.Equal(t, 1, status.SkippedExtensions)
+	assert.Equal(t, 2, status.SuspendedExtensions)
+	assert.Equal(t, []corev1alpha1.RepositorySyncError{
+		{Extension: "Invalid", Message: "invalid extension name"},
+		{Extension: "devops", Version: "0.9.0", Message: "failed to resolve chart URL"},
+		{Extension: "devops", Version: "1.0.0", Message: "invalid version 1.0.0"},
+	}, status.SyncErrors)
+	condition := meta.FindStatusCondition(status.Conditions, corev1alpha1.ConditionTypeDegraded)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, "EntriesSkipped", condition.Reason)
+
+	result = &repositorySyncResult{}
+	for i := 0; i < maxRepositorySyncErrors+1; i++ {
+		result.addError(fmt.Sprintf("extension-%03d", i), "", "invalid")
+	}
+	result.applyTo(status)
+	assert.Len(t, status.SyncErrors, maxRepositorySyncErrors)
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"kubesphere.io/utils/helm"
+)
+
+const (
+	rollback          = "Rollback"
+	rollbackFailed    = "RollbackFailed"
+	resourcesReady    = "ResourcesReady"
+	resourcesNotReady = "ResourcesNotReady"
+
+	// the resources are checked without blocking the reconciliation, and checked again after the interval
+	resourcesReadyCheckTimeout = time.Second
+	resourcesReadyPollInterval = 5 * time.Second
+)
+
+// releaseRevisions converts the release history to the revisions recorded in the installation status.
+func releaseRevisions(releases []*helmrelease.Release) []corev1alpha1.ReleaseRevision {
+	revisions := make([]corev1alpha1.ReleaseRevision, 0, min(len(releases), corev1alpha1.MaxRevisionNum))
+	for _, release := range releases {
+		if len(revisions) == corev1alpha1.MaxRevisionNum {
+			break
+		}
+		revision := corev1alpha1.ReleaseRevision{Revision: release.Version}
+		if release.Chart != nil && release.Chart.Metadata != nil {
+			revision.Version = release.Chart.Metadata.Version
+		}
+		if release.Info != nil {
+			revision.Status = release.Info.Status.String()
+			revision.Description = release.Info.Description
+			revision.Updated = metav1.NewTime(release.Info.LastDeployed.Time)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions
+}
+
+// rollbackTarget returns the revision to roll back to, the latest revision that has been deployed
+// before the current revision is selected if the revision is not specified.
+func rollbackTarget(revisions []corev1alpha1.ReleaseRevision, revision int) *corev1alpha1.ReleaseRevision {
+	// The first one is the current revision.
+	for i := 1; i < len(revisions); i++ {
+		target := revisions[i]
+		if revision > 0 {
+			if target.Revision == revision {
+				return &target
+			}
+			continue
+		}
+		if target.Status == helmrelease.StatusDeployed.String() || target.Status == helmrelease.StatusSuperseded.String() {
+			return &target
+		}
+	}
+	return nil
+}
+
+// rollbackAttempted checks whether the release has been rolled back since the last upgrade.
+func rollbackAttempted(status *corev1alpha1.InstallationStatus) bool {
+	for i := len(status.StateHistory) - 1; i >= 0; i-- {
+		switch status.StateHistory[i].State {
+		case corev1alpha1.StateUpgrading:
+			return false
+		case corev1alpha1.StateRollingBack:
+			return true
+		}
+	}
+	return false
+}
+
+// syncRollback rolls back the release if it is requested in the spec, or if RollbackOnFailure is enabled and the
+// upgrade failed or the resources are not ready after the upgrade, returns true if the rollback has started, and the
+// duration to wait before checking the resources again. The version in the spec is changed to the version of the
+// target revision by the rollbacks in the host cluster, so that the extension will not be upgraded again. The agent
+// rolled back automatically only records the version in the status of its cluster, see versionChanged.
+func (r *InstallPlanReconciler) syncRollback(ctx context.Context, plan *corev1alpha1.InstallPlan, clusterName string, kubeConfig []byte) (bool, time.Duration, error) {
+	logger := klog.FromContext(ctx)
+	releaseName := plan.Spec.Extension.Name
+	status := plan.Status.InstallationStatus
+	if clusterName != "" {
+		releaseName = fmt.Sprintf(agentReleaseFormat, plan.Spec.Extension.Name)
+		status = plan.Status.ClusterSchedulingStatuses[clusterName]
+	}
+
+	executor, ok := ctx.Value(contextKeyExecutor{}).(helm.Executor)
+	if !ok {
+		return false, 0, fmt.Errorf("failed to get executor from context")
+	}
+
+	var revision int
+	// the reason of the automatic rollback
+	var reason string
+	switch {
+	case clusterName == "" && plan.Spec.Rollback != nil:
+		if status.State != corev1alpha1.StateDeployed &&
+			status.State != corev1alpha1.StateUpgradeFailed &&
+			status.State != corev1alpha1.StateRollbackFailed {
+			// waiting for the installation to complete
+			return false, 0, nil
+		}
+		revision = plan.Spec.Rollback.Revision
+	case plan.Spec.RollbackOnFailure && !configChanged(plan, clusterName) && !versionChanged(plan, clusterName) && !rollbackAttempted(&status):
+		switch status.State {
+		case corev1alpha1.StateUpgradeFailed:
+			reason = "the upgrade failed"
+		case corev1alpha1.StateDeployed:
+			notReady, requeueAfter, err := r.syncResourcesReady(ctx, executor, plan, clusterName, releaseName, kubeConfig)
+			if err != nil || !notReady {
+				return false, requeueAfter, err
+			}
+			reason = "the resources are not ready after the upgrade"
+		default:
+			return false, 0, nil
+		}
+	default:
+		return false, 0, nil
+	}
+	automatic := reason != ""
+
+	// The history is only fetched when a rollback is considered.
+	history, err := executor.History(ctx, releaseName, helm.SetKubeconfig(kubeConfig), helm.SetNamespace(plan.Status.TargetNamespace))
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get helm release history: %v", err)
+	}
+	revisions := releaseRevisions(history)
+	target := rollbackTarget(revisions, revision)
+	if target == nil {
+		logger.V(4).Info("no revision to roll back to", "cluster", clusterName, "revision", revision)
+		if !automatic {
+			r.recorder.Eventf(plan, corev1.EventTypeWarning, rollbackFailed, "No revision of the release %s to roll back to", releaseName)
+			return false, 0, r.updateRollbackSpec(ctx, plan, plan.Spec.Extension.Version)
+		}
+		return false, 0, nil
+	}
+
+	// the version rolled back from, which the agent is held back from
+	rolledBackVersion := plan.Spec.Extension.Version
+	if clusterName == "" {
+		if err := r.updateRollbackSpec(ctx, plan, target.Version); err != nil {
+			return false, 0, err
+		}
+	}
+
+	jobName, err := executor.Rollback(ctx, releaseName, target.Revision,
+		helm.SetKubeconfig(kubeConfig),
+		helm.SetNamespace(plan.Status.TargetNamespace),
+		helm.SetTimeout(r.HelmExecutorOptions.Timeout),
+		helm.SetHistoryMax(r.HelmExecutorOptions.HistoryMax),
+		helm.SetKubeAsUser(fmt.Sprintf("system:serviceaccount:%s:helm-executor.%s", plan.Status.TargetNamespace, plan.Spec.Extension.Name)))
+
+	status = plan.Status.InstallationStatus
+	if clusterName != "" {
+		status = plan.Status.ClusterSchedulingStatuses[clusterName]
+	}
+	status.Revisions = revisions
+	if err != nil {
+		logger.Error(err, "failed to roll back extension", "cluster", clusterName)
+		message := fmt.Sprintf("Failed to roll back extension: %s", err)
+		updateStateAndConditions(&status, corev1alpha1.StateRollbackFailed, message, time.Now())
+	} else {
+		message := fmt.Sprintf("Rolling back to revision %d (version %s).", target.Revision, target.Version)
+		if automatic {
+			message = fmt.Sprintf("Rolling back automatically to revision %d (version %s) because %s.", target.Revision, target.Version, reason)
+		}
+		status.Version = target.Version
+		status.JobName = jobName
+		if clusterName != "" {
+			status.RolledBackVersion = rolledBackVersion
+		}
+		updateStateAndConditions(&status, corev1alpha1.StateRollingBack, message, time.Now())
+		r.recorder.Eventf(plan, corev1.EventTypeNormal, rollback, "Rolling back release %s to revision %d", releaseName, target.Revision)
+	}
+	if clusterName != "" {
+		plan.Status.ClusterSchedulingStatuses[clusterName] = status
+	} else {
+		plan.Status.InstallationStatus = status
+	}
+	return err == nil, 0, r.updateInstallPlan(ctx, plan)
+}
+
+// syncResourcesReady checks the resources of the release after it is upgraded without blocking the reconciliation,
+// returns the duration to wait before checking them again if they are not ready yet. The result is recorded in the
+// Ready condition once the resources are ready or the helm timeout has passed since the upgrade, true is
+// returned if the resources are not ready by then.
+func (r *InstallPlanReconciler) syncResourcesReady(ctx context.Context, executor helm.Executor, plan *corev1alpha1.InstallPlan, clusterName, releaseName string, kubeConfig []byte) (bool, time.Duration, error) {
+	status := plan.Status.InstallationStatus
+	if clusterName != "" {
+		status = plan.Status.ClusterSchedulingStatuses[clusterName]
+	}
+	upgraded := meta.FindStatusCondition(status.Conditions, corev1alpha1.ConditionTypeUpgraded)
+	if upgraded == nil || upgraded.Status != metav1.ConditionTrue {
+		return false, 0, nil
+	}
+	if ready := meta.FindStatusCondition(status.Conditions, corev1alpha1.ConditionTypeReady); ready != nil &&
+		!ready.LastTransitionTime.Before(&upgraded.LastTransitionTime) {
+		// the resources have been checked since the upgrade
+		return ready.Status == metav1.ConditionFalse, 0, nil
+	}
+
+	ready, err := executor.WaitingForResourcesReady(ctx, releaseName, resourcesReadyCheckTimeout,
+		helm.SetKubeconfig(kubeConfig), helm.SetNamespace(plan.Status.TargetNamespace))
+	if err != nil && !errors.Is(err, helm.ErrorTimedOutToWaitResource) {
+		return false, 0, fmt.Errorf("failed to check whether the resources are ready: %v", err)
+	}
+	now := time.Now()
+	timeout := r.resourcesReadyTimeout()
+	if ready {
+		updateCondition(&status, corev1alpha1.ConditionTypeReady, resourcesReady, "", metav1.ConditionTrue, now)
+	} else if remaining := upgraded.LastTransitionTime.Add(timeout).Sub(now); remaining > 0 {
+		// waiting for the resources to be ready
+		return false, min(remaining, resourcesReadyPollInterval), nil
+	} else {
+		message := fmt.Sprintf("The resources of the release are not ready within %s after the upgrade.", timeout)
+		updateCondition(&status, corev1alpha1.ConditionTypeReady, resourcesNotReady, message, metav1.ConditionFalse, now)
+	}
+	if clusterName != "" {
+		plan.Status.ClusterSchedulingStatuses[clusterName] = status
+	} else {
+		plan.Status.InstallationStatus = status
+	}
+	return !ready, 0, r.updateInstallPlan(ctx, plan)
+}
+
+// resourcesReadyTimeout returns the time the resources are given to be ready after an upgrade,
+// it is the same as the timeout of the helm upgrade, which is at least helm.MinimumTimeout.
+func (r *InstallPlanReconciler) resourcesReadyTimeout() time.Duration {
+	if r.HelmExecutorOptions != nil && r.HelmExecutorOptions.Timeout > helm.MinimumTimeout {
+		return r.HelmExecutorOptions.Timeout
+	}
+	return helm.MinimumTimeout
+}
+
+// updateRollbackSpec removes the rollback request and changes the version of the extension in the spec.
+func (r *InstallPlanReconciler) updateRollbackSpec(ctx context.Context, plan *corev1alpha1.InstallPlan, version string) error {
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.Get(ctx, types.NamespacedName{Name: plan.Name}, plan); err != nil {
+			return err
+		}
+		if plan.Spec.Rollback == nil && plan.Spec.Extension.Version == version {
+			return nil
+		}
+		plan.Spec.Rollback = nil
+		plan.Spec.Extension.Version = version
+		return r.Update(ctx, plan)
+	}); err != nil {
+		return fmt.Errorf("failed to update install plan: %v", err)
+	}
+	return nil
+}
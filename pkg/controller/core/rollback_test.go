@@ -0,0 +1,268 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"kubesphere.io/utils/helm"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/controller/options"
+	"kubesphere.io/kubesphere/pkg/scheme"
+	"kubesphere.io/kubesphere/pkg/utils/hashutil"
+)
+
+func newRelease(revision int, version string, status helmrelease.Status) *helmrelease.Release {
+	return &helmrelease.Release{
+		Version: revision,
+		Chart:   &chart.Chart{Metadata: &chart.Metadata{Version: version}},
+		Info:    &helmrelease.Info{Status: status},
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	revisions := releaseRevisions([]*helmrelease.Release{
+		newRelease(4, "1.2.0", helmrelease.StatusFailed),
+		newRelease(3, "1.1.0", helmrelease.StatusDeployed),
+		newRelease(2, "1.1.0", helmrelease.StatusSuperseded),
+		newRelease(1, "1.0.0", helmrelease.StatusSuperseded),
+	})
+	assert.Equal(t, "deployed", revisions[1].Status)
+
+	tests := []struct {
+		name     string
+		revision int
+		expected *corev1alpha1.ReleaseRevision
+	}{
+		{
+			name:     "last deployed revision",
+			expected: &revisions[1],
+		},
+		{
+			name:     "specified revision",
+			revision: 1,
+			expected: &revisions[3],
+		},
+		{
+			name:     "current revision",
+			revision: 4,
+		},
+		{
+			name:     "revision not found",
+			revision: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rollbackTarget(revisions, tt.revision))
+		})
+	}
+
+	assert.Nil(t, rollbackTarget(revisions[:1], 0))
+}
+
+func TestRollbackAttempted(t *testing.T) {
+	status := &corev1alpha1.InstallationStatus{}
+	assert.False(t, rollbackAttempted(status))
+
+	status.StateHistory = []corev1alpha1.InstallPlanState{
+		{State: corev1alpha1.StateUpgrading},
+		{State: corev1alpha1.StateUpgradeFailed},
+	}
+	assert.False(t, rollbackAttempted(status))
+
+	status.StateHistory = append(status.StateHistory,
+		corev1alpha1.InstallPlanState{State: corev1alpha1.StateRollingBack},
+		corev1alpha1.InstallPlanState{State: corev1alpha1.StateUpgradeFailed})
+	assert.True(t, rollbackAttempted(status))
+
+	status.StateHistory = append(status.StateHistory, corev1alpha1.InstallPlanState{State: corev1alpha1.StateUpgrading})
+	assert.False(t, rollbackAttempted(status))
+}
+
+type fakeExecutor struct {
+	helm.Executor
+	ready      bool
+	waits      int
+	histories  int
+	rolledBack int
+}
+
+func (e *fakeExecutor) WaitingForResourcesReady(_ context.Context, _ string, _ time.Duration, _ ...helm.HelmOption) (bool, error) {
+	e.waits++
+	if !e.ready {
+		return false, helm.ErrorTimedOutToWaitResource
+	}
+	return true, nil
+}
+
+func (e *fakeExecutor) History(_ context.Context, _ string, _ ...helm.HelmOption) ([]*helmrelease.Release, error) {
+	e.histories++
+	return []*helmrelease.Release{
+		newRelease(2, "1.1.0", helmrelease.StatusDeployed),
+		newRelease(1, "1.0.0", helmrelease.StatusSuperseded),
+	}, nil
+}
+
+func (e *fakeExecutor) Rollback(_ context.Context, _ string, revision int, _ ...helm.HelmOption) (string, error) {
+	e.rolledBack = revision
+	return "demo-rollback", nil
+}
+
+func newUpgradedPlan(upgraded metav1.Time) *corev1alpha1.InstallPlan {
+	plan := &corev1alpha1.InstallPlan{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Spec: corev1alpha1.InstallPlanSpec{
+			Extension:         corev1alpha1.ExtensionRef{Name: "demo", Version: "1.1.0"},
+			RollbackOnFailure: true,
+		},
+	}
+	plan.Status.TargetNamespace = "extension-demo"
+	plan.Status.Version = "1.1.0"
+	plan.Status.State = corev1alpha1.StateDeployed
+	plan.Status.ConfigHash = hashutil.FNVString(clusterConfig(plan, ""))
+	plan.Status.StateHistory = []corev1alpha1.InstallPlanState{
+		{State: corev1alpha1.StateUpgrading},
+		{State: corev1alpha1.StateDeployed, LastTransitionTime: upgraded},
+	}
+	plan.Status.Conditions = []metav1.Condition{
+		{Type: corev1alpha1.ConditionTypeUpgraded, Status: metav1.ConditionTrue, LastTransitionTime: upgraded},
+	}
+	return plan
+}
+
+func newRollbackReconciler(plan *corev1alpha1.InstallPlan) *InstallPlanReconciler {
+	return &InstallPlanReconciler{
+		Client:              runtimefakeclient.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(plan.DeepCopy()).Build(),
+		recorder:            record.NewFakeRecorder(10),
+		HelmExecutorOptions: &options.HelmExecutorOptions{},
+	}
+}
+
+func TestSyncRollbackResourcesNotReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		ready    bool
+		upgraded time.Duration
+		timeout  time.Duration
+		started  bool
+		requeued bool
+	}{
+		{
+			name:     "resources are ready",
+			ready:    true,
+			upgraded: time.Minute,
+		},
+		{
+			name:     "resources are not ready yet",
+			upgraded: 0,
+			requeued: true,
+		},
+		{
+			name:     "resources are not ready within the minimum timeout",
+			upgraded: time.Minute,
+			requeued: true,
+		},
+		{
+			name:     "resources are not ready within the helm timeout",
+			upgraded: 10 * time.Minute,
+			timeout:  15 * time.Minute,
+			requeued: true,
+		},
+		{
+			name:     "resources are not ready",
+			upgraded: 10 * time.Minute,
+			started:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := newUpgradedPlan(metav1.NewTime(time.Now().Add(-tt.upgraded).Round(time.Second)))
+			r := newRollbackReconciler(plan)
+			r.HelmExecutorOptions.Timeout = tt.timeout
+			executor := &fakeExecutor{ready: tt.ready}
+			ctx := context.WithValue(context.Background(), contextKeyExecutor{}, helm.Executor(executor))
+
+			started, requeueAfter, err := r.syncRollback(ctx, plan, "", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.started, started)
+			ready := meta.FindStatusCondition(plan.Status.Conditions, corev1alpha1.ConditionTypeReady)
+			if tt.requeued {
+				// the resources are checked again without blocking the reconciliation
+				assert.Greater(t, requeueAfter, time.Duration(0))
+				assert.LessOrEqual(t, requeueAfter, resourcesReadyPollInterval)
+				assert.Nil(t, ready)
+				assert.Equal(t, 0, executor.histories)
+				return
+			}
+			assert.Zero(t, requeueAfter)
+			if !tt.started {
+				assert.Equal(t, metav1.ConditionTrue, ready.Status)
+				// the history is only fetched when a rollback is considered
+				assert.Equal(t, 0, executor.histories)
+				// the resources are checked once after the upgrade
+				_, _, err = r.syncRollback(ctx, plan, "", nil)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, executor.waits)
+				return
+			}
+			assert.Equal(t, metav1.ConditionFalse, ready.Status)
+			assert.Equal(t, 1, executor.rolledBack)
+			assert.Equal(t, "1.0.0", plan.Spec.Extension.Version)
+			assert.Equal(t, corev1alpha1.StateRollingBack, plan.Status.State)
+			assert.Len(t, plan.Status.Revisions, 2)
+		})
+	}
+}
+
+func TestSyncRollbackClusterAgent(t *testing.T) {
+	upgraded := metav1.NewTime(time.Now().Add(-time.Minute).Round(time.Second))
+	plan := newUpgradedPlan(upgraded)
+	plan.Spec.ClusterScheduling = &corev1alpha1.ClusterScheduling{}
+	plan.Status.ClusterSchedulingStatuses = map[string]corev1alpha1.InstallationStatus{
+		"member": {
+			State:        corev1alpha1.StateUpgradeFailed,
+			Version:      "1.1.0",
+			ConfigHash:   hashutil.FNVString(clusterConfig(plan, "member")),
+			StateHistory: []corev1alpha1.InstallPlanState{{State: corev1alpha1.StateUpgrading}, {State: corev1alpha1.StateUpgradeFailed}},
+		},
+	}
+	r := newRollbackReconciler(plan)
+	executor := &fakeExecutor{}
+	ctx := context.WithValue(context.Background(), contextKeyExecutor{}, helm.Executor(executor))
+
+	started, _, err := r.syncRollback(ctx, plan, "member", nil)
+	assert.NoError(t, err)
+	assert.True(t, started)
+	assert.Equal(t, 1, executor.rolledBack)
+
+	// the rollback of the agent is recorded in the status of its cluster only
+	assert.Equal(t, "1.1.0", plan.Spec.Extension.Version)
+	assert.Equal(t, corev1alpha1.StateDeployed, plan.Status.State)
+	status := plan.Status.ClusterSchedulingStatuses["member"]
+	assert.Equal(t, corev1alpha1.StateRollingBack, status.State)
+	assert.Equal(t, "1.0.0", status.Version)
+	assert.Equal(t, "1.1.0", status.RolledBackVersion)
+
+	// the agent is not upgraded to the version rolled back from again
+	status.State = corev1alpha1.StateDeployed
+	plan.Status.ClusterSchedulingStatuses["member"] = status
+	assert.False(t, versionChanged(plan, "member"))
+	assert.Equal(t, agentFailed, rolloutAgentState(plan, "member"))
+	plan.Spec.Extension.Version = "1.2.0"
+	assert.True(t, versionChanged(plan, "member"))
+}
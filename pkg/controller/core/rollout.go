@@ -0,0 +1,250 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	clusterv1alpha1 "kubesphere.io/api/cluster/v1alpha1"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+
+	clusterutils "kubesphere.io/kubesphere/pkg/controller/cluster/utils"
+	"kubesphere.io/kubesphere/pkg/utils/hashutil"
+)
+
+const (
+	rolloutHalted    = "RolloutHalted"
+	rolloutAborted   = "RolloutAborted"
+	rolloutCompleted = "RolloutCompleted"
+)
+
+type agentState int
+
+const (
+	// agentPending indicates that the agent is waiting to be upgraded to the revision.
+	agentPending agentState = iota
+	agentUpgrading
+	agentUpdated
+	agentFailed
+)
+
+// rolloutRevision returns the hash of the version and configuration rolled out to the member clusters.
+func rolloutRevision(plan *corev1alpha1.InstallPlan) string {
+	data, _ := json.Marshal(struct {
+		Version   string            `json:"version"`
+		Config    string            `json:"config"`
+		Overrides map[string]string `json:"overrides"`
+	}{plan.Spec.Extension.Version, plan.Spec.Config, plan.Spec.ClusterScheduling.Overrides})
+	return hashutil.FNVString(data)
+}
+
+// rolloutAgentState returns the state of the agent in the cluster with respect to the revision being rolled out.
+func rolloutAgentState(plan *corev1alpha1.InstallPlan, clusterName string) agentState {
+	state := plan.Status.ClusterSchedulingStatuses[clusterName].State
+	switch state {
+	case corev1alpha1.StateUnknown:
+		return agentPending
+	case corev1alpha1.StatePreparing, corev1alpha1.StateInstalling, corev1alpha1.StateUpgrading, corev1alpha1.StateRollingBack:
+		return agentUpgrading
+	}
+	if configChanged(plan, clusterName) || versionChanged(plan, clusterName) {
+		return agentPending
+	}
+	if plan.Status.ClusterSchedulingStatuses[clusterName].RolledBackVersion == plan.Spec.Extension.Version {
+		// the agent has been rolled back from the revision
+		return agentFailed
+	}
+	if state == corev1alpha1.StateDeployed {
+		return agentUpdated
+	}
+	return agentFailed
+}
+
+// rolloutBatches splits the clusters into batches, the canaries make up the first batch and
+// the other clusters are sorted by name.
+func rolloutBatches(strategy *corev1alpha1.RolloutStrategy, clusters []string) [][]string {
+	var batches [][]string
+	var canaries, others []string
+	for _, canary := range strategy.Canaries {
+		if slices.Contains(clusters, canary) {
+			canaries = append(canaries, canary)
+		}
+	}
+	if len(canaries) > 0 {
+		batches = append(batches, canaries)
+	}
+	for _, cluster := range clusters {
+		if !slices.Contains(canaries, cluster) {
+			others = append(others, cluster)
+		}
+	}
+	if len(others) == 0 {
+		return batches
+	}
+	slices.Sort(others)
+
+	batchSize := 1
+	if strategy.BatchSize != nil {
+		batchSize, _ = intstr.GetScaledValueFromIntOrPercent(strategy.BatchSize, len(others), true)
+		batchSize = max(batchSize, 1)
+	}
+	for start := 0; start < len(others); start += batchSize {
+		batches = append(batches, others[start:min(start+batchSize, len(others))])
+	}
+	return batches
+}
+
+// applyRolloutAction resumes or aborts the rollout, returns false if the action is not applicable to the phase.
+func applyRolloutAction(status *corev1alpha1.RolloutStatus, action string) bool {
+	switch action {
+	case corev1alpha1.RolloutActionResume:
+		switch status.Phase {
+		case corev1alpha1.RolloutPhasePaused:
+			// skip the remaining pause
+			status.LastBatchCompletionTime = nil
+		case corev1alpha1.RolloutPhaseHalted:
+			// accept the failures of the halted batch and move on to the next batch
+			status.Batch++
+			status.LastBatchCompletionTime = nil
+		default:
+			return false
+		}
+		status.Phase = corev1alpha1.RolloutPhaseProgressing
+		status.Message = "The rollout has been resumed."
+		return true
+	case corev1alpha1.RolloutActionAbort:
+		switch status.Phase {
+		case corev1alpha1.RolloutPhaseProgressing, corev1alpha1.RolloutPhasePaused, corev1alpha1.RolloutPhaseHalted:
+			status.Phase = corev1alpha1.RolloutPhaseAborted
+			status.Message = "The rollout has been aborted, the remaining clusters will not be upgraded."
+			return true
+		}
+	}
+	return false
+}
+
+// progressRollout advances the rollout with the states of the agents, returns the clusters allowed to be
+// upgraded and the duration to wait before upgrading the next batch.
+func progressRollout(strategy *corev1alpha1.RolloutStrategy, status *corev1alpha1.RolloutStatus,
+	batches [][]string, states map[string]agentState, now time.Time) (sets.Set[string], time.Duration) {
+	status.Batches = len(batches)
+	allowed := func(n int) sets.Set[string] {
+		clusters := sets.New[string]()
+		for _, batch := range batches[:min(n, len(batches))] {
+			clusters.Insert(batch...)
+		}
+		return clusters
+	}
+
+	switch status.Phase {
+	case corev1alpha1.RolloutPhaseHalted, corev1alpha1.RolloutPhaseAborted:
+		return allowed(status.Batch), 0
+	case corev1alpha1.RolloutPhaseCompleted:
+		return allowed(len(batches)), 0
+	}
+
+	for ; status.Batch < len(batches); status.Batch++ {
+		batch := batches[status.Batch]
+		status.Clusters = batch
+		completed := true
+		for _, cluster := range batch {
+			switch states[cluster] {
+			case agentFailed:
+				if strategy.HaltOnFailure {
+					status.Phase = corev1alpha1.RolloutPhaseHalted
+					status.Message = fmt.Sprintf("The rollout is halted because the agent in cluster %s failed to upgrade.", cluster)
+					return allowed(status.Batch), 0
+				}
+			case agentPending, agentUpgrading:
+				completed = false
+			}
+		}
+		if completed {
+			status.LastBatchCompletionTime = &metav1.Time{Time: now}
+			continue
+		}
+
+		if strategy.PauseBetweenBatches != nil && status.LastBatchCompletionTime != nil {
+			if remaining := status.LastBatchCompletionTime.Add(strategy.PauseBetweenBatches.Duration).Sub(now); remaining > 0 {
+				status.Phase = corev1alpha1.RolloutPhasePaused
+				status.Message = fmt.Sprintf("Waiting %s before upgrading batch %d/%d.", remaining.Round(time.Second), status.Batch+1, len(batches))
+				return allowed(status.Batch), remaining
+			}
+		}
+		status.Phase = corev1alpha1.RolloutPhaseProgressing
+		status.Message = fmt.Sprintf("Upgrading batch %d/%d.", status.Batch+1, len(batches))
+		return allowed(status.Batch + 1), 0
+	}
+
+	status.Phase = corev1alpha1.RolloutPhaseCompleted
+	status.Clusters = nil
+	status.Message = "All clusters have been upgraded."
+	return allowed(len(batches)), 0
+}
+
+// syncRollout updates the rollout status of the agents if the rollout strategy is specified, returns the clusters
+// that are not allowed to be upgraded yet and the duration to wait before upgrading the next batch.
+func (r *InstallPlanReconciler) syncRollout(ctx context.Context, plan *corev1alpha1.InstallPlan, targetClusters []clusterv1alpha1.Cluster) (sets.Set[string], time.Duration, error) {
+	strategy := plan.Spec.ClusterScheduling.RolloutStrategy
+	if strategy == nil {
+		if plan.Status.Rollout != nil {
+			plan.Status.Rollout = nil
+			return nil, 0, r.updateInstallPlan(ctx, plan)
+		}
+		return nil, 0, nil
+	}
+
+	status := plan.Status.Rollout.DeepCopy()
+	revision := rolloutRevision(plan)
+	if status == nil || status.Revision != revision {
+		status = &corev1alpha1.RolloutStatus{Phase: corev1alpha1.RolloutPhaseProgressing, Revision: revision}
+	}
+
+	if action, ok := plan.Annotations[corev1alpha1.RolloutActionAnnotation]; ok {
+		if !applyRolloutAction(status, action) {
+			klog.FromContext(ctx).V(4).Info("ignore rollout action", "action", action, "phase", status.Phase)
+		}
+		delete(plan.Annotations, corev1alpha1.RolloutActionAnnotation)
+	}
+
+	clusters := make([]string, 0, len(targetClusters))
+	states := make(map[string]agentState, len(targetClusters))
+	for _, cluster := range targetClusters {
+		if clusterutils.IsClusterSchedulable(&cluster) {
+			clusters = append(clusters, cluster.Name)
+			states[cluster.Name] = rolloutAgentState(plan, cluster.Name)
+		}
+	}
+
+	phase := status.Phase
+	allowed, requeueAfter := progressRollout(strategy, status, rolloutBatches(strategy, clusters), states, time.Now())
+	if phase != status.Phase {
+		switch status.Phase {
+		case corev1alpha1.RolloutPhaseHalted:
+			r.recorder.Event(plan, corev1.EventTypeWarning, rolloutHalted, status.Message)
+		case corev1alpha1.RolloutPhaseAborted:
+			r.recorder.Event(plan, corev1.EventTypeNormal, rolloutAborted, status.Message)
+		case corev1alpha1.RolloutPhaseCompleted:
+			r.recorder.Event(plan, corev1.EventTypeNormal, rolloutCompleted, status.Message)
+		}
+	}
+
+	plan.Status.Rollout = status
+	if err := r.updateInstallPlan(ctx, plan); err != nil {
+		return nil, 0, err
+	}
+	return sets.New(clusters...).Difference(allowed), requeueAfter, nil
+}
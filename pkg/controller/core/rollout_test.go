@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+)
+
+func TestRolloutBatches(t *testing.T) {
+	clusters := []string{"e", "d", "c", "b", "a"}
+	tests := []struct {
+		name     string
+		strategy *corev1alpha1.RolloutStrategy
+		expected [][]string
+	}{
+		{
+			name:     "default batch size",
+			strategy: &corev1alpha1.RolloutStrategy{},
+			expected: [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}},
+		},
+		{
+			name: "canaries",
+			strategy: &corev1alpha1.RolloutStrategy{
+				Canaries:  []string{"d", "x"},
+				BatchSize: &intstr.IntOrString{Type: intstr.Int, IntVal: 3},
+			},
+			expected: [][]string{{"d"}, {"a", "b", "c"}, {"e"}},
+		},
+		{
+			name: "percentage",
+			strategy: &corev1alpha1.RolloutStrategy{
+				BatchSize: &intstr.IntOrString{Type: intstr.String, StrVal: "50%"},
+			},
+			expected: [][]string{{"a", "b", "c"}, {"d", "e"}},
+		},
+		{
+			name: "all canaries",
+			strategy: &corev1alpha1.RolloutStrategy{
+				Canaries: clusters,
+			},
+			expected: [][]string{clusters},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rolloutBatches(tt.strategy, clusters))
+		})
+	}
+}
+
+func TestProgressRollout(t *testing.T) {
+	now := time.Now()
+	batches := [][]string{{"a"}, {"b", "c"}}
+	strategy := &corev1alpha1.RolloutStrategy{
+		PauseBetweenBatches: &metav1.Duration{Duration: time.Minute},
+		HaltOnFailure:       true,
+	}
+
+	status := &corev1alpha1.RolloutStatus{Phase: corev1alpha1.RolloutPhaseProgressing}
+	states := map[string]agentState{"a": agentPending, "b": agentPending, "c": agentPending}
+	allowed, requeueAfter := progressRollout(strategy, status, batches, states, now)
+	assert.Equal(t, sets.New("a"), allowed)
+	assert.Zero(t, requeueAfter)
+	assert.Equal(t, 0, status.Batch)
+	assert.Equal(t, 2, status.Batches)
+
+	states["a"] = agentUpdated
+	allowed, requeueAfter = progressRollout(strategy, status, batches, states, now)
+	assert.Equal(t, sets.New("a"), allowed)
+	assert.Equal(t, time.Minute, requeueAfter)
+	assert.Equal(t, corev1alpha1.RolloutPhasePaused, status.Phase)
+	assert.Equal(t, 1, status.Batch)
+
+	allowed, _ = progressRollout(strategy, status, batches, states, now.Add(time.Minute))
+	assert.Equal(t, sets.New("a", "b", "c"), allowed)
+	assert.Equal(t, corev1alpha1.RolloutPhaseProgressing, status.Phase)
+
+	states["b"], states["c"] = agentFailed, agentUpgrading
+	allowed, _ = progressRollout(strategy, status, batches, states, now.Add(time.Minute))
+	assert.Equal(t, sets.New("a"), allowed)
+	assert.Equal(t, corev1alpha1.RolloutPhaseHalted, status.Phase)
+
+	assert.True(t, applyRolloutAction(status, corev1alpha1.RolloutActionResume))
+	states["c"] = agentUpdated
+	allowed, _ = progressRollout(strategy, status, batches, states, now.Add(time.Minute))
+	assert.Equal(t, sets.New("a", "b", "c"), allowed)
+	assert.Equal(t, corev1alpha1.RolloutPhaseCompleted, status.Phase)
+	assert.False(t, applyRolloutAction(status, corev1alpha1.RolloutActionAbort))
+}
+
+func TestApplyRolloutAction(t *testing.T) {
+	status := &corev1alpha1.RolloutStatus{
+		Phase:                   corev1alpha1.RolloutPhasePaused,
+		Batch:                   1,
+		LastBatchCompletionTime: &metav1.Time{Time: time.Now()},
+	}
+	assert.True(t, applyRolloutAction(status, corev1alpha1.RolloutActionResume))
+	assert.Equal(t, corev1alpha1.RolloutPhaseProgressing, status.Phase)
+	assert.Equal(t, 1, status.Batch)
+	assert.Nil(t, status.LastBatchCompletionTime)
+
+	assert.False(t, applyRolloutAction(status, corev1alpha1.RolloutActionResume))
+	assert.True(t, applyRolloutAction(status, corev1alpha1.RolloutActionAbort))
+	assert.Equal(t, corev1alpha1.RolloutPhaseAborted, status.Phase)
+	assert.False(t, applyRolloutAction(status, corev1alpha1.RolloutActionResume))
+	assert.False(t, applyRolloutAction(status, "unknown"))
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChartSchema returns the values.schema.json of the extension version. The schemas of the subcharts are nested
+// under the properties named after the subcharts, so that it describes the whole config of the extension.
+func ChartSchema(ctx context.Context, client client.Reader, extensionVersion *corev1alpha1.ExtensionVersion) (map[string]interface{}, error) {
+	data, err := fetchChartData(ctx, client, extensionVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch chart data")
+	}
+	mainChart, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load chart data")
+	}
+	return chartSchema(mainChart)
+}
+
+func chartSchema(c *chart.Chart) (map[string]interface{}, error) {
+	schema := make(map[string]interface{})
+	if c.Schema != nil {
+		if err := json.Unmarshal(c.Schema, &schema); err != nil {
+			return nil, errors.Wrapf(err, "invalid values.schema.json in chart %s", c.Name())
+		}
+	}
+	for _, subchart := range c.Dependencies() {
+		subchartSchema, err := chartSchema(subchart)
+		if err != nil {
+			return nil, err
+		}
+		if len(subchartSchema) == 0 {
+			continue
+		}
+		properties, ok := schema["properties"].(map[string]interface{})
+		if !ok {
+			properties = make(map[string]interface{})
+			schema["properties"] = properties
+		}
+		// The schema of the parent chart takes precedence.
+		if _, ok = properties[subchart.Name()]; !ok {
+			properties[subchart.Name()] = subchartSchema
+		}
+	}
+	return schema, nil
+}
+
+// processValues builds the values from the config and the overrides like `helm upgrade --install --set`, the
+// overrides are parsed like the --set flag. The subcharts disabled by the conditions and tags are removed from
+// the chart in place.
+func processValues(mainChart *chart.Chart, config []byte, overrides []string) (map[string]interface{}, error) {
+	values, err := chartutil.ReadValues(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	if len(overrides) > 0 {
+		if err = strvals.ParseInto(strings.Join(overrides, ","), values); err != nil {
+			return nil, fmt.Errorf("failed to parse overrides: %v", err)
+		}
+	}
+	if err = chartutil.ProcessDependenciesWithMerge(mainChart, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// validateConfig builds the values with the overrides as the InstallPlanReconciler does, coalesces them with the
+// default values of the chart, and validates the result against the values.schema.json of the chart and its enabled
+// subcharts, the same as Helm does before installing a release. The chart is changed, so a fresh one is expected.
+func validateConfig(mainChart *chart.Chart, config []byte, overrides []string, fldPath *field.Path) field.ErrorList {
+	values, err := processValues(mainChart, config, overrides)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, string(config), err.Error())}
+	}
+	merged, err := chartutil.CoalesceValues(mainChart, values)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, string(config), err.Error())}
+	}
+	return validateValues(mainChart, merged, fldPath)
+}
+
+func validateValues(c *chart.Chart, values map[string]interface{}, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if c.Schema != nil {
+		allErrs = append(allErrs, validateAgainstSchema(c.Schema, values, fldPath)...)
+	}
+	for _, subchart := range c.Dependencies() {
+		if subchartValues, ok := values[subchart.Name()].(map[string]interface{}); ok {
+			allErrs = append(allErrs, validateValues(subchart, subchartValues, fldPath.Child(subchart.Name()))...)
+		}
+	}
+	return allErrs
+}
+
+func validateAgainstSchema(schema []byte, values map[string]interface{}, fldPath *field.Path) (allErrs field.ErrorList) {
+	// gojsonschema panics on some malformed schemas.
+	defer func() {
+		if r := recover(); r != nil {
+			allErrs = field.ErrorList{field.InternalError(fldPath, fmt.Errorf("unable to validate schema: %v", r))}
+		}
+	}()
+
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(valuesJSON))
+	if err != nil {
+		return field.ErrorList{field.InternalError(fldPath, fmt.Errorf("invalid values.schema.json: %v", err))}
+	}
+	for _, resultErr := range result.Errors() {
+		path := fldPath
+		if resultErr.Field() != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			for _, name := range strings.Split(resultErr.Field(), ".") {
+				path = path.Child(name)
+			}
+		}
+		allErrs = append(allErrs, field.Invalid(path, resultErr.Value(), resultErr.Description()))
+	}
+	return allErrs
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func newSchemaChart() *chart.Chart {
+	subchart := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "agent"},
+		Values:   map[string]interface{}{"enabled": true},
+		Schema:   []byte(`{"type": "object", "properties": {"enabled": {"type": "boolean"}}}`),
+	}
+	mainChart := &chart.Chart{
+		Metadata: &chart.Metadata{
+			Name:         "devops",
+			Dependencies: []*chart.Dependency{{Name: "agent", Tags: []string{tagAgent}}},
+		},
+		Values: map[string]interface{}{"replicas": 1, "image": map[string]interface{}{"tag": "v1.0.0"}},
+		Schema: []byte(`{
+  "type": "object",
+  "required": ["replicas"],
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "image": {"type": "object", "properties": {"tag": {"type": "string"}}}
+  }
+}`),
+	}
+	mainChart.AddDependency(subchart)
+	return mainChart
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		overrides []string
+		expected  []string
+	}{
+		{
+			name: "empty config",
+		},
+		{
+			name:   "valid config",
+			config: "replicas: 2\nagent:\n  enabled: false",
+		},
+		{
+			name:     "invalid type",
+			config:   "replicas: two",
+			expected: []string{"spec.config.replicas"},
+		},
+		{
+			name:     "nested fields",
+			config:   "replicas: 0\nimage:\n  tag: 1\nagent:\n  enabled: \"yes\"",
+			expected: []string{"spec.config.replicas", "spec.config.image.tag", "spec.config.agent.enabled"},
+		},
+		{
+			name:      "overrides",
+			config:    "replicas: 2",
+			overrides: []string{"replicas=0"},
+			expected:  []string{"spec.config.replicas"},
+		},
+		{
+			name:      "disabled subchart",
+			config:    "agent:\n  enabled: \"yes\"",
+			overrides: []string{"tags.agent=false"},
+		},
+		{
+			name:     "invalid yaml",
+			config:   "replicas: [",
+			expected: []string{"spec.config"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allErrs := validateConfig(newSchemaChart(), []byte(tt.config), tt.overrides, field.NewPath("spec", "config"))
+			var fields []string
+			for _, err := range allErrs {
+				fields = append(fields, err.Field)
+			}
+			assert.ElementsMatch(t, tt.expected, fields)
+		})
+	}
+}
+
+func TestChartSchema(t *testing.T) {
+	schema, err := chartSchema(newSchemaChart())
+	assert.NoError(t, err)
+	properties := schema["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "replicas")
+	assert.Equal(t, map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"enabled": map[string]interface{}{"type": "boolean"}},
+	}, properties["agent"])
+
+	schema, err = chartSchema(&chart.Chart{Metadata: &chart.Metadata{Name: "devops"}})
+	assert.NoError(t, err)
+	assert.Empty(t, schema)
+
+	_, err = chartSchema(&chart.Chart{Metadata: &chart.Metadata{Name: "devops"}, Schema: []byte("invalid")})
+	assert.Error(t, err)
+}
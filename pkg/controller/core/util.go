@@ -41,6 +41,7 @@ import (
 	"kubesphere.io/utils/helm"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"kubesphere.io/kubesphere/pkg/controller/options"
 	"kubesphere.io/kubesphere/pkg/utils/hashutil"
 	"kubesphere.io/kubesphere/pkg/version"
 )
@@ -97,6 +98,42 @@ func checkVersionConstraint(constraint string, version *semver.Version) bool {
 	return targetVersion.Check(version)
 }
 
+// untilMaintenanceWindow returns the duration to wait until the maintenance window opens,
+// zero means that the given time is within the window.
+func untilMaintenanceWindow(window *options.MaintenanceWindow, now time.Time) (time.Duration, error) {
+	if window == nil {
+		return 0, nil
+	}
+	schedule, err := window.Parse()
+	if err != nil {
+		return 0, err
+	}
+	days, location := schedule.Days, schedule.Location
+	start, end := schedule.Start, schedule.End
+
+	now = now.In(location)
+	wait := time.Duration(-1)
+	// The window may start on the previous day and end today.
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, location)
+		if len(days) > 0 && !days[day.Weekday()] {
+			continue
+		}
+		opening := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, location)
+		closing := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, location)
+		if !closing.After(opening) {
+			closing = closing.AddDate(0, 0, 1)
+		}
+		if !now.Before(opening) && now.Before(closing) {
+			return 0, nil
+		}
+		if opening.After(now) && (wait < 0 || opening.Sub(now) < wait) {
+			wait = opening.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
 // filterExtensionVersions filters and sorts a slice of ExtensionVersion objects based on semantic versioning.
 // It first validates and removes entries with invalid versions (non-semver format) and logs warnings for them.
 // The remaining entries are sorted in descending order by version (latest first).
@@ -158,6 +195,14 @@ func isReleaseNotFoundError(err error) bool {
 	return strings.Contains(err.Error(), driver.ErrReleaseNotFound.Error())
 }
 
+// extensionTargetNamespace returns the namespace where the extension is installed.
+func extensionTargetNamespace(extensionVersion *corev1alpha1.ExtensionVersion, extensionName string) string {
+	if extensionVersion.Spec.Namespace != "" {
+		return extensionVersion.Spec.Namespace
+	}
+	return fmt.Sprintf("extension-%s", extensionName)
+}
+
 func clusterConfig(sub *corev1alpha1.InstallPlan, clusterName string) []byte {
 	if clusterName == "" {
 		return []byte(sub.Spec.Config)
@@ -277,7 +322,12 @@ func versionChanged(plan *corev1alpha1.InstallPlan, cluster string) bool {
 	if cluster == "" {
 		oldVersion = plan.Status.Version
 	} else if plan.Status.ClusterSchedulingStatuses != nil {
-		oldVersion = plan.Status.ClusterSchedulingStatuses[cluster].Version
+		status := plan.Status.ClusterSchedulingStatuses[cluster]
+		if status.RolledBackVersion == plan.Spec.Extension.Version {
+			// the agent has been rolled back from the version automatically
+			return false
+		}
+		oldVersion = status.Version
 	}
 	newVersion := plan.Spec.Extension.Version
 	if oldVersion == "" {
@@ -314,12 +364,17 @@ func createHelmCredential(repo *corev1alpha1.Repository) (helm.RepoCredential, e
 }
 
 func fetchExtensionVersionSpec(ctx context.Context, client client.Reader, extensionVersion *corev1alpha1.ExtensionVersion) (corev1alpha1.ExtensionVersionSpec, error) {
-	extensionVersionSpec := extensionVersion.Spec
-	logger := klog.FromContext(ctx)
 	data, err := fetchChartData(ctx, client, extensionVersion)
 	if err != nil {
-		return extensionVersionSpec, errors.Wrapf(err, "failed to fetch chart data")
+		return extensionVersion.Spec, errors.Wrapf(err, "failed to fetch chart data")
 	}
+	return loadExtensionVersionSpec(ctx, extensionVersion, data)
+}
+
+// loadExtensionVersionSpec loads the extension version spec from the chart data.
+func loadExtensionVersionSpec(ctx context.Context, extensionVersion *corev1alpha1.ExtensionVersion, data []byte) (corev1alpha1.ExtensionVersionSpec, error) {
+	extensionVersionSpec := extensionVersion.Spec
+	logger := klog.FromContext(ctx)
 	helmChart, err := loader.LoadArchive(bytes.NewReader(data))
 	if err != nil {
 		return extensionVersionSpec, errors.Wrapf(err, "failed to load chart archive")
@@ -365,24 +420,14 @@ func fetchChartData(ctx context.Context, client client.Reader, extensionVersion
 		return fetchChartDataFromConfigMap(ctx, client, extensionVersion.Spec.ChartDataRef)
 	}
 
-	chartURL, err := url.Parse(extensionVersion.Spec.ChartURL)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to parse chart URL: %s", extensionVersion.Spec.ChartURL)
-	}
-
 	repo, err := fetchRepository(ctx, client, extensionVersion.Spec.Repository)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to fetch repository: %s", extensionVersion.Spec.Repository)
 	}
 
-	repoURL, err := url.Parse(repo.Spec.URL)
+	chartURL, err := parseChartURL(extensionVersion.Spec.ChartURL, repo)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to parse repo URL: %s", extensionVersion.Spec.ChartURL)
-	}
-
-	if chartURL.Host == "" {
-		chartURL.Scheme = repoURL.Scheme
-		chartURL.Host = repoURL.Host
+		return nil, err
 	}
 
 	transport, err := createTransport(repo, chartURL.Hostname())
@@ -391,12 +436,43 @@ func fetchChartData(ctx context.Context, client client.Reader, extensionVersion
 	}
 
 	opts := createGetterOptions(repo, transport)
+	// the getters do not accept a context, the deadline of the context is applied as the timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		opts = append(opts, getter.WithTimeout(time.Until(deadline)))
+	}
 	chartGetter, err := createChartGetter(chartURL.Scheme, opts)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create chart getter")
 	}
 
-	return getChartData(chartGetter, chartURL.String())
+	data, err := getChartData(chartGetter, chartURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifyDigest(data, extensionVersion.Spec.Digest); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseChartURL parses the chart URL, the relative URL is resolved against the repo URL.
+func parseChartURL(rawURL string, repo *corev1alpha1.Repository) (*url.URL, error) {
+	chartURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse chart URL: %s", rawURL)
+	}
+
+	repoURL, err := url.Parse(repo.Spec.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse repo URL: %s", repo.Spec.URL)
+	}
+
+	if chartURL.Host == "" {
+		chartURL.Scheme = repoURL.Scheme
+		chartURL.Host = repoURL.Host
+	}
+	return chartURL, nil
 }
 
 func fetchChartDataFromConfigMap(ctx context.Context, client client.Reader, ref *corev1alpha1.ConfigMapKeyRef) ([]byte, error) {
@@ -501,3 +577,11 @@ func isValidExtensionName(name string) []string {
 	}
 	return errs
 }
+
+// minRequeueAfter returns the shorter one of the durations to requeue, zero means not to requeue.
+func minRequeueAfter(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -8,6 +8,7 @@ package core
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/stretchr/testify/assert"
@@ -15,6 +16,7 @@ import (
 	"k8s.io/utils/ptr"
 	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
 
+	"kubesphere.io/kubesphere/pkg/controller/options"
 	"kubesphere.io/kubesphere/pkg/version"
 )
 
@@ -218,3 +220,85 @@ func TestFilterExtensionVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestUntilMaintenanceWindow(t *testing.T) {
+	// 2024-06-01 is a Saturday
+	saturday := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 1, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		window  *options.MaintenanceWindow
+		now     time.Time
+		wait    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "no window",
+			now:  saturday(12, 0),
+		},
+		{
+			name:   "within the window",
+			window: &options.MaintenanceWindow{Start: "02:00", End: "04:00"},
+			now:    saturday(3, 0),
+		},
+		{
+			name:   "before the window",
+			window: &options.MaintenanceWindow{Start: "02:00", End: "04:00"},
+			now:    saturday(1, 30),
+			wait:   30 * time.Minute,
+		},
+		{
+			name:   "after the window",
+			window: &options.MaintenanceWindow{Start: "02:00", End: "04:00"},
+			now:    saturday(4, 0),
+			wait:   22 * time.Hour,
+		},
+		{
+			name:   "window across midnight",
+			window: &options.MaintenanceWindow{Start: "22:00", End: "02:00", Days: []string{"Friday"}},
+			now:    saturday(1, 0),
+		},
+		{
+			name:   "next week",
+			window: &options.MaintenanceWindow{Start: "02:00", End: "04:00", Days: []string{"sat"}},
+			now:    saturday(5, 0),
+			wait:   7*24*time.Hour - 3*time.Hour,
+		},
+		{
+			name:   "time zone",
+			window: &options.MaintenanceWindow{Start: "02:00", End: "04:00", TimeZone: "Asia/Shanghai"},
+			now:    saturday(19, 0),
+		},
+		{
+			name:    "invalid day",
+			window:  &options.MaintenanceWindow{Start: "02:00", End: "04:00", Days: []string{"someday"}},
+			now:     saturday(3, 0),
+			wantErr: true,
+		},
+		{
+			name:    "no end time",
+			window:  &options.MaintenanceWindow{Start: "02:00"},
+			now:     saturday(3, 0),
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			window:  &options.MaintenanceWindow{Start: "2am", End: "04:00"},
+			now:     saturday(3, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, err := untilMaintenanceWindow(tt.window, tt.now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wait, wait)
+		})
+	}
+}
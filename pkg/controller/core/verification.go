@@ -0,0 +1,356 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"           //nolint
+	"golang.org/x/crypto/openpgp/clearsign" //nolint
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	orasregistry "oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartVerified     = "ChartVerified"
+	digestMismatch    = "DigestMismatch"
+	invalidKeyring    = "InvalidKeyring"
+	signatureNotFound = "SignatureNotFound"
+	signatureInvalid  = "SignatureInvalid"
+
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+)
+
+// verificationError indicates that the chart failed the digest or signature verification.
+type verificationError struct {
+	reason  string
+	message string
+}
+
+func (e *verificationError) Error() string {
+	return e.message
+}
+
+func asVerificationError(err error) (*verificationError, bool) {
+	var verificationErr *verificationError
+	ok := errors.As(err, &verificationErr)
+	return verificationErr, ok
+}
+
+// updateVerifiedCondition records the result of the chart verification, other errors are ignored.
+func updateVerifiedCondition(status *corev1alpha1.InstallationStatus, err error) {
+	if err == nil {
+		updateCondition(status, corev1alpha1.ConditionTypeVerified, chartVerified,
+			"The chart of the extension has been verified.", metav1.ConditionTrue, time.Now())
+		return
+	}
+	if verificationErr, ok := asVerificationError(err); ok {
+		updateCondition(status, corev1alpha1.ConditionTypeVerified, verificationErr.reason,
+			verificationErr.message, metav1.ConditionFalse, time.Now())
+	}
+}
+
+// verifyDigest checks the SHA-256 digest of the chart data, the verification is skipped if the digest is empty.
+func verifyDigest(data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	actual := sha256Hex(data)
+	if !strings.EqualFold(strings.TrimPrefix(digest, "sha256:"), actual) {
+		return &verificationError{
+			reason:  digestMismatch,
+			message: fmt.Sprintf("The SHA-256 digest %s of the chart does not match the expected digest %s.", actual, digest),
+		}
+	}
+	return nil
+}
+
+// verifyChartSignature verifies the signature of the chart with the keyring of the Repository,
+// the verification is skipped if the Repository does not require it.
+func verifyChartSignature(ctx context.Context, repo *corev1alpha1.Repository, rawURL string, data []byte) error {
+	verification := repo.Spec.Verification
+	if verification == nil {
+		return nil
+	}
+	keyring, err := base64.StdEncoding.DecodeString(verification.Keyring)
+	if err != nil {
+		return &verificationError{reason: invalidKeyring, message: fmt.Sprintf("Failed to decode the keyring: %s", err)}
+	}
+	chartURL, err := parseChartURL(rawURL, repo)
+	if err != nil {
+		return err
+	}
+
+	switch verification.Provider {
+	case corev1alpha1.SignatureProviderHelm:
+		filename, prov, err := fetchProvenance(ctx, repo, chartURL)
+		if err != nil {
+			return err
+		}
+		return verifyProvenance(keyring, filename, data, prov)
+	case corev1alpha1.SignatureProviderCosign:
+		if chartURL.Scheme != registry.OCIScheme {
+			return &verificationError{
+				reason:  signatureNotFound,
+				message: "The cosign signatures are only supported for the charts stored in OCI registries.",
+			}
+		}
+		return verifyCosignSignature(ctx, repo, chartURL, keyring, data)
+	default:
+		return errors.Errorf("unsupported signature provider: %s", verification.Provider)
+	}
+}
+
+// fetchProvenance returns the provenance file and the chart filename recorded in it. The provenance file
+// is next to the chart in HTTP repositories, or stored as a layer of the chart manifest in OCI registries.
+func fetchProvenance(ctx context.Context, repo *corev1alpha1.Repository, chartURL *url.URL) (string, []byte, error) {
+	if chartURL.Scheme != registry.OCIScheme {
+		transport, err := createTransport(repo, chartURL.Hostname())
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to create transport")
+		}
+		chartGetter, err := createChartGetter(chartURL.Scheme, createGetterOptions(repo, transport))
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to create chart getter")
+		}
+		prov, err := getChartData(chartGetter, chartURL.String()+".prov")
+		if err != nil {
+			return "", nil, &verificationError{reason: signatureNotFound, message: fmt.Sprintf("Failed to fetch the provenance file: %s", err)}
+		}
+		return path.Base(chartURL.Path), prov, nil
+	}
+
+	repository, reference, err := newRemoteRepository(repo, chartURL)
+	if err != nil {
+		return "", nil, err
+	}
+	_, manifest, err := fetchManifest(ctx, repository, reference.Reference)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != registry.ProvLayerMediaType {
+			continue
+		}
+		prov, err := content.FetchAll(ctx, repository, layer)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to fetch the provenance file")
+		}
+		// Helm signs the chart archive named after the chart name and version before pushing it.
+		filename := fmt.Sprintf("%s-%s.tgz", path.Base(reference.Repository), strings.ReplaceAll(reference.Reference, "_", "+"))
+		return filename, prov, nil
+	}
+	return "", nil, &verificationError{reason: signatureNotFound, message: "The provenance file of the chart is not found."}
+}
+
+// verifyProvenance verifies the provenance file is signed by the keyring and contains the digest of the chart.
+func verifyProvenance(keyring []byte, filename string, data, prov []byte) error {
+	keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyring))
+	if err != nil {
+		if keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(keyring)); err != nil {
+			return &verificationError{reason: invalidKeyring, message: fmt.Sprintf("Failed to read the PGP keyring: %s", err)}
+		}
+	}
+
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return &verificationError{reason: signatureInvalid, message: "The provenance file of the chart does not contain a signature."}
+	}
+	if _, err = openpgp.CheckDetachedSignature(keyRing, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body); err != nil {
+		return &verificationError{reason: signatureInvalid, message: fmt.Sprintf("The provenance file of the chart is not signed by the trusted keys: %s", err)}
+	}
+
+	// The message block consists of the chart metadata and the checksums separated by the YAML document end marker.
+	parts := bytes.Split(block.Plaintext, []byte("\n...\n"))
+	sums := &provenance.SumCollection{}
+	if len(parts) < 2 || yaml.Unmarshal(parts[1], sums) != nil {
+		return &verificationError{reason: signatureInvalid, message: "The provenance file of the chart is malformed."}
+	}
+	if sums.Files[filename] != "sha256:"+sha256Hex(data) {
+		return &verificationError{reason: signatureInvalid, message: fmt.Sprintf("The provenance file does not match the chart %s.", filename)}
+	}
+	return nil
+}
+
+// cosignPayload is the simple signing payload signed by cosign.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyCosignSignature verifies the chart manifest is signed by one of the public keys and the chart data is
+// the chart layer of the manifest, only the signatures stored in the OCI registry with the cosign tag convention
+// are supported, the transparency log is not checked.
+func verifyCosignSignature(ctx context.Context, repo *corev1alpha1.Repository, chartURL *url.URL, keyring, data []byte) error {
+	publicKeys, err := parsePublicKeys(keyring)
+	if err != nil {
+		return &verificationError{reason: invalidKeyring, message: fmt.Sprintf("Failed to read the public keys: %s", err)}
+	}
+
+	repository, reference, err := newRemoteRepository(repo, chartURL)
+	if err != nil {
+		return err
+	}
+	desc, chartManifest, err := fetchManifest(ctx, repository, reference.Reference)
+	if err != nil {
+		return err
+	}
+	// The signature only covers the manifest, the tag may have been moved since the chart was pulled.
+	if !hasChartLayer(chartManifest, "sha256:"+sha256Hex(data)) {
+		return &verificationError{reason: signatureInvalid, message: "The chart does not match the chart layer of the signed manifest."}
+	}
+
+	signatureTag := strings.Replace(desc.Digest.String(), ":", "-", 1) + ".sig"
+	_, manifest, err := fetchManifest(ctx, repository, signatureTag)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return &verificationError{reason: signatureNotFound, message: "The cosign signature of the chart is not found."}
+		}
+		return err
+	}
+
+	for _, layer := range manifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		payloadData, err := content.FetchAll(ctx, repository, layer)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch the signature payload")
+		}
+		payload := &cosignPayload{}
+		if err = json.Unmarshal(payloadData, payload); err != nil || payload.Critical.Image.DockerManifestDigest != desc.Digest.String() {
+			continue
+		}
+		for _, publicKey := range publicKeys {
+			if verifyWithPublicKey(publicKey, payloadData, signature) {
+				return nil
+			}
+		}
+	}
+	return &verificationError{reason: signatureInvalid, message: "The chart is not signed by the trusted keys."}
+}
+
+func hasChartLayer(manifest *ocispec.Manifest, digest string) bool {
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == registry.ChartLayerMediaType || layer.MediaType == registry.LegacyChartLayerMediaType {
+			return layer.Digest.String() == digest
+		}
+	}
+	return false
+}
+
+func newRemoteRepository(repo *corev1alpha1.Repository, chartURL *url.URL) (*remote.Repository, orasregistry.Reference, error) {
+	// Helm replaces the plus sign of the version with underscore in OCI tags.
+	reference, err := orasregistry.ParseReference(strings.ReplaceAll(chartURL.Host+chartURL.Path, "+", "_"))
+	if err != nil {
+		return nil, reference, errors.Wrapf(err, "failed to parse chart reference")
+	}
+	if reference.Reference == "" {
+		return nil, reference, errors.Errorf("the tag of the chart %s is missing", chartURL)
+	}
+	repository, err := remote.NewRepository(fmt.Sprintf("%s/%s", reference.Registry, reference.Repository))
+	if err != nil {
+		return nil, reference, errors.Wrapf(err, "failed to create remote repository")
+	}
+	transport, err := createTransport(repo, chartURL.Hostname())
+	if err != nil {
+		return nil, reference, errors.Wrapf(err, "failed to create transport")
+	}
+	client := &auth.Client{Client: &http.Client{Transport: transport}}
+	if repo.Spec.BasicAuth != nil {
+		client.Credential = auth.StaticCredential(reference.Registry, auth.Credential{
+			Username: repo.Spec.BasicAuth.Username,
+			Password: repo.Spec.BasicAuth.Password,
+		})
+	}
+	repository.Client = client
+	return repository, reference, nil
+}
+
+func fetchManifest(ctx context.Context, repository *remote.Repository, reference string) (ocispec.Descriptor, *ocispec.Manifest, error) {
+	desc, data, err := oras.FetchBytes(ctx, repository, reference, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return desc, nil, errors.Wrapf(err, "failed to fetch manifest %s", reference)
+	}
+	manifest := &ocispec.Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return desc, nil, errors.Wrapf(err, "failed to decode manifest %s", reference)
+	}
+	return desc, manifest, nil
+}
+
+// parsePublicKeys parses the PEM encoded public keys.
+func parsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var publicKeys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no public key found")
+	}
+	return publicKeys, nil
+}
+
+func verifyWithPublicKey(publicKey crypto.PublicKey, payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	default:
+		return false
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
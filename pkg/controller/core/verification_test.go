@@ -0,0 +1,243 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"           //nolint
+	"golang.org/x/crypto/openpgp/armor"     //nolint
+	"golang.org/x/crypto/openpgp/clearsign" //nolint
+	"helm.sh/helm/v3/pkg/registry"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
+)
+
+func TestVerifyDigest(t *testing.T) {
+	data := []byte("chart")
+	assert.NoError(t, verifyDigest(data, ""))
+	assert.NoError(t, verifyDigest(data, sha256Hex(data)))
+	assert.NoError(t, verifyDigest(data, "sha256:"+sha256Hex(data)))
+
+	verificationErr, ok := asVerificationError(verifyDigest(data, sha256Hex([]byte("tampered"))))
+	assert.True(t, ok)
+	assert.Equal(t, digestMismatch, verificationErr.reason)
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	signer, err := openpgp.NewEntity("signer", "", "signer@kubesphere.io", nil)
+	assert.NoError(t, err)
+	untrusted, err := openpgp.NewEntity("untrusted", "", "untrusted@kubesphere.io", nil)
+	assert.NoError(t, err)
+
+	keyring := &bytes.Buffer{}
+	w, err := armor.Encode(keyring, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, signer.Serialize(w))
+	assert.NoError(t, w.Close())
+
+	data := []byte("chart")
+	sign := func(entity *openpgp.Entity, filename string) []byte {
+		message := fmt.Sprintf("name: devops\nversion: 1.0.0\n\n...\nfiles:\n  %s: sha256:%s\n", filename, sha256Hex(data))
+		prov := &bytes.Buffer{}
+		w, err := clearsign.Encode(prov, entity.PrivateKey, nil)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(message))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		return prov.Bytes()
+	}
+
+	tests := []struct {
+		name   string
+		prov   []byte
+		reason string
+	}{
+		{
+			name: "valid",
+			prov: sign(signer, "devops-1.0.0.tgz"),
+		},
+		{
+			name:   "untrusted key",
+			prov:   sign(untrusted, "devops-1.0.0.tgz"),
+			reason: signatureInvalid,
+		},
+		{
+			name:   "filename mismatch",
+			prov:   sign(signer, "devops-1.1.0.tgz"),
+			reason: signatureInvalid,
+		},
+		{
+			name:   "unsigned",
+			prov:   []byte("files:\n  devops-1.0.0.tgz: sha256:0000\n"),
+			reason: signatureInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyProvenance(keyring.Bytes(), "devops-1.0.0.tgz", data, tt.prov)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			verificationErr, ok := asVerificationError(err)
+			assert.True(t, ok, "unexpected error: %v", err)
+			assert.Equal(t, tt.reason, verificationErr.reason)
+		})
+	}
+}
+
+func TestVerifyWithPublicKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+
+	publicKeys, err := parsePublicKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.Len(t, publicKeys, 1)
+
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"sha256:0000"}}}`)
+	digest := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	assert.NoError(t, err)
+
+	assert.True(t, verifyWithPublicKey(publicKeys[0], payload, signature))
+	assert.False(t, verifyWithPublicKey(publicKeys[0], []byte("tampered"), signature))
+
+	_, err = parsePublicKeys([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+// fakeRegistry serves the manifests and blobs of a single repository with the OCI distribution API.
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func (r *fakeRegistry) push(data []byte) ocispec.Descriptor {
+	desc := ocispec.Descriptor{Digest: digest.FromBytes(data), Size: int64(len(data))}
+	r.blobs[desc.Digest.String()] = data
+	return desc
+}
+
+func (r *fakeRegistry) pushManifest(tag string, manifest *ocispec.Manifest) digest.Digest {
+	data, _ := json.Marshal(manifest)
+	dgst := digest.FromBytes(data)
+	r.manifests[tag] = data
+	r.manifests[dgst.String()] = data
+	return dgst
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var data []byte
+	var ok bool
+	if _, reference, found := strings.Cut(req.URL.Path, "/manifests/"); found {
+		data, ok = r.manifests[reference]
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+	} else if _, reference, found = strings.Cut(req.URL.Path, "/blobs/"); found {
+		data, ok = r.blobs[reference]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	if req.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+}
+
+func TestVerifyCosignSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+	keyring := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	r := &fakeRegistry{manifests: make(map[string][]byte), blobs: make(map[string][]byte)}
+	server := httptest.NewTLSServer(r)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	repo := &corev1alpha1.Repository{Spec: corev1alpha1.RepositorySpec{Insecure: true}}
+
+	sign := func(manifestDigest digest.Digest) {
+		payload := []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":%q}}}`, manifestDigest))
+		hash := sha256.Sum256(payload)
+		signature, err := ecdsa.SignASN1(rand.Reader, privateKey, hash[:])
+		assert.NoError(t, err)
+		layer := r.push(payload)
+		layer.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+		layer.Annotations = map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)}
+		r.pushManifest(strings.Replace(manifestDigest.String(), ":", "-", 1)+".sig", &ocispec.Manifest{Layers: []ocispec.Descriptor{layer}})
+	}
+	pushChart := func(tag string, data []byte) digest.Digest {
+		layer := r.push(data)
+		layer.MediaType = registry.ChartLayerMediaType
+		return r.pushManifest(tag, &ocispec.Manifest{Layers: []ocispec.Descriptor{layer}})
+	}
+
+	chart := []byte("signed chart")
+	sign(pushChart("1.0.0", chart))
+	pushChart("2.0.0", []byte("unsigned chart"))
+
+	tests := []struct {
+		name   string
+		tag    string
+		data   []byte
+		reason string
+	}{
+		{
+			name: "signed chart",
+			tag:  "1.0.0",
+			data: chart,
+		},
+		{
+			name:   "chart is not the chart layer of the signed manifest",
+			tag:    "1.0.0",
+			data:   []byte("tampered chart"),
+			reason: signatureInvalid,
+		},
+		{
+			name:   "signature not found",
+			tag:    "2.0.0",
+			data:   []byte("unsigned chart"),
+			reason: signatureNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chartURL := &url.URL{Scheme: registry.OCIScheme, Host: serverURL.Host, Path: "/charts/demo:" + tt.tag}
+			err := verifyCosignSignature(context.Background(), repo, chartURL, keyring, tt.data)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			verificationErr, ok := asVerificationError(err)
+			assert.True(t, ok, "unexpected error %v", err)
+			assert.Equal(t, tt.reason, verificationErr.reason)
+		})
+	}
+}
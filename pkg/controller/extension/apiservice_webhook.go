@@ -44,6 +44,9 @@ func (r *APIServiceWebhook) ValidateDelete(ctx context.Context, obj runtime.Obje
 }
 
 func (r *APIServiceWebhook) validateAPIService(ctx context.Context, service *extensionsv1alpha1.APIService) (admission.Warnings, error) {
+	if err := validateTrafficPolicy(service.Spec.RateLimit, service.Spec.CircuitBreaker); err != nil {
+		return nil, err
+	}
 	apiServices := &extensionsv1alpha1.APIServiceList{}
 	if err := r.Client.List(ctx, apiServices, &client.ListOptions{}); err != nil {
 		return nil, err
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package extension
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kscontroller "kubesphere.io/kubesphere/pkg/controller"
+)
+
+const reverseProxyController = "reverseproxy"
+
+var _ kscontroller.Controller = &ReverseProxyReconciler{}
+var _ reconcile.Reconciler = &ReverseProxyReconciler{}
+
+// ReverseProxyReconciler flags the ReverseProxies whose matchers conflict with others on the status.
+// The oldest ReverseProxy takes effect among the conflicting ones, the same as the routing table of ks-apiserver.
+// The health of the upstreams is reported on the status as well if the health check is configured.
+type ReverseProxyReconciler struct {
+	client.Client
+	healthChecker *upstreamHealthChecker
+}
+
+func (r *ReverseProxyReconciler) Name() string {
+	return reverseProxyController
+}
+
+func (r *ReverseProxyReconciler) SetupWithManager(mgr *kscontroller.Manager) error {
+	r.Client = mgr.GetClient()
+	r.healthChecker = newUpstreamHealthChecker()
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(reverseProxyController).
+		Watches(&extensionsv1alpha1.ReverseProxy{}, handler.EnqueueRequestsFromMapFunc(r.mapReverseProxies)).
+		Complete(r)
+}
+
+// mapReverseProxies enqueues the ReverseProxies with the same matcher, and the conflicted ones
+// since the ReverseProxies they conflict with may have been changed or deleted.
+func (r *ReverseProxyReconciler) mapReverseProxies(ctx context.Context, obj client.Object) []reconcile.Request {
+	reverseProxy, ok := obj.(*extensionsv1alpha1.ReverseProxy)
+	if !ok {
+		return nil
+	}
+	requests := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: reverseProxy.Name}}}
+	reverseProxies := &extensionsv1alpha1.ReverseProxyList{}
+	if err := r.List(ctx, reverseProxies); err != nil {
+		klog.Errorf("failed to list reverse proxies: %v", err)
+		return requests
+	}
+	for _, item := range reverseProxies.Items {
+		if item.Name == reverseProxy.Name {
+			continue
+		}
+		if sameRoute(&item, reverseProxy) || meta.IsStatusConditionTrue(item.Status.Conditions, extensionsv1alpha1.ConditionTypeConflicted) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: item.Name}})
+		}
+	}
+	return requests
+}
+
+func (r *ReverseProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reverseProxy := &extensionsv1alpha1.ReverseProxy{}
+	if err := r.Get(ctx, req.NamespacedName, reverseProxy); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.healthChecker.forget(req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !reverseProxy.DeletionTimestamp.IsZero() {
+		r.healthChecker.forget(req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	reverseProxies := &extensionsv1alpha1.ReverseProxyList{}
+	if err := r.List(ctx, reverseProxies); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	expected := reverseProxy.DeepCopy()
+	var changed bool
+	if winner := effectiveReverseProxy(reverseProxy, reverseProxies.Items); winner != nil {
+		changed = meta.SetStatusCondition(&expected.Status.Conditions, metav1.Condition{
+			Type:    extensionsv1alpha1.ConditionTypeConflicted,
+			Status:  metav1.ConditionTrue,
+			Reason:  "MatcherConflicted",
+			Message: fmt.Sprintf("the matcher %s %s is taken by the ReverseProxy %s", reverseProxy.Spec.Matcher.Method, reverseProxy.Spec.Matcher.Path, winner.Name),
+		})
+	} else if meta.FindStatusCondition(expected.Status.Conditions, extensionsv1alpha1.ConditionTypeConflicted) != nil {
+		changed = meta.SetStatusCondition(&expected.Status.Conditions, metav1.Condition{
+			Type:   extensionsv1alpha1.ConditionTypeConflicted,
+			Status: metav1.ConditionFalse,
+			Reason: "NoConflict",
+		})
+	}
+	healthChanged, requeueAfter := r.healthChecker.sync(ctx, expected)
+	if !changed && !healthChanged {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.Update(ctx, expected)
+}
+
+// effectiveReverseProxy returns the ReverseProxy which takes effect instead of the given one, or nil if there is none.
+func effectiveReverseProxy(reverseProxy *extensionsv1alpha1.ReverseProxy, reverseProxies []extensionsv1alpha1.ReverseProxy) *extensionsv1alpha1.ReverseProxy {
+	var winner *extensionsv1alpha1.ReverseProxy
+	for i := range reverseProxies {
+		item := &reverseProxies[i]
+		if item.Name == reverseProxy.Name || !item.DeletionTimestamp.IsZero() || !sameRoute(item, reverseProxy) {
+			continue
+		}
+		if !olderThan(item, reverseProxy) {
+			continue
+		}
+		if winner == nil || olderThan(item, winner) {
+			winner = item
+		}
+	}
+	return winner
+}
+
+func sameRoute(a, b *extensionsv1alpha1.ReverseProxy) bool {
+	return reverseProxyTarget(a) == reverseProxyTarget(b) && a.Spec.Matcher == b.Spec.Matcher
+}
+
+// reverseProxyTarget returns the component which handles the ReverseProxy, it is ks-apiserver if the label is not set.
+func reverseProxyTarget(reverseProxy *extensionsv1alpha1.ReverseProxy) string {
+	if reverseProxy.Labels[extensionsv1alpha1.ReverseProxyTargetLabel] == extensionsv1alpha1.ReverseProxyTargetConsole {
+		return extensionsv1alpha1.ReverseProxyTargetConsole
+	}
+	return extensionsv1alpha1.ReverseProxyTargetAPIServer
+}
+
+func olderThan(a, b *extensionsv1alpha1.ReverseProxy) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
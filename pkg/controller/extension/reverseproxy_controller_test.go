@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package extension
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+)
+
+func TestEffectiveReverseProxy(t *testing.T) {
+	now := time.Now()
+	newReverseProxy := func(name, method string, created time.Time, target string) extensionsv1alpha1.ReverseProxy {
+		reverseProxy := extensionsv1alpha1.ReverseProxy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Spec:       extensionsv1alpha1.ReverseProxySpec{Matcher: extensionsv1alpha1.Matcher{Method: method, Path: "/proxy/devops/*"}},
+		}
+		if target != "" {
+			reverseProxy.Labels = map[string]string{extensionsv1alpha1.ReverseProxyTargetLabel: target}
+		}
+		return reverseProxy
+	}
+	reverseProxies := []extensionsv1alpha1.ReverseProxy{
+		newReverseProxy("a", "*", now, ""),
+		newReverseProxy("b", "*", now, extensionsv1alpha1.ReverseProxyTargetAPIServer),
+		newReverseProxy("c", "*", now.Add(-time.Minute), extensionsv1alpha1.ReverseProxyTargetConsole),
+		newReverseProxy("d", "GET", now.Add(-time.Minute), ""),
+		newReverseProxy("e", "*", now.Add(time.Minute), ""),
+	}
+
+	assert.Nil(t, effectiveReverseProxy(&reverseProxies[0], reverseProxies))
+	assert.Equal(t, "a", effectiveReverseProxy(&reverseProxies[1], reverseProxies).Name)
+	assert.Nil(t, effectiveReverseProxy(&reverseProxies[2], reverseProxies))
+	assert.Nil(t, effectiveReverseProxy(&reverseProxies[3], reverseProxies))
+	assert.Equal(t, "a", effectiveReverseProxy(&reverseProxies[4], reverseProxies).Name)
+}
+
+func TestUpstreamHealthChecker(t *testing.T) {
+	var failing atomic.Bool
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+
+	reverseProxy := &extensionsv1alpha1.ReverseProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "devops"},
+		Spec: extensionsv1alpha1.ReverseProxySpec{
+			Upstreams: []extensionsv1alpha1.WeightedEndpoint{
+				{Endpoint: extensionsv1alpha1.Endpoint{URL: ptr.To(healthy.URL)}},
+				{Endpoint: extensionsv1alpha1.Endpoint{URL: ptr.To(flaky.URL)}},
+			},
+			LoadBalancer: &extensionsv1alpha1.LoadBalancer{HealthCheck: &extensionsv1alpha1.HealthCheck{
+				Path:               "/healthz",
+				Interval:           &metav1.Duration{Duration: time.Hour},
+				UnhealthyThreshold: 2,
+			}},
+		},
+	}
+	checker := newUpstreamHealthChecker()
+	check := func() bool {
+		// the interval has passed
+		checker.health[reverseProxy.Name].checked = time.Time{}
+		changed, requeueAfter := checker.sync(context.Background(), reverseProxy)
+		assert.Equal(t, time.Hour, requeueAfter)
+		return changed
+	}
+
+	changed, requeueAfter := checker.sync(context.Background(), reverseProxy)
+	assert.True(t, changed)
+	assert.Equal(t, time.Hour, requeueAfter)
+	assert.True(t, meta.IsStatusConditionTrue(reverseProxy.Status.Conditions, extensionsv1alpha1.ConditionTypeUpstreamsHealthy))
+
+	// not checked again within the interval
+	failing.Store(true)
+	changed, requeueAfter = checker.sync(context.Background(), reverseProxy)
+	assert.False(t, changed)
+	assert.Greater(t, requeueAfter, 59*time.Minute)
+
+	// the upstream is unhealthy after the consecutive failures reach the threshold
+	assert.False(t, check())
+	assert.True(t, check())
+	condition := meta.FindStatusCondition(reverseProxy.Status.Conditions, extensionsv1alpha1.ConditionTypeUpstreamsHealthy)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "1/2 upstreams are healthy, unhealthy upstreams: "+flaky.URL, condition.Message)
+
+	failing.Store(false)
+	assert.True(t, check())
+	assert.True(t, meta.IsStatusConditionTrue(reverseProxy.Status.Conditions, extensionsv1alpha1.ConditionTypeUpstreamsHealthy))
+
+	// the condition is removed without the health check
+	reverseProxy.Spec.LoadBalancer = nil
+	changed, requeueAfter = checker.sync(context.Background(), reverseProxy)
+	assert.True(t, changed)
+	assert.Zero(t, requeueAfter)
+	assert.Nil(t, meta.FindStatusCondition(reverseProxy.Status.Conditions, extensionsv1alpha1.ConditionTypeUpstreamsHealthy))
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package extension
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+
+	"kubesphere.io/kubesphere/pkg/utils/healthcheck"
+)
+
+// reverseProxyHealth is the health of the upstreams of a ReverseProxy by their URLs.
+type reverseProxyHealth struct {
+	checked   time.Time
+	upstreams map[string]*healthcheck.Status
+}
+
+// upstreamHealthChecker probes the upstreams of the ReverseProxies, the results are kept across the reconciliations
+// to apply the thresholds. Every replica of ks-apiserver checks the upstreams independently, the status reflects
+// the checks of the leader of ks-controller-manager, which share the configuration of the health check.
+type upstreamHealthChecker struct {
+	mu     sync.Mutex
+	health map[string]*reverseProxyHealth
+}
+
+func newUpstreamHealthChecker() *upstreamHealthChecker {
+	return &upstreamHealthChecker{health: make(map[string]*reverseProxyHealth)}
+}
+
+func (c *upstreamHealthChecker) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.health, name)
+}
+
+// sync checks the upstreams if the interval has passed since the last check and sets the UpstreamsHealthy condition,
+// returns true if the condition is changed, and the duration to wait before the next check. The condition is removed
+// if the health check is not configured.
+func (c *upstreamHealthChecker) sync(ctx context.Context, reverseProxy *extensionsv1alpha1.ReverseProxy) (bool, time.Duration) {
+	var healthCheck *extensionsv1alpha1.HealthCheck
+	if reverseProxy.Spec.LoadBalancer != nil {
+		healthCheck = reverseProxy.Spec.LoadBalancer.HealthCheck
+	}
+	if healthCheck == nil {
+		c.forget(reverseProxy.Name)
+		return meta.RemoveStatusCondition(&reverseProxy.Status.Conditions, extensionsv1alpha1.ConditionTypeUpstreamsHealthy), 0
+	}
+	interval := healthcheck.Interval(healthCheck)
+
+	c.mu.Lock()
+	health, ok := c.health[reverseProxy.Name]
+	if !ok {
+		health = &reverseProxyHealth{upstreams: make(map[string]*healthcheck.Status)}
+		c.health[reverseProxy.Name] = health
+	}
+	c.mu.Unlock()
+	// the reconciliations triggered by the status updates do not count as the checks
+	if wait := interval - time.Since(health.checked); wait > 0 {
+		return false, wait
+	}
+	health.checked = time.Now()
+
+	endpoints := reverseProxy.Spec.Upstreams
+	if len(endpoints) == 0 {
+		endpoints = []extensionsv1alpha1.WeightedEndpoint{{Endpoint: reverseProxy.Spec.Upstream}}
+	}
+	results := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = checkUpstream(ctx, &endpoints[i].Endpoint, healthCheck)
+		}()
+	}
+	wg.Wait()
+
+	upstreams := make(map[string]*healthcheck.Status, len(endpoints))
+	var unhealthy []string
+	for i, endpoint := range endpoints {
+		rawURL := endpoint.RawURL()
+		u, ok := health.upstreams[rawURL]
+		if !ok {
+			u = &healthcheck.Status{}
+		}
+		upstreams[rawURL] = u
+		if u.Record(healthCheck, results[i]) && u.Unhealthy() {
+			klog.Warningf("upstream %s of reverse proxy %s becomes unhealthy: %v", rawURL, reverseProxy.Name, results[i])
+		}
+		if u.Unhealthy() {
+			unhealthy = append(unhealthy, rawURL)
+		}
+	}
+	health.upstreams = upstreams
+
+	total := len(endpoints)
+	condition := metav1.Condition{
+		Type:    extensionsv1alpha1.ConditionTypeUpstreamsHealthy,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Healthy",
+		Message: fmt.Sprintf("%d/%d upstreams are healthy", total, total),
+	}
+	if len(unhealthy) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unhealthy"
+		condition.Message = fmt.Sprintf("%d/%d upstreams are healthy, unhealthy upstreams: %s",
+			total-len(unhealthy), total, strings.Join(unhealthy, ", "))
+	}
+	return meta.SetStatusCondition(&reverseProxy.Status.Conditions, condition), interval
+}
+
+// checkUpstream probes the upstream in the same way as the reverse proxy of ks-apiserver.
+func checkUpstream(ctx context.Context, endpoint *extensionsv1alpha1.Endpoint, healthCheck *extensionsv1alpha1.HealthCheck) error {
+	upstream, err := url.Parse(endpoint.RawURL())
+	if err != nil {
+		return err
+	}
+	tlsConfig := transport.TLSConfig{Insecure: endpoint.InsecureSkipVerify}
+	if !endpoint.InsecureSkipVerify && len(endpoint.CABundle) > 0 {
+		if tlsConfig.CAData, err = base64.StdEncoding.DecodeString(string(endpoint.CABundle)); err != nil {
+			return fmt.Errorf("failed to decode CA bundle: %v", err)
+		}
+	}
+	roundTripper, err := transport.New(&transport.Config{TLS: tlsConfig})
+	if err != nil {
+		return err
+	}
+	return healthcheck.Probe(ctx, roundTripper, upstream, healthCheck)
+}
@@ -53,6 +53,12 @@ func (r *ReverseProxyWebhook) ValidateDelete(ctx context.Context, obj runtime.Ob
 }
 
 func (r *ReverseProxyWebhook) validateReverseProxy(ctx context.Context, proxy *extensionsv1alpha1.ReverseProxy) (admission.Warnings, error) {
+	if err := validateUpstreams(proxy); err != nil {
+		return nil, err
+	}
+	if err := validateTrafficPolicy(proxy.Spec.Directives.RateLimit, proxy.Spec.Directives.CircuitBreaker); err != nil {
+		return nil, err
+	}
 	reverseProxies := &extensionsv1alpha1.ReverseProxyList{}
 	if err := r.Client.List(ctx, reverseProxies, &client.ListOptions{}); err != nil {
 		return nil, err
@@ -75,3 +81,66 @@ func (r *ReverseProxyWebhook) validateReverseProxy(ctx context.Context, proxy *e
 	}
 	return nil, nil
 }
+
+func validateUpstreams(proxy *extensionsv1alpha1.ReverseProxy) error {
+	if len(proxy.Spec.Upstreams) > 0 {
+		var totalWeight int32
+		for _, upstream := range proxy.Spec.Upstreams {
+			if upstream.Weight == nil {
+				totalWeight++
+				continue
+			}
+			if *upstream.Weight < 0 {
+				return fmt.Errorf("weight of upstream %s must not be negative", upstream.RawURL())
+			}
+			totalWeight += *upstream.Weight
+		}
+		if totalWeight == 0 {
+			return fmt.Errorf("at least one upstream must have a positive weight")
+		}
+	}
+	if proxy.Spec.LoadBalancer == nil {
+		return nil
+	}
+	switch proxy.Spec.LoadBalancer.Policy {
+	case "", extensionsv1alpha1.LoadBalancerPolicyRoundRobin, extensionsv1alpha1.LoadBalancerPolicyLeastRequest:
+	default:
+		return fmt.Errorf("unsupported load balancer policy %s", proxy.Spec.LoadBalancer.Policy)
+	}
+	if healthCheck := proxy.Spec.LoadBalancer.HealthCheck; healthCheck != nil && !strings.HasPrefix(healthCheck.Path, "/") {
+		return fmt.Errorf("health check path %s must start with /", healthCheck.Path)
+	}
+	return nil
+}
+
+func validateTrafficPolicy(rateLimit *extensionsv1alpha1.RateLimit, circuitBreaker *extensionsv1alpha1.CircuitBreaker) error {
+	if rateLimit != nil {
+		for _, limit := range []struct {
+			name   string
+			bucket *extensionsv1alpha1.TokenBucket
+		}{{"perUser", rateLimit.PerUser}, {"perRoute", rateLimit.PerRoute}, {"global", rateLimit.Global}} {
+			name, bucket := limit.name, limit.bucket
+			if bucket == nil {
+				continue
+			}
+			if bucket.RequestsPerSecond <= 0 {
+				return fmt.Errorf("requestsPerSecond of %s rate limit must be positive", name)
+			}
+			if bucket.Burst < 0 {
+				return fmt.Errorf("burst of %s rate limit must not be negative", name)
+			}
+		}
+	}
+	if circuitBreaker != nil {
+		if circuitBreaker.MaxConcurrentRequests < 0 {
+			return fmt.Errorf("maxConcurrentRequests of circuit breaker must not be negative")
+		}
+		if circuitBreaker.ErrorRateThreshold < 0 || circuitBreaker.ErrorRateThreshold > 100 {
+			return fmt.Errorf("errorRateThreshold of circuit breaker must be between 0 and 100")
+		}
+		if circuitBreaker.MinimumRequests < 0 {
+			return fmt.Errorf("minimumRequests of circuit breaker must not be negative")
+		}
+	}
+	return nil
+}
@@ -7,6 +7,8 @@
 package options
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -69,12 +71,88 @@ type ExtensionOptions struct {
 	ImageRegistry string                   `json:"imageRegistry,omitempty" yaml:"imageRegistry,omitempty" mapstructure:"imageRegistry,omitempty"`
 	NodeSelector  map[string]string        `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty" mapstructure:"nodeSelector,omitempty"`
 	Ingress       *ExtensionIngressOptions `json:"ingress,omitempty" yaml:"ingress,omitempty" mapstructure:"ingress,omitempty"`
+	// MaintenanceWindow limits when the extensions with the Automatic upgrade strategy can be upgraded,
+	// the upgrades are allowed at any time if it is not specified.
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty" yaml:"maintenanceWindow,omitempty" mapstructure:"maintenanceWindow,omitempty"`
+}
+
+// MaintenanceWindow is a daily time window, the window ends on the next day if the end time is before the start time.
+type MaintenanceWindow struct {
+	// Start time of the window in the format of 15:04
+	Start string `json:"start,omitempty" yaml:"start,omitempty" mapstructure:"start,omitempty"`
+	// End time of the window in the format of 15:04
+	End string `json:"end,omitempty" yaml:"end,omitempty" mapstructure:"end,omitempty"`
+	// Days of the week on which the window starts, e.g. Saturday, defaults to every day.
+	Days []string `json:"days,omitempty" yaml:"days,omitempty" mapstructure:"days,omitempty"`
+	// TimeZone is the IANA time zone name of the window, defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty" yaml:"timeZone,omitempty" mapstructure:"timeZone,omitempty"`
+}
+
+// MaintenanceSchedule is the parsed MaintenanceWindow.
+type MaintenanceSchedule struct {
+	// Start and End only keep the hour and minute of the window.
+	Start time.Time
+	End   time.Time
+	// Days is empty if the window starts on every day.
+	Days     map[time.Weekday]bool
+	Location *time.Location
+}
+
+const maintenanceWindowTimeLayout = "15:04"
+
+// Parse parses the maintenance window into a schedule.
+func (w *MaintenanceWindow) Parse() (*MaintenanceSchedule, error) {
+	schedule := &MaintenanceSchedule{Days: make(map[time.Weekday]bool), Location: time.UTC}
+	if w.TimeZone != "" {
+		location, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone of the maintenance window %q: %w", w.TimeZone, err)
+		}
+		schedule.Location = location
+	}
+	if w.Start == "" || w.End == "" {
+		return nil, fmt.Errorf("both start and end time of the maintenance window are required")
+	}
+	var err error
+	if schedule.Start, err = time.Parse(maintenanceWindowTimeLayout, w.Start); err != nil {
+		return nil, fmt.Errorf("invalid start time of the maintenance window %q: %w", w.Start, err)
+	}
+	if schedule.End, err = time.Parse(maintenanceWindowTimeLayout, w.End); err != nil {
+		return nil, fmt.Errorf("invalid end time of the maintenance window %q: %w", w.End, err)
+	}
+	for _, day := range w.Days {
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			return nil, fmt.Errorf("invalid day of the maintenance window: %q", day)
+		}
+		schedule.Days[weekday] = true
+	}
+	return schedule, nil
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), day) || strings.EqualFold(weekday.String()[:3], day) {
+			return weekday, true
+		}
+	}
+	return 0, false
 }
 
 func NewExtensionOptions() *ExtensionOptions {
 	return &ExtensionOptions{}
 }
 
+func (o *ExtensionOptions) Validate() []error {
+	var errs []error
+	if o.MaintenanceWindow != nil {
+		if _, err := o.MaintenanceWindow.Parse(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 type KubeSphereOptions struct {
 	TLS bool `json:"tls,omitempty" yaml:"tls,omitempty" mapstructure:"tls,omitempty"`
 }
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/emicklei/go-restful/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"kubesphere.io/kubesphere/pkg/api"
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+	auditingmodel "kubesphere.io/kubesphere/pkg/models/auditing"
+)
+
+type handler struct {
+	operator auditingmodel.Interface
+}
+
+func (h *handler) ListEvents(req *restful.Request, resp *restful.Response) {
+	if h.operator == nil {
+		api.HandleError(resp, req, errors.NewServiceUnavailable("the auditing log backend is not enabled"))
+		return
+	}
+
+	queryParam := query.ParseQueryParameter(req)
+	// the events are scoped to the workspace in the path, workspace admins are authorized to this path only
+	if workspace := req.PathParameter("workspace"); workspace != "" {
+		queryParam.Filters[auditingmodel.FieldWorkspace] = query.Value(workspace)
+	}
+
+	filter, err := auditingmodel.ParseFilter(queryParam)
+	if err != nil {
+		api.HandleError(resp, req, errors.NewBadRequest(fmt.Sprintf("invalid search parameters: %s", err)))
+		return
+	}
+
+	result, err := h.operator.Events(filter, queryParam)
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+	_ = resp.WriteEntity(result)
+}
+
+func (h *handler) VerifyLog(req *restful.Request, resp *restful.Response) {
+	if h.operator == nil {
+		api.HandleError(resp, req, errors.NewServiceUnavailable("the auditing log backend is not enabled"))
+		return
+	}
+
+	result, err := h.operator.Verify(req.QueryParameter("file"))
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+	_ = resp.WriteEntity(result)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package v1alpha1
+
+import (
+	"net/http"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"kubesphere.io/kubesphere/pkg/api"
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing"
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/log"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+	"kubesphere.io/kubesphere/pkg/apiserver/rest"
+	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
+	auditingmodel "kubesphere.io/kubesphere/pkg/models/auditing"
+)
+
+const (
+	GroupName = "auditing.kubesphere.io"
+	Version   = "v1alpha1"
+)
+
+var GroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+func NewHandler(options *auditing.Options, keys *token.Keys) rest.Handler {
+	h := &handler{}
+	// events can only be searched when they are written to a local log file
+	if options != nil && options.Enable && options.LogOptions.Path != "" && options.LogOptions.Path != "-" {
+		h.operator = auditingmodel.NewOperator(options.LogOptions.Path, keys, options.LogOptions.VerificationKeysFile)
+	}
+	return h
+}
+
+func NewFakeHandler() rest.Handler {
+	return &handler{}
+}
+
+func (h *handler) AddToContainer(container *restful.Container) error {
+	ws := runtime.NewWebService(GroupVersion)
+
+	ws.Route(withSearchParameters(ws, ws.GET("/events")).
+		To(h.ListEvents).
+		Doc("Search the auditing events recorded by the log backend.").
+		Operation("list-auditing-events").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAdvancedOperations}).
+		Param(ws.QueryParameter(auditingmodel.FieldWorkspace, "Comma-separated list of workspaces.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, auditingmodel.EventList{}))
+
+	ws.Route(withSearchParameters(ws, ws.GET("/workspaces/{workspace}/events")).
+		To(h.ListEvents).
+		Doc("Search the auditing events of the workspace recorded by the log backend.").
+		Operation("list-workspace-auditing-events").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAdvancedOperations}).
+		Param(ws.PathParameter("workspace", "The specified workspace.")).
+		Returns(http.StatusOK, api.StatusOK, auditingmodel.EventList{}))
+
+	ws.Route(ws.GET("/verification").
+		To(h.VerifyLog).
+		Doc("Walk the hash chain across the rotated audit logs and the audit log file, and report the first broken link.").
+		Operation("verify-auditing-log").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAdvancedOperations}).
+		Param(ws.QueryParameter("file", "The file name of a rotated audit log, the chain is verified up to it. All the files are verified if empty.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, log.VerifyResult{}))
+
+	container.Add(ws)
+	return nil
+}
+
+func withSearchParameters(ws *restful.WebService, builder *restful.RouteBuilder) *restful.RouteBuilder {
+	return builder.
+		Param(ws.QueryParameter(auditingmodel.FieldStartTime, "Start time of the search, in seconds since epoch or RFC3339 format.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldEndTime, "End time of the search, in seconds since epoch or RFC3339 format.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldUser, "Comma-separated list of usernames.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldVerb, "Comma-separated list of verbs, e.g. create,delete.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldCluster, "Comma-separated list of clusters.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldNamespace, "Comma-separated list of namespaces.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldResource, "Comma-separated list of resources, e.g. workspaces.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldName, "Comma-separated list of resource names.").Required(false)).
+		Param(ws.QueryParameter(auditingmodel.FieldCode, "Comma-separated list of response codes.").Required(false)).
+		Param(ws.QueryParameter(query.ParameterPage, "page").Required(false).DataFormat("page=%d").DefaultValue("page=1")).
+		Param(ws.QueryParameter(query.ParameterLimit, "limit").Required(false)).
+		Param(ws.QueryParameter(query.ParameterAscending, "sort by the request received time in ascending order, e.g. ascending=true").Required(false).DefaultValue("ascending=false"))
+}
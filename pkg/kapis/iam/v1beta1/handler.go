@@ -7,6 +7,7 @@
 package v1beta1
 
 import (
+	stderrors "errors"
 	"fmt"
 	"sync"
 
@@ -21,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	authuser "k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/klog/v2"
 	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
 
 	"kubesphere.io/kubesphere/pkg/api"
@@ -52,20 +54,35 @@ type PasswordReset struct {
 type TOTOAuthKeyBind struct {
 	AuthKey string `json:"authKey"`
 	OTP     string `json:"otp"`
+	// CurrentOTP is a one-time password or recovery code of the bound auth key, it is required to replace it.
+	CurrentOTP string `json:"currentOTP,omitempty"`
 }
 
 type TOTPAuthKey struct {
 	AuthKey string `json:"authKey"`
 }
 
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+type RecoveryCodesRegenerate struct {
+	// OTP is a one-time password or an unused recovery code of the bound auth key.
+	OTP string `json:"otp"`
+}
+
 type handler struct {
-	im         im.IdentityManagementInterface
-	am         am.AccessManagementInterface
-	authorizer authorizer.Authorizer
+	im            im.IdentityManagementInterface
+	am            am.AccessManagementInterface
+	totp          auth.TOTPAuthenticator
+	tokenOperator auth.TokenManagementInterface
+	loginRecorder auth.LoginRecorder
+	authorizer    authorizer.Authorizer
 }
 
-func NewHandler(im im.IdentityManagementInterface, am am.AccessManagementInterface) rest.Handler {
-	return &handler{im: im, am: am, authorizer: rbac.NewRBACAuthorizer(am)}
+func NewHandler(im im.IdentityManagementInterface, am am.AccessManagementInterface, totp auth.TOTPAuthenticator,
+	tokenOperator auth.TokenManagementInterface, loginRecorder auth.LoginRecorder) rest.Handler {
+	return &handler{im: im, am: am, totp: totp, tokenOperator: tokenOperator, loginRecorder: loginRecorder, authorizer: rbac.NewRBACAuthorizer(am)}
 }
 
 func NewFakeHandler() rest.Handler {
@@ -861,6 +878,166 @@ func (h *handler) UpdateNamespaceMember(request *restful.Request, response *rest
 	response.WriteEntity(servererr.None)
 }
 
+func (h *handler) DescribeTOTP(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	status, err := h.totp.Status(request.Request.Context(), username)
+	if err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(status)
+}
+
+func (h *handler) GenerateTOTPAuthKey(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	key, err := h.totp.GenerateAuthKey(username)
+	if err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(TOTPAuthKey{AuthKey: key.URL()})
+}
+
+func (h *handler) BindTOTPAuthKey(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	var bind TOTOAuthKeyBind
+	if err := request.ReadEntity(&bind); err != nil {
+		api.HandleBadRequest(response, request, err)
+		return
+	}
+
+	codes, err := h.totp.Bind(request.Request.Context(), username, bind.AuthKey, bind.OTP, bind.CurrentOTP)
+	if err != nil {
+		// only the one-time password of the bound auth key is the second factor
+		if err == auth.InvalidCurrentOTPError {
+			h.recordOTPFailure(request, username, err)
+		}
+		h.handleTOTPError(response, request, err)
+		return
+	}
+	response.WriteEntity(RecoveryCodes{Codes: codes})
+}
+
+func (h *handler) RegenerateRecoveryCodes(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	var regenerate RecoveryCodesRegenerate
+	if err := request.ReadEntity(&regenerate); err != nil {
+		api.HandleBadRequest(response, request, err)
+		return
+	}
+
+	codes, err := h.totp.RegenerateRecoveryCodes(request.Request.Context(), username, regenerate.OTP)
+	if err != nil {
+		if err == auth.InvalidOTPError {
+			h.recordOTPFailure(request, username, err)
+		}
+		h.handleTOTPError(response, request, err)
+		return
+	}
+	response.WriteEntity(RecoveryCodes{Codes: codes})
+}
+
+// recordOTPFailure records the invalid one-time password as a failed login attempt,
+// so that the user is blocked after too many attempts.
+func (h *handler) recordOTPFailure(request *restful.Request, username string, otpErr error) {
+	if h.loginRecorder == nil {
+		return
+	}
+	ctx := request.Request.Context()
+	var sourceIP, userAgent string
+	if requestInfo, ok := apirequest.RequestInfoFrom(ctx); ok {
+		sourceIP, userAgent = requestInfo.SourceIP, requestInfo.UserAgent
+	}
+	if err := h.loginRecorder.RecordLogin(ctx, username, iamv1beta1.Token, "", sourceIP, userAgent, otpErr); err != nil {
+		klog.Errorf("Failed to record unsuccessful login attempt for user %s, error: %v", username, err)
+	}
+}
+
+func (h *handler) handleTOTPError(response *restful.Response, request *restful.Request, err error) {
+	switch {
+	case stderrors.Is(err, auth.InvalidOTPError), err == auth.TOTPAlreadyEnrolledError, err == auth.TOTPNotEnrolledError:
+		api.HandleBadRequest(response, request, err)
+	case err == auth.RateLimitExceededError:
+		api.HandleTooManyRequests(response, request, err)
+	default:
+		api.HandleError(response, request, err)
+	}
+}
+
+func (h *handler) UnbindTOTPAuthKey(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	operator, ok := apirequest.UserFrom(request.Request.Context())
+	if !ok {
+		err := errors.NewInternalError(fmt.Errorf("cannot obtain user info"))
+		api.HandleInternalError(response, request, err)
+		return
+	}
+
+	userManagement := authorizer.AttributesRecord{
+		Resource:        "users/totp",
+		Verb:            "delete",
+		ResourceScope:   apirequest.GlobalScope,
+		ResourceRequest: true,
+		User:            operator,
+	}
+	decision, _, err := h.authorizer.Authorize(userManagement)
+	if err != nil {
+		api.HandleInternalError(response, request, err)
+		return
+	}
+
+	// only the user manager can unbind the auth key without a one-time password
+	if decision != authorizer.DecisionAllow {
+		if err = h.totp.Authenticate(request.Request.Context(), username, request.QueryParameter("otp")); err != nil {
+			if err == auth.InvalidOTPError {
+				h.recordOTPFailure(request, username, err)
+			}
+			h.handleTOTPError(response, request, err)
+			return
+		}
+	}
+
+	if err = h.totp.Unbind(request.Request.Context(), username); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(servererr.None)
+}
+
+func (h *handler) ListUserSessions(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	sessions, err := h.tokenOperator.ListSessions(username)
+	if err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(sessions)
+}
+
+func (h *handler) RevokeUserSession(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	sessionID := request.PathParameter("session")
+	if err := h.tokenOperator.RevokeSession(username, sessionID); err != nil {
+		if err == auth.SessionNotFoundError {
+			api.HandleNotFound(response, request, err)
+			return
+		}
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(servererr.None)
+}
+
+// RevokeAllUserSessions signs the user out everywhere.
+func (h *handler) RevokeAllUserSessions(request *restful.Request, response *restful.Response) {
+	username := request.PathParameter("user")
+	if err := h.tokenOperator.RevokeAllUserTokens(username); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.WriteEntity(servererr.None)
+}
+
 func NewErrMemberNotExist(username string) error {
 	return fmt.Errorf("member %s not exist", username)
 }
@@ -17,6 +17,7 @@ import (
 
 	"kubesphere.io/kubesphere/pkg/api"
 	apiserverruntime "kubesphere.io/kubesphere/pkg/apiserver/runtime"
+	"kubesphere.io/kubesphere/pkg/models/auth"
 	"kubesphere.io/kubesphere/pkg/server/errors"
 )
 
@@ -71,6 +72,72 @@ func (h *handler) AddToContainer(container *restful.Container) error {
 		Param(ws.PathParameter("user", "username of the user")).
 		Returns(http.StatusOK, api.StatusOK, api.ListResult{Items: []runtime.Object{&iamv1beta1.LoginRecord{}}}))
 
+	// sessions
+	ws.Route(ws.GET("/users/{user}/sessions").
+		To(h.ListUserSessions).
+		Doc("List sessions").
+		Notes("List the active login sessions of the user, the most recently used session comes first.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Returns(http.StatusOK, api.StatusOK, []auth.Session{}))
+	ws.Route(ws.DELETE("/users/{user}/sessions/{session}").
+		To(h.RevokeUserSession).
+		Doc("Revoke session").
+		Notes("Revoke all tokens issued in the session.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Param(ws.PathParameter("session", "session ID")).
+		Returns(http.StatusOK, api.StatusOK, errors.None))
+	ws.Route(ws.DELETE("/users/{user}/sessions").
+		To(h.RevokeAllUserSessions).
+		Doc("Revoke all sessions").
+		Notes("Sign the user out everywhere by revoking all tokens of the user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Returns(http.StatusOK, api.StatusOK, errors.None))
+
+	// multi-factor authentication
+	ws.Route(ws.GET("/users/{user}/totp").
+		To(h.DescribeTOTP).
+		Doc("Get the multi-factor authentication status").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Returns(http.StatusOK, api.StatusOK, auth.TOTPStatus{}))
+	ws.Route(ws.POST("/users/{user}/totp/authkey").
+		To(h.GenerateTOTPAuthKey).
+		Doc("Generate TOTP auth key").
+		Notes("Generate a TOTP auth key in the otpauth URI format which can be rendered as a QR code, "+
+			"the auth key takes effect after it is bound with a one-time password.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Returns(http.StatusOK, api.StatusOK, TOTPAuthKey{}))
+	ws.Route(ws.POST("/users/{user}/totp/bind").
+		To(h.BindTOTPAuthKey).
+		Doc("Bind TOTP auth key").
+		Notes("Confirm the TOTP auth key with a one-time password, the recovery codes are returned. "+
+			"A bound auth key is only replaced if a one-time password or recovery code of it is provided as currentOTP.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Reads(TOTOAuthKeyBind{}).
+		Returns(http.StatusOK, api.StatusOK, RecoveryCodes{}))
+	ws.Route(ws.POST("/users/{user}/totp/recoverycodes").
+		To(h.RegenerateRecoveryCodes).
+		Doc("Regenerate recovery codes").
+		Notes("Replace the recovery codes, each of them can be used once instead of a one-time password. "+
+			"A one-time password or an unused recovery code is required.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Reads(RecoveryCodesRegenerate{}).
+		Returns(http.StatusOK, api.StatusOK, RecoveryCodes{}))
+	ws.Route(ws.DELETE("/users/{user}/totp").
+		To(h.UnbindTOTPAuthKey).
+		Doc("Unbind TOTP auth key").
+		Notes("A one-time password is required unless the operator is allowed to manage the multi-factor authentication of users.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagIdentityManagement}).
+		Param(ws.PathParameter("user", "username")).
+		Param(ws.QueryParameter("otp", "one-time password or recovery code").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, errors.None))
+
 	// members
 	ws.Route(ws.GET("/clustermembers").
 		To(h.ListClusterMembers).
@@ -7,6 +7,7 @@
 package oauth
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 
 	"kubesphere.io/kubesphere/pkg/api"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/oauth"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
 	"kubesphere.io/kubesphere/pkg/apiserver/query"
@@ -38,6 +40,8 @@ import (
 const (
 	KindTokenReview            = "TokenReview"
 	internalServerErrorMessage = "An internal server error occurred while processing the request."
+	// mfaTokenMaxAge is the time to complete the multi-factor authentication.
+	mfaTokenMaxAge = 5 * time.Minute
 )
 
 type Spec struct {
@@ -56,6 +60,16 @@ type TokenReview struct {
 	Status     *Status `json:"status,omitempty" description:"token review status"`
 }
 
+// MFARequiredError is responded by the token endpoint if the multi-factor authentication
+// must be completed with the otp grant before the tokens are issued.
+type MFARequiredError struct {
+	*oauth.Error
+	// MFAToken is a short-lived token which identifies the authenticated user in the otp grant.
+	MFAToken string `json:"mfa_token"`
+	// MFAEnrolled is false if the user must bind a TOTP auth key in the otp grant.
+	MFAEnrolled bool `json:"mfa_enrolled"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username" description:"username"`
 	Password string `json:"password" description:"password"`
@@ -77,6 +91,8 @@ type ProviderMetadata struct {
 	Auth string `json:"authorization_endpoint"`
 	// URL of the OP's OAuth 2.0 Token Endpoint.
 	Token string `json:"token_endpoint"`
+	// URL of the OAuth 2.0 Device Authorization Endpoint.
+	DeviceAuth string `json:"device_authorization_endpoint"`
 	// URL of the OP's UserInfo Endpoint
 	UserInfo string `json:"userinfo_endpoint"`
 	// URL of the OP's JSON Web Key Set [JWK] document.
@@ -109,6 +125,8 @@ type handler struct {
 	passwordAuthenticator auth.PasswordAuthenticator
 	oauthAuthenticator    auth.OAuthAuthenticator
 	loginRecorder         auth.LoginRecorder
+	totpAuthenticator     auth.TOTPAuthenticator
+	deviceAuthorizer      auth.DeviceAuthorizer
 	clientGetter          oauth.ClientGetter
 }
 
@@ -117,6 +135,8 @@ func NewHandler(im im.IdentityManagementInterface,
 	passwordAuthenticator auth.PasswordAuthenticator,
 	oauth2Authenticator auth.OAuthAuthenticator,
 	loginRecorder auth.LoginRecorder,
+	totpAuthenticator auth.TOTPAuthenticator,
+	deviceAuthorizer auth.DeviceAuthorizer,
 	options *authentication.Options,
 	oauthOperator oauth.ClientGetter) rest.Handler {
 	handler := &handler{im: im,
@@ -124,6 +144,8 @@ func NewHandler(im im.IdentityManagementInterface,
 		passwordAuthenticator: passwordAuthenticator,
 		oauthAuthenticator:    oauth2Authenticator,
 		loginRecorder:         loginRecorder,
+		totpAuthenticator:     totpAuthenticator,
+		deviceAuthorizer:      deviceAuthorizer,
 		options:               options,
 		clientGetter:          oauthOperator}
 	return handler
@@ -173,14 +195,16 @@ func (h *handler) discovery(_ *restful.Request, response *restful.Response) {
 		Issuer:            h.options.Issuer.URL,
 		Auth:              h.options.Issuer.URL + root + "/authorize",
 		Token:             h.options.Issuer.URL + root + "/token",
+		DeviceAuth:        h.options.Issuer.URL + root + "/device_authorization",
 		Keys:              h.options.Issuer.URL + root + "/keys",
 		UserInfo:          h.options.Issuer.URL + root + "/userinfo",
 		Subjects:          []string{"public"},
-		GrantTypes:        []string{oauth.GrantTypeAuthorizationCode, oauth.GrantTypeRefreshToken},
+		GrantTypes:        append(append([]string{}, oauth.ValidGrantTypes...), oauth.GrantTypeOTP),
 		IDTokenAlgs:       []string{string(jose.RS256)},
-		CodeChallengeAlgs: []string{"plain", "S256"},
+		CodeChallengeAlgs: []string{oauth.CodeChallengeMethodS256},
 		Scopes:            []string{oauth.ScopeOpenID, oauth.ScopeEmail, oauth.ScopeProfile},
-		AuthMethods:       []string{"client_secret_post"},
+		// public clients are not authenticated
+		AuthMethods: []string{"client_secret_post", "none"},
 		Claims: []string{
 			"iss", "sub", "aud", "iat", "exp", "email", "locale", "preferred_username",
 		},
@@ -202,7 +226,7 @@ func (h *handler) keys(_ *restful.Request, response *restful.Response) {
 
 // The Authorization Endpoint performs Authentication of the End-User.
 func (h *handler) authorize(req *restful.Request, response *restful.Response) {
-	var scope, responseType, clientID, redirectURI, state, nonce, prompt string
+	var scope, responseType, clientID, redirectURI, state, nonce, prompt, codeChallenge, codeChallengeMethod string
 	scope = req.QueryParameter("scope")
 	clientID = req.QueryParameter("client_id")
 	redirectURI = req.QueryParameter("redirect_uri")
@@ -210,6 +234,8 @@ func (h *handler) authorize(req *restful.Request, response *restful.Response) {
 	state = req.QueryParameter("state")
 	nonce = req.QueryParameter("nonce")
 	prompt = req.QueryParameter("prompt")
+	codeChallenge = req.QueryParameter("code_challenge")
+	codeChallengeMethod = req.QueryParameter("code_challenge_method")
 	// Authorization Servers MUST support the use of the HTTP GET and POST methods
 	// defined in RFC 2616 [RFC2616] at the Authorization Endpoint.
 	if req.Request.Method == http.MethodPost {
@@ -220,6 +246,8 @@ func (h *handler) authorize(req *restful.Request, response *restful.Response) {
 		state, _ = req.BodyParameter("state")
 		nonce, _ = req.BodyParameter("nonce")
 		prompt, _ = req.BodyParameter("prompt")
+		codeChallenge, _ = req.BodyParameter("code_challenge")
+		codeChallengeMethod, _ = req.BodyParameter("code_challenge_method")
 	}
 
 	client, err := h.clientGetter.GetOAuthClient(req.Request.Context(), clientID)
@@ -285,6 +313,22 @@ func (h *handler) authorize(req *restful.Request, response *restful.Response) {
 		return
 	}
 
+	if responseType == oauth.ResponseTypeCode {
+		if !client.IsGrantTypeAllowed(oauth.GrantTypeAuthorizationCode) {
+			informsError(oauth.NewError(oauth.UnauthorizedClient, "The client is not authorized to use the authorization code grant."))
+			return
+		}
+		// https://datatracker.ietf.org/doc/html/rfc7636#section-4.4.1
+		if codeChallenge == "" && client.RequirePKCE {
+			informsError(oauth.NewInvalidRequest("Code challenge required."))
+			return
+		}
+		if codeChallenge != "" && codeChallengeMethod != oauth.CodeChallengeMethodS256 {
+			informsError(oauth.NewInvalidRequest("Transform algorithm not supported."))
+			return
+		}
+	}
+
 	authenticated, _ := request.UserFrom(req.Request.Context())
 	if authenticated == nil || authenticated.GetName() == user.Anonymous {
 		if prompt == "none" {
@@ -314,6 +358,7 @@ func (h *handler) authorize(req *restful.Request, response *restful.Response) {
 			scopes:        scopes,
 			redirectURL:   redirectURL,
 			state:         state,
+			codeChallenge: codeChallenge,
 		})
 	case oauth.ResponseTypeIDToken:
 		h.handleAuthIDTokenRequest(req, response, &authIDTokenRequest{
@@ -339,8 +384,12 @@ func (h *handler) oauthCallback(req *restful.Request, response *restful.Response
 		return
 	}
 
+	if h.requireMFA(req, response, &mfaRequest{authenticated: authenticated, provider: provider}) {
+		return
+	}
+
 	// TODO(@hongming) using the really client configuration
-	result, err := h.issueTokenTo(authenticated, nil)
+	result, err := h.issueTokenTo(authenticated, nil, newSession(req, provider))
 	if err != nil {
 		klog.Errorf("failed to issue token: %s", err)
 		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
@@ -355,13 +404,59 @@ func (h *handler) oauthCallback(req *restful.Request, response *restful.Response
 	_ = response.WriteEntity(result)
 }
 
+// login redirects the user agent to the identity provider which builds the login request itself,
+// such as the SAML AuthnRequest, the state is sent back to the callback by the identity provider.
+// The login request is bound to the user agent by the cookie of the identity provider.
+func (h *handler) login(req *restful.Request, response *restful.Response) {
+	providerName := req.PathParameter("provider")
+	provider, exist := identityprovider.SharedIdentityProviderController.GetOAuthProvider(providerName)
+	if !exist {
+		api.HandleNotFound(response, req, fmt.Errorf("identity provider %s not found", providerName))
+		return
+	}
+	initiator, ok := provider.(identityprovider.LoginInitiator)
+	if !ok {
+		api.HandleBadRequest(response, req, fmt.Errorf("identity provider %s does not support login initiation", providerName))
+		return
+	}
+	loginURL, cookie, err := initiator.LoginURL(req.QueryParameter("state"))
+	if err != nil {
+		api.HandleInternalError(response, req, fmt.Errorf("failed to build the login request: %s", err))
+		return
+	}
+	if cookie != nil {
+		http.SetCookie(response, cookie)
+	}
+	http.Redirect(response, req.Request, loginURL, http.StatusFound)
+}
+
+// metadata publishes the metadata of KubeSphere as a relying party of the identity provider.
+func (h *handler) metadata(req *restful.Request, response *restful.Response) {
+	providerName := req.PathParameter("provider")
+	provider, exist := identityprovider.SharedIdentityProviderController.GetOAuthProvider(providerName)
+	if !exist {
+		api.HandleNotFound(response, req, fmt.Errorf("identity provider %s not found", providerName))
+		return
+	}
+	metadataProvider, ok := provider.(identityprovider.MetadataProvider)
+	if !ok {
+		api.HandleNotFound(response, req, fmt.Errorf("identity provider %s does not publish metadata", providerName))
+		return
+	}
+	contentType, data, err := metadataProvider.Metadata()
+	if err != nil {
+		api.HandleInternalError(response, req, fmt.Errorf("failed to generate metadata: %s", err))
+		return
+	}
+	response.Header().Set("Content-Type", contentType)
+	_, _ = response.Write(data)
+}
+
 // token handles the Token Request to obtain an Access Token, an ID Token, and optionally a Refresh Token.
 // This is used in the Authorization Code Flow, where the RP (Client) sends a Token Request to the Token Endpoint
 // (described in Section 3.2 of OAuth 2.0 [RFC6749]) to obtain a Token Response.
 // Communication with the Token Endpoint is required to utilize TLS for security.
 func (h *handler) token(req *restful.Request, response *restful.Response) {
-	clientID, _ := req.BodyParameter("client_id")
-	clientSecret, _ := req.BodyParameter("client_secret")
 	grantType, _ := req.BodyParameter("grant_type")
 
 	// All Token Responses containing sensitive information MUST include the following HTTP response header fields and values:
@@ -370,28 +465,21 @@ func (h *handler) token(req *restful.Request, response *restful.Response) {
 	response.Header().Set("Cache-Control", "no-store")
 	response.Header().Set("Pragma", "no-cache")
 
-	// Retrieve the OAuth client associated with the provided client_id.
-	client, err := h.clientGetter.GetOAuthClient(req.Request.Context(), clientID)
-	if err != nil {
-		if errors.Is(err, oauth.ErrorClientNotFound) {
-			klog.Warningf("The provided client_id %s is invalid or does not exist.", clientID)
-			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidClient("The provided client_id is invalid or does not exist."))
-			return
-		}
-		klog.Errorf("failed to get oauth client: %v", err)
-		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+	client := h.authenticateClient(req, response)
+	if client == nil {
 		return
 	}
 
-	// Check if the client_secret matches the one associated with the retrieved client.
-	if client.Secret != clientSecret {
-		klog.Warningf("Invalid client credential for client_id %s", clientID)
-		_ = response.WriteHeaderAndEntity(http.StatusUnauthorized, oauth.NewError(oauth.UnauthorizedClient, "Invalid client credential."))
+	unsupportedGrantType := oauth.NewError(oauth.UnsupportedGrantType, "The provided grant_type is not supported.")
+
+	// The otp grant continues the other grants, and the mfa token is bound to the client.
+	if grantType != oauth.GrantTypeOTP && !client.IsGrantTypeAllowed(grantType) {
+		klog.Warningf("The client %s is not authorized to use the grant_type %s.", client.Name, grantType)
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.UnauthorizedClient,
+			"The client is not authorized to use this grant type."))
 		return
 	}
 
-	unsupportedGrantType := oauth.NewError(oauth.UnsupportedGrantType, "The provided grant_type is not supported.")
-
 	switch grantType {
 	case oauth.GrantTypePassword:
 		if client.Trusted {
@@ -404,12 +492,256 @@ func (h *handler) token(req *restful.Request, response *restful.Response) {
 		h.refreshTokenGrant(req, response, client)
 	case oauth.GrantTypeCode, oauth.GrantTypeAuthorizationCode:
 		h.codeGrant(req, response, client)
+	case oauth.GrantTypeOTP:
+		h.otpGrant(req, response, client)
+	case oauth.GrantTypeClientCredentials:
+		h.clientCredentialsGrant(req, response, client)
+	case oauth.GrantTypeDeviceCode:
+		h.deviceCodeGrant(req, response, client)
 	default:
 		klog.Warningf("The provided grant_type %s is not supported.", grantType)
 		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, unsupportedGrantType)
 	}
 }
 
+// authenticateClient retrieves the OAuth client and verifies the client credential, nil is returned
+// if the client is not authenticated and the error response is written.
+// The clients without a secret are public clients, such as single-page applications and CLI tools.
+func (h *handler) authenticateClient(req *restful.Request, response *restful.Response) *oauth.Client {
+	clientID, _ := req.BodyParameter("client_id")
+	clientSecret, _ := req.BodyParameter("client_secret")
+
+	// Retrieve the OAuth client associated with the provided client_id.
+	client, err := h.clientGetter.GetOAuthClient(req.Request.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, oauth.ErrorClientNotFound) {
+			klog.Warningf("The provided client_id %s is invalid or does not exist.", clientID)
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidClient("The provided client_id is invalid or does not exist."))
+			return nil
+		}
+		klog.Errorf("failed to get oauth client: %v", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return nil
+	}
+
+	// Check if the client_secret matches the one associated with the retrieved client.
+	if subtle.ConstantTimeCompare([]byte(client.Secret), []byte(clientSecret)) != 1 {
+		klog.Warningf("Invalid client credential for client_id %s", clientID)
+		_ = response.WriteHeaderAndEntity(http.StatusUnauthorized, oauth.NewError(oauth.UnauthorizedClient, "Invalid client credential."))
+		return nil
+	}
+	return client
+}
+
+// clientCredentialsGrant handles the Client Credentials Grant.
+// For more details, refer to: https://datatracker.ietf.org/doc/html/rfc6749#section-4.4
+//
+// The access token represents the user configured by the clientCredentialsUser of the client,
+// and a refresh token SHOULD NOT be included.
+func (h *handler) clientCredentialsGrant(req *restful.Request, response *restful.Response, client *oauth.Client) {
+	// public clients can not be authenticated
+	if client.Secret == "" || client.ClientCredentialsUser == "" {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.UnauthorizedClient,
+			"The client is not authorized to use this grant type."))
+		return
+	}
+
+	scope, _ := req.BodyParameter("scope")
+	if scope != "" && !client.IsValidScope(scope) {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidScope("The requested scope is invalid or not supported."))
+		return
+	}
+
+	credentialsUser, err := h.im.DescribeUser(client.ClientCredentialsUser)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("The client credentials user does not exist."))
+			return
+		}
+		klog.Errorf("failed to get user: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+	// The same as the password grant, only the active users can be represented by the access token.
+	switch credentialsUser.Status.State {
+	case iamv1beta1.UserActive:
+	case iamv1beta1.UserAuthLimitExceeded:
+		_ = response.WriteHeaderAndEntity(http.StatusTooManyRequests, oauth.NewInvalidGrant("Rate limit exceeded."))
+		return
+	default:
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("Account suspended."))
+		return
+	}
+
+	accessTokenMaxAge := h.options.Issuer.AccessTokenMaxAge
+	if client.AccessTokenMaxAgeSeconds > 0 {
+		accessTokenMaxAge = time.Duration(client.AccessTokenMaxAgeSeconds) * time.Second
+	}
+	accessToken, err := h.tokenOperator.IssueTo(&token.IssueRequest{
+		User: &user.DefaultInfo{Name: client.ClientCredentialsUser},
+		Claims: token.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience: []string{client.Name},
+			},
+			TokenType: token.AccessToken,
+		},
+		ExpiresIn: accessTokenMaxAge,
+	})
+	if err != nil {
+		klog.Errorf("failed to issue token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	_ = response.WriteEntity(&oauth.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(accessTokenMaxAge.Seconds()),
+	})
+}
+
+// deviceAuthorization handles the Device Authorization Request.
+// For more details, refer to: https://datatracker.ietf.org/doc/html/rfc8628#section-3.1
+func (h *handler) deviceAuthorization(req *restful.Request, response *restful.Response) {
+	response.Header().Set("Cache-Control", "no-store")
+	response.Header().Set("Pragma", "no-cache")
+
+	client := h.authenticateClient(req, response)
+	if client == nil {
+		return
+	}
+	if !client.IsGrantTypeAllowed(oauth.GrantTypeDeviceCode) {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.UnauthorizedClient,
+			"The client is not authorized to use the device authorization grant."))
+		return
+	}
+
+	scope, _ := req.BodyParameter("scope")
+	var scopes []string
+	if scope != "" {
+		if !client.IsValidScope(scope) {
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidScope("The requested scope is invalid or not supported."))
+			return
+		}
+		scopes = strings.Split(scope, " ")
+	}
+
+	deviceCode, userCode, err := h.deviceAuthorizer.Authorize(client.Name, scopes)
+	if err != nil {
+		klog.Errorf("failed to authorize device: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	// the user opens the verification page of the console in the browser,
+	// which submits the user code to the device verification endpoint
+	verificationURI := h.options.Issuer.DeviceVerificationURI
+	if verificationURI == "" {
+		verificationURI = h.options.Issuer.URL + "/device"
+	}
+	verificationURIComplete, err := url.Parse(verificationURI)
+	if err != nil {
+		klog.Errorf("invalid device verification uri %s: %s", verificationURI, err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+	query := verificationURIComplete.Query()
+	query.Set("user_code", userCode)
+	verificationURIComplete.RawQuery = query.Encode()
+
+	_ = response.WriteEntity(&oauth.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURIComplete.String(),
+		ExpiresIn:               int(auth.DeviceCodeExpiresIn.Seconds()),
+		Interval:                int(auth.DevicePollInterval.Seconds()),
+	})
+}
+
+// deviceVerification approves or denies the device authorization of the user code
+// on behalf of the authenticated user.
+func (h *handler) deviceVerification(req *restful.Request, response *restful.Response) {
+	authenticated, _ := request.UserFrom(req.Request.Context())
+	if authenticated == nil || authenticated.GetName() == user.Anonymous ||
+		authenticated.GetName() == iamv1beta1.PreRegistrationUser {
+		_ = response.WriteHeaderAndEntity(http.StatusUnauthorized, oauth.NewError(oauth.LoginRequired, "Not authenticated."))
+		return
+	}
+
+	userCode, _ := req.BodyParameter("user_code")
+	action, _ := req.BodyParameter("action")
+	if action != "" && action != "approve" && action != "deny" {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("The action must be approve or deny."))
+		return
+	}
+
+	// the authenticated user info does not carry the extra of the token
+	if err := h.deviceAuthorizer.Approve(userCode, &user.DefaultInfo{Name: authenticated.GetName()}, action != "deny"); err != nil {
+		if errors.Is(err, auth.InvalidUserCodeError) {
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("The user code is invalid or expired."))
+			return
+		}
+		klog.Errorf("failed to approve device authorization: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	_ = response.WriteAsJson(serverrors.None)
+}
+
+// deviceCodeGrant handles the Device Access Token Request which is polled by the device.
+// For more details, refer to: https://datatracker.ietf.org/doc/html/rfc8628#section-3.4
+func (h *handler) deviceCodeGrant(req *restful.Request, response *restful.Response, client *oauth.Client) {
+	deviceCode, _ := req.BodyParameter("device_code")
+	if deviceCode == "" {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("The device code is empty or missing."))
+		return
+	}
+
+	authenticated, scopes, err := h.deviceAuthorizer.Poll(client.Name, deviceCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.AuthorizationPendingError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.AuthorizationPending, ""))
+		case errors.Is(err, auth.SlowDownError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.SlowDown, ""))
+		case errors.Is(err, auth.AccessDeniedError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.AccessDenied, "The authorization request was denied."))
+		case errors.Is(err, auth.ExpiredDeviceCodeError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewError(oauth.ExpiredToken, "The device code is invalid or expired."))
+		default:
+			klog.Errorf("failed to poll device authorization: %s", err)
+			_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		}
+		return
+	}
+
+	result, err := h.issueTokenTo(authenticated, client, newSession(req, ""))
+	if err != nil {
+		klog.Errorf("failed to issue token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	if err = h.issueIDTokenTo(result, &idTokenRequest{
+		authenticated: authenticated,
+		client:        client,
+		scopes:        scopes,
+	}); err != nil {
+		klog.Errorf("failed to issue id token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	requestInfo, _ := request.RequestInfoFrom(req.Request.Context())
+	if err = h.loginRecorder.RecordLogin(req.Request.Context(), authenticated.GetName(), iamv1beta1.Token, "", requestInfo.SourceIP, requestInfo.UserAgent, nil); err != nil {
+		klog.Errorf("Failed to record successful login for user %s, error: %v", authenticated.GetName(), err)
+	}
+
+	_ = response.WriteEntity(result)
+}
+
 // passwordGrant handles the Resource Owner Password Credentials Grant.
 // For more details, refer to: https://datatracker.ietf.org/doc/html/rfc6749#section-4.3
 //
@@ -453,8 +785,13 @@ func (h *handler) passwordGrant(req *restful.Request, response *restful.Response
 		}
 	}
 
+	// The multi-factor authentication is completed with the otp grant.
+	if h.requireMFA(req, response, &mfaRequest{authenticated: authenticated, client: client, provider: provider}) {
+		return
+	}
+
 	// Issue token to the authenticated user.
-	result, err := h.issueTokenTo(authenticated, client)
+	result, err := h.issueTokenTo(authenticated, client, newSession(req, provider))
 	if err != nil {
 		// Failed to issue token.
 		klog.Errorf("Failed to issue token: %s", err)
@@ -472,7 +809,7 @@ func (h *handler) passwordGrant(req *restful.Request, response *restful.Response
 	_ = response.WriteEntity(result)
 }
 
-func (h *handler) issueTokenTo(user user.Info, client *oauth.Client) (*oauth.Token, error) {
+func (h *handler) issueTokenTo(user user.Info, client *oauth.Client, session *auth.Session) (*oauth.Token, error) {
 	accessTokenMaxAge := h.options.Issuer.AccessTokenMaxAge
 	accessTokenInactivityTimeout := h.options.Issuer.AccessTokenInactivityTimeout
 	if client != nil && client.AccessTokenMaxAgeSeconds > 0 && client.AccessTokenInactivityTimeoutSeconds > 0 {
@@ -485,9 +822,29 @@ func (h *handler) issueTokenTo(user user.Info, client *oauth.Client) (*oauth.Tok
 			return nil, err
 		}
 	}
+
+	// the tokens can not be revoked if they never expire, so the session is not tracked
+	var sessionID string
+	if session != nil && accessTokenMaxAge > 0 {
+		session.Username = user.GetName()
+		if client != nil {
+			session.Client = client.Name
+		}
+		err := h.tokenOperator.SaveSession(session, accessTokenMaxAge+accessTokenInactivityTimeout)
+		// the session has been revoked or expired, start a new one
+		if errors.Is(err, auth.SessionNotFoundError) {
+			session.ID = ""
+			err = h.tokenOperator.SaveSession(session, accessTokenMaxAge+accessTokenInactivityTimeout)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessionID = session.ID
+	}
+
 	accessToken, err := h.tokenOperator.IssueTo(&token.IssueRequest{
 		User:      user,
-		Claims:    token.Claims{TokenType: token.AccessToken},
+		Claims:    token.Claims{TokenType: token.AccessToken, SessionID: sessionID},
 		ExpiresIn: accessTokenMaxAge,
 	})
 	if err != nil {
@@ -495,7 +852,7 @@ func (h *handler) issueTokenTo(user user.Info, client *oauth.Client) (*oauth.Tok
 	}
 	refreshToken, err := h.tokenOperator.IssueTo(&token.IssueRequest{
 		User:      user,
-		Claims:    token.Claims{TokenType: token.RefreshToken},
+		Claims:    token.Claims{TokenType: token.RefreshToken, SessionID: sessionID},
 		ExpiresIn: accessTokenMaxAge + accessTokenInactivityTimeout,
 	})
 	if err != nil {
@@ -512,6 +869,16 @@ func (h *handler) issueTokenTo(user user.Info, client *oauth.Client) (*oauth.Tok
 	return &result, nil
 }
 
+// newSession returns the metadata of the login session initiated by the request.
+func newSession(req *restful.Request, provider string) *auth.Session {
+	requestInfo, _ := request.RequestInfoFrom(req.Request.Context())
+	return &auth.Session{
+		Provider:  provider,
+		IP:        requestInfo.SourceIP,
+		UserAgent: requestInfo.UserAgent,
+	}
+}
+
 func (h *handler) refreshTokenGrant(req *restful.Request, response *restful.Response, client *oauth.Client) {
 	refreshToken, _ := req.BodyParameter("refresh_token")
 	verified, err := h.tokenOperator.Verify(refreshToken)
@@ -548,7 +915,10 @@ func (h *handler) refreshTokenGrant(req *restful.Request, response *restful.Resp
 		authenticated = &user.DefaultInfo{Name: users.Items[0].(*iamv1beta1.User).Name}
 	}
 
-	result, err := h.issueTokenTo(authenticated, client)
+	// the refreshed tokens continue the login session
+	session := newSession(req, "")
+	session.ID = verified.SessionID
+	result, err := h.issueTokenTo(authenticated, client, session)
 	if err != nil {
 		klog.Errorf("failed to issue token: %s", err)
 		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
@@ -571,11 +941,21 @@ func (h *handler) codeGrant(req *restful.Request, response *restful.Response, cl
 	}
 
 	authorizeContext, err := h.tokenOperator.Verify(code)
-	if err != nil || authorizeContext.TokenType != token.AuthorizationCode {
+	if err != nil || authorizeContext.TokenType != token.AuthorizationCode ||
+		!sliceutil.HasString(authorizeContext.Audience, client.Name) {
 		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("The authorization code is invalid or expired."))
 		return
 	}
 
+	// https://datatracker.ietf.org/doc/html/rfc7636#section-4.6
+	codeVerifier, _ := req.BodyParameter("code_verifier")
+	if authorizeContext.CodeChallenge != "" || client.RequirePKCE {
+		if !oauth.VerifyCodeChallenge(authorizeContext.CodeChallenge, codeVerifier) {
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("The code verifier is invalid."))
+			return
+		}
+	}
+
 	defer func() {
 		// The client MUST NOT use the authorization code more than once.
 		if err = h.tokenOperator.Revoke(code); err != nil {
@@ -583,41 +963,210 @@ func (h *handler) codeGrant(req *restful.Request, response *restful.Response, cl
 		}
 	}()
 
-	result, err := h.issueTokenTo(authorizeContext.User, client)
-	if err != nil {
-		klog.Errorf("failed to issue token: %s", err)
-		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+	if h.requireMFA(req, response, &mfaRequest{
+		authenticated: authorizeContext.User,
+		client:        client,
+		scopes:        authorizeContext.Scopes,
+		nonce:         authorizeContext.Nonce,
+	}) {
 		return
 	}
 
-	// If no openid scope value is present, the request may still be a valid OAuth 2.0 request,
-	// but is not an OpenID Connect request.
-	if !sliceutil.HasString(authorizeContext.Scopes, oauth.ScopeOpenID) {
-		_ = response.WriteEntity(result)
+	result, err := h.issueTokenTo(authorizeContext.User, client, newSession(req, ""))
+	if err != nil {
+		klog.Errorf("failed to issue token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
 		return
 	}
 
-	idTokenRequest, err := h.buildIDTokenIssueRequest(&idTokenRequest{
+	if err = h.issueIDTokenTo(result, &idTokenRequest{
 		authenticated: authorizeContext.User,
 		client:        client,
 		scopes:        authorizeContext.Scopes,
 		nonce:         authorizeContext.Nonce,
-	})
+	}); err != nil {
+		klog.Errorf("failed to issue id token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	_ = response.WriteEntity(result)
+}
+
+// issueIDTokenTo adds an ID token to the result if the openid scope is requested.
+func (h *handler) issueIDTokenTo(result *oauth.Token, request *idTokenRequest) error {
+	// If no openid scope value is present, the request may still be a valid OAuth 2.0 request,
+	// but is not an OpenID Connect request.
+	if !sliceutil.HasString(request.scopes, oauth.ScopeOpenID) {
+		return nil
+	}
 
+	idTokenRequest, err := h.buildIDTokenIssueRequest(request)
 	if err != nil {
-		klog.Errorf("failed to build id token request: %s", err)
+		return fmt.Errorf("failed to build id token request: %s", err)
+	}
+
+	idToken, err := h.tokenOperator.IssueTo(idTokenRequest)
+	if err != nil {
+		return err
+	}
+
+	result.IDToken = idToken
+	return nil
+}
+
+type mfaRequest struct {
+	authenticated user.Info
+	client        *oauth.Client
+	provider      string
+	scopes        []string
+	nonce         string
+}
+
+// requireMFA responds with the mfa_required error and returns true if the user must complete
+// the multi-factor authentication with the otp grant before the tokens are issued.
+func (h *handler) requireMFA(req *restful.Request, response *restful.Response, request *mfaRequest) bool {
+	// the pre-registration users have no auth key bound
+	if h.totpAuthenticator == nil || request.authenticated.GetName() == iamv1beta1.PreRegistrationUser {
+		return false
+	}
+
+	status, err := h.totpAuthenticator.Status(req.Request.Context(), request.authenticated.GetName())
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		klog.Errorf("failed to get the multi-factor authentication status: %s", err)
 		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return true
+	}
+	if !status.Required {
+		return false
+	}
+
+	// the identity provider is carried by the mfa token to record the login
+	extra := make(map[string][]string)
+	for k, v := range request.authenticated.GetExtra() {
+		extra[k] = v
+	}
+	if request.provider != "" {
+		extra[iamv1beta1.ExtraIdentityProvider] = []string{request.provider}
+	}
+
+	issueRequest := &token.IssueRequest{
+		User: &user.DefaultInfo{Name: request.authenticated.GetName(), Extra: extra},
+		Claims: token.Claims{
+			TokenType: token.MFAToken,
+			Scopes:    request.scopes,
+			Nonce:     request.nonce,
+		},
+		ExpiresIn: mfaTokenMaxAge,
+	}
+	// the mfa token can only be used by the client it is issued to
+	if request.client != nil {
+		issueRequest.Audience = []string{request.client.Name}
+	}
+
+	mfaToken, err := h.tokenOperator.IssueTo(issueRequest)
+	if err != nil {
+		klog.Errorf("failed to issue mfa token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return true
+	}
+
+	_ = response.WriteHeaderAndEntity(http.StatusForbidden, &MFARequiredError{
+		Error:       oauth.NewError(oauth.MFARequired, "Multi-factor authentication is required."),
+		MFAToken:    mfaToken,
+		MFAEnrolled: status.Enabled,
+	})
+	return true
+}
+
+// otpGrant completes the multi-factor authentication with the mfa token responded by the other grants
+// and a one-time password or a recovery code. If no TOTP auth key is bound to the user yet, a new auth key
+// must be provided with the auth_key parameter and it is bound after the one-time password is verified.
+func (h *handler) otpGrant(req *restful.Request, response *restful.Response, client *oauth.Client) {
+	mfaToken, _ := req.BodyParameter("mfa_token")
+	otp, _ := req.BodyParameter("otp")
+	authKey, _ := req.BodyParameter("auth_key")
+
+	verified, err := h.tokenOperator.Verify(mfaToken)
+	if err != nil || verified.TokenType != token.MFAToken ||
+		(len(verified.Audience) > 0 && !sliceutil.HasString(verified.Audience, client.Name)) {
+		_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("The mfa token is invalid or expired."))
 		return
 	}
 
-	idToken, err := h.tokenOperator.IssueTo(idTokenRequest)
+	ctx := req.Request.Context()
+	username := verified.User.GetName()
+	extra := make(map[string][]string)
+	for k, v := range verified.User.GetExtra() {
+		extra[k] = v
+	}
+	var provider string
+	if providers := extra[iamv1beta1.ExtraIdentityProvider]; len(providers) > 0 {
+		provider = providers[0]
+		delete(extra, iamv1beta1.ExtraIdentityProvider)
+	}
+	authenticated := &user.DefaultInfo{Name: username, Extra: extra}
+
+	if authKey != "" {
+		// the bound auth key can not be replaced in the otp grant
+		_, err = h.totpAuthenticator.Bind(ctx, username, authKey, otp, "")
+	} else {
+		err = h.totpAuthenticator.Authenticate(ctx, username, otp)
+	}
+
+	requestInfo, _ := request.RequestInfoFrom(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.InvalidOTPError):
+			// Record unsuccessful login attempt, the user is blocked after too many attempts.
+			if err := h.loginRecorder.RecordLogin(ctx, username, iamv1beta1.Token, provider, requestInfo.SourceIP, requestInfo.UserAgent, err); err != nil {
+				klog.Errorf("Failed to record unsuccessful login attempt for user %s, error: %v", username, err)
+			}
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidGrant("Invalid one-time password."))
+		case errors.Is(err, auth.TOTPNotEnrolledError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("A TOTP auth key must be bound with the auth_key parameter."))
+		case errors.Is(err, auth.TOTPAlreadyEnrolledError):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("A TOTP auth key is already bound."))
+		case errors.Is(err, auth.RateLimitExceededError):
+			_ = response.WriteHeaderAndEntity(http.StatusTooManyRequests, oauth.NewInvalidGrant("Rate limit exceeded."))
+		case apierrors.IsBadRequest(err):
+			_ = response.WriteHeaderAndEntity(http.StatusBadRequest, oauth.NewInvalidRequest("The auth key is invalid."))
+		default:
+			klog.Errorf("Multi-factor authentication failed: %s", err)
+			_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		}
+		return
+	}
+
+	// The mfa token MUST NOT be used more than once.
+	if err = h.tokenOperator.Revoke(mfaToken); err != nil {
+		klog.Warningf("grant: failed to revoke mfa token: %v", err)
+	}
+
+	result, err := h.issueTokenTo(authenticated, client, newSession(req, provider))
 	if err != nil {
+		klog.Errorf("failed to issue token: %s", err)
+		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
+		return
+	}
+
+	if err = h.issueIDTokenTo(result, &idTokenRequest{
+		authenticated: authenticated,
+		client:        client,
+		scopes:        verified.Scopes,
+		nonce:         verified.Nonce,
+	}); err != nil {
 		klog.Errorf("failed to issue id token: %s", err)
 		_ = response.WriteHeaderAndEntity(http.StatusInternalServerError, oauth.NewServerError(internalServerErrorMessage))
 		return
 	}
 
-	result.IDToken = idToken
+	if err = h.loginRecorder.RecordLogin(ctx, username, iamv1beta1.Token, provider, requestInfo.SourceIP, requestInfo.UserAgent, nil); err != nil {
+		klog.Errorf("Failed to record successful login for user %s, error: %v", username, err)
+	}
 
 	_ = response.WriteEntity(result)
 }
@@ -735,6 +1284,7 @@ type authCodeRequest struct {
 	scopes        []string
 	redirectURL   *url.URL
 	state         string
+	codeChallenge string
 }
 
 func (h *handler) handleAuthorizationCodeRequest(req *restful.Request, response *restful.Response, authCodeRequest authCodeRequest) {
@@ -744,9 +1294,10 @@ func (h *handler) handleAuthorizationCodeRequest(req *restful.Request, response
 			RegisteredClaims: jwt.RegisteredClaims{
 				Audience: []string{authCodeRequest.clientID},
 			},
-			TokenType: token.AuthorizationCode,
-			Nonce:     authCodeRequest.nonce,
-			Scopes:    authCodeRequest.scopes,
+			TokenType:     token.AuthorizationCode,
+			Nonce:         authCodeRequest.nonce,
+			Scopes:        authCodeRequest.scopes,
+			CodeChallenge: authCodeRequest.codeChallenge,
 		},
 		// A maximum authorization code lifetime of 10 minutes is
 		ExpiresIn: 10 * time.Minute,
@@ -0,0 +1,405 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/oauth"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/totp"
+	"kubesphere.io/kubesphere/pkg/apiserver/request"
+	"kubesphere.io/kubesphere/pkg/models/auth"
+	"kubesphere.io/kubesphere/pkg/models/iam/im"
+	"kubesphere.io/kubesphere/pkg/scheme"
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+func TestOTPGrant(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := authentication.NewOptions()
+	options.Issuer.JWTSecret = "kubesphere"
+	tokenOperator, err := auth.NewTokenOperator(c, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClient := runtimefakeclient.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(&iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Name: "admin", UID: "1"}}).
+		Build()
+	totpAuthenticator := auth.NewTOTPAuthenticator(fakeClient, options)
+	h := &handler{
+		options:           options,
+		tokenOperator:     tokenOperator,
+		loginRecorder:     auth.NewLoginRecorder(fakeClient),
+		totpAuthenticator: totpAuthenticator,
+	}
+	client := &oauth.Client{Name: "kubesphere"}
+
+	issueMFAToken := func(audience string) string {
+		issueRequest := &token.IssueRequest{
+			User:      &user.DefaultInfo{Name: "admin"},
+			Claims:    token.Claims{TokenType: token.MFAToken},
+			ExpiresIn: time.Minute,
+		}
+		issueRequest.Audience = []string{audience}
+		mfaToken, err := tokenOperator.IssueTo(issueRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mfaToken
+	}
+	grant := func(values url.Values) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(request.WithRequestInfo(context.Background(), &request.RequestInfo{SourceIP: "10.0.0.1"}))
+		recorder := httptest.NewRecorder()
+		response := restful.NewResponse(recorder)
+		response.SetRequestAccepts(restful.MIME_JSON)
+		h.otpGrant(restful.NewRequest(req), response, client)
+		result := make(map[string]interface{})
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, result
+	}
+
+	key, err := totp.Generate("KubeSphere", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := key.Counter(time.Now())
+	otp := func(counter uint64) string {
+		code, err := key.Code(counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		// the mfa token is issued to the client if the audience is empty
+		audience   string
+		values     url.Values
+		statusCode int
+		errorType  oauth.ErrorType
+	}{
+		{
+			name:       "mfa token issued to another client",
+			audience:   "kubectl",
+			values:     url.Values{"otp": {otp(counter)}},
+			statusCode: http.StatusBadRequest,
+			errorType:  oauth.InvalidGrant,
+		},
+		{
+			name:       "no auth key bound",
+			values:     url.Values{"otp": {otp(counter)}},
+			statusCode: http.StatusBadRequest,
+			errorType:  oauth.InvalidRequest,
+		},
+		{
+			name:       "invalid auth key",
+			values:     url.Values{"otp": {otp(counter)}, "auth_key": {"otpauth://hotp/admin"}},
+			statusCode: http.StatusBadRequest,
+			errorType:  oauth.InvalidRequest,
+		},
+		{
+			name:       "bind auth key",
+			values:     url.Values{"otp": {otp(counter)}, "auth_key": {key.URL()}},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "bound auth key can not be replaced",
+			values:     url.Values{"otp": {otp(counter)}, "auth_key": {key.URL()}},
+			statusCode: http.StatusBadRequest,
+			errorType:  oauth.InvalidRequest,
+		},
+		{
+			name:       "used one-time password",
+			values:     url.Values{"otp": {otp(counter)}},
+			statusCode: http.StatusBadRequest,
+			errorType:  oauth.InvalidGrant,
+		},
+		{
+			name:       "valid one-time password",
+			values:     url.Values{"otp": {otp(counter + 1)}},
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			audience := test.audience
+			if audience == "" {
+				audience = client.Name
+			}
+			// the tokens issued before are revoked on login since multiple login is not allowed
+			test.values.Set("mfa_token", issueMFAToken(audience))
+			statusCode, result := grant(test.values)
+			if statusCode != test.statusCode {
+				t.Fatalf("expected status code %d, got %d: %v", test.statusCode, statusCode, result)
+			}
+			if test.errorType != "" && result["error"] != string(test.errorType) {
+				t.Fatalf("expected error %s, got %v", test.errorType, result)
+			}
+			if test.statusCode != http.StatusOK {
+				return
+			}
+			if result["access_token"] == "" {
+				t.Fatalf("expected access token, got %v", result)
+			}
+			// the mfa token can be used only once
+			if statusCode, _ = grant(test.values); statusCode != http.StatusBadRequest {
+				t.Fatalf("expected the mfa token to be rejected, got %d", statusCode)
+			}
+		})
+	}
+}
+
+type fakeClientGetter map[string]*oauth.Client
+
+func (f fakeClientGetter) GetOAuthClient(_ context.Context, name string) (*oauth.Client, error) {
+	if client, ok := f[name]; ok {
+		return client, nil
+	}
+	return nil, oauth.ErrorClientNotFound
+}
+
+func (f fakeClientGetter) ListOAuthClients(_ context.Context) ([]*oauth.Client, error) {
+	clients := make([]*oauth.Client, 0, len(f))
+	for _, client := range f {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := authentication.NewOptions()
+	options.Issuer.JWTSecret = "kubesphere"
+	tokenOperator, err := auth.NewTokenOperator(c, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClient := runtimefakeclient.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			&iamv1beta1.User{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci"},
+				Status:     iamv1beta1.UserStatus{State: iamv1beta1.UserActive},
+			},
+			&iamv1beta1.User{
+				ObjectMeta: metav1.ObjectMeta{Name: "disabled"},
+				Status:     iamv1beta1.UserStatus{State: iamv1beta1.UserDisabled},
+			},
+			&iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Name: "inactive"}},
+		).
+		Build()
+	newClient := func(name, user string) *oauth.Client {
+		return &oauth.Client{
+			Name:                  name,
+			Secret:                "P@88w0rd",
+			GrantTypes:            []string{oauth.GrantTypeClientCredentials},
+			ClientCredentialsUser: user,
+		}
+	}
+	h := &handler{
+		im:            im.NewOperator(fakeClient, nil, options),
+		options:       options,
+		tokenOperator: tokenOperator,
+		clientGetter: fakeClientGetter{
+			"ci":       newClient("ci", "ci"),
+			"disabled": newClient("disabled", "disabled"),
+			"inactive": newClient("inactive", "inactive"),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		clientID     string
+		clientSecret string
+		statusCode   int
+	}{
+		{
+			name:         "invalid client secret",
+			clientID:     "ci",
+			clientSecret: "P@88w0r",
+			statusCode:   http.StatusUnauthorized,
+		},
+		{
+			name:         "active user",
+			clientID:     "ci",
+			clientSecret: "P@88w0rd",
+			statusCode:   http.StatusOK,
+		},
+		{
+			name:         "disabled user",
+			clientID:     "disabled",
+			clientSecret: "P@88w0rd",
+			statusCode:   http.StatusBadRequest,
+		},
+		{
+			name:         "inactive user",
+			clientID:     "inactive",
+			clientSecret: "P@88w0rd",
+			statusCode:   http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{
+				"grant_type":    {oauth.GrantTypeClientCredentials},
+				"client_id":     {test.clientID},
+				"client_secret": {test.clientSecret},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(values.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			recorder := httptest.NewRecorder()
+			response := restful.NewResponse(recorder)
+			response.SetRequestAccepts(restful.MIME_JSON)
+			h.token(restful.NewRequest(req), response)
+			if recorder.Code != test.statusCode {
+				t.Fatalf("expected status code %d, got %d: %s", test.statusCode, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := authentication.NewOptions()
+	options.Issuer.JWTSecret = "kubesphere"
+	options.Issuer.URL = "https://console.kubesphere.io"
+	tokenOperator, err := auth.NewTokenOperator(c, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClient := runtimefakeclient.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(&iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Name: "admin", UID: "1"}}).
+		Build()
+	h := &handler{
+		options:          options,
+		tokenOperator:    tokenOperator,
+		loginRecorder:    auth.NewLoginRecorder(fakeClient),
+		deviceAuthorizer: auth.NewDeviceAuthorizer(c),
+		clientGetter: fakeClientGetter{
+			"kubectl": &oauth.Client{
+				Name:       "kubectl",
+				Secret:     "P@88w0rd",
+				GrantTypes: []string{oauth.GrantTypeDeviceCode},
+			},
+		},
+	}
+
+	call := func(handle restful.RouteFunction, path string, values url.Values, authenticated user.Info) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := request.WithRequestInfo(context.Background(), &request.RequestInfo{SourceIP: "10.0.0.1"})
+		if authenticated != nil {
+			ctx = request.WithUser(ctx, authenticated)
+		}
+		recorder := httptest.NewRecorder()
+		response := restful.NewResponse(recorder)
+		response.SetRequestAccepts(restful.MIME_JSON)
+		handle(restful.NewRequest(req.WithContext(ctx)), response)
+		return recorder
+	}
+	authorize := func() *oauth.DeviceAuthorization {
+		recorder := call(h.deviceAuthorization, "/oauth/device_authorization", url.Values{
+			"client_id":     {"kubectl"},
+			"client_secret": {"P@88w0rd"},
+		}, nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+		}
+		authorization := &oauth.DeviceAuthorization{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), authorization); err != nil {
+			t.Fatal(err)
+		}
+		return authorization
+	}
+
+	// defaults to the verification page of the console
+	if authorization := authorize(); authorization.VerificationURI != "https://console.kubesphere.io/device" {
+		t.Fatalf("expected the verification page of the console, got %s", authorization.VerificationURI)
+	}
+
+	// the verification page submits the user code on behalf of the logged-in user
+	console := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/device" || r.URL.Query().Get("lang") != "en" {
+			http.NotFound(w, r)
+			return
+		}
+		recorder := call(h.deviceVerification, "/oauth/device", url.Values{
+			"user_code": {r.URL.Query().Get("user_code")},
+		}, &user.DefaultInfo{Name: "admin"})
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	}))
+	defer console.Close()
+	options.Issuer.DeviceVerificationURI = console.URL + "/device?lang=en"
+
+	authorization := authorize()
+	if authorization.VerificationURI != options.Issuer.DeviceVerificationURI {
+		t.Fatalf("expected the configured verification uri, got %s", authorization.VerificationURI)
+	}
+	resp, err := http.Get(authorization.VerificationURIComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the device to be approved on the verification page, got %d", resp.StatusCode)
+	}
+
+	recorder := call(h.token, "/oauth/token", url.Values{
+		"grant_type":    {oauth.GrantTypeDeviceCode},
+		"client_id":     {"kubectl"},
+		"client_secret": {"P@88w0rd"},
+		"device_code":   {authorization.DeviceCode},
+	}, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["access_token"] == "" || result["access_token"] == nil {
+		t.Fatalf("expected access token, got %v", result)
+	}
+}
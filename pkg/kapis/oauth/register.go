@@ -16,6 +16,7 @@ import (
 	"kubesphere.io/kubesphere/pkg/api"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/oauth"
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+	"kubesphere.io/kubesphere/pkg/server/errors"
 )
 
 const (
@@ -87,7 +88,9 @@ func (h *handler) AddToContainer(c *restful.Container) error {
 			"This URI MUST exactly match one of the Redirection URI values for the Client pre-registered at the OpenID Provider.").Required(true)).
 		Param(ws.QueryParameter("scope", "OpenID Connect requests MUST contain the openid scope value. "+
 			"If the openid scope value is not present, the behavior is entirely unspecified.").Required(false)).
-		Param(ws.QueryParameter("state", "Opaque value used to maintain state between the request and the callback.").Required(false)))
+		Param(ws.QueryParameter("state", "Opaque value used to maintain state between the request and the callback.").Required(false)).
+		Param(ws.QueryParameter("code_challenge", "The PKCE code challenge, required if the client requires PKCE.").Required(false)).
+		Param(ws.QueryParameter("code_challenge_method", "The PKCE code challenge method, only S256 is supported.").Required(false)))
 
 	// Authorization Servers MUST support the use of the HTTP GET and POST methods
 	// defined in RFC 2616 [RFC2616] at the Authorization Endpoint.
@@ -106,7 +109,9 @@ func (h *handler) AddToContainer(c *restful.Container) error {
 			"This URI MUST exactly match one of the Redirection URI values for the Client pre-registered at the OpenID Provider.").Required(true)).
 		Param(ws.FormParameter("scope", "OpenID Connect requests MUST contain the openid scope value. "+
 			"If the openid scope value is not present, the behavior is entirely unspecified.").Required(false)).
-		Param(ws.FormParameter("state", "Opaque value used to maintain state between the request and the callback.").Required(false)))
+		Param(ws.FormParameter("state", "Opaque value used to maintain state between the request and the callback.").Required(false)).
+		Param(ws.FormParameter("code_challenge", "The PKCE code challenge, required if the client requires PKCE.").Required(false)).
+		Param(ws.FormParameter("code_challenge_method", "The PKCE code challenge method, only S256 is supported.").Required(false)))
 
 	// https://datatracker.ietf.org/doc/html/rfc6749#section-3.2
 	ws.Route(ws.POST("/token").
@@ -119,14 +124,25 @@ func (h *handler) AddToContainer(c *restful.Container) error {
 			"client, such as the device operating system or a highly privileged application.").
 		Operation("openid-token").
 		Param(ws.FormParameter("grant_type", "OAuth defines four grant types: "+
-			"authorization code, implicit, resource owner password credentials, and client credentials.").
+			"authorization code, implicit, resource owner password credentials, and client credentials. "+
+			"The device code grant and the otp grant are also supported, "+
+			"the grant types allowed for each client are configured by the grantTypes of the client.").
 			Required(true)).
 		Param(ws.FormParameter("client_id", "Valid client credential.").Required(true)).
-		Param(ws.FormParameter("client_secret", "Valid client credential.").Required(true)).
+		Param(ws.FormParameter("client_secret", "Valid client credential, not required for public clients.").Required(false)).
 		Param(ws.FormParameter("username", "The resource owner username.").Required(false)).
 		Param(ws.FormParameter("password", "The resource owner password.").Required(false)).
 		Param(ws.FormParameter("code", "Valid authorization code.").Required(false)).
-		Returns(http.StatusOK, api.StatusOK, &oauth.Token{}))
+		Param(ws.FormParameter("code_verifier", "The PKCE code verifier, required if a code challenge was "+
+			"sent in the authorization request.").Required(false)).
+		Param(ws.FormParameter("device_code", "The device verification code, used by the device code grant.").Required(false)).
+		Param(ws.FormParameter("scope", "The scope of the access request, used by the client credentials grant.").Required(false)).
+		Param(ws.FormParameter("mfa_token", "The mfa token responded with the mfa_required error, "+
+			"used by the otp grant to complete the multi-factor authentication.").Required(false)).
+		Param(ws.FormParameter("otp", "The one-time password or a recovery code, used by the otp grant.").Required(false)).
+		Param(ws.FormParameter("auth_key", "The TOTP auth key to bind if the user is not enrolled, used by the otp grant.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, &oauth.Token{}).
+		Returns(http.StatusForbidden, "Multi-factor authentication is required", &MFARequiredError{}))
 
 	// Authorization callback URL, where the end of the URL contains the identity provider name.
 	// The provider name is also used to build the callback URL.
@@ -151,6 +167,64 @@ func (h *handler) AddToContainer(c *restful.Container) error {
 			"The exact value received from the client.").Required(true)).
 		Returns(http.StatusOK, api.StatusOK, oauth.Token{}))
 
+	// The assertion consumer service of the identity providers that respond with the HTTP-POST binding, such as SAML.
+	ws.Route(ws.POST("/callback/{callback}").
+		To(h.oauthCallback).
+		Doc("OAuth2 callback with the HTTP-POST binding").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAuthentication}).
+		Operation("oauth-callback-post").
+		Consumes(contentTypeFormData).
+		Param(ws.PathParameter("callback", "The identity provider name.")).
+		Param(ws.FormParameter("SAMLResponse", "The base64 encoded SAML response.").Required(false)).
+		Param(ws.FormParameter("RelayState", "The state sent with the login request.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, oauth.Token{}))
+
+	ws.Route(ws.GET("/login/{provider}").
+		To(h.login).
+		Doc("Redirect to the identity provider with the login request built by KubeSphere, such as the SAML AuthnRequest.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAuthentication}).
+		Operation("oauth-login").
+		Param(ws.PathParameter("provider", "The identity provider name.")).
+		Param(ws.QueryParameter("state", "Opaque value sent back to the callback.").Required(false)).
+		Returns(http.StatusFound, http.StatusText(http.StatusFound), nil))
+
+	ws.Route(ws.GET("/metadata/{provider}").
+		To(h.metadata).
+		Doc("The metadata of KubeSphere as a relying party of the identity provider, such as the SAML service provider metadata.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAuthentication}).
+		Operation("oauth-metadata").
+		Param(ws.PathParameter("provider", "The identity provider name.")).
+		Produces("application/samlmetadata+xml", restful.MIME_XML).
+		Returns(http.StatusOK, api.StatusOK, nil))
+
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-3.1
+	ws.Route(ws.POST("/device_authorization").
+		Consumes(contentTypeFormData).
+		To(h.deviceAuthorization).
+		Doc("Device authorization endpoint").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAuthentication}).
+		Notes("The device authorization endpoint issues a device code and an end-user code to the devices "+
+			"that lack a browser or are input constrained, the device polls the token endpoint with the device "+
+			"code until the user approves the request with the end-user code.").
+		Operation("device-authorization").
+		Param(ws.FormParameter("client_id", "Valid client credential.").Required(true)).
+		Param(ws.FormParameter("client_secret", "Valid client credential, not required for public clients.").Required(false)).
+		Param(ws.FormParameter("scope", "The scope of the access request.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, oauth.DeviceAuthorization{}))
+
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-3.3
+	ws.Route(ws.POST("/device").
+		Consumes(contentTypeFormData).
+		To(h.deviceVerification).
+		Doc("Device verification endpoint").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagAuthentication}).
+		Notes("The authenticated user approves or denies the device authorization request with the end-user code, "+
+			"it is submitted by the verification page of the console which is returned as the verification_uri.").
+		Operation("device-verification").
+		Param(ws.FormParameter("user_code", "The end-user verification code.").Required(true)).
+		Param(ws.FormParameter("action", "The action to take, approve or deny, defaults to approve.").Required(false)).
+		Returns(http.StatusOK, api.StatusOK, errors.None))
+
 	// https://openid.net/specs/openid-connect-rpinitiated-1_0.html
 	ws.Route(ws.GET("/logout").
 		To(h.logout).
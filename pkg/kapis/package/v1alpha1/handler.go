@@ -11,24 +11,35 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/emicklei/go-restful/v3"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/registry"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
 	"kubesphere.io/utils/helm"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"kubesphere.io/kubesphere/pkg/api"
+	"kubesphere.io/kubesphere/pkg/controller/core"
 )
 
 var caTemplate = "{{ .TempDIR }}/repository/{{ .RepositoryName }}/ssl/ca.crt"
 
+const (
+	mimeGzip            = "application/gzip"
+	maxBundleUploadSize = 256 << 20 // 256M
+)
+
 type handler struct {
-	cache runtimeclient.Reader
+	cache     runtimeclient.Reader
+	client    runtimeclient.Client
+	dryRunner *core.DryRunner
 }
 
 func (h *handler) ListFiles(request *restful.Request, response *restful.Response) {
@@ -127,3 +138,164 @@ func (h *handler) ListFiles(request *restful.Request, response *restful.Response
 
 	_ = response.WriteEntity(files)
 }
+
+// Schema returns the config schema of the extension version, an empty object is returned if the chart has no schema.
+func (h *handler) Schema(request *restful.Request, response *restful.Response) {
+	extensionVersion := &corev1alpha1.ExtensionVersion{}
+	if err := h.client.Get(request.Request.Context(), types.NamespacedName{Name: request.PathParameter("version")}, extensionVersion); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	schema, err := core.ChartSchema(request.Request.Context(), h.client, extensionVersion)
+	if err != nil {
+		api.HandleInternalError(response, request, err)
+		return
+	}
+	_ = response.WriteEntity(schema)
+}
+
+// ExportBundle exports the extension versions as a gzipped tarball for air-gapped installation.
+func (h *handler) ExportBundle(request *restful.Request, response *restful.Response) {
+	var names []string
+	for _, name := range strings.Split(request.QueryParameter("versions"), ",") {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		api.HandleBadRequest(response, request, fmt.Errorf("the extension versions are required"))
+		return
+	}
+
+	// Buffer the bundle so that errors can still be reported before the response is committed.
+	bundle := &bytes.Buffer{}
+	if err := core.ExportBundle(request.Request.Context(), h.client, names, bundle); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	response.Header().Set(restful.HEADER_ContentType, mimeGzip)
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "extensions-bundle.tar.gz"))
+	_, _ = response.Write(bundle.Bytes())
+}
+
+// ImportBundle imports the extension versions from a bundle uploaded as the multipart form file "file".
+func (h *handler) ImportBundle(request *restful.Request, response *restful.Response) {
+	request.Request.Body = http.MaxBytesReader(response, request.Request.Body, maxBundleUploadSize)
+	if err := request.Request.ParseMultipartForm(32 << 20); err != nil {
+		api.HandleBadRequest(response, request, fmt.Errorf("failed to parse multipart form: %s", err))
+		return
+	}
+	file, _, err := request.Request.FormFile("file")
+	if err != nil {
+		api.HandleBadRequest(response, request, fmt.Errorf("invalid form data: %s", err))
+		return
+	}
+	defer file.Close()
+
+	extensionVersions, err := core.ImportBundle(request.Request.Context(), h.client, file)
+	if err != nil {
+		api.HandleBadRequest(response, request, err)
+		return
+	}
+	_ = response.WriteEntity(extensionVersions)
+}
+
+// RepositoryStatus returns the sync status of the repository, so that the owners can fix the invalid index entries.
+func (h *handler) RepositoryStatus(request *restful.Request, response *restful.Response) {
+	repo := &corev1alpha1.Repository{}
+	if err := h.cache.Get(request.Request.Context(), types.NamespacedName{Name: request.PathParameter("repository")}, repo); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	_ = response.WriteEntity(repo.Status)
+}
+
+// RolloutAction requests the InstallPlan controller to resume or abort the staged rollout.
+func (h *handler) RolloutAction(request *restful.Request, response *restful.Response) {
+	action := request.PathParameter("action")
+	plan := &corev1alpha1.InstallPlan{}
+	if err := h.client.Get(request.Request.Context(), types.NamespacedName{Name: request.PathParameter("installplan")}, plan); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+
+	if plan.Status.Rollout == nil {
+		api.HandleBadRequest(response, request, fmt.Errorf("install plan %s has no rollout in progress", plan.Name))
+		return
+	}
+	var phases []corev1alpha1.RolloutPhase
+	switch action {
+	case corev1alpha1.RolloutActionResume:
+		phases = []corev1alpha1.RolloutPhase{corev1alpha1.RolloutPhasePaused, corev1alpha1.RolloutPhaseHalted}
+	case corev1alpha1.RolloutActionAbort:
+		phases = []corev1alpha1.RolloutPhase{corev1alpha1.RolloutPhaseProgressing, corev1alpha1.RolloutPhasePaused, corev1alpha1.RolloutPhaseHalted}
+	default:
+		api.HandleBadRequest(response, request, fmt.Errorf("unsupported rollout action %s", action))
+		return
+	}
+	if !slices.Contains(phases, plan.Status.Rollout.Phase) {
+		api.HandleBadRequest(response, request, fmt.Errorf("cannot %s the rollout in phase %s", action, plan.Status.Rollout.Phase))
+		return
+	}
+
+	expected := plan.DeepCopy()
+	if expected.Annotations == nil {
+		expected.Annotations = make(map[string]string)
+	}
+	expected.Annotations[corev1alpha1.RolloutActionAnnotation] = action
+	if err := h.client.Patch(request.Request.Context(), expected, runtimeclient.MergeFrom(plan)); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	_ = response.WriteEntity(expected)
+}
+
+// DryRun previews the changes of a proposed InstallPlan, the status of the existing InstallPlan with the same name
+// is used to find the clusters where the agents are no longer scheduled.
+func (h *handler) DryRun(request *restful.Request, response *restful.Response) {
+	plan := &corev1alpha1.InstallPlan{}
+	if err := request.ReadEntity(plan); err != nil {
+		api.HandleBadRequest(response, request, err)
+		return
+	}
+	if plan.Spec.Extension.Name == "" || plan.Spec.Extension.Version == "" {
+		api.HandleBadRequest(response, request, fmt.Errorf("the extension name and version are required"))
+		return
+	}
+
+	if plan.Name != "" {
+		existing := &corev1alpha1.InstallPlan{}
+		if err := h.client.Get(request.Request.Context(), types.NamespacedName{Name: plan.Name}, existing); err != nil {
+			if !apierrors.IsNotFound(err) {
+				api.HandleError(response, request, err)
+				return
+			}
+		} else {
+			plan.Status = existing.Status
+		}
+	}
+	h.diff(request, response, plan)
+}
+
+// Diff previews the changes of an existing InstallPlan which have not been applied yet.
+func (h *handler) Diff(request *restful.Request, response *restful.Response) {
+	plan := &corev1alpha1.InstallPlan{}
+	if err := h.client.Get(request.Request.Context(), types.NamespacedName{Name: request.PathParameter("installplan")}, plan); err != nil {
+		api.HandleError(response, request, err)
+		return
+	}
+	h.diff(request, response, plan)
+}
+
+func (h *handler) diff(request *restful.Request, response *restful.Response, plan *corev1alpha1.InstallPlan) {
+	releases, err := h.dryRunner.DryRun(request.Request.Context(), plan)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			api.HandleBadRequest(response, request, err)
+			return
+		}
+		api.HandleInternalError(response, request, err)
+		return
+	}
+	_ = response.WriteEntity(releases)
+}
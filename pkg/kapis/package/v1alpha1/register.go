@@ -12,11 +12,13 @@ import (
 	"github.com/emicklei/go-restful/v3"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1alpha1 "kubesphere.io/api/core/v1alpha1"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"kubesphere.io/kubesphere/pkg/api"
 	"kubesphere.io/kubesphere/pkg/apiserver/rest"
 	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
+	"kubesphere.io/kubesphere/pkg/controller/core"
 )
 
 const (
@@ -26,8 +28,8 @@ const (
 
 var GroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
 
-func NewHandler(cache runtimeclient.Reader) rest.Handler {
-	return &handler{cache: cache}
+func NewHandler(cache runtimeclient.Reader, client runtimeclient.Client, dryRunner *core.DryRunner) rest.Handler {
+	return &handler{cache: cache, client: client, dryRunner: dryRunner}
 }
 
 func NewFakeHandler() rest.Handler {
@@ -42,6 +44,57 @@ func (h *handler) AddToContainer(container *restful.Container) error {
 		Operation("list-extension-version-files").
 		Param(ws.PathParameter("version", "The specified extension version name.")).
 		Returns(http.StatusOK, api.StatusOK, []loader.BufferedFile{}))
+	ws.Route(ws.GET("/extensionversions/{version}/schema").
+		To(h.Schema).
+		Doc("Get the config schema").
+		Notes("Get the values.schema.json of the extension version, the schemas of the subcharts are nested under the properties named after the subcharts.").
+		Operation("get-extension-version-schema").
+		Param(ws.PathParameter("version", "The specified extension version name.")).
+		Returns(http.StatusOK, api.StatusOK, map[string]interface{}{}))
+	ws.Route(ws.GET("/extensionversions/export").
+		To(h.ExportBundle).
+		Doc("Export extension versions").
+		Notes("Export the charts, the metadata and the image list of the extension versions as a bundle for air-gapped installation.").
+		Operation("export-extension-versions").
+		Param(ws.QueryParameter("versions", "Comma separated list of extension version names.").Required(true)).
+		Produces(mimeGzip).
+		Returns(http.StatusOK, api.StatusOK, nil))
+	ws.Route(ws.POST("/extensionversions/import").
+		To(h.ImportBundle).
+		Doc("Import extension versions").
+		Notes("Import the extension versions from a bundle, the charts are stored in ConfigMaps.").
+		Operation("import-extension-versions").
+		Consumes(runtime.MimeMultipartFormData).
+		Param(ws.FormParameter("file", "The bundle exported by the export API.").DataType("file").Required(true)).
+		Returns(http.StatusOK, api.StatusOK, []corev1alpha1.ExtensionVersion{}))
+	ws.Route(ws.GET("/repositories/{repository}/status").
+		To(h.RepositoryStatus).
+		Doc("Get the sync status of a repository").
+		Notes("Get the conditions, the extension counts and the errors of the index entries in the last synchronization.").
+		Operation("get-repository-status").
+		Param(ws.PathParameter("repository", "The specified repository name.")).
+		Returns(http.StatusOK, api.StatusOK, corev1alpha1.RepositoryStatus{}))
+	ws.Route(ws.POST("/installplans/dryrun").
+		To(h.DryRun).
+		Doc("Preview the changes of a proposed install plan").
+		Notes("Render the charts of the install plan for the host cluster and each scheduled cluster, and compare the objects with the deployed releases.").
+		Operation("dryrun-installplan").
+		Reads(corev1alpha1.InstallPlan{}).
+		Returns(http.StatusOK, api.StatusOK, []core.ReleaseDiff{}))
+	ws.Route(ws.GET("/installplans/{installplan}/diff").
+		To(h.Diff).
+		Doc("Preview the changes of an install plan").
+		Notes("Render the charts of the install plan for the host cluster and each scheduled cluster, and compare the objects with the deployed releases.").
+		Operation("diff-installplan").
+		Param(ws.PathParameter("installplan", "The specified install plan name.")).
+		Returns(http.StatusOK, api.StatusOK, []core.ReleaseDiff{}))
+	ws.Route(ws.POST("/installplans/{installplan}/rollout/{action}").
+		To(h.RolloutAction).
+		Doc("Resume or abort the staged rollout").
+		Operation("rollout-installplan").
+		Param(ws.PathParameter("installplan", "The specified install plan name.")).
+		Param(ws.PathParameter("action", "The rollout action, one of: resume, abort.")).
+		Returns(http.StatusOK, api.StatusOK, corev1alpha1.InstallPlan{}))
 	container.Add(ws)
 	return nil
 }
@@ -7,19 +7,27 @@
 package v1alpha3
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/emicklei/go-restful/v3"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/klog/v2"
 
 	"kubesphere.io/kubesphere/pkg/api"
+	"kubesphere.io/kubesphere/pkg/apiserver/authorization/authorizer"
 	"kubesphere.io/kubesphere/pkg/apiserver/query"
+	apirequest "kubesphere.io/kubesphere/pkg/apiserver/request"
+	clusterutils "kubesphere.io/kubesphere/pkg/controller/cluster/utils"
 	"kubesphere.io/kubesphere/pkg/models/components"
 	"kubesphere.io/kubesphere/pkg/models/registries/imagesearch"
 	"kubesphere.io/kubesphere/pkg/models/registries/imagesearch/dockerhub"
@@ -27,6 +35,7 @@ import (
 	v2 "kubesphere.io/kubesphere/pkg/models/registries/v2"
 	resourcev1alpha3 "kubesphere.io/kubesphere/pkg/models/resources/v1alpha3/resource"
 	"kubesphere.io/kubesphere/pkg/simple/client/overview"
+	"kubesphere.io/kubesphere/pkg/utils/clusterclient"
 )
 
 var (
@@ -47,6 +56,8 @@ var (
 
 type handler struct {
 	resourceGetterV1alpha3  *resourcev1alpha3.Getter
+	clusterClient           clusterclient.Interface
+	authorizer              authorizer.Authorizer
 	componentsGetter        components.Getter
 	registryHelper          v2.RegistryHelper
 	counter                 overview.Counter
@@ -94,6 +105,109 @@ func (h *handler) ListResources(request *restful.Request, response *restful.Resp
 	response.WriteEntity(result)
 }
 
+// ListMultiClusterResources runs the query against the clusters in parallel and merges the results
+func (h *handler) ListMultiClusterResources(request *restful.Request, response *restful.Response) {
+	resourceType := request.PathParameter("resources")
+	namespace := request.QueryParameter("namespace")
+	q := query.ParseQueryParameter(request)
+	for _, parameter := range []string{"clusters", "namespace", "timeout"} {
+		delete(q.Filters, query.Field(parameter))
+	}
+
+	var timeout time.Duration
+	if value := request.QueryParameter("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 || timeout > resourcev1alpha3.MaxClusterTimeout {
+			api.HandleBadRequest(response, request, fmt.Errorf("invalid timeout %s, it must be positive and no more than %s",
+				value, resourcev1alpha3.MaxClusterTimeout))
+			return
+		}
+	}
+	if !resourcev1alpha3.MultiClusterSortable(q.SortBy) {
+		api.HandleBadRequest(response, request, fmt.Errorf("unsupported sortBy %s, the resources across clusters can only be sorted by %s or %s",
+			q.SortBy, query.FieldName, query.FieldCreationTimeStamp))
+		return
+	}
+	if h.resourceGetterV1alpha3.TryResource(namespace == "", resourceType) == nil {
+		api.HandleNotFound(response, request, resourcev1alpha3.ErrResourceNotSupported)
+		return
+	}
+
+	var clusters []string
+	if value := request.QueryParameter("clusters"); value != "" {
+		clusters = sets.List(sets.New(strings.Split(value, ",")...).Delete(""))
+	} else {
+		clusterList, err := h.clusterClient.ListClusters(request.Request.Context())
+		if err != nil {
+			api.HandleError(response, request, err)
+			return
+		}
+		for _, cluster := range clusterList {
+			clusters = append(clusters, cluster.Name)
+		}
+		sort.Strings(clusters)
+	}
+
+	user, ok := apirequest.UserFrom(request.Request.Context())
+	if !ok {
+		api.HandleUnauthorized(response, request, fmt.Errorf("user not found"))
+		return
+	}
+	getter := resourcev1alpha3.NewMultiClusterGetter(func(ctx context.Context, cluster string) (*resourcev1alpha3.Getter, error) {
+		return h.clusterResourceGetter(ctx, user, cluster, resourceType, namespace)
+	}, timeout)
+	response.WriteEntity(getter.List(request.Request.Context(), clusters, resourceType, namespace, q))
+}
+
+// clusterResourceGetter returns the resource getter of the cluster, if the user is allowed to list the resources
+// in the cluster the same as through /clusters/{cluster}/kapis/resources.kubesphere.io/v1alpha3.
+func (h *handler) clusterResourceGetter(ctx context.Context, user user.Info, clusterName, resourceType, namespace string) (*resourcev1alpha3.Getter, error) {
+	listResources := authorizer.AttributesRecord{
+		User:            user,
+		Verb:            "list",
+		Cluster:         clusterName,
+		Namespace:       namespace,
+		APIGroup:        GroupName,
+		APIVersion:      Version,
+		Resource:        resourceType,
+		ResourceRequest: true,
+		ResourceScope:   apirequest.ClusterScope,
+	}
+	if namespace != "" {
+		listResources.ResourceScope = apirequest.NamespaceScope
+	}
+	decision, _, err := h.authorizer.Authorize(listResources)
+	if err != nil {
+		return nil, err
+	}
+	if decision != authorizer.DecisionAllow {
+		return nil, errors.NewForbidden(Resource(resourceType), "", fmt.Errorf("user %s is not allowed to list %s in cluster %s", user.GetName(), resourceType, clusterName))
+	}
+
+	cluster, err := h.clusterClient.Get(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if clusterutils.IsHostCluster(cluster) {
+		return h.resourceGetterV1alpha3, nil
+	}
+	if !clusterutils.IsClusterReady(cluster) {
+		return nil, errors.NewServiceUnavailable(fmt.Sprintf("cluster %s is not ready", clusterName))
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	clusterClient, err := h.clusterClient.GetClusterClient(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	k8sVersion, err := semver.NewVersion(clusterClient.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	return resourcev1alpha3.NewResourceGetter(clusterClient.Client, k8sVersion), nil
+}
+
 func (h *handler) GetComponentStatus(request *restful.Request, response *restful.Response) {
 	component := request.PathParameter("component")
 	result, err := h.componentsGetter.GetComponentStatus(component)
@@ -18,6 +18,7 @@ import (
 
 	"kubesphere.io/kubesphere/pkg/api"
 	"kubesphere.io/kubesphere/pkg/api/resource/v1alpha2"
+	"kubesphere.io/kubesphere/pkg/apiserver/authorization/authorizer"
 	"kubesphere.io/kubesphere/pkg/apiserver/query"
 	"kubesphere.io/kubesphere/pkg/apiserver/rest"
 	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
@@ -25,6 +26,7 @@ import (
 	v2 "kubesphere.io/kubesphere/pkg/models/registries/v2"
 	resourcev1alpha3 "kubesphere.io/kubesphere/pkg/models/resources/v1alpha3/resource"
 	"kubesphere.io/kubesphere/pkg/simple/client/overview"
+	"kubesphere.io/kubesphere/pkg/utils/clusterclient"
 
 	"kubesphere.io/kubesphere/pkg/models/registries/imagesearch"
 )
@@ -32,6 +34,9 @@ import (
 const (
 	GroupName = "resources.kubesphere.io"
 	Version   = "v1alpha3"
+
+	// ResourcesPluralMultiClusterResource is a global resource, the permission of each cluster is checked by the handler.
+	ResourcesPluralMultiClusterResource = "multiclusterresources"
 )
 
 var GroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
@@ -40,9 +45,12 @@ func Resource(resource string) schema.GroupResource {
 	return GroupVersion.WithResource(resource).GroupResource()
 }
 
-func NewHandler(cacheReader runtimeclient.Reader, counter overview.Counter, k8sVersion *semver.Version) rest.Handler {
+func NewHandler(cacheReader runtimeclient.Reader, counter overview.Counter, k8sVersion *semver.Version,
+	clusterClient clusterclient.Interface, authorizer authorizer.Authorizer) rest.Handler {
 	return &handler{
 		resourceGetterV1alpha3:  resourcev1alpha3.NewResourceGetter(cacheReader, k8sVersion),
+		clusterClient:           clusterClient,
+		authorizer:              authorizer,
 		componentsGetter:        components.NewComponentsGetter(cacheReader),
 		registryHelper:          v2.NewRegistryHelper(),
 		imageSearchController:   imagesearch.SharedImageSearchProviderController,
@@ -72,6 +80,24 @@ func (h *handler) AddToContainer(c *restful.Container) error {
 		Param(ws.QueryParameter(query.ParameterOrderBy, "sort parameters, e.g. orderBy=createTime")).
 		Returns(http.StatusOK, api.StatusOK, api.ListResult{}))
 
+	ws.Route(ws.GET("/"+ResourcesPluralMultiClusterResource+"/{resources}").
+		To(h.ListMultiClusterResources).
+		Doc("List resources across multiple clusters").
+		Notes("Runs the query against the clusters in parallel, the results are merged and paginated. The clusters which failed or timed out are reported instead of failing the whole request.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{api.TagMultiCluster}).
+		Operation("list-multicluster-resources").
+		Param(ws.PathParameter("resources", "resource type, e.g. pods,jobs,configmaps,services.")).
+		Param(ws.QueryParameter("clusters", "comma separated cluster names, all the clusters by default").Required(false)).
+		Param(ws.QueryParameter("namespace", "namespace of the resources, resources in all namespaces by default").Required(false)).
+		Param(ws.QueryParameter("timeout", "timeout of the query against each cluster, no more than 30s, e.g. timeout=5s").Required(false).DefaultValue("10s")).
+		Param(ws.QueryParameter(query.ParameterName, "name used to do filtering").Required(false)).
+		Param(ws.QueryParameter(query.ParameterLabelSelector, "label selector, e.g. labelSelector=app=nginx").Required(false)).
+		Param(ws.QueryParameter(query.ParameterPage, "page").Required(false).DataFormat("page=%d").DefaultValue("page=1")).
+		Param(ws.QueryParameter(query.ParameterLimit, "limit").Required(false)).
+		Param(ws.QueryParameter(query.ParameterAscending, "sort parameters, e.g. reverse=true").Required(false).DefaultValue("ascending=false")).
+		Param(ws.QueryParameter(query.ParameterOrderBy, "sort parameters, only name and creationTimestamp are supported, e.g. sortBy=name")).
+		Returns(http.StatusOK, api.StatusOK, resourcev1alpha3.MultiClusterListResult{}))
+
 	ws.Route(ws.GET("/{resources}/{name}").
 		To(h.GetResources).
 		Deprecate().
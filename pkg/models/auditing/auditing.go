@@ -0,0 +1,392 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing"
+	"kubesphere.io/kubesphere/pkg/apiserver/auditing/log"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+)
+
+const (
+	FieldStartTime = "start_time"
+	FieldEndTime   = "end_time"
+	FieldUser      = "user"
+	FieldVerb      = "verb"
+	FieldWorkspace = "workspace"
+	FieldNamespace = "namespace"
+	FieldCluster   = "cluster"
+	FieldResource  = "resource"
+	FieldName      = "name"
+	FieldCode      = "code"
+
+	// max size of an event line in the audit log
+	maxEventSize = 16 * 1024 * 1024
+	// max number of events returned if the query is not paginated
+	maxEvents = 10000
+	// max size of the audit log files scanned by a query, the newest files are scanned first
+	maxScanSize = 1024 * 1024 * 1024
+)
+
+type EventList struct {
+	Items      []auditing.Event `json:"items"`
+	TotalItems int              `json:"totalItems"`
+	// Truncated is true if the older audit log files are not scanned because maxScanSize is exceeded,
+	// the TotalItems only counts the events in the scanned files.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Filter is the search criteria of auditing events, the multi values of a field are ORed.
+type Filter struct {
+	StartTime  time.Time
+	EndTime    time.Time
+	Users      []string
+	Verbs      []string
+	Workspaces []string
+	Namespaces []string
+	Clusters   []string
+	Resources  []string
+	Names      []string
+	Codes      []int32
+}
+
+type Interface interface {
+	// Events searches the auditing events recorded in the local audit log files.
+	Events(filter *Filter, q *query.Query) (*EventList, error)
+	// Verify walks the hash chain across the rotated backups and the audit log file, up to the file with the
+	// name if it is not empty.
+	Verify(file string) (*log.VerifyResult, error)
+}
+
+type operator struct {
+	path string
+	// keys is the signing key of the token issuer, which signs the checkpoints.
+	keys *token.Keys
+	// verificationKeysFile keeps the previous signing keys out of band.
+	verificationKeysFile string
+}
+
+// NewOperator returns an Interface which searches the audit log file at path and its rotated backups.
+// The checkpoints are verified with the signing key in keys and the keys in verificationKeysFile.
+func NewOperator(path string, keys *token.Keys, verificationKeysFile string) Interface {
+	return &operator{path: path, keys: keys, verificationKeysFile: verificationKeysFile}
+}
+
+// ParseFilter parses the search criteria from the filters of the query.
+func ParseFilter(q *query.Query) (*Filter, error) {
+	filter := &Filter{
+		Users:      splitValues(q.Filters[FieldUser]),
+		Verbs:      splitValues(q.Filters[FieldVerb]),
+		Workspaces: splitValues(q.Filters[FieldWorkspace]),
+		Namespaces: splitValues(q.Filters[FieldNamespace]),
+		Clusters:   splitValues(q.Filters[FieldCluster]),
+		Resources:  splitValues(q.Filters[FieldResource]),
+		Names:      splitValues(q.Filters[FieldName]),
+	}
+
+	var err error
+	if filter.StartTime, err = parseTime(q.Filters[FieldStartTime]); err != nil {
+		return nil, err
+	}
+	if filter.EndTime, err = parseTime(q.Filters[FieldEndTime]); err != nil {
+		return nil, err
+	}
+	for _, code := range splitValues(q.Filters[FieldCode]) {
+		c, err := strconv.ParseInt(code, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		filter.Codes = append(filter.Codes, int32(c))
+	}
+	return filter, nil
+}
+
+// parseTime parses the time in seconds since epoch or in RFC3339 format.
+func parseTime(value query.Value) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, string(value))
+}
+
+func splitValues(value query.Value) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(string(value), ",")
+}
+
+func (o *operator) Events(filter *Filter, q *query.Query) (*EventList, error) {
+	files, err := o.logFiles(filter.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	pagination := q.Pagination
+	if pagination == nil || pagination.Limit == query.NoPagination.Limit {
+		pagination = &query.Pagination{Limit: maxEvents}
+	}
+	if pagination.Limit < 0 || pagination.Offset < 0 {
+		return &EventList{Items: []auditing.Event{}}, nil
+	}
+
+	// only the first offset+limit events are kept while scanning the files
+	top := &topEvents{size: pagination.Offset + pagination.Limit, ascending: q.Ascending}
+	result := &EventList{Items: []auditing.Event{}}
+	var scanned int64
+	for _, file := range files {
+		if scanned >= maxScanSize {
+			result.Truncated = true
+			break
+		}
+		n, err := searchFile(file, filter, maxScanSize-scanned, top)
+		if err != nil {
+			return nil, err
+		}
+		scanned += n
+	}
+
+	result.TotalItems = top.total
+	events := top.sorted()
+	if pagination.Offset < len(events) {
+		result.Items = events[pagination.Offset:]
+	}
+	return result, nil
+}
+
+type rankedEvent struct {
+	event auditing.Event
+	// seq is the order in which the event was scanned, it breaks the ties of the timestamps
+	seq int
+}
+
+// topEvents is a heap of the first size events in the order of the query, the root is the last one.
+type topEvents struct {
+	size      int
+	ascending bool
+	total     int
+	items     []rankedEvent
+}
+
+// before reports whether a is ordered before b in the result.
+func (t *topEvents) before(a, b *rankedEvent) bool {
+	ta, tb := a.event.RequestReceivedTimestamp.Time, b.event.RequestReceivedTimestamp.Time
+	if !ta.Equal(tb) {
+		return ta.Before(tb) == t.ascending
+	}
+	return a.seq < b.seq
+}
+
+func (t *topEvents) Len() int           { return len(t.items) }
+func (t *topEvents) Less(i, j int) bool { return t.before(&t.items[j], &t.items[i]) }
+func (t *topEvents) Swap(i, j int)      { t.items[i], t.items[j] = t.items[j], t.items[i] }
+func (t *topEvents) Push(x interface{}) { t.items = append(t.items, x.(rankedEvent)) }
+func (t *topEvents) Pop() interface{} {
+	item := t.items[len(t.items)-1]
+	t.items = t.items[:len(t.items)-1]
+	return item
+}
+
+func (t *topEvents) add(event auditing.Event) {
+	item := rankedEvent{event: event, seq: t.total}
+	t.total++
+	if t.size <= 0 {
+		return
+	}
+	if len(t.items) < t.size {
+		heap.Push(t, item)
+		return
+	}
+	if t.before(&item, &t.items[0]) {
+		t.items[0] = item
+		heap.Fix(t, 0)
+	}
+}
+
+func (t *topEvents) sorted() []auditing.Event {
+	sort.Slice(t.items, func(i, j int) bool {
+		return t.before(&t.items[i], &t.items[j])
+	})
+	events := make([]auditing.Event, 0, len(t.items))
+	for _, item := range t.items {
+		events = append(events, item.event)
+	}
+	return events
+}
+
+// logFiles returns the audit log file and the rotated backups which may contain events after since,
+// ordered from the newest to the oldest.
+func (o *operator) logFiles(since time.Time) ([]string, error) {
+	dir := filepath.Dir(o.path)
+	filename := filepath.Base(o.path)
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filename, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	// the entries are sorted by the file names, which end with the rotation time of the backups
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		name := entry.Name()
+		if entry.IsDir() || (name != filename && !(strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext))) {
+			continue
+		}
+		// a backup is not written anymore after rotated, skip it if it is older than the start time
+		if name != filename && !since.IsZero() {
+			if info, err := entry.Info(); err == nil && info.ModTime().Before(since) {
+				continue
+			}
+		}
+		if name == filename {
+			files = append([]string{filepath.Join(dir, name)}, files...)
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+func (o *operator) Verify(file string) (*log.VerifyResult, error) {
+	files, err := o.logFiles(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	// the files are verified from the oldest to the newest, so that the last link is carried to the next file
+	slices.Reverse(files)
+	if file != "" {
+		i := slices.IndexFunc(files, func(f string) bool { return filepath.Base(f) == file })
+		if i < 0 {
+			return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "auditlogs"}, file)
+		}
+		files = files[:i+1]
+	}
+
+	keys, err := log.VerificationKeys(o.keys, o.verificationKeysFile)
+	if err != nil {
+		return nil, err
+	}
+	return log.Verify(files, keys)
+}
+
+// searchFile adds the events of the file matching the filter to top, at most limit bytes are scanned.
+// It returns the number of the bytes scanned.
+func searchFile(path string, filter *Filter, limit int64, top *topEvents) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := &countingReader{reader: io.LimitReader(f, limit)}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	for scanner.Scan() {
+		event := auditing.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			klog.V(4).Infof("skip invalid audit event in %s: %s", path, err)
+			continue
+		}
+		// skip the checkpoints of the hash chain
+		if event.AuditID == "" {
+			continue
+		}
+		if filter.Match(&event) {
+			top.add(event)
+		}
+	}
+	return reader.count, scanner.Err()
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// Match reports whether the event matches the filter.
+func (f *Filter) Match(e *auditing.Event) bool {
+	received := e.RequestReceivedTimestamp.Time
+	if !f.StartTime.IsZero() && received.Before(f.StartTime) {
+		return false
+	}
+	if !f.EndTime.IsZero() && received.After(f.EndTime) {
+		return false
+	}
+	if !matchValue(f.Users, e.User.Username) || !matchValue(f.Verbs, e.Verb) ||
+		!matchValue(f.Workspaces, e.Workspace) || !matchValue(f.Clusters, e.Cluster) {
+		return false
+	}
+
+	var namespace, resource, name string
+	if e.ObjectRef != nil {
+		namespace, resource, name = e.ObjectRef.Namespace, e.ObjectRef.Resource, e.ObjectRef.Name
+	}
+	if !matchValue(f.Namespaces, namespace) || !matchValue(f.Resources, resource) || !matchValue(f.Names, name) {
+		return false
+	}
+
+	if len(f.Codes) > 0 {
+		if e.ResponseStatus == nil {
+			return false
+		}
+		matched := false
+		for _, code := range f.Codes {
+			if e.ResponseStatus.Code == code {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValue(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
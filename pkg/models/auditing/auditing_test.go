@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auditing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+)
+
+func TestEvents(t *testing.T) {
+	dir := t.TempDir()
+	current := strings.Join([]string{
+		`{"Workspace":"ws1","auditID":"3","verb":"delete","user":{"username":"admin"},"objectRef":{"resource":"workspaces","name":"ws1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2024-01-01T00:03:00.000000Z"}`,
+		`invalid event`,
+		`{"Workspace":"ws2","auditID":"4","verb":"create","user":{"username":"bob"},"objectRef":{"namespace":"demo","resource":"deployments","name":"nginx"},"responseStatus":{"code":403},"requestReceivedTimestamp":"2024-01-01T00:04:00.000000Z"}`,
+	}, "\n")
+	backup := strings.Join([]string{
+		`{"Workspace":"ws1","auditID":"1","verb":"create","user":{"username":"admin"},"objectRef":{"resource":"workspaces","name":"ws1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2024-01-01T00:01:00.000000Z"}`,
+		`{"Workspace":"ws1","auditID":"2","verb":"update","user":{"username":"alice"},"objectRef":{"resource":"workspaces","name":"ws1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2024-01-01T00:02:00.000000Z"}`,
+	}, "\n")
+	if err := os.WriteFile(filepath.Join(dir, "audit.log"), []byte(current), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "audit-2024-01-01T00-02-30.000.log"), []byte(backup), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.log"), []byte(backup), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	operator := NewOperator(filepath.Join(dir, "audit.log"), nil, "")
+
+	tests := []struct {
+		name      string
+		filters   map[query.Field]query.Value
+		limit     int
+		offset    int
+		ascending bool
+		expected  []string
+		total     int
+	}{
+		{
+			name:     "all events in descending order",
+			expected: []string{"4", "3", "2", "1"},
+			total:    4,
+		},
+		{
+			name:     "filter by workspace and verb",
+			filters:  map[query.Field]query.Value{FieldWorkspace: "ws1", FieldVerb: "create,delete"},
+			expected: []string{"3", "1"},
+			total:    2,
+		},
+		{
+			name:     "filter by time range",
+			filters:  map[query.Field]query.Value{FieldStartTime: "2024-01-01T00:02:00Z", FieldEndTime: "1704067380"},
+			expected: []string{"3", "2"},
+			total:    2,
+		},
+		{
+			name:     "filter by code and namespace",
+			filters:  map[query.Field]query.Value{FieldCode: "403", FieldNamespace: "demo"},
+			expected: []string{"4"},
+			total:    1,
+		},
+		{
+			name:     "paginated",
+			limit:    1,
+			expected: []string{"4"},
+			total:    4,
+		},
+		{
+			name:     "paginated with offset",
+			limit:    2,
+			offset:   1,
+			expected: []string{"3", "2"},
+			total:    4,
+		},
+		{
+			name:      "paginated in ascending order",
+			limit:     3,
+			offset:    2,
+			ascending: true,
+			expected:  []string{"3", "4"},
+			total:     4,
+		},
+		{
+			name:     "offset out of range",
+			limit:    2,
+			offset:   4,
+			expected: nil,
+			total:    4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := query.New()
+			if test.limit > 0 {
+				q.Pagination = &query.Pagination{Limit: test.limit, Offset: test.offset}
+			}
+			q.Ascending = test.ascending
+			for k, v := range test.filters {
+				q.Filters[k] = v
+			}
+			filter, err := ParseFilter(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := operator.Events(filter, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.TotalItems != test.total {
+				t.Errorf("expected total %d, got %d", test.total, result.TotalItems)
+			}
+			var ids []string
+			for _, item := range result.Items {
+				ids = append(ids, string(item.AuditID))
+			}
+			if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("expected events %v, got %v", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestSearchFileLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	lines := []string{
+		`{"auditID":"1","requestReceivedTimestamp":"2024-01-01T00:01:00.000000Z"}`,
+		`{"auditID":"2","requestReceivedTimestamp":"2024-01-01T00:02:00.000000Z"}`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the first event is within the limit
+	top := &topEvents{size: 10}
+	scanned, err := searchFile(path, &Filter{}, int64(len(lines[0])+1), top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned != int64(len(lines[0])+1) || top.total != 1 {
+		t.Errorf("expected 1 event in %d bytes, got %d events in %d bytes", len(lines[0])+1, top.total, scanned)
+	}
+}
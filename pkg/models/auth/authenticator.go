@@ -99,7 +99,7 @@ func authByIdentityProvider(ctx context.Context, client client.Client, mapper Us
 
 			klog.V(4).Infof("user %s has been updated successfully, operation: %s", mappedUser.Name, op)
 
-			return &authuser.DefaultInfo{Name: mappedUser.GetName()}, nil
+			return newUserInfoWithGroups(ctx, client, providerConfig, mappedUser.GetName(), identity)
 		}
 
 		return nil, fmt.Errorf("invalid mapping method found %s", providerConfig.MappingMethod)
@@ -109,5 +109,13 @@ func authByIdentityProvider(ctx context.Context, client client.Client, mapper Us
 		return nil, AccountIsNotActiveError
 	}
 
-	return &authuser.DefaultInfo{Name: mappedUser.GetName()}, nil
+	return newUserInfoWithGroups(ctx, client, providerConfig, mappedUser.GetName(), identity)
+}
+
+func newUserInfoWithGroups(ctx context.Context, client client.Client, providerConfig *identityprovider.Configuration, username string, identity identityprovider.Identity) (authuser.Info, error) {
+	groups, err := syncGroups(ctx, client, providerConfig, username, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync groups of user %s: %s", username, err)
+	}
+	return &authuser.DefaultInfo{Name: username, Groups: groups}, nil
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+const (
+	// DeviceCodeExpiresIn is the lifetime of the device code and the user code.
+	DeviceCodeExpiresIn = 10 * time.Minute
+	// DevicePollInterval is the minimum interval between polling requests.
+	DevicePollInterval = 5 * time.Second
+
+	// userCodeCharset only contains the base-20 consonants to avoid ambiguity and words,
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-6.1
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+
+	deviceStatePending  = "pending"
+	deviceStateApproved = "approved"
+	deviceStateDenied   = "denied"
+)
+
+var (
+	AuthorizationPendingError = fmt.Errorf("authorization pending")
+	SlowDownError             = fmt.Errorf("slow down")
+	AccessDeniedError         = fmt.Errorf("access denied")
+	ExpiredDeviceCodeError    = fmt.Errorf("device code is expired")
+	InvalidUserCodeError      = fmt.Errorf("invalid user code")
+)
+
+// DeviceAuthorizer implements the Device Authorization Grant, https://datatracker.ietf.org/doc/html/rfc8628
+// The pending authorizations are stored in the cache so that they are shared by all ks-apiserver replicas.
+type DeviceAuthorizer interface {
+	// Authorize starts a device authorization for the client and returns the device code and the user code.
+	Authorize(clientID string, scopes []string) (deviceCode string, userCode string, err error)
+	// Approve approves or denies the device authorization identified by the user code on behalf of the user.
+	Approve(userCode string, user authuser.Info, approved bool) error
+	// Poll returns the user who approved the device authorization and the requested scopes,
+	// AuthorizationPendingError, SlowDownError, AccessDeniedError or ExpiredDeviceCodeError
+	// is returned if the authorization is not approved.
+	Poll(clientID, deviceCode string) (authuser.Info, []string, error)
+}
+
+type deviceAuthorization struct {
+	ClientID   string              `json:"clientID"`
+	Scopes     []string            `json:"scopes,omitempty"`
+	State      string              `json:"state"`
+	Username   string              `json:"username,omitempty"`
+	Extra      map[string][]string `json:"extra,omitempty"`
+	ExpiresAt  time.Time           `json:"expiresAt"`
+	LastPolled time.Time           `json:"lastPolled,omitempty"`
+	Interval   time.Duration       `json:"interval"`
+}
+
+type deviceAuthorizer struct {
+	cache cache.Interface
+}
+
+func NewDeviceAuthorizer(cache cache.Interface) DeviceAuthorizer {
+	return &deviceAuthorizer{cache: cache}
+}
+
+func (d *deviceAuthorizer) Authorize(clientID string, scopes []string) (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(buf)
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return "", "", err
+	}
+
+	authorization := &deviceAuthorization{
+		ClientID:  clientID,
+		Scopes:    scopes,
+		State:     deviceStatePending,
+		ExpiresAt: time.Now().Add(DeviceCodeExpiresIn),
+		Interval:  DevicePollInterval,
+	}
+	if err = d.save(hashDeviceCode(deviceCode), authorization); err != nil {
+		return "", "", err
+	}
+	// the device code is never stored in plain text
+	if err = d.cache.Set(userCodeKey(userCode), hashDeviceCode(deviceCode), DeviceCodeExpiresIn); err != nil {
+		return "", "", err
+	}
+	return deviceCode, formatUserCode(userCode), nil
+}
+
+func (d *deviceAuthorizer) Approve(userCode string, user authuser.Info, approved bool) error {
+	userCode = normalizeUserCode(userCode)
+	hash, exists, err := getCacheValue(d.cache, userCodeKey(userCode))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return InvalidUserCodeError
+	}
+	authorization, err := d.load(hash)
+	if err != nil {
+		return err
+	}
+	if authorization == nil || authorization.State != deviceStatePending {
+		return InvalidUserCodeError
+	}
+
+	if approved {
+		authorization.State = deviceStateApproved
+		authorization.Username = user.GetName()
+		authorization.Extra = user.GetExtra()
+	} else {
+		authorization.State = deviceStateDenied
+	}
+	// the user code can only be used once
+	if err = d.cache.Del(userCodeKey(userCode)); err != nil {
+		return err
+	}
+	return d.save(hash, authorization)
+}
+
+func (d *deviceAuthorizer) Poll(clientID, deviceCode string) (authuser.Info, []string, error) {
+	hash := hashDeviceCode(deviceCode)
+	authorization, err := d.load(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the device code was issued to another client is treated as unknown
+	if authorization == nil || authorization.ClientID != clientID {
+		return nil, nil, ExpiredDeviceCodeError
+	}
+
+	switch authorization.State {
+	case deviceStateApproved:
+		// the device code can only be used once
+		if err = d.cache.Del(deviceCodeKey(hash)); err != nil {
+			return nil, nil, err
+		}
+		return &authuser.DefaultInfo{Name: authorization.Username, Extra: authorization.Extra}, authorization.Scopes, nil
+	case deviceStateDenied:
+		if err = d.cache.Del(deviceCodeKey(hash)); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, AccessDeniedError
+	}
+
+	now := time.Now()
+	tooFast := now.Sub(authorization.LastPolled) < authorization.Interval
+	if tooFast {
+		authorization.Interval += DevicePollInterval
+	}
+	authorization.LastPolled = now
+	if err = d.save(hash, authorization); err != nil {
+		return nil, nil, err
+	}
+	if tooFast {
+		return nil, nil, SlowDownError
+	}
+	return nil, nil, AuthorizationPendingError
+}
+
+func (d *deviceAuthorizer) save(hash string, authorization *deviceAuthorization) error {
+	expiresIn := time.Until(authorization.ExpiresAt)
+	if expiresIn <= 0 {
+		return ExpiredDeviceCodeError
+	}
+	data, err := json.Marshal(authorization)
+	if err != nil {
+		return err
+	}
+	return d.cache.Set(deviceCodeKey(hash), string(data), expiresIn)
+}
+
+// load returns nil if the device authorization does not exist or is expired.
+func (d *deviceAuthorizer) load(hash string) (*deviceAuthorization, error) {
+	data, exists, err := getCacheValue(d.cache, deviceCodeKey(hash))
+	if err != nil || !exists {
+		return nil, err
+	}
+	authorization := &deviceAuthorization{}
+	if err = json.Unmarshal([]byte(data), authorization); err != nil {
+		return nil, err
+	}
+	if time.Now().After(authorization.ExpiresAt) {
+		return nil, nil
+	}
+	return authorization, nil
+}
+
+func deviceCodeKey(hash string) string {
+	return fmt.Sprintf("kubesphere:oauth:devicecode:%s", hash)
+}
+
+func userCodeKey(userCode string) string {
+	return fmt.Sprintf("kubesphere:oauth:usercode:%s", userCode)
+}
+
+func hashDeviceCode(deviceCode string) string {
+	sum := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode formats the user code as XXXX-XXXX for readability.
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// normalizeUserCode removes the punctuation and the whitespaces typed by the user.
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeCharset, r) {
+			return r
+		}
+		return -1
+	}, userCode)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+func TestDeviceAuthorizer(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := NewDeviceAuthorizer(c)
+
+	deviceCode, userCode, err := authorizer.Authorize("kubectl", []string{"openid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = authorizer.Poll("kubectl", deviceCode); !errors.Is(err, AuthorizationPendingError) {
+		t.Fatalf("expected authorization pending, got %v", err)
+	}
+	if _, _, err = authorizer.Poll("kubectl", deviceCode); !errors.Is(err, SlowDownError) {
+		t.Fatalf("expected slow down, got %v", err)
+	}
+	if _, _, err = authorizer.Poll("other", deviceCode); !errors.Is(err, ExpiredDeviceCodeError) {
+		t.Fatalf("expected the device code to be rejected for another client, got %v", err)
+	}
+
+	// the user code is case-insensitive and the punctuation is ignored
+	if err = authorizer.Approve(strings.ToLower(userCode), &authuser.DefaultInfo{Name: "admin"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = authorizer.Approve(userCode, &authuser.DefaultInfo{Name: "admin"}, true); !errors.Is(err, InvalidUserCodeError) {
+		t.Fatalf("expected the user code to be used once, got %v", err)
+	}
+
+	user, scopes, err := authorizer.Poll("kubectl", deviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetName() != "admin" || len(scopes) != 1 || scopes[0] != "openid" {
+		t.Fatalf("unexpected user %v and scopes %v", user, scopes)
+	}
+	if _, _, err = authorizer.Poll("kubectl", deviceCode); !errors.Is(err, ExpiredDeviceCodeError) {
+		t.Fatalf("expected the device code to be used once, got %v", err)
+	}
+
+	deviceCode, userCode, err = authorizer.Authorize("kubectl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = authorizer.Approve(userCode, &authuser.DefaultInfo{Name: "admin"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = authorizer.Poll("kubectl", deviceCode); !errors.Is(err, AccessDeniedError) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
+	tenantv1beta1 "kubesphere.io/api/tenant/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider"
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+// maxGroupNameLength is the max length of label values, the group name is used as the value of the group-ref label.
+const maxGroupNameLength = 63
+
+// syncGroups synchronizes the groups of the identity into the groups of the workspace configured by the identity provider,
+// the group bindings of the user created by the previous synchronization are removed if the user left the groups.
+// The names of the synchronized groups of the user are returned, nothing is synchronized if the groups of the identity are unknown.
+func syncGroups(ctx context.Context, c client.Client, providerConfig *identityprovider.Configuration, username string, identity identityprovider.Identity) ([]string, error) {
+	groupsIdentity, ok := identity.(identityprovider.GroupsIdentity)
+	if !ok || !providerConfig.GroupSyncEnabled() {
+		return nil, nil
+	}
+	options := providerConfig.GroupSync
+
+	prefix := options.Prefix
+	if prefix == "" {
+		prefix = providerConfig.Name
+	}
+	allowed := sets.New(options.Groups...)
+
+	expected := sets.New[string]()
+	for _, externalGroup := range groupsIdentity.GetGroups() {
+		if externalGroup == "" || (allowed.Len() > 0 && !allowed.Has(externalGroup)) {
+			continue
+		}
+		groupName := syncedGroupName(prefix, externalGroup)
+		if expected.Has(groupName) {
+			continue
+		}
+		ok, err := ensureSyncedGroup(ctx, c, providerConfig.Name, options.Workspace, groupName, externalGroup)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			expected.Insert(groupName)
+		}
+	}
+
+	groupBindings := &iamv1beta1.GroupBindingList{}
+	if err := c.List(ctx, groupBindings, client.MatchingLabels{
+		iamv1beta1.UserReferenceLabel:    username,
+		iamv1beta1.IdentityProviderLabel: providerConfig.Name,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list group bindings: %s", err)
+	}
+
+	bound := sets.New[string]()
+	for i := range groupBindings.Items {
+		groupBinding := &groupBindings.Items[i]
+		if expected.Has(groupBinding.GroupRef.Name) {
+			bound.Insert(groupBinding.GroupRef.Name)
+			continue
+		}
+		if err := c.Delete(ctx, groupBinding); client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("failed to delete group binding %s: %s", groupBinding.Name, err)
+		}
+	}
+
+	for _, groupName := range sets.List(expected.Difference(bound)) {
+		groupBinding := &iamv1beta1.GroupBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-%s", groupName, username),
+				Labels: map[string]string{
+					iamv1beta1.UserReferenceLabel:    username,
+					iamv1beta1.GroupReferenceLabel:   groupName,
+					iamv1beta1.IdentityProviderLabel: providerConfig.Name,
+					tenantv1beta1.WorkspaceLabel:     options.Workspace,
+				},
+			},
+			Users: []string{username},
+			GroupRef: iamv1beta1.GroupRef{
+				APIGroup: iamv1beta1.SchemeGroupVersion.Group,
+				Kind:     iamv1beta1.ResourcePluralGroup,
+				Name:     groupName,
+			},
+		}
+		if err := c.Create(ctx, groupBinding); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("failed to create group binding %s: %s", groupBinding.Name, err)
+		}
+	}
+
+	return sets.List(expected), nil
+}
+
+// ensureSyncedGroup creates the group if it does not exist, false is returned if the group
+// exists but is not synchronized from the identity provider.
+func ensureSyncedGroup(ctx context.Context, c client.Client, idp, workspace, groupName, externalGroup string) (bool, error) {
+	group := &iamv1beta1.Group{}
+	err := c.Get(ctx, types.NamespacedName{Name: groupName}, group)
+	if err == nil {
+		if group.Labels[iamv1beta1.IdentityProviderLabel] != idp || group.Labels[tenantv1beta1.WorkspaceLabel] != workspace {
+			klog.Warningf("group %s is not synchronized from the identity provider %s, skip it", groupName, idp)
+			return false, nil
+		}
+		return true, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get group %s: %s", groupName, err)
+	}
+
+	group = &iamv1beta1.Group{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: groupName,
+			Labels: map[string]string{
+				iamv1beta1.IdentityProviderLabel: idp,
+				tenantv1beta1.WorkspaceLabel:     workspace,
+			},
+			Annotations: map[string]string{
+				constants.DisplayNameAnnotationKey: externalGroup,
+			},
+		},
+	}
+	if err = c.Create(ctx, group); err != nil && !errors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create group %s: %s", groupName, err)
+	}
+	return true, nil
+}
+
+// syncedGroupName converts the external group name to a valid group name, a hash suffix is appended
+// if the name is too long so that different external groups are not mapped to the same group.
+func syncedGroupName(prefix, externalGroup string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(fmt.Sprintf("%s-%s", prefix, externalGroup)))
+	name = strings.Trim(name, "-")
+
+	if len(name) > maxGroupNameLength {
+		sum := sha256.Sum256([]byte(externalGroup))
+		suffix := hex.EncodeToString(sum[:])[:8]
+		name = strings.TrimRight(name[:maxGroupNameLength-len(suffix)-1], "-") + "-" + suffix
+	}
+	return name
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
+	tenantv1beta1 "kubesphere.io/api/tenant/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/identityprovider"
+	"kubesphere.io/kubesphere/pkg/scheme"
+)
+
+func Test_syncGroups(t *testing.T) {
+	// a group with the same name created manually should not be taken over
+	manualGroup := &iamv1beta1.Group{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ldap-admins",
+			Labels: map[string]string{tenantv1beta1.WorkspaceLabel: "corp"},
+		},
+	}
+	fakeClient := runtimefakeclient.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithRuntimeObjects(manualGroup).
+		Build()
+
+	providerConfig := &identityprovider.Configuration{
+		Name: "ldap",
+		GroupSync: &identityprovider.GroupSyncOptions{
+			Workspace: "corp",
+			Groups:    []string{"Developers", "QA Team", "admins"},
+		},
+	}
+	ctx := context.Background()
+
+	groups, err := syncGroups(ctx, fakeClient, providerConfig, "user1", fakeIdentity{
+		Groups: []string{"Developers", "QA Team", "admins", "others"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ldap-developers", "ldap-qa-team"}; !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected groups %v, got %v", expected, groups)
+	}
+
+	group := &iamv1beta1.Group{}
+	if err = fakeClient.Get(ctx, client.ObjectKey{Name: "ldap-qa-team"}, group); err != nil {
+		t.Fatal(err)
+	}
+	if group.Labels[tenantv1beta1.WorkspaceLabel] != "corp" || group.Labels[iamv1beta1.IdentityProviderLabel] != "ldap" {
+		t.Fatalf("unexpected labels of the synchronized group: %v", group.Labels)
+	}
+
+	// the user left the group
+	groups, err = syncGroups(ctx, fakeClient, providerConfig, "user1", fakeIdentity{
+		Groups: []string{"QA Team"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ldap-qa-team"}; !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected groups %v, got %v", expected, groups)
+	}
+
+	groupBindings := &iamv1beta1.GroupBindingList{}
+	if err = fakeClient.List(ctx, groupBindings, client.MatchingLabels{iamv1beta1.UserReferenceLabel: "user1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(groupBindings.Items) != 1 || groupBindings.Items[0].GroupRef.Name != "ldap-qa-team" {
+		t.Fatalf("unexpected group bindings %v", groupBindings.Items)
+	}
+
+	// the groups of the identity are unknown, e.g. the lookup failed
+	if _, err = syncGroups(ctx, fakeClient, providerConfig, "user1", fakePasswordIdentity{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = fakeClient.List(ctx, groupBindings, client.MatchingLabels{iamv1beta1.UserReferenceLabel: "user1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(groupBindings.Items) != 1 {
+		t.Fatalf("the group bindings are removed when the groups are unknown: %v", groupBindings.Items)
+	}
+}
+
+func Test_syncedGroupName(t *testing.T) {
+	name := syncedGroupName("github", "kubesphere/"+strings.Repeat("a", 100))
+	if len(name) > maxGroupNameLength {
+		t.Fatalf("the length of group name %s exceeds %d", name, maxGroupNameLength)
+	}
+	if other := syncedGroupName("github", "kubesphere/"+strings.Repeat("a", 101)); other == name {
+		t.Fatalf("expected different group names, got %s", name)
+	}
+	if name := syncedGroupName("github", "KubeSphere/Dev"); name != "github-kubesphere-dev" {
+		t.Fatalf("unexpected group name %s", name)
+	}
+}
@@ -80,7 +80,7 @@ func Test_oauthAuthenticator_Authenticate(t *testing.T) {
 
 	identityprovider.RegisterOAuthProviderFactory(&fakeProviderFactory{})
 	identityprovider.SharedIdentityProviderController = identityprovider.NewController()
-	err = identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(context.Background(), &fakeCache)
+	err = identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(context.Background(), &fakeCache, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,9 +190,10 @@ type fakeProvider struct {
 }
 
 type fakeIdentity struct {
-	UID      string `json:"uid"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UID      string   `json:"uid"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Groups   []string `json:"groups"`
 }
 
 func (f fakeIdentity) GetUserID() string {
@@ -207,6 +208,10 @@ func (f fakeIdentity) GetEmail() string {
 	return f.Email
 }
 
+func (f fakeIdentity) GetGroups() []string {
+	return f.Groups
+}
+
 func (fakeProviderFactory) Type() string {
 	return "FakeOAuthProvider"
 }
@@ -179,7 +179,7 @@ func Test_passwordAuthenticator_Authenticate(t *testing.T) {
 
 	identityprovider.RegisterOAuthProviderFactory(&fakeProviderFactory{})
 	identityprovider.SharedIdentityProviderController = identityprovider.NewController()
-	err = identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(context.Background(), &fakeCache)
+	err = identityprovider.SharedIdentityProviderController.WatchConfigurationChanges(context.Background(), &fakeCache, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
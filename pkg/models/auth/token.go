@@ -7,18 +7,32 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
 
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/klog/v2"
 
 	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
 	"kubesphere.io/kubesphere/pkg/simple/client/cache"
 )
 
+const (
+	// sessionTouchInterval limits how often the last used time of a session is updated.
+	sessionTouchInterval = time.Minute
+	// maxTouchedSessions limits the number of sessions recorded to throttle the updates.
+	maxTouchedSessions = 4096
+)
+
+var SessionNotFoundError = fmt.Errorf("session not found")
+
 // TokenManagementInterface Cache issued token, support revocation of tokens after issuance
 type TokenManagementInterface interface {
 	// Verify the given token and returns token.VerifiedResponse
@@ -31,12 +45,35 @@ type TokenManagementInterface interface {
 	RevokeAllUserTokens(username string) error
 	// Keys hold encryption and signing keys.
 	Keys() *token.Keys
+	// SaveSession creates the session if the session ID is empty, otherwise renews the existing session.
+	SaveSession(session *Session, expiresIn time.Duration) error
+	// ListSessions lists the active sessions of the user
+	ListSessions(username string) ([]Session, error)
+	// RevokeSession revokes all tokens issued in the session
+	RevokeSession(username, sessionID string) error
+}
+
+// Session is a login session of the user, the tokens issued in the same login session
+// are tracked by the session so that they can be revoked together.
+type Session struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Client    string `json:"client,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	// The identity provider that the user logged in with.
+	Provider   string    `json:"provider,omitempty"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
 }
 
 type tokenOperator struct {
 	issuer  token.Issuer
 	options *authentication.Options
 	cache   cache.Interface
+	// touched records the sessions recently updated by this replica.
+	touched *utilcache.LRUExpireCache
 }
 
 func (t *tokenOperator) Revoke(token string) error {
@@ -61,6 +98,7 @@ func NewTokenOperator(cache cache.Interface, options *authentication.Options) (T
 		issuer:  issuer,
 		options: options,
 		cache:   cache,
+		touched: utilcache.NewLRUExpireCache(maxTouchedSessions),
 	}
 	return operator, nil
 }
@@ -77,6 +115,9 @@ func (t *tokenOperator) Verify(tokenStr string) (*token.VerifiedResponse, error)
 	if err := t.tokenCacheValidate(response.User.GetName(), tokenStr); err != nil {
 		return nil, err
 	}
+	if response.SessionID != "" && response.TokenType == token.AccessToken {
+		t.touchSession(response.User.GetName(), response.SessionID)
+	}
 	return response, nil
 }
 
@@ -86,7 +127,7 @@ func (t *tokenOperator) IssueTo(request *token.IssueRequest) (string, error) {
 		return "", err
 	}
 	if request.ExpiresIn > 0 {
-		if err = t.cacheToken(request.User.GetName(), tokenStr, request.ExpiresIn); err != nil {
+		if err = t.cacheToken(request.User.GetName(), tokenStr, request.SessionID, request.ExpiresIn); err != nil {
 			return "", err
 		}
 	}
@@ -95,12 +136,16 @@ func (t *tokenOperator) IssueTo(request *token.IssueRequest) (string, error) {
 
 // RevokeAllUserTokens revoke all user tokens in the cache
 func (t *tokenOperator) RevokeAllUserTokens(username string) error {
-	pattern := fmt.Sprintf("kubesphere:user:%s:token:*", username)
-	if keys, err := t.cache.Keys(pattern); err != nil {
-		return err
-	} else if len(keys) > 0 {
-		if err := t.cache.Del(keys...); err != nil {
+	for _, pattern := range []string{
+		fmt.Sprintf("kubesphere:user:%s:token:*", username),
+		fmt.Sprintf("kubesphere:user:%s:session:*", username),
+	} {
+		if keys, err := t.cache.Keys(pattern); err != nil {
 			return err
+		} else if len(keys) > 0 {
+			if err := t.cache.Del(keys...); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -110,6 +155,130 @@ func (t *tokenOperator) Keys() *token.Keys {
 	return t.issuer.Keys()
 }
 
+func (t *tokenOperator) SaveSession(session *Session, expiresIn time.Duration) error {
+	now := time.Now()
+	if session.ID != "" {
+		existing, err := t.getSession(session.Username, session.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return SessionNotFoundError
+		}
+		session.IssuedAt = existing.IssuedAt
+		if session.Provider == "" {
+			session.Provider = existing.Provider
+		}
+	} else {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		session.ID = hex.EncodeToString(id)
+		session.IssuedAt = now
+	}
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(expiresIn)
+	return t.setSession(session)
+}
+
+func (t *tokenOperator) ListSessions(username string) ([]Session, error) {
+	keys, err := t.cache.Keys(sessionKey(username, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0)
+	for _, key := range keys {
+		session, err := t.loadSession(key)
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (t *tokenOperator) RevokeSession(username, sessionID string) error {
+	session, err := t.getSession(username, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return SessionNotFoundError
+	}
+	keys, err := t.cache.Keys(fmt.Sprintf("kubesphere:user:%s:token:*", username))
+	if err != nil {
+		return err
+	}
+	revoked := []string{sessionKey(username, sessionID)}
+	for _, key := range keys {
+		value, exists, err := getCacheValue(t.cache, key)
+		if err != nil {
+			return err
+		}
+		if exists && value == sessionID {
+			revoked = append(revoked, key)
+		}
+	}
+	t.touched.Remove(sessionID)
+	return t.cache.Del(revoked...)
+}
+
+// touchSession updates the last used time of the session, the errors are logged
+// only because the session metadata is not critical to the authentication.
+func (t *tokenOperator) touchSession(username, sessionID string) {
+	if _, ok := t.touched.Get(sessionID); ok {
+		return
+	}
+	t.touched.Add(sessionID, struct{}{}, sessionTouchInterval)
+	session, err := t.getSession(username, sessionID)
+	if err != nil {
+		klog.Warningf("failed to get session %s of user %s: %s", sessionID, username, err)
+		return
+	}
+	if session == nil {
+		return
+	}
+	session.LastUsedAt = time.Now()
+	if err = t.setSession(session); err != nil {
+		klog.Warningf("failed to update session %s of user %s: %s", sessionID, username, err)
+	}
+}
+
+func (t *tokenOperator) getSession(username, sessionID string) (*Session, error) {
+	return t.loadSession(sessionKey(username, sessionID))
+}
+
+// loadSession returns nil if the session does not exist or is expired.
+func (t *tokenOperator) loadSession(key string) (*Session, error) {
+	data, exists, err := getCacheValue(t.cache, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	session := &Session{}
+	if err = json.Unmarshal([]byte(data), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (t *tokenOperator) setSession(session *Session) error {
+	expiresIn := time.Until(session.ExpiresAt)
+	if expiresIn <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(sessionKey(session.Username, session.ID), string(data), expiresIn)
+}
+
 // tokenCacheValidate verify that the token is in the cache
 func (t *tokenOperator) tokenCacheValidate(username, token string) error {
 	key := fmt.Sprintf("kubesphere:user:%s:token:%s", username, token)
@@ -121,12 +290,32 @@ func (t *tokenOperator) tokenCacheValidate(username, token string) error {
 	return nil
 }
 
-// cacheToken cache the token for a period of time
-func (t *tokenOperator) cacheToken(username, token string, duration time.Duration) error {
+// cacheToken cache the token for a period of time, the value is the session ID of the token.
+func (t *tokenOperator) cacheToken(username, token, sessionID string, duration time.Duration) error {
 	key := fmt.Sprintf("kubesphere:user:%s:token:%s", username, token)
-	if err := t.cache.Set(key, token, duration); err != nil {
+	if err := t.cache.Set(key, sessionID, duration); err != nil {
 		klog.Error(err)
 		return err
 	}
 	return nil
 }
+
+func sessionKey(username, sessionID string) string {
+	return fmt.Sprintf("kubesphere:user:%s:session:%s", username, sessionID)
+}
+
+// getCacheValue returns false if the key does not exist or is expired.
+func getCacheValue(c cache.Interface, key string) (string, bool, error) {
+	exists, err := c.Exists(key)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	value, err := c.Get(key)
+	if err != nil {
+		if errors.Is(err, cache.ErrNoSuchKey) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
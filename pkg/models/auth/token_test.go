@@ -0,0 +1,102 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/token"
+	"kubesphere.io/kubesphere/pkg/simple/client/cache"
+)
+
+func TestTokenOperatorSessions(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := cache.NewInMemoryCache(nil, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := authentication.NewOptions()
+	options.Issuer.JWTSecret = "kubesphere"
+	operator, err := NewTokenOperator(c, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(session *Session) string {
+		if err := operator.SaveSession(session, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		accessToken, err := operator.IssueTo(&token.IssueRequest{
+			User:      &authuser.DefaultInfo{Name: "admin"},
+			Claims:    token.Claims{TokenType: token.AccessToken, SessionID: session.ID},
+			ExpiresIn: time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accessToken
+	}
+
+	browser := &Session{Username: "admin", IP: "10.0.0.1", UserAgent: "Mozilla/5.0"}
+	browserToken := issue(browser)
+	kubectl := &Session{Username: "admin", Client: "kubectl"}
+	kubectlToken := issue(kubectl)
+
+	verified, err := operator.Verify(browserToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.SessionID != browser.ID {
+		t.Fatalf("expected session %s, got %s", browser.ID, verified.SessionID)
+	}
+
+	sessions, err := operator.ListSessions("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %v", sessions)
+	}
+
+	// renewing the session keeps the issued time
+	renewed := &Session{ID: browser.ID, Username: "admin"}
+	if err = operator.SaveSession(renewed, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !renewed.IssuedAt.Equal(browser.IssuedAt) {
+		t.Fatalf("expected issued at %s, got %s", browser.IssuedAt, renewed.IssuedAt)
+	}
+
+	if err = operator.RevokeSession("admin", browser.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = operator.Verify(browserToken); err == nil {
+		t.Fatal("expected the token of the revoked session to be rejected")
+	}
+	if _, err = operator.Verify(kubectlToken); err != nil {
+		t.Fatalf("expected the token of another session to be accepted, got %v", err)
+	}
+	if err = operator.RevokeSession("admin", browser.ID); !errors.Is(err, SessionNotFoundError) {
+		t.Fatalf("expected session not found, got %v", err)
+	}
+
+	if err = operator.RevokeAllUserTokens("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ = operator.ListSessions("admin"); len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %v", sessions)
+	}
+	if _, err = operator.Verify(kubectlToken); err == nil {
+		t.Fatal("expected the token to be rejected after signing out everywhere")
+	}
+}
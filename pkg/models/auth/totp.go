@@ -0,0 +1,364 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
+	tenantv1beta1 "kubesphere.io/api/tenant/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/totp"
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+const (
+	SecretTypeTOTPAuthKey = "iam.kubesphere.io/totp-auth-key"
+
+	// the keys of the TOTP auth key secret data
+	totpAuthKeyKey       = "authKey"
+	totpRecoveryCodesKey = "recoveryCodes"
+	totpLastCounterKey   = "lastCounter"
+
+	recoveryCodesCount = 10
+)
+
+var (
+	InvalidOTPError          = fmt.Errorf("invalid one-time password")
+	TOTPNotEnrolledError     = fmt.Errorf("totp auth key is not bound")
+	TOTPAlreadyEnrolledError = fmt.Errorf("totp auth key is already bound")
+	// InvalidCurrentOTPError is returned if the one-time password of the bound auth key is invalid,
+	// it should be recorded as a failed login attempt.
+	InvalidCurrentOTPError = fmt.Errorf("%w of the bound auth key", InvalidOTPError)
+)
+
+// TOTPStatus is the multi-factor authentication status of a user.
+type TOTPStatus struct {
+	// Enabled is true if a TOTP auth key is bound to the user.
+	Enabled bool `json:"enabled"`
+	// Required is true if the user must complete the multi-factor authentication to log in.
+	Required bool `json:"required"`
+	// RecoveryCodes is the number of the unused recovery codes.
+	RecoveryCodes int `json:"recoveryCodes"`
+}
+
+// TOTPAuthenticator manages the TOTP auth keys of users and verifies the one-time passwords.
+// The auth key is stored in a Secret in the kubesphere-system namespace which is referenced
+// by the iam.kubesphere.io/totp-auth-key-ref annotation of the user.
+type TOTPAuthenticator interface {
+	// GenerateAuthKey generates a new auth key, it is not bound to the user until confirmed by Bind.
+	GenerateAuthKey(username string) (*totp.Key, error)
+	// Bind binds the auth key to the user if the otp is valid, the recovery codes are returned.
+	// If an auth key is already bound, it is only replaced if the currentOTP is a valid one-time
+	// password or recovery code of the bound auth key.
+	Bind(ctx context.Context, username, authKey, otp, currentOTP string) ([]string, error)
+	// Unbind removes the auth key of the user.
+	Unbind(ctx context.Context, username string) error
+	// Status returns the multi-factor authentication status of the user.
+	Status(ctx context.Context, username string) (*TOTPStatus, error)
+	// Authenticate verifies the otp or a recovery code of the user, each of them can be used only once.
+	Authenticate(ctx context.Context, username, otp string) error
+	// RegenerateRecoveryCodes replaces the recovery codes of the user if the otp is a valid one-time
+	// password or an unused recovery code.
+	RegenerateRecoveryCodes(ctx context.Context, username, otp string) ([]string, error)
+}
+
+type totpAuthenticator struct {
+	client  runtimeclient.Client
+	options *authentication.MultiFactorAuthOptions
+}
+
+func NewTOTPAuthenticator(client runtimeclient.Client, options *authentication.Options) TOTPAuthenticator {
+	mfaOptions := options.MultiFactorAuth
+	if mfaOptions == nil {
+		mfaOptions = &authentication.MultiFactorAuthOptions{}
+	}
+	if mfaOptions.Issuer == "" {
+		mfaOptions.Issuer = authentication.DefaultMFAIssuer
+	}
+	return &totpAuthenticator{client: client, options: mfaOptions}
+}
+
+func (t *totpAuthenticator) GenerateAuthKey(username string) (*totp.Key, error) {
+	return totp.Generate(t.options.Issuer, username)
+}
+
+func (t *totpAuthenticator) Bind(ctx context.Context, username, authKey, otp, currentOTP string) ([]string, error) {
+	key, err := totp.ParseKey(authKey)
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid auth key: %s", err))
+	}
+	counter, ok := key.Validate(otp, time.Now())
+	if !ok {
+		return nil, InvalidOTPError
+	}
+
+	user := &iamv1beta1.User{}
+	if err := t.client.Get(ctx, types.NamespacedName{Name: username}, user); err != nil {
+		return nil, err
+	}
+
+	// the bound auth key can not be replaced without the current factor
+	if _, err := t.authKeySecret(ctx, user); err == nil {
+		if currentOTP == "" {
+			return nil, TOTPAlreadyEnrolledError
+		}
+		if err := t.Authenticate(ctx, username, currentOTP); err != nil {
+			if err == InvalidOTPError {
+				err = InvalidCurrentOTPError
+			}
+			return nil, err
+		}
+	} else if err != TOTPNotEnrolledError {
+		return nil, err
+	}
+
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: totpSecretName(username), Namespace: constants.KubeSphereNamespace}}
+	if _, err := ctrl.CreateOrUpdate(ctx, t.client, secret, func() error {
+		secret.Labels = map[string]string{iamv1beta1.UserReferenceLabel: username}
+		// the secret is garbage collected with the user
+		secret.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: iamv1beta1.SchemeGroupVersion.String(),
+			Kind:       iamv1beta1.ResourceKindUser,
+			Name:       user.Name,
+			UID:        user.UID,
+		}}
+		secret.Type = SecretTypeTOTPAuthKey
+		secret.Data = map[string][]byte{
+			totpAuthKeyKey:       []byte(key.URL()),
+			totpRecoveryCodesKey: []byte(strings.Join(hashed, "\n")),
+			totpLastCounterKey:   []byte(strconv.FormatUint(counter, 10)),
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	patch := runtimeclient.MergeFrom(user.DeepCopy())
+	if user.Annotations == nil {
+		user.Annotations = make(map[string]string)
+	}
+	user.Annotations[iamv1beta1.TOTPAuthKeyRefAnnotation] = secret.Name
+	if err := t.client.Patch(ctx, user, patch); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (t *totpAuthenticator) Unbind(ctx context.Context, username string) error {
+	user := &iamv1beta1.User{}
+	if err := t.client.Get(ctx, types.NamespacedName{Name: username}, user); err != nil {
+		return err
+	}
+	secretName := user.Annotations[iamv1beta1.TOTPAuthKeyRefAnnotation]
+	if secretName == "" {
+		return nil
+	}
+
+	patch := runtimeclient.MergeFrom(user.DeepCopy())
+	delete(user.Annotations, iamv1beta1.TOTPAuthKeyRefAnnotation)
+	if err := t.client.Patch(ctx, user, patch); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: constants.KubeSphereNamespace}}
+	return runtimeclient.IgnoreNotFound(t.client.Delete(ctx, secret))
+}
+
+func (t *totpAuthenticator) Status(ctx context.Context, username string) (*TOTPStatus, error) {
+	user := &iamv1beta1.User{}
+	if err := t.client.Get(ctx, types.NamespacedName{Name: username}, user); err != nil {
+		return nil, err
+	}
+
+	status := &TOTPStatus{}
+	secret, err := t.authKeySecret(ctx, user)
+	if err != nil && err != TOTPNotEnrolledError {
+		return nil, err
+	}
+	if secret != nil {
+		status.Enabled = true
+		status.RecoveryCodes = len(recoveryCodes(secret))
+	}
+
+	if status.Required, err = t.required(ctx, user); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// required returns whether the multi-factor authentication is enforced for the user,
+// by the bound auth key, the global options or a workspace the user is a member of.
+func (t *totpAuthenticator) required(ctx context.Context, user *iamv1beta1.User) (bool, error) {
+	if user.Annotations[iamv1beta1.TOTPAuthKeyRefAnnotation] != "" || t.options.Required {
+		return true, nil
+	}
+
+	workspaceRoleBindings := &iamv1beta1.WorkspaceRoleBindingList{}
+	if err := t.client.List(ctx, workspaceRoleBindings,
+		runtimeclient.MatchingLabels{iamv1beta1.UserReferenceLabel: user.Name}); err != nil {
+		return false, err
+	}
+	for _, workspaceRoleBinding := range workspaceRoleBindings.Items {
+		workspaceName := workspaceRoleBinding.Labels[tenantv1beta1.WorkspaceLabel]
+		if workspaceName == "" {
+			continue
+		}
+		workspaceTemplate := &tenantv1beta1.WorkspaceTemplate{}
+		if err := t.client.Get(ctx, types.NamespacedName{Name: workspaceName}, workspaceTemplate); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		if workspaceTemplate.Annotations[iamv1beta1.MFARequiredAnnotation] == "true" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *totpAuthenticator) Authenticate(ctx context.Context, username, otp string) error {
+	user := &iamv1beta1.User{}
+	if err := t.client.Get(ctx, types.NamespacedName{Name: username}, user); err != nil {
+		return err
+	}
+	if user.Status.State == iamv1beta1.UserAuthLimitExceeded {
+		return RateLimitExceededError
+	}
+
+	secret, err := t.authKeySecret(ctx, user)
+	if err != nil {
+		return err
+	}
+	key, err := totp.ParseKey(string(secret.Data[totpAuthKeyKey]))
+	if err != nil {
+		return fmt.Errorf("invalid auth key of user %s: %s", username, err)
+	}
+
+	if counter, ok := key.Validate(otp, time.Now()); ok {
+		// a code can not be used twice
+		lastCounter, _ := strconv.ParseUint(string(secret.Data[totpLastCounterKey]), 10, 64)
+		if counter <= lastCounter {
+			return InvalidOTPError
+		}
+		secret.Data[totpLastCounterKey] = []byte(strconv.FormatUint(counter, 10))
+		return t.client.Update(ctx, secret)
+	}
+
+	// fall back to the recovery codes
+	codes := recoveryCodes(secret)
+	normalized := normalizeRecoveryCode(otp)
+	for i, hashed := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(normalized)) == nil {
+			codes = append(codes[:i], codes[i+1:]...)
+			secret.Data[totpRecoveryCodesKey] = []byte(strings.Join(codes, "\n"))
+			return t.client.Update(ctx, secret)
+		}
+	}
+	return InvalidOTPError
+}
+
+func (t *totpAuthenticator) RegenerateRecoveryCodes(ctx context.Context, username, otp string) ([]string, error) {
+	// the recovery codes satisfy the second factor, they can not be minted without it
+	if err := t.Authenticate(ctx, username, otp); err != nil {
+		return nil, err
+	}
+	user := &iamv1beta1.User{}
+	if err := t.client.Get(ctx, types.NamespacedName{Name: username}, user); err != nil {
+		return nil, err
+	}
+	secret, err := t.authKeySecret(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	secret.Data[totpRecoveryCodesKey] = []byte(strings.Join(hashed, "\n"))
+	if err := t.client.Update(ctx, secret); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (t *totpAuthenticator) authKeySecret(ctx context.Context, user *iamv1beta1.User) (*corev1.Secret, error) {
+	secretName := user.Annotations[iamv1beta1.TOTPAuthKeyRefAnnotation]
+	if secretName == "" {
+		return nil, TOTPNotEnrolledError
+	}
+	secret := &corev1.Secret{}
+	if err := t.client.Get(ctx, types.NamespacedName{Namespace: constants.KubeSphereNamespace, Name: secretName}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, TOTPNotEnrolledError
+		}
+		return nil, err
+	}
+	if secret.Type != SecretTypeTOTPAuthKey || secret.Labels[iamv1beta1.UserReferenceLabel] != user.Name {
+		return nil, TOTPNotEnrolledError
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	return secret, nil
+}
+
+func totpSecretName(username string) string {
+	return fmt.Sprintf("totp-auth-key-%s", username)
+}
+
+func recoveryCodes(secret *corev1.Secret) []string {
+	data := strings.TrimSpace(string(secret.Data[totpRecoveryCodesKey]))
+	if data == "" {
+		return nil
+	}
+	return strings.Split(data, "\n")
+}
+
+// generateRecoveryCodes returns the recovery codes like a1b2c-3d4e5 and their bcrypt hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashed := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(buf)
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashed = append(hashed, string(hash))
+	}
+	return codes, hashed, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	iamv1beta1 "kubesphere.io/api/iam/v1beta1"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication"
+	"kubesphere.io/kubesphere/pkg/apiserver/authentication/totp"
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/scheme"
+)
+
+func code(t *testing.T, key *totp.Key, counter uint64) string {
+	code, err := key.Code(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPAuthenticator(t *testing.T) {
+	fakeClient := runtimefakeclient.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(&iamv1beta1.User{ObjectMeta: metav1.ObjectMeta{Name: "admin", UID: "1"}}).
+		Build()
+	authenticator := NewTOTPAuthenticator(fakeClient, authentication.NewOptions())
+	ctx := context.Background()
+
+	key, err := authenticator.GenerateAuthKey("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := key.Counter(time.Now())
+
+	if _, err = authenticator.Bind(ctx, "admin", key.URL(), "000000", ""); !errors.Is(err, InvalidOTPError) {
+		t.Fatalf("expected invalid otp, got %v", err)
+	}
+	codes, err := authenticator.Bind(ctx, "admin", key.URL(), code(t, key, counter), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("expected %d recovery codes, got %v", recoveryCodesCount, codes)
+	}
+
+	// the code used to bind the auth key can not be used again
+	if err = authenticator.Authenticate(ctx, "admin", code(t, key, counter)); !errors.Is(err, InvalidOTPError) {
+		t.Fatalf("expected the code to be rejected, got %v", err)
+	}
+	// each recovery code can be used once
+	if err = authenticator.Authenticate(ctx, "admin", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = authenticator.Authenticate(ctx, "admin", codes[0]); !errors.Is(err, InvalidOTPError) {
+		t.Fatalf("expected the recovery code to be rejected, got %v", err)
+	}
+
+	// the bound auth key can not be replaced without the current factor
+	replacement, err := authenticator.GenerateAuthKey("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = authenticator.Bind(ctx, "admin", replacement.URL(), code(t, replacement, counter), ""); !errors.Is(err, TOTPAlreadyEnrolledError) {
+		t.Fatalf("expected already enrolled, got %v", err)
+	}
+	if _, err = authenticator.Bind(ctx, "admin", replacement.URL(), code(t, replacement, counter), "000000"); !errors.Is(err, InvalidOTPError) {
+		t.Fatalf("expected invalid otp, got %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err = fakeClient.Get(ctx, types.NamespacedName{Namespace: constants.KubeSphereNamespace, Name: totpSecretName("admin")}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[totpAuthKeyKey]) != key.URL() {
+		t.Fatal("the auth key is replaced without the current factor")
+	}
+
+	if codes, err = authenticator.Bind(ctx, "admin", replacement.URL(), code(t, replacement, counter), code(t, key, counter+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = authenticator.Authenticate(ctx, "admin", code(t, replacement, counter+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := authenticator.Status(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || !status.Required || status.RecoveryCodes != recoveryCodesCount {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// the recovery codes can not be regenerated without the second factor
+	if _, err = authenticator.RegenerateRecoveryCodes(ctx, "admin", ""); !errors.Is(err, InvalidOTPError) {
+		t.Fatalf("expected invalid otp, got %v", err)
+	}
+	if codes, err = authenticator.RegenerateRecoveryCodes(ctx, "admin", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("expected %d recovery codes, got %v", recoveryCodesCount, codes)
+	}
+
+	if err = authenticator.Unbind(ctx, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err = authenticator.Authenticate(ctx, "admin", code(t, replacement, counter+1)); !errors.Is(err, TOTPNotEnrolledError) {
+		t.Fatalf("expected not enrolled, got %v", err)
+	}
+}
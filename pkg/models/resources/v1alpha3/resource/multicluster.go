@@ -0,0 +1,194 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/api"
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+	"kubesphere.io/kubesphere/pkg/models/resources/v1alpha3"
+)
+
+const (
+	DefaultClusterTimeout = 10 * time.Second
+	// MaxClusterTimeout bounds the time the query waits for the clusters.
+	MaxClusterTimeout = 30 * time.Second
+)
+
+// ClusterObject is an object in the merged result, along with the cluster it belongs to.
+type ClusterObject struct {
+	Cluster string         `json:"cluster"`
+	Object  runtime.Object `json:"object"`
+}
+
+// ClusterListStatus is the result of the query against a cluster.
+type ClusterListStatus struct {
+	Cluster    string `json:"cluster"`
+	TotalItems int    `json:"totalItems"`
+	// Error is set if the query failed, the items of the cluster are not included in the result.
+	Error    string `json:"error,omitempty"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+}
+
+type MultiClusterListResult struct {
+	Items      []ClusterObject     `json:"items"`
+	TotalItems int                 `json:"totalItems"`
+	Clusters   []ClusterListStatus `json:"clusters"`
+}
+
+// ClusterGetterFunc returns the resource getter of the cluster, it should give up once the context is done.
+type ClusterGetterFunc func(ctx context.Context, cluster string) (*Getter, error)
+
+// MultiClusterGetter runs the same query against a set of clusters in parallel and merges the results.
+type MultiClusterGetter struct {
+	getterFor ClusterGetterFunc
+	timeout   time.Duration
+}
+
+func NewMultiClusterGetter(getterFor ClusterGetterFunc, timeout time.Duration) *MultiClusterGetter {
+	if timeout <= 0 {
+		timeout = DefaultClusterTimeout
+	}
+	timeout = min(timeout, MaxClusterTimeout)
+	return &MultiClusterGetter{getterFor: getterFor, timeout: timeout}
+}
+
+// List queries the resources of the clusters. The failed and timed out clusters are reported in the status of
+// the clusters instead of failing the whole query. The items are merged and sorted by the name or the creation
+// timestamp, then paginated.
+func (g *MultiClusterGetter) List(ctx context.Context, clusters []string, resource, namespace string, q *query.Query) *MultiClusterListResult {
+	if q.Pagination == nil {
+		q.Pagination = query.NoPagination
+	}
+	// Each cluster returns the first offset+limit items, which covers the requested page of the merged result.
+	clusterQuery := *q
+	if q.Pagination.Limit != query.NoPagination.Limit {
+		clusterQuery.Pagination = &query.Pagination{Limit: q.Pagination.Offset + q.Pagination.Limit, Offset: 0}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	type clusterResult struct {
+		index  int
+		result *api.ListResult
+		err    error
+	}
+	// Buffered, so that the queries that have timed out can finish in the background.
+	results := make(chan clusterResult, len(clusters))
+	for i, cluster := range clusters {
+		go func() {
+			result, err := g.list(ctx, cluster, resource, namespace, &clusterQuery)
+			results <- clusterResult{index: i, result: result, err: err}
+		}()
+	}
+
+	statuses := make([]ClusterListStatus, len(clusters))
+	for i, cluster := range clusters {
+		statuses[i] = ClusterListStatus{Cluster: cluster, TimedOut: true, Error: fmt.Sprintf("timed out after %s", g.timeout)}
+	}
+	// The results are indexed by the clusters, so that they are merged in the same order whichever arrives first.
+	clusterResults := make([]*api.ListResult, len(clusters))
+	for received := 0; received < len(clusters); received++ {
+		var r clusterResult
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			received = len(clusters)
+			continue
+		}
+		status := &statuses[r.index]
+		if r.err != nil && ctx.Err() != nil {
+			// the query gave up since the context is done
+			continue
+		}
+		status.TimedOut = false
+		status.Error = ""
+		if r.err != nil {
+			status.Error = r.err.Error()
+			continue
+		}
+		status.TotalItems = r.result.TotalItems
+		clusterResults[r.index] = r.result
+	}
+
+	merged := &MultiClusterListResult{Items: make([]ClusterObject, 0), Clusters: statuses}
+	for i, result := range clusterResults {
+		if result == nil {
+			continue
+		}
+		merged.TotalItems += result.TotalItems
+		for _, object := range result.Items {
+			merged.Items = append(merged.Items, ClusterObject{Cluster: clusters[i], Object: object})
+		}
+	}
+	sort.Slice(merged.Items, func(i, j int) bool {
+		return clusterObjectLess(merged.Items[i], merged.Items[j], q.SortBy, q.Ascending)
+	})
+	start, end := q.Pagination.GetValidPagination(len(merged.Items))
+	merged.Items = merged.Items[start:end]
+	return merged
+}
+
+// MultiClusterSortable returns whether the merged items can be sorted by the field. The items of the clusters
+// are only compared by the metadata, the other fields sorted by the resource getters are not supported.
+func MultiClusterSortable(sortBy query.Field) bool {
+	switch sortBy {
+	case query.FieldName, query.FieldCreateTime, query.FieldCreationTimeStamp:
+		return true
+	}
+	return false
+}
+
+func (g *MultiClusterGetter) list(ctx context.Context, cluster, resource, namespace string, q *query.Query) (result *api.ListResult, err error) {
+	// A panic in the query of a cluster should not crash the whole query.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to list %s: %v", resource, r)
+		}
+	}()
+	getter, err := g.getterFor(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	// the query has timed out while the getter is being prepared
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return getter.List(resource, namespace, q)
+}
+
+// clusterObjectLess reports whether left is ordered before right. The objects equal in the sort field are ordered
+// by the namespaces and then the clusters, regardless of the direction, so that the order is strict and stable across
+// the queries.
+func clusterObjectLess(left, right ClusterObject, sortBy query.Field, ascending bool) bool {
+	leftMeta, leftErr := meta.Accessor(left.Object)
+	rightMeta, rightErr := meta.Accessor(right.Object)
+	if leftErr == nil && rightErr == nil {
+		l := metav1.ObjectMeta{Name: leftMeta.GetName(), CreationTimestamp: leftMeta.GetCreationTimestamp()}
+		r := metav1.ObjectMeta{Name: rightMeta.GetName(), CreationTimestamp: rightMeta.GetCreationTimestamp()}
+		if v1alpha3.DefaultObjectMetaCompare(l, r, sortBy) {
+			return !ascending
+		}
+		if v1alpha3.DefaultObjectMetaCompare(r, l, sortBy) {
+			return ascending
+		}
+		if c := strings.Compare(leftMeta.GetNamespace(), rightMeta.GetNamespace()); c != 0 {
+			return c < 0
+		}
+	}
+	return left.Cluster < right.Cluster
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimefakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kubesphere.io/kubesphere/pkg/apiserver/query"
+	"kubesphere.io/kubesphere/pkg/scheme"
+)
+
+func newClusterGetter(names ...string) *Getter {
+	builder := runtimefakeclient.NewClientBuilder().WithScheme(scheme.Scheme)
+	for _, name := range names {
+		builder.WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	k8sVersion, _ := semver.NewVersion("1.30.0")
+	return NewResourceGetter(builder.Build(), k8sVersion)
+}
+
+func TestMultiClusterGetter(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+	getters := map[string]*Getter{
+		"host":   newClusterGetter("default", "kube-system"),
+		"member": newClusterGetter("default", "devops"),
+	}
+	var slowCanceled atomic.Bool
+	getter := NewMultiClusterGetter(func(ctx context.Context, cluster string) (*Getter, error) {
+		switch cluster {
+		case "slow":
+			select {
+			case <-blocked:
+			case <-ctx.Done():
+				slowCanceled.Store(true)
+				return nil, ctx.Err()
+			}
+		case "broken":
+			return nil, fmt.Errorf("cluster %s is not ready", cluster)
+		}
+		return getters[cluster], nil
+	}, 100*time.Millisecond)
+
+	q := &query.Query{
+		Pagination: &query.Pagination{Limit: 3, Offset: 0},
+		SortBy:     query.FieldName,
+		Ascending:  true,
+		Filters:    map[query.Field]query.Value{},
+	}
+	result := getter.List(context.Background(), []string{"host", "member", "broken", "slow"}, "namespaces", "", q)
+	assert.Equal(t, 4, result.TotalItems)
+	var items []string
+	for _, item := range result.Items {
+		items = append(items, item.Cluster+"/"+item.Object.(*corev1.Namespace).Name)
+	}
+	assert.Equal(t, []string{"host/default", "member/default", "member/devops"}, items)
+	assert.Equal(t, []ClusterListStatus{
+		{Cluster: "host", TotalItems: 2},
+		{Cluster: "member", TotalItems: 2},
+		{Cluster: "broken", Error: "cluster broken is not ready"},
+		{Cluster: "slow", Error: "timed out after 100ms", TimedOut: true},
+	}, result.Clusters)
+	// the query of the slow cluster is given up
+	assert.Eventually(t, slowCanceled.Load, time.Second, 10*time.Millisecond)
+
+	q.Pagination = &query.Pagination{Limit: 3, Offset: 3}
+	result = getter.List(context.Background(), []string{"host", "member"}, "namespaces", "", q)
+	assert.Equal(t, 4, result.TotalItems)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "kube-system", result.Items[0].Object.(*corev1.Namespace).Name)
+
+	q.Filters[query.FieldName] = "dev"
+	q.Pagination = query.NoPagination
+	result = getter.List(context.Background(), []string{"host", "member"}, "namespaces", "", q)
+	assert.Equal(t, 1, result.TotalItems)
+	assert.Equal(t, "member", result.Items[0].Cluster)
+}
+
+func TestMultiClusterGetterOrder(t *testing.T) {
+	created := metav1.NewTime(time.Now().Round(time.Second))
+	newGetter := func(names ...string) *Getter {
+		builder := runtimefakeclient.NewClientBuilder().WithScheme(scheme.Scheme)
+		for _, name := range names {
+			builder.WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: created}})
+		}
+		k8sVersion, _ := semver.NewVersion("1.30.0")
+		return NewResourceGetter(builder.Build(), k8sVersion)
+	}
+	getters := map[string]*Getter{
+		"a": newGetter("default", "devops"),
+		"b": newGetter("default", "devops"),
+		"c": newGetter("default"),
+	}
+	// the clusters respond in the reverse order
+	delays := map[string]time.Duration{"a": 40 * time.Millisecond, "b": 20 * time.Millisecond}
+	getter := NewMultiClusterGetter(func(_ context.Context, cluster string) (*Getter, error) {
+		time.Sleep(delays[cluster])
+		return getters[cluster], nil
+	}, time.Second)
+
+	list := func(sortBy query.Field, ascending bool) []string {
+		q := &query.Query{Pagination: query.NoPagination, SortBy: sortBy, Ascending: ascending, Filters: map[query.Field]query.Value{}}
+		var items []string
+		for _, item := range getter.List(context.Background(), []string{"a", "b", "c"}, "namespaces", "", q).Items {
+			items = append(items, item.Cluster+"/"+item.Object.(*corev1.Namespace).Name)
+		}
+		return items
+	}
+	// the objects equal in the sort field are always ordered by the clusters
+	assert.Equal(t, []string{"a/default", "b/default", "c/default", "a/devops", "b/devops"}, list(query.FieldName, true))
+	assert.Equal(t, []string{"a/devops", "b/devops", "a/default", "b/default", "c/default"}, list(query.FieldName, false))
+	assert.Equal(t, []string{"a/default", "b/default", "c/default", "a/devops", "b/devops"}, list(query.FieldCreationTimeStamp, true))
+	assert.Equal(t, []string{"a/devops", "b/devops", "a/default", "b/default", "c/default"}, list(query.FieldCreationTimeStamp, false))
+}
+
+func TestMultiClusterGetterTimeout(t *testing.T) {
+	assert.Equal(t, DefaultClusterTimeout, NewMultiClusterGetter(nil, 0).timeout)
+	assert.Equal(t, MaxClusterTimeout, NewMultiClusterGetter(nil, time.Hour).timeout)
+	assert.True(t, MultiClusterSortable(query.FieldCreationTimeStamp))
+	assert.False(t, MultiClusterSortable(query.FieldStatus))
+}
@@ -15,8 +15,9 @@ import (
 )
 
 const (
-	DefaultResyncPeriod    = 900 * time.Second
-	DefaultHostClusterName = "host"
+	DefaultResyncPeriod      = 900 * time.Second
+	DefaultHealthProbePeriod = 30 * time.Second
+	DefaultHostClusterName   = "host"
 )
 
 type Options struct {
@@ -37,6 +38,10 @@ type Options struct {
 	// ClusterControllerResyncPeriod is the resync period used by cluster controller.
 	ClusterControllerResyncPeriod time.Duration `json:"clusterControllerResyncPeriod,omitempty" yaml:"clusterControllerResyncPeriod,omitempty"`
 
+	// ClusterHealthProbePeriod is the period used by cluster controller to probe the endpoints of the clusters.
+	// Probing is disabled if it is not positive.
+	ClusterHealthProbePeriod time.Duration `json:"clusterHealthProbePeriod,omitempty" yaml:"clusterHealthProbePeriod,omitempty"`
+
 	// HostClusterName is the name of the control plane cluster, default set to host.
 	HostClusterName string `json:"hostClusterName,omitempty" yaml:"hostClusterName,omitempty"`
 
@@ -61,6 +66,7 @@ func NewOptions() *Options {
 		ProxyPublishService:           "",
 		AgentImage:                    "kubesphere/tower:v1.0",
 		ClusterControllerResyncPeriod: DefaultResyncPeriod,
+		ClusterHealthProbePeriod:      DefaultHealthProbePeriod,
 		HostClusterName:               DefaultHostClusterName,
 	}
 }
@@ -95,6 +101,9 @@ func (o *Options) AddFlags(fs *pflag.FlagSet, s *Options) {
 	fs.DurationVar(&o.ClusterControllerResyncPeriod, "cluster-controller-resync-period", s.ClusterControllerResyncPeriod,
 		"Cluster controller resync period to sync cluster resource. e.g. 2m 5m 10m ... default set to 2m")
 
+	fs.DurationVar(&o.ClusterHealthProbePeriod, "cluster-health-probe-period", s.ClusterHealthProbePeriod,
+		"Period of probing the kube-apiserver and ks-apiserver of the clusters, set to 0 to disable probing.")
+
 	fs.StringVar(&o.HostClusterName, "host-cluster-name", s.HostClusterName, "the name of the control plane"+
 		" cluster, default set to host")
 }
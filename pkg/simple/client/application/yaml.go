@@ -9,6 +9,7 @@ package application
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	helmrelease "helm.sh/helm/v3/pkg/release"
@@ -81,6 +82,14 @@ func (t YamlInstaller) WaitingForResourcesReady(ctx context.Context, release str
 	return true, nil
 }
 
+func (t YamlInstaller) History(ctx context.Context, releaseName string, options ...helm.HelmOption) ([]*helmrelease.Release, error) {
+	return nil, nil
+}
+
+func (t YamlInstaller) Rollback(ctx context.Context, release string, revision int, options ...helm.HelmOption) (string, error) {
+	return "", errors.New("rollback is not supported for yaml applications")
+}
+
 func (t YamlInstaller) ForApply(tasks []json.RawMessage) (err error) {
 
 	for idx, js := range tasks {
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"oras.land/oras-go/pkg/registry/remote/auth"
+)
+
+const harborPageSize = 100
+
+// HarborRepositories lists the repositories of the Harbor project by the Harbor API, which is available to the
+// members of the project, while the catalog API is restricted to the system administrators by Harbor.
+func (r *Registry) HarborRepositories(ctx context.Context, project string, fn func(repos []string) error) error {
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("%s://%s/api/v2.0/projects/%s/repositories?page=%d&page_size=%d",
+			buildScheme(r.PlainHTTP), r.Reference.Host(), url.PathEscape(project), page, harborPageSize)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		// the tokens of the registry are not accepted by the Harbor API
+		if r.username != "" || r.password != "" {
+			req.SetBasicAuth(r.username, r.password)
+		}
+		repos, err := r.harborRepositories(req)
+		if err != nil {
+			return err
+		}
+		if err = fn(repos); err != nil {
+			return err
+		}
+		if len(repos) < harborPageSize {
+			return nil
+		}
+	}
+}
+
+func (r *Registry) harborRepositories(req *http.Request) ([]string, error) {
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ParseErrorResponse(resp)
+	}
+	var page []struct {
+		Name string `json:"name"`
+	}
+	if err = json.NewDecoder(limitReader(resp.Body, r.MaxMetadataBytes)).Decode(&page); err != nil {
+		return nil, fmt.Errorf("%s %q: failed to decode response: %w", resp.Request.Method, resp.Request.URL, err)
+	}
+	repos := make([]string, 0, len(page))
+	for _, repo := range page {
+		repos = append(repos, repo.Name)
+	}
+	return repos, nil
+}
+
+// httpClient returns the HTTP client without the token authentication of the registry.
+func (r *Registry) httpClient() *http.Client {
+	if client, ok := r.Client.(*auth.Client); ok && client.Client != nil {
+		return client.Client
+	}
+	return http.DefaultClient
+}
@@ -36,6 +36,7 @@ type Registry struct {
 	password              string
 	timeout               time.Duration
 	insecureSkipVerifyTLS bool
+	tlsConfig             *tls.Config
 }
 
 func NewRegistry(name string, options ...RegistryOption) (*Registry, error) {
@@ -53,12 +54,17 @@ func NewRegistry(name string, options ...RegistryOption) (*Registry, error) {
 		option(reg)
 	}
 
+	tlsConfig := reg.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: reg.insecureSkipVerifyTLS}
+	}
+
 	headers := http.Header{}
 	headers.Set("User-Agent", "kubesphere.io")
 	reg.Client = &auth.Client{
 		Client: &http.Client{
 			Timeout:   reg.timeout,
-			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: reg.insecureSkipVerifyTLS}},
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
 		},
 		Header: headers,
 		Credential: func(_ context.Context, _ string) (auth.Credential, error) {
@@ -100,6 +106,13 @@ func WithInsecureSkipVerifyTLS(insecureSkipVerifyTLS bool) RegistryOption {
 	}
 }
 
+// WithTLSConfig specifies the TLS config of the client, it takes precedence over WithInsecureSkipVerifyTLS.
+func WithTLSConfig(tlsConfig *tls.Config) RegistryOption {
+	return func(reg *Registry) {
+		reg.tlsConfig = tlsConfig
+	}
+}
+
 func (r *Registry) client() remote.Client {
 	if r.Client == nil {
 		return auth.DefaultClient
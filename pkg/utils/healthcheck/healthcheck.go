@@ -0,0 +1,105 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+// Package healthcheck implements the active health checks of the ReverseProxy upstreams. It is shared by the
+// reverse proxy of ks-apiserver and the ReverseProxy controller, so that the status agrees with the routing.
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+)
+
+const (
+	DefaultInterval           = 10 * time.Second
+	DefaultTimeout            = 3 * time.Second
+	DefaultUnhealthyThreshold = 3
+	DefaultHealthyThreshold   = 1
+)
+
+// Interval returns the interval between the health checks.
+func Interval(healthCheck *extensionsv1alpha1.HealthCheck) time.Duration {
+	if healthCheck != nil && healthCheck.Interval != nil && healthCheck.Interval.Duration > 0 {
+		return healthCheck.Interval.Duration
+	}
+	return DefaultInterval
+}
+
+// Timeout returns the timeout of a health check.
+func Timeout(healthCheck *extensionsv1alpha1.HealthCheck) time.Duration {
+	if healthCheck != nil && healthCheck.Timeout != nil && healthCheck.Timeout.Duration > 0 {
+		return healthCheck.Timeout.Duration
+	}
+	return DefaultTimeout
+}
+
+// Threshold returns the value if it is positive, otherwise the default value.
+func Threshold(value, defaultValue int32) int32 {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// Probe sends an HTTP GET request to the health check path of the upstream, a 2xx or 3xx response is healthy.
+func Probe(ctx context.Context, roundTripper http.RoundTripper, upstream *url.URL, healthCheck *extensionsv1alpha1.HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout(healthCheck))
+	defer cancel()
+
+	location := &url.URL{Scheme: upstream.Scheme, Host: upstream.Host, Path: healthCheck.Path}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := roundTripper.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Status is the health of an upstream derived from the consecutive health checks. Record must not be called
+// concurrently, Unhealthy is safe to be called at any time.
+type Status struct {
+	successes int32
+	failures  int32
+	unhealthy atomic.Bool
+}
+
+// Record records the result of a health check, true is returned if the upstream becomes healthy or unhealthy.
+func (s *Status) Record(healthCheck *extensionsv1alpha1.HealthCheck, err error) bool {
+	if err == nil {
+		s.failures = 0
+		s.successes++
+		if s.unhealthy.Load() && s.successes >= Threshold(healthCheck.HealthyThreshold, DefaultHealthyThreshold) {
+			s.unhealthy.Store(false)
+			return true
+		}
+		return false
+	}
+	s.successes = 0
+	s.failures++
+	if !s.unhealthy.Load() && s.failures >= Threshold(healthCheck.UnhealthyThreshold, DefaultUnhealthyThreshold) {
+		s.unhealthy.Store(true)
+		return true
+	}
+	return false
+}
+
+// Unhealthy reports whether the upstream is unhealthy.
+func (s *Status) Unhealthy() bool {
+	return s.unhealthy.Load()
+}
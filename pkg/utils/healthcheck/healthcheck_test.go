@@ -0,0 +1,40 @@
+/*
+ * Copyright 2024 the KubeSphere Authors.
+ * Please refer to the LICENSE file in the root directory of the project.
+ * https://github.com/kubesphere/kubesphere/blob/master/LICENSE
+ */
+
+package healthcheck
+
+import (
+	"errors"
+	"testing"
+
+	extensionsv1alpha1 "kubesphere.io/api/extensions/v1alpha1"
+)
+
+func TestStatus(t *testing.T) {
+	healthCheck := &extensionsv1alpha1.HealthCheck{HealthyThreshold: 2}
+	failure := errors.New("connection refused")
+	status := &Status{}
+
+	// the default unhealthy threshold is 3
+	for i := 0; i < DefaultUnhealthyThreshold-1; i++ {
+		if status.Record(healthCheck, failure) || status.Unhealthy() {
+			t.Fatalf("unhealthy after %d failures", i+1)
+		}
+	}
+	if !status.Record(healthCheck, failure) || !status.Unhealthy() {
+		t.Fatal("expected unhealthy after the threshold is reached")
+	}
+
+	if status.Record(healthCheck, nil) || !status.Unhealthy() {
+		t.Fatal("expected unhealthy before the healthy threshold is reached")
+	}
+	// a failure resets the consecutive successes
+	status.Record(healthCheck, failure)
+	status.Record(healthCheck, nil)
+	if !status.Record(healthCheck, nil) || status.Unhealthy() {
+		t.Fatal("expected healthy after the healthy threshold is reached")
+	}
+}
@@ -295,10 +295,13 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"k8s.io/apimachinery/pkg/runtime.Unknown":                        schema_k8sio_apimachinery_pkg_runtime_Unknown(ref),
 		"kubesphere.io/api/cluster/v1alpha1.Cluster":                     schema_kubesphereio_api_cluster_v1alpha1_Cluster(ref),
 		"kubesphere.io/api/cluster/v1alpha1.ClusterCondition":            schema_kubesphereio_api_cluster_v1alpha1_ClusterCondition(ref),
+		"kubesphere.io/api/cluster/v1alpha1.ClusterHealth":               schema_kubesphereio_api_cluster_v1alpha1_ClusterHealth(ref),
 		"kubesphere.io/api/cluster/v1alpha1.ClusterList":                 schema_kubesphereio_api_cluster_v1alpha1_ClusterList(ref),
 		"kubesphere.io/api/cluster/v1alpha1.ClusterSpec":                 schema_kubesphereio_api_cluster_v1alpha1_ClusterSpec(ref),
 		"kubesphere.io/api/cluster/v1alpha1.ClusterStatus":               schema_kubesphereio_api_cluster_v1alpha1_ClusterStatus(ref),
 		"kubesphere.io/api/cluster/v1alpha1.Connection":                  schema_kubesphereio_api_cluster_v1alpha1_Connection(ref),
+		"kubesphere.io/api/cluster/v1alpha1.ConnectivityTransition":      schema_kubesphereio_api_cluster_v1alpha1_ConnectivityTransition(ref),
+		"kubesphere.io/api/cluster/v1alpha1.EndpointHealth":              schema_kubesphereio_api_cluster_v1alpha1_EndpointHealth(ref),
 		"kubesphere.io/api/cluster/v1alpha1.Label":                       schema_kubesphereio_api_cluster_v1alpha1_Label(ref),
 		"kubesphere.io/api/cluster/v1alpha1.LabelList":                   schema_kubesphereio_api_cluster_v1alpha1_LabelList(ref),
 		"kubesphere.io/api/cluster/v1alpha1.LabelSpec":                   schema_kubesphereio_api_cluster_v1alpha1_LabelSpec(ref),
@@ -15219,6 +15222,48 @@ func schema_kubesphereio_api_cluster_v1alpha1_ClusterCondition(ref common.Refere
 	}
 }
 
+func schema_kubesphereio_api_cluster_v1alpha1_ClusterHealth(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"endpoints": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoints are the latest probe results of the endpoints of the cluster.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("kubesphere.io/api/cluster/v1alpha1.EndpointHealth"),
+									},
+								},
+							},
+						},
+					},
+					"transitions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Transitions are the recent connectivity transitions of the endpoints, ordered from the oldest to the newest. Only the last MaxConnectivityTransitions transitions are kept.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("kubesphere.io/api/cluster/v1alpha1.ConnectivityTransition"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"kubesphere.io/api/cluster/v1alpha1.ConnectivityTransition", "kubesphere.io/api/cluster/v1alpha1.EndpointHealth"},
+	}
+}
+
 func schema_kubesphereio_api_cluster_v1alpha1_ClusterList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -15409,11 +15454,17 @@ func schema_kubesphereio_api_cluster_v1alpha1_ClusterStatus(ref common.Reference
 							Format:      "",
 						},
 					},
+					"health": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Health is the result of probing the endpoints of the cluster, this field is populated by cluster controller.",
+							Ref:         ref("kubesphere.io/api/cluster/v1alpha1.ClusterHealth"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"kubesphere.io/api/cluster/v1alpha1.ClusterCondition"},
+			"kubesphere.io/api/cluster/v1alpha1.ClusterCondition", "kubesphere.io/api/cluster/v1alpha1.ClusterHealth"},
 	}
 }
 
@@ -15485,6 +15536,117 @@ func schema_kubesphereio_api_cluster_v1alpha1_Connection(ref common.ReferenceCal
 	}
 }
 
+func schema_kubesphereio_api_cluster_v1alpha1_ConnectivityTransition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint is the endpoint whose connectivity changed.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"healthy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Healthy is the connectivity after the transition.",
+							Default:     false,
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"time": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Time of the transition.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message of the failed probe if the endpoint became unhealthy.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"endpoint", "healthy", "time"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_kubesphereio_api_cluster_v1alpha1_EndpointHealth(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint is the probed endpoint of the cluster, one of kube-apiserver, ks-apiserver.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"healthy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Healthy is the result of the last probe.",
+							Default:     false,
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message of the last failed probe.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"consecutiveFailures": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConsecutiveFailures is the number of the failed probes since the last successful one.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"lastProbeTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "The last time the endpoint was probed.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"latencyP50": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Latency percentiles of the recent successful probes.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"latencyP90": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"latencyP99": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+				},
+				Required: []string{"endpoint", "healthy"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
 func schema_kubesphereio_api_cluster_v1alpha1_Label(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
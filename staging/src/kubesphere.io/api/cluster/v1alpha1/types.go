@@ -184,6 +184,66 @@ type ClusterStatus struct {
 
 	// UID is the kube-system namespace UID of the cluster, which represents the unique ID of the cluster.
 	UID types.UID `json:"uid,omitempty"`
+
+	// Health is the result of probing the endpoints of the cluster, this field is populated by cluster controller.
+	// +optional
+	Health *ClusterHealth `json:"health,omitempty"`
+}
+
+type ClusterEndpoint string
+
+const (
+	ClusterEndpointKubernetesAPIServer ClusterEndpoint = "kube-apiserver"
+	ClusterEndpointKubeSphereAPIServer ClusterEndpoint = "ks-apiserver"
+)
+
+// MaxConnectivityTransitions is the max number of the connectivity transitions kept in the cluster health.
+const MaxConnectivityTransitions = 10
+
+type ClusterHealth struct {
+	// Endpoints are the latest probe results of the endpoints of the cluster.
+	// +optional
+	Endpoints []EndpointHealth `json:"endpoints,omitempty"`
+
+	// Transitions are the recent connectivity transitions of the endpoints, ordered from the oldest to the newest.
+	// Only the last MaxConnectivityTransitions transitions are kept.
+	// +optional
+	Transitions []ConnectivityTransition `json:"transitions,omitempty"`
+}
+
+type EndpointHealth struct {
+	// Endpoint is the probed endpoint of the cluster, one of kube-apiserver, ks-apiserver.
+	Endpoint ClusterEndpoint `json:"endpoint"`
+	// Healthy is the result of the last probe.
+	Healthy bool `json:"healthy"`
+	// Message of the last failed probe.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// ConsecutiveFailures is the number of the failed probes since the last successful one.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// The last time the endpoint was probed.
+	// +optional
+	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
+	// Latency percentiles of the recent successful probes.
+	// +optional
+	LatencyP50 *metav1.Duration `json:"latencyP50,omitempty"`
+	// +optional
+	LatencyP90 *metav1.Duration `json:"latencyP90,omitempty"`
+	// +optional
+	LatencyP99 *metav1.Duration `json:"latencyP99,omitempty"`
+}
+
+type ConnectivityTransition struct {
+	// Endpoint is the endpoint whose connectivity changed.
+	Endpoint ClusterEndpoint `json:"endpoint"`
+	// Healthy is the connectivity after the transition.
+	Healthy bool `json:"healthy"`
+	// Time of the transition.
+	Time metav1.Time `json:"time"`
+	// Message of the failed probe if the endpoint became unhealthy.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
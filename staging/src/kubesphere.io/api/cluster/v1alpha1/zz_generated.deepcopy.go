@@ -11,6 +11,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -58,6 +59,35 @@ func (in *ClusterCondition) DeepCopy() *ClusterCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterHealth) DeepCopyInto(out *ClusterHealth) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]EndpointHealth, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Transitions != nil {
+		in, out := &in.Transitions, &out.Transitions
+		*out = make([]ConnectivityTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterHealth.
+func (in *ClusterHealth) DeepCopy() *ClusterHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterList) DeepCopyInto(out *ClusterList) {
 	*out = *in
@@ -138,6 +168,11 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(ClusterHealth)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
@@ -170,6 +205,53 @@ func (in *Connection) DeepCopy() *Connection {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectivityTransition) DeepCopyInto(out *ConnectivityTransition) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectivityTransition.
+func (in *ConnectivityTransition) DeepCopy() *ConnectivityTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectivityTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointHealth) DeepCopyInto(out *EndpointHealth) {
+	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	if in.LatencyP50 != nil {
+		in, out := &in.LatencyP50, &out.LatencyP50
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LatencyP90 != nil {
+		in, out := &in.LatencyP90, &out.LatencyP90
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LatencyP99 != nil {
+		in, out := &in.LatencyP99, &out.LatencyP99
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointHealth.
+func (in *EndpointHealth) DeepCopy() *EndpointHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Label) DeepCopyInto(out *Label) {
 	*out = *in
@@ -18,23 +18,42 @@ const (
 	StateUninstalling    = "Uninstalling"
 	StateUninstalled     = "Uninstalled"
 	StateUninstallFailed = "UninstallFailed"
+	StateRollingBack     = "RollingBack"
+	StateRollbackFailed  = "RollbackFailed"
 	// StatePreparing indicates that the Extension is in the Preparing state.
 	// This value is only used for Extension objects and is triggered when the state of its InstallPlan is empty
 	// and is changing to the Installing/Upgrading state.
 	StatePreparing = "Preparing"
 
-	MaxStateNum = 10
+	MaxStateNum    = 10
+	MaxRevisionNum = 10
 
 	ConditionTypeInitialized = "Initialized"
 	ConditionTypeInstalled   = "Installed"
 	ConditionTypeUpgraded    = "Upgraded"
 	ConditionTypeUninstalled = "Uninstalled"
 	ConditionTypeReady       = "Ready"
+	// ConditionTypeDependenciesSatisfied indicates whether the external dependencies of the extension are satisfied.
+	ConditionTypeDependenciesSatisfied = "DependenciesSatisfied"
+	// ConditionTypeVerified indicates whether the chart of the extension passed the digest and signature verification.
+	ConditionTypeVerified = "Verified"
+	// ConditionTypeSynced indicates whether the index of the repository is synchronized.
+	ConditionTypeSynced = "Synced"
+	// ConditionTypeDegraded indicates whether some entries of the repository index are skipped.
+	ConditionTypeDegraded = "Degraded"
 
 	DisplayNameAnnotation          = "kubesphere.io/display-name"
 	KSVersionAnnotation            = "kubesphere.io/ks-version"
 	InstallationModeAnnotation     = "kubesphere.io/installation-mode"
 	ExternalDependenciesAnnotation = "kubesphere.io/external-dependencies"
+	// InstallDependenciesAnnotation is set on an InstallPlan to create InstallPlans for the missing dependencies automatically.
+	InstallDependenciesAnnotation = "kubesphere.io/install-dependencies"
+	// RequiredByAnnotation records the InstallPlan that an automatically created InstallPlan is required by.
+	RequiredByAnnotation = "kubesphere.io/required-by"
+	// AutomaticUpgradeAnnotation records the target version of the latest automatic upgrade of an InstallPlan.
+	AutomaticUpgradeAnnotation = "kubesphere.io/automatic-upgrade"
+	// RolloutActionAnnotation requests to resume or abort the staged rollout of an InstallPlan, it is removed once handled.
+	RolloutActionAnnotation = "kubesphere.io/rollout-action"
 
 	ExtensionReferenceLabel  = "kubesphere.io/extension-ref"
 	RepositoryReferenceLabel = "kubesphere.io/repository-ref"
@@ -50,3 +69,8 @@ const (
 const (
 	DefaultRepositoryDepth = 3
 )
+
+const (
+	RolloutActionResume = "resume"
+	RolloutActionAbort  = "abort"
+)
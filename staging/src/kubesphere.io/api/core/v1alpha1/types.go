@@ -9,6 +9,7 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type InstallationMode string
@@ -95,6 +96,11 @@ type ExtensionVersionSpec struct {
 	ExternalDependencies []ExternalDependency `json:"externalDependencies,omitempty"`
 }
 
+const (
+	// DependencyTypeExtension indicates that the dependency is another extension.
+	DependencyTypeExtension = "extension"
+)
+
 type ExternalDependency struct {
 	// Name of the external dependency
 	Name string `json:"name"`
@@ -202,11 +208,34 @@ type Placement struct {
 type ClusterScheduling struct {
 	Placement *Placement        `json:"placement,omitempty"`
 	Overrides map[string]string `json:"overrides,omitempty"`
+	// RolloutStrategy upgrades the agents in batches instead of upgrading all clusters at once.
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+}
+
+type RolloutStrategy struct {
+	// Canaries are the clusters upgraded in the first batch.
+	// +listType=set
+	// +optional
+	Canaries []string `json:"canaries,omitempty"`
+	// BatchSize is the number or percentage of the remaining clusters upgraded in each batch, defaults to 1.
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+	// PauseBetweenBatches is the duration to wait after a batch completes before upgrading the next batch.
+	// +optional
+	PauseBetweenBatches *metav1.Duration `json:"pauseBetweenBatches,omitempty"`
+	// HaltOnFailure halts the rollout if any cluster in the batch fails to upgrade.
+	// +optional
+	HaltOnFailure bool `json:"haltOnFailure,omitempty"`
 }
 
 type InstallPlanState struct {
 	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
 	State              string      `json:"state"`
+	// Message is a human readable message indicating details about the transition.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 type InstallationStatus struct {
@@ -218,6 +247,21 @@ type InstallationStatus struct {
 	JobName         string             `json:"jobName,omitempty"`
 	Conditions      []metav1.Condition `json:"conditions,omitempty"`
 	StateHistory    []InstallPlanState `json:"stateHistory,omitempty"`
+	// Revisions of the release fetched when the release is rolled back, the latest revision comes first.
+	Revisions []ReleaseRevision `json:"revisions,omitempty"`
+	// RolledBackVersion is the version the agent was rolled back from automatically in the cluster,
+	// the agent is not upgraded to the version again unless the configuration changes.
+	RolledBackVersion string `json:"rolledBackVersion,omitempty"`
+}
+
+// ReleaseRevision describes a revision of the release.
+type ReleaseRevision struct {
+	Revision int `json:"revision"`
+	// Version of the extension deployed in the revision.
+	Version     string      `json:"version,omitempty"`
+	Status      string      `json:"status,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Updated     metav1.Time `json:"updated,omitempty"`
 }
 
 type ExtensionRef struct {
@@ -234,6 +278,22 @@ type InstallPlanSpec struct {
 	UpgradeStrategy   UpgradeStrategy    `json:"upgradeStrategy,omitempty"`
 	Config            string             `json:"config,omitempty"`
 	ClusterScheduling *ClusterScheduling `json:"clusterScheduling,omitempty"`
+	// Rollback requests to roll back the extension to a previous revision of the release in the host cluster,
+	// the request is removed once the rollback starts. The agents follow the version of the revision.
+	// +optional
+	Rollback *RollbackRequest `json:"rollback,omitempty"`
+	// RollbackOnFailure rolls back the extension to the last deployed revision if the upgrade fails,
+	// or if the resources are not ready after the upgrade. The version in the spec is changed by the
+	// rollback in the host cluster, while the agents are rolled back in their own clusters only.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+type RollbackRequest struct {
+	// Revision of the release to roll back to, the previous deployed revision is used if it is not specified.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Revision int `json:"revision,omitempty"`
 }
 
 type InstallPlanStatus struct {
@@ -241,6 +301,37 @@ type InstallPlanStatus struct {
 	Enabled            bool `json:"enabled,omitempty"`
 	// ClusterSchedulingStatuses describes the subchart installation status of the extension
 	ClusterSchedulingStatuses map[string]InstallationStatus `json:"clusterSchedulingStatuses,omitempty"`
+	// Rollout describes the progress of the staged rollout to the member clusters.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+type RolloutPhase string
+
+const (
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	RolloutPhasePaused      RolloutPhase = "Paused"
+	RolloutPhaseHalted      RolloutPhase = "Halted"
+	RolloutPhaseAborted     RolloutPhase = "Aborted"
+	RolloutPhaseCompleted   RolloutPhase = "Completed"
+)
+
+type RolloutStatus struct {
+	Phase RolloutPhase `json:"phase,omitempty"`
+	// Revision is the hash of the version and configuration being rolled out.
+	Revision string `json:"revision,omitempty"`
+	// Batch is the index of the current batch, the canaries make up the first batch if specified.
+	Batch   int `json:"batch"`
+	Batches int `json:"batches"`
+	// Clusters in the current batch.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+	// LastBatchCompletionTime is the time when the previous batch completed.
+	// +optional
+	LastBatchCompletionTime *metav1.Time `json:"lastBatchCompletionTime,omitempty"`
+	// Message is a human readable message indicating details about the rollout.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -290,11 +381,58 @@ type RepositorySpec struct {
 	// The maximum number of synchronized versions for each extension. A value of 0 indicates that all versions will be synchronized. The default is 3.
 	// +optional
 	Depth *int `json:"depth,omitempty"`
+	// Verification requires the charts to be signed by the trusted keys before installation.
+	// +optional
+	Verification *ChartVerification `json:"verification,omitempty"`
+	// The repositories under the path of the OCI registry URL, each of them is an extension.
+	// They are listed by the Harbor project API or the catalog API of the registry if empty,
+	// which are not served by all registries, e.g. Docker Hub and GHCR.
+	// +optional
+	Repositories []string `json:"repositories,omitempty"`
+}
+
+type SignatureProvider string
+
+const (
+	// SignatureProviderHelm verifies the Helm provenance files of the charts.
+	SignatureProviderHelm SignatureProvider = "helm"
+	// SignatureProviderCosign verifies the cosign signatures of the charts stored in the OCI registry.
+	SignatureProviderCosign SignatureProvider = "cosign"
+)
+
+type ChartVerification struct {
+	// +kubebuilder:validation:Enum=helm;cosign
+	Provider SignatureProvider `json:"provider"`
+	// The keyring (base64 string) contains the trusted keys, a PGP keyring is required by the helm provider
+	// and PEM encoded public keys are required by the cosign provider.
+	Keyring string `json:"keyring"`
 }
 
 type RepositoryStatus struct {
 	// +optional
 	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// The number of extensions found in the index in the last synchronization.
+	// +optional
+	DiscoveredExtensions int `json:"discoveredExtensions,omitempty"`
+	// The number of extensions skipped in the last synchronization because of invalid entries.
+	// +optional
+	SkippedExtensions int `json:"skippedExtensions,omitempty"`
+	// The number of extensions removed from the index, their versions are no longer available.
+	// +optional
+	SuspendedExtensions int `json:"suspendedExtensions,omitempty"`
+	// The errors of the index entries skipped in the last synchronization.
+	// +optional
+	SyncErrors []RepositorySyncError `json:"syncErrors,omitempty"`
+}
+
+// RepositorySyncError describes an entry of the repository index which can not be synchronized.
+type RepositorySyncError struct {
+	Extension string `json:"extension"`
+	// +optional
+	Version string `json:"version,omitempty"`
+	Message string `json:"message"`
 }
 
 // +kubebuilder:object:root=true
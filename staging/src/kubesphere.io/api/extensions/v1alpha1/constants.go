@@ -17,4 +17,11 @@ const (
 	ReverseProxyTargetLabel     = "kubesphere.io/reverse-proxy-target"
 	ReverseProxyTargetAPIServer = "ks-apiserver"
 	ReverseProxyTargetConsole   = "ks-console"
+
+	// ConditionTypeConflicted indicates whether the matcher of the ReverseProxy conflicts with an older one,
+	// which takes effect instead.
+	ConditionTypeConflicted = "Conflicted"
+	// ConditionTypeUpstreamsHealthy indicates whether the upstreams of the ReverseProxy are healthy,
+	// as observed by the active health checks of ks-controller-manager.
+	ConditionTypeUpstreamsHealthy = "UpstreamsHealthy"
 )
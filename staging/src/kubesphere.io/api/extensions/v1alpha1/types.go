@@ -16,6 +16,58 @@ type APIServiceSpec struct {
 	Group    string `json:"group,omitempty"`
 	Version  string `json:"version,omitempty"`
 	Endpoint `json:",inline"`
+	// Limits the rate of the requests forwarded to the endpoint, the limits apply to each replica of ks-apiserver.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// Stops forwarding the requests to the endpoint when it is overloaded or failing,
+	// the breaker is tracked by each replica of ks-apiserver.
+	// +optional
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+}
+
+// RateLimit limits the requests by token buckets, a request is rejected with 429 Too Many Requests
+// if any of the buckets is exhausted. The buckets are not shared between the replicas of ks-apiserver,
+// so the effective limits are multiplied by the number of the replicas.
+type RateLimit struct {
+	// Limits the requests of each user.
+	// +optional
+	PerUser *TokenBucket `json:"perUser,omitempty"`
+	// Limits the requests of all users to the route.
+	// +optional
+	PerRoute *TokenBucket `json:"perRoute,omitempty"`
+	// Limits the requests to all the routes of the same extension (identified by the kubesphere.io/extension-ref label)
+	// which specify the same global limit.
+	// +optional
+	Global *TokenBucket `json:"global,omitempty"`
+}
+
+type TokenBucket struct {
+	// The number of tokens refilled per second.
+	RequestsPerSecond int32 `json:"requestsPerSecond"`
+	// The size of the bucket, defaults to requestsPerSecond.
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// CircuitBreaker rejects the requests with 503 Service Unavailable when the number of the concurrent requests
+// exceeds the limit, or when the error rate trips the breaker until the cool-down elapses. Each replica of
+// ks-apiserver counts the requests and evaluates the error rate independently.
+type CircuitBreaker struct {
+	// The maximum number of concurrent requests handled by each replica of ks-apiserver, 0 means unlimited.
+	// +optional
+	MaxConcurrentRequests int32 `json:"maxConcurrentRequests,omitempty"`
+	// The percentage of failed requests (connection errors and 5xx responses) that trips the breaker, 0 disables tripping.
+	// +optional
+	ErrorRateThreshold int32 `json:"errorRateThreshold,omitempty"`
+	// The minimum number of requests in the interval before the error rate is evaluated, defaults to 20.
+	// +optional
+	MinimumRequests int32 `json:"minimumRequests,omitempty"`
+	// The interval over which the error rate is evaluated, defaults to 10s.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// How long the breaker stays open before a probe request is allowed, defaults to 30s.
+	// +optional
+	CoolDown *metav1.Duration `json:"coolDown,omitempty"`
 }
 
 type APIServiceStatus struct {
@@ -127,9 +179,67 @@ type Matcher struct {
 }
 
 type ReverseProxySpec struct {
-	Matcher    Matcher    `json:"matcher,omitempty"`
-	Upstream   Endpoint   `json:"upstream,omitempty"`
-	Directives Directives `json:"directives,omitempty"`
+	Matcher Matcher `json:"matcher,omitempty"`
+	// Upstream is used when no upstreams are specified.
+	Upstream Endpoint `json:"upstream,omitempty"`
+	// Upstreams are the weighted endpoints among which the requests are balanced, it takes precedence over Upstream.
+	// +optional
+	Upstreams []WeightedEndpoint `json:"upstreams,omitempty"`
+	// +optional
+	LoadBalancer *LoadBalancer `json:"loadBalancer,omitempty"`
+	Directives   Directives    `json:"directives,omitempty"`
+}
+
+type WeightedEndpoint struct {
+	Endpoint `json:",inline"`
+	// The relative weight of the endpoint, defaults to 1. An endpoint with weight 0 receives no requests.
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+type LoadBalancerPolicy string
+
+const (
+	LoadBalancerPolicyRoundRobin   LoadBalancerPolicy = "RoundRobin"
+	LoadBalancerPolicyLeastRequest LoadBalancerPolicy = "LeastRequest"
+)
+
+type LoadBalancer struct {
+	// The policy to pick an upstream, one of RoundRobin and LeastRequest, defaults to RoundRobin.
+	// +optional
+	Policy LoadBalancerPolicy `json:"policy,omitempty"`
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// +optional
+	OutlierDetection *OutlierDetection `json:"outlierDetection,omitempty"`
+}
+
+// HealthCheck probes the upstreams actively with HTTP GET requests, a 2xx or 3xx response is healthy.
+// The result is reported by the UpstreamsHealthy condition of the status.
+type HealthCheck struct {
+	Path string `json:"path"`
+	// Defaults to 10s.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Defaults to 3s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// The number of consecutive failures before an upstream is marked unhealthy, defaults to 3.
+	// +optional
+	UnhealthyThreshold int32 `json:"unhealthyThreshold,omitempty"`
+	// The number of consecutive successes before an upstream is marked healthy again, defaults to 1.
+	// +optional
+	HealthyThreshold int32 `json:"healthyThreshold,omitempty"`
+}
+
+// OutlierDetection ejects the upstreams which keep failing the proxied requests for a while.
+type OutlierDetection struct {
+	// The number of consecutive connection errors or 5xx responses before an upstream is ejected, defaults to 5.
+	// +optional
+	ConsecutiveErrors int32 `json:"consecutiveErrors,omitempty"`
+	// How long an upstream is ejected, defaults to 30s.
+	// +optional
+	EjectionTime *metav1.Duration `json:"ejectionTime,omitempty"`
 }
 
 type Directives struct {
@@ -152,6 +262,13 @@ type Directives struct {
 	Rewrite    []string `json:"rewrite,omitempty"`
 	Replace    []string `json:"replace,omitempty"`
 	PathRegexp []string `json:"pathRegexp,omitempty"`
+	// Limits the rate of the requests forwarded to the upstreams, the limits apply to each replica of ks-apiserver.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// Stops forwarding the requests to the upstreams when they are overloaded or failing,
+	// the breaker is tracked by each replica of ks-apiserver.
+	// +optional
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
 }
 
 type ReverseProxyStatus struct {
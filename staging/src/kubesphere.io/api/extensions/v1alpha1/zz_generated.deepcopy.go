@@ -78,6 +78,16 @@ func (in *APIServiceList) DeepCopyObject() runtime.Object {
 func (in *APIServiceSpec) DeepCopyInto(out *APIServiceSpec) {
 	*out = *in
 	in.Endpoint.DeepCopyInto(&out.Endpoint)
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CircuitBreaker != nil {
+		in, out := &in.CircuitBreaker, &out.CircuitBreaker
+		*out = new(CircuitBreaker)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIServiceSpec.
@@ -155,6 +165,31 @@ func (in *AuxiliaryStyle) DeepCopy() *AuxiliaryStyle {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CircuitBreaker) DeepCopyInto(out *CircuitBreaker) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CoolDown != nil {
+		in, out := &in.CoolDown, &out.CoolDown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CircuitBreaker.
+func (in *CircuitBreaker) DeepCopy() *CircuitBreaker {
+	if in == nil {
+		return nil
+	}
+	out := new(CircuitBreaker)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigMapKeyRef) DeepCopyInto(out *ConfigMapKeyRef) {
 	*out = *in
@@ -199,6 +234,16 @@ func (in *Directives) DeepCopyInto(out *Directives) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CircuitBreaker != nil {
+		in, out := &in.CircuitBreaker, &out.CircuitBreaker
+		*out = new(CircuitBreaker)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Directives.
@@ -365,6 +410,31 @@ func (in *FileLocation) DeepCopy() *FileLocation {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthCheck) DeepCopyInto(out *HealthCheck) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthCheck.
+func (in *HealthCheck) DeepCopy() *HealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JSBundle) DeepCopyInto(out *JSBundle) {
 	*out = *in
@@ -468,6 +538,31 @@ func (in *JSBundleStatus) DeepCopy() *JSBundleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancer) DeepCopyInto(out *LoadBalancer) {
+	*out = *in
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(HealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutlierDetection != nil {
+		in, out := &in.OutlierDetection, &out.OutlierDetection
+		*out = new(OutlierDetection)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancer.
+func (in *LoadBalancer) DeepCopy() *LoadBalancer {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Matcher) DeepCopyInto(out *Matcher) {
 	*out = *in
@@ -483,6 +578,26 @@ func (in *Matcher) DeepCopy() *Matcher {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutlierDetection) DeepCopyInto(out *OutlierDetection) {
+	*out = *in
+	if in.EjectionTime != nil {
+		in, out := &in.EjectionTime, &out.EjectionTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutlierDetection.
+func (in *OutlierDetection) DeepCopy() *OutlierDetection {
+	if in == nil {
+		return nil
+	}
+	out := new(OutlierDetection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RawFrom) DeepCopyInto(out *RawFrom) {
 	*out = *in
@@ -509,6 +624,36 @@ func (in *RawFrom) DeepCopy() *RawFrom {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimit) DeepCopyInto(out *RateLimit) {
+	*out = *in
+	if in.PerUser != nil {
+		in, out := &in.PerUser, &out.PerUser
+		*out = new(TokenBucket)
+		**out = **in
+	}
+	if in.PerRoute != nil {
+		in, out := &in.PerRoute, &out.PerRoute
+		*out = new(TokenBucket)
+		**out = **in
+	}
+	if in.Global != nil {
+		in, out := &in.Global, &out.Global
+		*out = new(TokenBucket)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimit.
+func (in *RateLimit) DeepCopy() *RateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReverseProxy) DeepCopyInto(out *ReverseProxy) {
 	*out = *in
@@ -573,6 +718,18 @@ func (in *ReverseProxySpec) DeepCopyInto(out *ReverseProxySpec) {
 	*out = *in
 	out.Matcher = in.Matcher
 	in.Upstream.DeepCopyInto(&out.Upstream)
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]WeightedEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LoadBalancer != nil {
+		in, out := &in.LoadBalancer, &out.LoadBalancer
+		*out = new(LoadBalancer)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Directives.DeepCopyInto(&out.Directives)
 }
 
@@ -648,3 +805,39 @@ func (in *ServiceReference) DeepCopy() *ServiceReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenBucket) DeepCopyInto(out *TokenBucket) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenBucket.
+func (in *TokenBucket) DeepCopy() *TokenBucket {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenBucket)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WeightedEndpoint) DeepCopyInto(out *WeightedEndpoint) {
+	*out = *in
+	in.Endpoint.DeepCopyInto(&out.Endpoint)
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WeightedEndpoint.
+func (in *WeightedEndpoint) DeepCopy() *WeightedEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(WeightedEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
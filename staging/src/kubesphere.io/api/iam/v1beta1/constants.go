@@ -55,12 +55,15 @@ const (
 	GrantedClustersAnnotation             = "iam.kubesphere.io/granted-clusters"
 	UninitializedAnnotation               = "iam.kubesphere.io/uninitialized"
 	LastPasswordChangeTimeAnnotation      = "iam.kubesphere.io/last-password-change-time"
+	TOTPAuthKeyRefAnnotation              = "iam.kubesphere.io/totp-auth-key-ref"
+	MFARequiredAnnotation                 = "iam.kubesphere.io/mfa-required"
 	RoleAnnotation                        = "iam.kubesphere.io/role"
 	RoleTemplateLabel                     = "iam.kubesphere.io/role-template"
 	ScopeLabel                            = "iam.kubesphere.io/scope"
 	UserReferenceLabel                    = "iam.kubesphere.io/user-ref"
 	RoleReferenceLabel                    = "iam.kubesphere.io/role-ref"
 	IdentityProviderAnnotation            = "iam.kubesphere.io/identity-provider"
+	IdentityProviderLabel                 = "iam.kubesphere.io/identity-provider"
 	ServiceAccountReferenceLabel          = "iam.kubesphere.io/serviceaccount-ref"
 	FieldEmail                            = "email"
 	ExtraEmail                            = FieldEmail
@@ -15,6 +15,8 @@ import (
 	"fmt"
 	"hash/fnv"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -56,6 +58,13 @@ type Executor interface {
 
 	// helm get all RELEASE_NAME [flags]
 	Get(ctx context.Context, releaseName string, options ...HelmOption) (*helmrelease.Release, error)
+
+	// helm history RELEASE_NAME [flags], the latest revision comes first.
+	History(ctx context.Context, releaseName string, options ...HelmOption) ([]*helmrelease.Release, error)
+
+	// Rollback rolls back the release to the specified revision and returns the name of the Job that executed the task.
+	// helm rollback RELEASE_NAME REVISION [flags]
+	Rollback(ctx context.Context, release string, revision int, options ...HelmOption) (string, error)
 }
 
 const (
@@ -83,6 +92,7 @@ kustomize build
 	ActionInstall   = "install"
 	ActionUpgrade   = "upgrade"
 	ActionUninstall = "uninstall"
+	ActionRollback  = "rollback"
 
 	HookEnvAction      = "HOOK_ACTION"
 	HookEnvClusterRole = "CLUSTER_ROLE"
@@ -90,7 +100,8 @@ kustomize build
 )
 
 var (
-	errorTimedOutToWaitResource = errors.New("timed out waiting for resources to be ready")
+	// ErrorTimedOutToWaitResource is returned by WaitingForResourcesReady if the resources are not ready in time.
+	ErrorTimedOutToWaitResource = errors.New("timed out waiting for resources to be ready")
 )
 
 type executor struct {
@@ -575,6 +586,52 @@ func (e *executor) createInstallJob(ctx context.Context, release, chart string,
 		jobAction = ActionInstall
 	}
 
+	return e.createJob(ctx, release, jobAction, args, values, helmOptions)
+}
+
+// Rollback rolls back the release to the specified revision, returns the name of the Job that executed the task.
+func (e *executor) Rollback(ctx context.Context, release string, revision int, options ...HelmOption) (string, error) {
+	helmOptions := e.newHelmOption(options)
+	args := []string{
+		"rollback", release, strconv.Itoa(revision),
+		"--namespace", helmOptions.namespace,
+		"--history-max", fmt.Sprintf("%d", helmOptions.historyMax),
+	}
+
+	if len(helmOptions.kubeConfig) > 0 {
+		args = append(args, "--kubeconfig", kubeConfigPath)
+	}
+
+	if helmOptions.kubeAsUser != "" {
+		args = append(args, "--kube-as-user", helmOptions.kubeAsUser)
+	}
+
+	if helmOptions.kubeAsGroup != "" {
+		args = append(args, "--kube-as-group", helmOptions.kubeAsGroup)
+	}
+
+	if helmOptions.dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	if helmOptions.debug {
+		args = append(args, "--debug")
+	}
+
+	if helmOptions.wait {
+		args = append(args, "--wait")
+		args = append(args, "--wait-for-jobs")
+	}
+
+	if helmOptions.timeout > MinimumTimeout {
+		args = append(args, "--timeout", helmOptions.timeout.String())
+	}
+
+	return e.createJob(ctx, release, ActionRollback, args, nil, helmOptions)
+}
+
+// createJob creates the ConfigMap and the Job to execute the helm command.
+func (e *executor) createJob(ctx context.Context, release, jobAction string, args []string, values []byte, helmOptions *helmOption) (string, error) {
 	jobName := generateName(release, jobAction)
 	configMapName := jobName
 	e.labels["name"] = jobName
@@ -947,6 +1004,24 @@ func (e *executor) Uninstall(ctx context.Context, release string, options ...Hel
 	return name, nil
 }
 
+// helm history RELEASE_NAME [flags]
+func (e *executor) History(ctx context.Context, release string, options ...HelmOption) ([]*helmrelease.Release, error) {
+	helmOptions := e.newHelmOption(options)
+	helmConf, err := InitHelmConf(helmOptions.kubeConfig, helmOptions.namespace)
+	if err != nil {
+		return nil, err
+	}
+	history := action.NewHistory(helmConf)
+	releases, err := history.Run(release)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Version > releases[j].Version
+	})
+	return releases, nil
+}
+
 // helm get all RELEASE_NAME [flags]
 func (e *executor) Get(ctx context.Context, release string, options ...HelmOption) (*helmrelease.Release, error) {
 	helmOptions := e.newHelmOption(options)
@@ -996,8 +1071,8 @@ func (e *executor) WaitingForResourcesReady(ctx context.Context, release string,
 	if err = kubeClient.Wait(resources, timeout); err == nil {
 		return true, nil
 	}
-	if err == wait.ErrWaitTimeout {
-		return false, errorTimedOutToWaitResource
+	if wait.Interrupted(err) {
+		return false, ErrorTimedOutToWaitResource
 	}
 	return false, err
 }
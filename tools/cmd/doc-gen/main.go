@@ -27,6 +27,7 @@ import (
 	"kubesphere.io/kubesphere/pkg/apiserver/rest"
 	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
 	appv2 "kubesphere.io/kubesphere/pkg/kapis/application/v2"
+	auditingv1alpha1 "kubesphere.io/kubesphere/pkg/kapis/auditing/v1alpha1"
 	clusterkapisv1alpha1 "kubesphere.io/kubesphere/pkg/kapis/cluster/v1alpha1"
 	configv1alpha2 "kubesphere.io/kubesphere/pkg/kapis/config/v1alpha2"
 	gatewayv1alpha2 "kubesphere.io/kubesphere/pkg/kapis/gateway/v1alpha2"
@@ -98,6 +99,7 @@ func generateSwaggerJson() []byte {
 		operationsv1alpha2.NewFakeHandler(),
 		packagev1alpha1.NewFakeHandler(),
 		gatewayv1alpha2.NewFakeHandler(),
+		auditingv1alpha1.NewFakeHandler(),
 		configv1alpha2.NewFakeHandler(),
 		terminalv1alpha2.NewFakeHandler(),
 		resourcesv1alpha2.NewFakeHandler(),